@@ -3,15 +3,16 @@ module github.com/cjlapao/deployment-tools-go
 go 1.16
 
 require (
-	github.com/cjlapao/common-go v0.0.7
-	github.com/Azure/azure-amqp-common-go/v3 v3.1.0 // indirect
+	github.com/Azure/azure-amqp-common-go/v3 v3.1.0
 	github.com/Azure/azure-sdk-for-go v50.1.0+incompatible
 	github.com/Azure/azure-service-bus-go v0.10.7
 	github.com/Azure/azure-storage-blob-go v0.12.0
 	github.com/Azure/go-autorest/autorest v0.11.17
 	github.com/Azure/go-autorest/autorest/adal v0.9.10 // indirect
+	github.com/Azure/go-autorest/autorest/date v0.3.0
 	github.com/Azure/go-autorest/autorest/azure/auth v0.5.6
 	github.com/Azure/go-autorest/logger v0.2.0
+	github.com/cjlapao/common-go v0.0.7
 	github.com/fatih/color v1.10.0
 	github.com/gorilla/mux v1.8.0
 	github.com/klauspost/compress v1.11.4 // indirect
@@ -19,8 +19,32 @@ func PrintMainCommandHelper() {
 	logger.Info("  servicebus [command]")
 	logger.Info("")
 	logger.Info("Available Commands:")
-	logger.Info("  topic         Service bus topic command")
-	logger.Info("  queue         Service bus topic command")
+	logger.Info("  topic              Service bus topic command")
+	logger.Info("  queue              Service bus topic command")
+	logger.Info("  plan               Shows the changes needed for the Namespace to match a topology file")
+	logger.Info("  apply              Creates, updates and deletes entities so the Namespace matches a topology file")
+	logger.Info("  move               Moves messages from a queue, subscription or dead letter queue to a queue or topic")
+	logger.Info("  copy               Copies messages from a queue, subscription or dead letter queue to a queue or topic")
+	logger.Info("  probe              Sends probe messages through a forwarding chain and reports their latency")
+	logger.Info("  top                Shows a refreshing table of the message counts of every queue and subscription")
+	logger.Info("  graph              Writes the topics, subscriptions, queues and forwards as a dot or mermaid graph")
+	logger.Info("  lint               Checks the topology for forwarding cycles, missing forward targets and rules that never match")
+	logger.Info("  context            Lists, adds and switches between the named namespaces of the connections file")
+	logger.Info("  export-namespace   Exports every topic, subscription and queue of the Namespace into a versioned snapshot")
+	logger.Info("  restore-namespace  Recreates the entities of a namespace snapshot in forwarding dependency order")
+	logger.Info("  auth               Parses connection strings and generates shared access signatures")
+	logger.Info("")
+	logger.Info("Global Options:")
+	logger.Info("  --namespace   Name of the namespace of the connections file to use, can also be set with SERVICEBUS_NAMESPACE")
+	logger.Info("                defaults to the current context when SERVICEBUS_CONNECTION_STRING is not set")
+	logger.Info("  --endpoint    Namespace host to connect to without a connection string, can also be set with SERVICEBUS_ENDPOINT")
+	logger.Info("                it is authenticated with --sas-token or with the azure client credential of --tenantId,")
+	logger.Info("                --clientId and --clientSecret or DT_AZURE_TENANT_ID, DT_AZURE_CLIENT_ID and DT_AZURE_CLIENT_SECRET")
+	logger.Info("  --sas-token   Shared access signature for the --endpoint, can also be set with SERVICEBUS_SAS_TOKEN")
+	logger.Info("  --broker      Use memory to run the commands against an offline in memory broker, can also be set with SERVICEBUS_BROKER")
+	logger.Info("  --state       State file of the in memory broker, can also be set with SERVICEBUS_MEMORY_STATE, defaults to the temp folder")
+	logger.Info("  -o, --output  Output format of the list, deadletter, probe, lint, context list, auth, export-namespace and top commands, json, yaml, table or csv")
+	logger.Info("                only errors are logged when it is set")
 }
 
 func PrintMissingServiceBusConnectionHelper() {
@@ -36,6 +60,179 @@ func PrintMissingServiceBusConnectionHelper() {
 	case "windows":
 		logger.Info("  $env:SERVICEBUS_CONNECTION_STRING=\"{your connection string}\"")
 	}
+	logger.Info("")
+	logger.Info("Or add the namespace to the connections file with the context add command, or use the --endpoint")
+	logger.Info("option with a shared access signature or an azure client credential")
+	logger.Info("")
+	logger.Info("To run offline against the in memory broker use the --broker=memory option")
+}
+
+func PrintContextMainCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus context [subcommand]")
+	logger.Info("")
+	logger.Info("Available Sub-Commands:")
+	logger.Info("  list                 Lists the namespaces of the connections file")
+	logger.Info("  current              Shows the namespace used when the --namespace option is not set")
+	logger.Info("  use                  Sets the namespace used when the --namespace option is not set")
+	logger.Info("  add                  Adds or replaces a namespace in the connections file")
+	logger.Info("  remove               Removes a namespace from the connections file")
+	logger.Info("")
+	logger.Info("The connections file is ~/.servicebus/connections.yaml, it can be changed with SERVICEBUS_CONNECTIONS")
+	logger.Info("")
+	logger.Info("Connections file:")
+	logger.Info("  currentContext: dev")
+	logger.Info("  namespaces:")
+	logger.Info("    - name: dev")
+	logger.Info("      connectionString: Endpoint=sb://example-dev.servicebus.windows.net/;SharedAccessKeyName=...")
+	logger.Info("    - name: local")
+	logger.Info("      broker: memory")
+	logger.Info("      state: /tmp/servicebus-local.json")
+}
+
+func PrintContextListCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus context list [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  -o, --output     string  Output format, json, yaml, table or csv")
+	logger.Info("")
+	logger.Info("The connection strings are not shown, only the endpoint of the namespaces.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v context list %v", color.HiYellowString("servicebus"), color.HiBlackString("-o table"))
+	case "windows":
+		color.White("%v context list %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("-o table"))
+	}
+}
+
+func PrintContextUseCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus context use [name]")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v context use %v", color.HiYellowString("servicebus"), color.HiBlackString("staging"))
+	case "windows":
+		color.White("%v context use %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("staging"))
+	}
+}
+
+func PrintContextAddCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus context add [name] [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --connection-string  string  Connection string of the namespace")
+	logger.Info("  --endpoint           string  Host of the namespace when it has no connection string")
+	logger.Info("  --sas-token          string  Shared access signature for the endpoint, without it the azure client")
+	logger.Info("                               credential of --tenantId, --clientId and --clientSecret is saved")
+	logger.Info("  --broker             string  Broker of the namespace, azure or memory, defaults to azure")
+	logger.Info("  --state              string  State file of an in memory broker namespace, defaults to the temp folder")
+	logger.Info("  --use                        Sets the namespace as the current context")
+	logger.Info("")
+	logger.Info("The namespace also becomes the current context when there is none.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v context add %v", color.HiYellowString("servicebus"), color.HiBlackString("dev --connection-string=\"$SERVICEBUS_CONNECTION_STRING\" --use"))
+		color.White("%v context add %v", color.HiYellowString("servicebus"), color.HiBlackString("partner --endpoint=example.servicebus.windows.net --sas-token=\"SharedAccessSignature sr=...\""))
+		color.White("%v context add %v", color.HiYellowString("servicebus"), color.HiBlackString("local --broker=memory"))
+	case "windows":
+		color.White("%v context add %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("dev --connection-string=\"$env:SERVICEBUS_CONNECTION_STRING\" --use"))
+		color.White("%v context add %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("partner --endpoint=example.servicebus.windows.net --sas-token=\"SharedAccessSignature sr=...\""))
+		color.White("%v context add %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("local --broker=memory"))
+	}
+}
+
+func PrintAuthMainCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus auth [subcommand]")
+	logger.Info("")
+	logger.Info("Available Sub-Commands:")
+	logger.Info("  parse                Shows the endpoint, key name and entity path of a connection string")
+	logger.Info("  sas-token            Generates a time limited shared access signature for a namespace or an entity")
+	logger.Info("")
+	logger.Info("The connection string is the --connection-string option, SERVICEBUS_CONNECTION_STRING or the one of")
+	logger.Info("the --namespace or current context of the connections file.")
+}
+
+func PrintAuthParseCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus auth parse [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --connection-string  string  Connection string to parse")
+	logger.Info("  -o, --output         string  Output format, json, yaml, table or csv")
+	logger.Info("")
+	logger.Info("The shared access key and signature are not shown.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v auth parse %v", color.HiYellowString("servicebus"), color.HiBlackString("--namespace=staging -o yaml"))
+	case "windows":
+		color.White("%v auth parse %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--namespace=staging -o yaml"))
+	}
+}
+
+func PrintAuthSASTokenCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus auth sas-token [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --connection-string  string  Connection string with the shared access key to sign with")
+	logger.Info("  --expiry             string  Time the signature is valid for, like 30m or 24h, defaults to 1h")
+	logger.Info("  --queue              string  Scopes the signature to a queue")
+	logger.Info("  --topic              string  Scopes the signature to a topic")
+	logger.Info("  --subscription       string  Scopes the signature to a subscription of the --topic")
+	logger.Info("  -o, --output         string  Output format, json, yaml, table or csv")
+	logger.Info("")
+	logger.Info("Without an entity the signature is valid for the whole namespace. The rights of the signature are")
+	logger.Info("the rights of the shared access policy of the connection string.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v auth sas-token %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --expiry=24h"))
+		color.White("%v %v", color.HiYellowString("servicebus"), color.HiBlackString("queue list --endpoint=example.servicebus.windows.net --sas-token=\"SharedAccessSignature sr=...\""))
+	case "windows":
+		color.White("%v auth sas-token %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --expiry=24h"))
+		color.White("%v %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("queue list --endpoint=example.servicebus.windows.net --sas-token=\"SharedAccessSignature sr=...\""))
+	}
+}
+
+func PrintContextRemoveCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus context remove [name]")
+	logger.Info("")
+	logger.Info("The current context is cleared when it is the removed namespace.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v context remove %v", color.HiYellowString("servicebus"), color.HiBlackString("staging"))
+	case "windows":
+		color.White("%v context remove %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("staging"))
+	}
 }
 
 func PrintTopicMainCommandHelper() {
@@ -46,12 +243,25 @@ func PrintTopicMainCommandHelper() {
 	logger.Info("Available Sub-Commands:")
 	logger.Info("  list                 Lists all Topics in a Namespace")
 	logger.Info("  create               Creates a Topic in a Namespace")
+	logger.Info("  update               Updates the properties of a Topic in a Namespace")
 	logger.Info("  delete               Deletes a Topic in a Namespace")
 	logger.Info("  send                 Sends a Json Message to a specific Topic in a Namespace")
 	logger.Info("  list-subscriptions   List all Subscriptions on a Topic in a Namespace")
 	logger.Info("  create-subscription  Creates a Subscription on a specific Topic in a Namespace")
+	logger.Info("  update-subscription  Updates the properties of a Subscription on a specific Topic")
 	logger.Info("  delete-subscription  Deletes a Subscription from a specific Topic in a Namespace")
+	logger.Info("  list-rules           Lists the filter and action of the rules of a Subscription")
+	logger.Info("  add-rule             Adds a sql or correlation filter rule to a Subscription")
+	logger.Info("  delete-rule          Deletes a rule from a Subscription")
+	logger.Info("  replace-rules        Replaces all the rules of a Subscription")
 	logger.Info("  subscribe            Subscribe to a Subscription and prints the message")
+	logger.Info("  list-scheduled       Lists the scheduled messages of a Subscription")
+	logger.Info("  cancel-scheduled     Cancels scheduled messages of a Topic")
+	logger.Info("  deadletter           Peeks, resubmits or purges the dead letters of a Subscription")
+	logger.Info("  export               Exports the messages of a Subscription to a json lines file")
+	logger.Info("  import               Sends the messages of a json lines file to a Topic")
+	logger.Info("  purge-subscription   Removes the messages of a Subscription keeping its configuration")
+	logger.Info("  test-rule            Tests a sql filter and action against a message without connecting")
 }
 
 func PrintTopicListSubscriptionsCommandHelper() {
@@ -61,14 +271,17 @@ func PrintTopicListSubscriptionsCommandHelper() {
 	logger.Info("")
 	logger.Info("Available Options:")
 	logger.Info("  --name               Topic name to list subscriptions")
+	logger.Info("  -o, --output         Output format, json, yaml, table or csv")
 	logger.Info("")
 	logger.Info("Example:")
 	os := runtime.GOOS
 	switch strings.ToLower(os) {
 	case "linux":
 		color.White("%v topic list-subscriptions %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic"))
+		color.White("%v topic list-subscriptions %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic -o json"))
 	case "windows":
 		color.White("%v topic list-subscriptions %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic"))
+		color.White("%v topic list-subscriptions %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic -o json"))
 	}
 }
 
@@ -108,6 +321,7 @@ func PrintTopicCreateSubscriptionCommandHelper() {
 	logger.Info("                           the format will be [rule_name]:[sql_filter_expression]:[sql_action_expression]")
 	logger.Info("                           example with only filter: --with-rule=example:2=2")
 	logger.Info("                           example with filter and action: --with-rule=example:2=2:SET sys.label='example'")
+	logger.Info("  --requires-session       Creates a session enabled subscription, messages need a session id")
 	logger.Info("")
 	logger.Info("Example:")
 	os := runtime.GOOS
@@ -125,15 +339,23 @@ func PrintTopicCreateTopicCommandHelper() {
 	logger.Info("  servicebus topic create [Options]")
 	logger.Info("")
 	logger.Info("Available Options:")
-	logger.Info("  --name               Topic name to create")
+	logger.Info("  --name                        Topic name to create")
+	logger.Info("  --max-size                    Maximum size of the topic in megabytes, between 1024 and 81920")
+	logger.Info("  --message-ttl                 Default time to live of the messages, example: 24h")
+	logger.Info("  --auto-delete-on-idle         Deletes the topic after being idle for this duration, example: 168h")
+	logger.Info("  --duplicate-detection-window  Enables duplicate detection with this message id history window, example: 10m")
+	logger.Info("  --enable-partitioning         Creates a partitioned topic")
+	logger.Info("  --support-ordering            Creates a topic that keeps the order of the messages")
 	logger.Info("")
 	logger.Info("Example:")
 	os := runtime.GOOS
 	switch strings.ToLower(os) {
 	case "linux":
 		color.White("%v topic create %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic"))
+		color.White("%v topic create %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --max-size=2048 --message-ttl=24h --duplicate-detection-window=10m --enable-partitioning"))
 	case "windows":
 		color.White("%v topic create %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic"))
+		color.White("%v topic create %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --max-size=2048 --message-ttl=24h --duplicate-detection-window=10m --enable-partitioning"))
 	}
 }
 
@@ -171,6 +393,31 @@ func PrintTopicSubscribeCommandHelper() {
 	logger.Info("                         does not exist it will be created and deleted on exit")
 	logger.Info("                         this will also override the %v flag", "--subscription")
 	logger.Info("  %v                 peeks into the subscription leaving the messages there", "--peek")
+	logger.Info("  %v             receives the next available session of a session enabled entity", "--sessions")
+	logger.Info("                         the messages are printed grouped per session")
+	logger.Info("  %v=string  receives only the session with this id", "--session-id")
+	logger.Info("  %v=string         only shows the messages matching this sql filter, it can use", "--where")
+	logger.Info("                         user properties, sys.Label and json body fields like body.order.id")
+	logger.Info("                         property names can contain hyphens, use spaces around the minus operator")
+	logger.Info("                         it needs %v, or %v where the messages that do not match are completed", "--peek", "--wiretap")
+	logger.Info("  %v=number  stops after receiving this number of matching messages", "--max-messages")
+	logger.Info("  %v=duration     stops when no matching message is received in this time, like 30s", "--timeout")
+	logger.Info("  %v=false         stops after the first matching message, like %v", "--follow", "--max-messages=1")
+	logger.Info("  %v=string          runs this command for every message instead of printing it, the body", "--exec")
+	logger.Info("                         is sent to its standard input and the properties are SERVICEBUS_ variables")
+	logger.Info("                         like SERVICEBUS_LABEL or SERVICEBUS_PROPERTY_X_TENANT_ID")
+	logger.Info("  %v=url     posts every message to this url instead of printing it, the system", "--forward-http")
+	logger.Info("                         properties are sent in the BrokerProperties header")
+	logger.Info("  %v=string    action when the command does not exit with 0 or the url does not", "--on-failure")
+	logger.Info("                         answer with 2xx, abandon (default) or deadletter")
+	logger.Info("  %v=string        how the handled messages are settled, complete (default), abandon,", "--settle")
+	logger.Info("                         deadletter, defer or none to leave them locked like %v", "--peek")
+	logger.Info("  %v=number   number of messages handled at the same time, defaults to 1", "--concurrency")
+	logger.Info("                         with sessions it is the number of sessions received at the same time")
+	logger.Info("  %v=number      number of messages fetched at once by each receiver", "--prefetch")
+	logger.Info("  %v      renews the lock of the messages while they are handled", "--auto-renew-lock")
+	logger.Info("  %v=duration", "--max-lock-renewal")
+	logger.Info("                         stops renewing the lock after this time, defaults to 5m")
 	logger.Info("")
 	logger.Info("example:")
 	os := runtime.GOOS
@@ -181,12 +428,24 @@ func PrintTopicSubscribeCommandHelper() {
 		logger.Info("")
 		logger.Info("Multiple topics subscriber")
 		color.White("%v topic subscribe %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --topic=example.topic2 --wiretap"))
+		logger.Info("")
+		logger.Info("Wait for the first matching message:")
+		color.White("%v topic subscribe %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --wiretap --where=\"X-TenantId = '11111111-1111-1111-1111-555555550001' AND body.orderId > 100\" --follow=false --timeout=1m"))
+		logger.Info("")
+		logger.Info("Forward the messages to a local endpoint:")
+		color.White("%v topic subscribe %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example --forward-http=http://localhost:5000/messages"))
 	case "windows":
 		logger.Info("Single topic subscriber:")
 		color.White("%v topic subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --wiretap"))
 		logger.Info("")
 		logger.Info("Multiple topics subscriber")
 		color.White("%v topic subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --topic=example.topic2 --wiretap"))
+		logger.Info("")
+		logger.Info("Wait for the first matching message:")
+		color.White("%v topic subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --wiretap --where=\"X-TenantId = '11111111-1111-1111-1111-555555550001' AND body.orderId > 100\" --follow=false --timeout=1m"))
+		logger.Info("")
+		logger.Info("Forward the messages to a local endpoint:")
+		color.White("%v topic subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example --forward-http=http://localhost:5000/messages"))
 	}
 }
 
@@ -197,13 +456,41 @@ func PrintTopicSendCommandHelper() {
 	logger.Info("")
 	logger.Info("Available Options:")
 	logger.Info("  --topic    string     Name of the topic where to send the message")
-	logger.Info("  --tenant   guid       Id of the tenant")
-	logger.Info("  --body     json       Message body in json (please escape the json correctly as this is validated)")
-	logger.Info("  --domain   string     Forwarding topology Message Domain")
-	logger.Info("  --name     string     Forwarding topology Message Name")
-	logger.Info("  --version  string     Forwarding topology Version")
-	logger.Info("  --sender   string     Forwarding topology Sender")
-	logger.Info("  --label    string     Message Label")
+	logger.Info("  --tenant   guid       Id of the tenant of the forwarding and uno profiles")
+	logger.Info("  --body     string     Message body, json bodies are validated and indented unless --raw is set")
+	logger.Info("                        (please escape the json correctly as this is validated)")
+	logger.Info("  --body-file path      Reads the message body from a file instead of --body, use - to read it")
+	logger.Info("                        from the standard input")
+	logger.Info("  --content-type string Content type of the message body, defaults to json when not set")
+	logger.Info("                        example: --content-type=text/plain")
+	logger.Info("  --raw                 Sends the body bytes as they are, without validating or indenting json")
+	logger.Info("  --base64              Decodes a base64 body before sending it, used for binary bodies like protobuf")
+	logger.Info("  --domain   string     Forwarding profile Message Domain")
+	logger.Info("  --name     string     Forwarding profile Message Name")
+	logger.Info("  --version  string     Forwarding profile Version")
+	logger.Info("  --sender   string     Forwarding profile Sender")
+	logger.Info("  --label    string     Message Label, replaces the label of the envelope profile")
+	logger.Info("  --profile  string     Envelope profile setting the label and properties of the message")
+	logger.Info("                        built in profiles: forwarding, uno, cloudevents and none")
+	logger.Info("                        defaults to forwarding if --domain and --name are set, otherwise uno")
+	logger.Info("                        or none if only --property is set")
+	logger.Info("  --profiles path       Json or yaml file with more envelope profiles, it can also be set with")
+	logger.Info("                        SERVICEBUS_PROFILES, profiles with a built in name replace it")
+	logger.Info("  --var name:value      Sets a variable of the envelope profile, variables can also be set with")
+	logger.Info("                        a flag with the same name like --source for the cloudevents profile")
+	logger.Info("                        This option can be repeated to set more than one variable")
+	logger.Info("  --session-id string   Session id of the message, mandatory for session enabled entities")
+	logger.Info("  --schedule-at date    Schedules the message to be enqueued at a RFC3339 date")
+	logger.Info("                        example: --schedule-at=2021-01-01T10:00:00Z")
+	logger.Info("  --delay    duration   Schedules the message to be enqueued after a delay, example: --delay=5m")
+	logger.Info("                        the sequence number of a scheduled message is printed to cancel it")
+	logger.Info("  --file     path       Sends the messages of a json or json lines file in batches instead of --body")
+	logger.Info("                        use - to read the messages from the standard input")
+	logger.Info("  --count    number     Number of messages to send from the file, the file messages are repeated")
+	logger.Info("                        until it is reached, defaults to the number of messages in the file")
+	logger.Info("  --rate     number     Maximum number of messages sent per second, defaults to no limit")
+	logger.Info("  --concurrency number  Number of concurrent senders, defaults to 1")
+	logger.Info("  --batch-size number   Maximum number of messages in a batch, defaults to 100")
 	logger.Info("  --property key:value  Add a User property to the message")
 	logger.Info("                        This option can be repeated to add more than one property")
 	logger.Info("                        the format will be [key]:[value]")
@@ -218,8 +505,14 @@ func PrintTopicSendCommandHelper() {
 	switch strings.ToLower(os) {
 	case "linux":
 		color.White("%v topic send %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --body='{\\\"example\\\":\\\"document\\\"}' --domain=ExampleService --name=Example --version=\"2.1\" --sender=ExampleSender --label=ExampleLabel"))
+		color.White("%v topic send %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --file=messages.jsonl --count=1000 --rate=50 --concurrency=4"))
+		color.White("%v topic send %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --body='{\\\"example\\\":\\\"document\\\"}' --profile=cloudevents --source=/orders --type=Orders.Created"))
+		color.White("%v topic send %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --body-file=order.bin --content-type=application/x-protobuf --raw"))
 	case "windows":
 		color.White("%v topic send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --body='{\\\"example\\\":\\\"document\\\"}' --domain=ExampleService --name=Example --version=\"2.1\" --sender=ExampleSender --label=ExampleLabel"))
+		color.White("%v topic send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --file=messages.jsonl --count=1000 --rate=50 --concurrency=4"))
+		color.White("%v topic send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --body='{\\\"example\\\":\\\"document\\\"}' --profile=cloudevents --source=/orders --type=Orders.Created"))
+		color.White("%v topic send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --body-file=order.bin --content-type=application/x-protobuf --raw"))
 	}
 }
 
@@ -231,9 +524,16 @@ func PrintQueueMainCommandHelper() {
 	logger.Info("Available Sub-Commands:")
 	logger.Info("  list                 Lists all Queues in a Namespace")
 	logger.Info("  create               Creates a Queues in a Namespace")
+	logger.Info("  update               Updates the properties of a Queue in a Namespace")
 	logger.Info("  delete               Deletes a Queues in a Namespace")
 	logger.Info("  send                 Sends a Json Message to a specific Queue in a Namespace")
 	logger.Info("  subscribe            Subscribe to a Queue and prints the messages")
+	logger.Info("  list-scheduled       Lists the scheduled messages of a Queue")
+	logger.Info("  cancel-scheduled     Cancels scheduled messages of a Queue")
+	logger.Info("  deadletter           Peeks, resubmits or purges the dead letters of a Queue")
+	logger.Info("  export               Exports the messages of a Queue to a json lines file")
+	logger.Info("  import               Sends the messages of a json lines file to a Queue")
+	logger.Info("  purge                Removes the messages of a Queue keeping its configuration")
 }
 
 func PrintQueueDeleteCommandHelper() {
@@ -267,14 +567,24 @@ func PrintQueueCreateCommandHelper() {
 	logger.Info("  --forward-deadletter-to  Creates a forward to rule for dead letters in the subscription")
 	logger.Info("                           the format will be topic|queue:[name_of_the_target]")
 	logger.Info("                           example: --forward-deadletter-to=topic:example.topic")
+	logger.Info("  --requires-session       Creates a session enabled queue, messages need a session id")
+	logger.Info("  --lock-duration          Duration a received message stays locked, example: 30s")
+	logger.Info("  --message-ttl            Default time to live of the messages, example: 24h")
+	logger.Info("  --auto-delete-on-idle    Deletes the queue after being idle for this duration, example: 168h")
+	logger.Info("  --max-delivery-count     Number of deliveries before a message is dead lettered")
+	logger.Info("  --duplicate-detection-window")
+	logger.Info("                           Enables duplicate detection with this message id history window, example: 10m")
+	logger.Info("  --enable-partitioning    Creates a partitioned queue")
 	logger.Info("")
 	logger.Info("Example:")
 	os := runtime.GOOS
 	switch strings.ToLower(os) {
 	case "linux":
 		color.White("%v queue create-subscription %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.queue --forward-to=topic:example.topic --with-rule=example:1=1"))
+		color.White("%v queue create %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.queue --duplicate-detection-window=10m --enable-partitioning --requires-session"))
 	case "windows":
 		color.White("%v queue create-subscription %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.queue --forward-to=topic:example.topic --with-rule=example:1=1"))
+		color.White("%v queue create %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.queue --duplicate-detection-window=10m --enable-partitioning --requires-session"))
 	}
 }
 
@@ -285,13 +595,41 @@ func PrintQueueSendCommandHelper() {
 	logger.Info("")
 	logger.Info("Available Options:")
 	logger.Info("  --queue    string     Name of the queue where to send the message")
-	logger.Info("  --tenant   guid       Id of the tenant")
-	logger.Info("  --body     json       Message body in json (please escape the json correctly as this is validated)")
-	logger.Info("  --domain   string     Forwarding topology Message Domain")
-	logger.Info("  --name     string     Forwarding topology Message Name")
-	logger.Info("  --version  string     Forwarding topology Version")
-	logger.Info("  --sender   string     Forwarding topology Sender")
-	logger.Info("  --label    string     Message Label")
+	logger.Info("  --tenant   guid       Id of the tenant of the forwarding and uno profiles")
+	logger.Info("  --body     string     Message body, json bodies are validated and indented unless --raw is set")
+	logger.Info("                        (please escape the json correctly as this is validated)")
+	logger.Info("  --body-file path      Reads the message body from a file instead of --body, use - to read it")
+	logger.Info("                        from the standard input")
+	logger.Info("  --content-type string Content type of the message body, defaults to json when not set")
+	logger.Info("                        example: --content-type=text/plain")
+	logger.Info("  --raw                 Sends the body bytes as they are, without validating or indenting json")
+	logger.Info("  --base64              Decodes a base64 body before sending it, used for binary bodies like protobuf")
+	logger.Info("  --domain   string     Forwarding profile Message Domain")
+	logger.Info("  --name     string     Forwarding profile Message Name")
+	logger.Info("  --version  string     Forwarding profile Version")
+	logger.Info("  --sender   string     Forwarding profile Sender")
+	logger.Info("  --label    string     Message Label, replaces the label of the envelope profile")
+	logger.Info("  --profile  string     Envelope profile setting the label and properties of the message")
+	logger.Info("                        built in profiles: forwarding, uno, cloudevents and none")
+	logger.Info("                        defaults to forwarding if --domain and --name are set, otherwise uno")
+	logger.Info("                        or none if only --property is set")
+	logger.Info("  --profiles path       Json or yaml file with more envelope profiles, it can also be set with")
+	logger.Info("                        SERVICEBUS_PROFILES, profiles with a built in name replace it")
+	logger.Info("  --var name:value      Sets a variable of the envelope profile, variables can also be set with")
+	logger.Info("                        a flag with the same name like --source for the cloudevents profile")
+	logger.Info("                        This option can be repeated to set more than one variable")
+	logger.Info("  --session-id string   Session id of the message, mandatory for session enabled entities")
+	logger.Info("  --schedule-at date    Schedules the message to be enqueued at a RFC3339 date")
+	logger.Info("                        example: --schedule-at=2021-01-01T10:00:00Z")
+	logger.Info("  --delay    duration   Schedules the message to be enqueued after a delay, example: --delay=5m")
+	logger.Info("                        the sequence number of a scheduled message is printed to cancel it")
+	logger.Info("  --file     path       Sends the messages of a json or json lines file in batches instead of --body")
+	logger.Info("                        use - to read the messages from the standard input")
+	logger.Info("  --count    number     Number of messages to send from the file, the file messages are repeated")
+	logger.Info("                        until it is reached, defaults to the number of messages in the file")
+	logger.Info("  --rate     number     Maximum number of messages sent per second, defaults to no limit")
+	logger.Info("  --concurrency number  Number of concurrent senders, defaults to 1")
+	logger.Info("  --batch-size number   Maximum number of messages in a batch, defaults to 100")
 	logger.Info("  --property key:value  Add a User property to the message")
 	logger.Info("                        This option can be repeated to add more than one property")
 	logger.Info("                        the format will be [key]:[value]")
@@ -306,8 +644,14 @@ func PrintQueueSendCommandHelper() {
 	switch strings.ToLower(os) {
 	case "linux":
 		color.White("%v queue send %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --body='{\\\"example\\\":\\\"document\\\"}' --domain=ExampleService --name=Example --version=\"2.1\" --sender=ExampleSender --label=ExampleLabel"))
+		color.White("%v queue send %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --file=messages.jsonl --count=1000 --rate=50 --concurrency=4"))
+		color.White("%v queue send %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --body='{\\\"example\\\":\\\"document\\\"}' --profile=cloudevents --source=/orders --type=Orders.Created"))
+		color.White("%v queue send %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --body-file=order.bin --content-type=application/x-protobuf --raw"))
 	case "windows":
 		color.White("%v queue send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --body='{\\\"example\\\":\\\"document\\\"}' --domain=ExampleService --name=Example --version=\"2.1\" --sender=ExampleSender --label=ExampleLabel"))
+		color.White("%v queue send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --file=messages.jsonl --count=1000 --rate=50 --concurrency=4"))
+		color.White("%v queue send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --body='{\\\"example\\\":\\\"document\\\"}' --profile=cloudevents --source=/orders --type=Orders.Created"))
+		color.White("%v queue send %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --body-file=order.bin --content-type=application/x-protobuf --raw"))
 	}
 }
 
@@ -322,6 +666,31 @@ func PrintQueueSubscribeCommandHelper() {
 	logger.Info("  %v=string         Name of the queue to listen to (mandatory)", "--queue")
 	logger.Info("                         this flag can be repeated to listen to several queues")
 	logger.Info("  %v                 peeks into the subscription leaving the messages there", "--peek")
+	logger.Info("  %v             receives the next available session of a session enabled entity", "--sessions")
+	logger.Info("                         the messages are printed grouped per session")
+	logger.Info("  %v=string  receives only the session with this id", "--session-id")
+	logger.Info("  %v=string         only shows the messages matching this sql filter, it can use", "--where")
+	logger.Info("                         user properties, sys.Label and json body fields like body.order.id")
+	logger.Info("                         property names can contain hyphens, use spaces around the minus operator")
+	logger.Info("                         it needs %v so the messages that do not match are not locked", "--peek")
+	logger.Info("  %v=number  stops after receiving this number of matching messages", "--max-messages")
+	logger.Info("  %v=duration     stops when no matching message is received in this time, like 30s", "--timeout")
+	logger.Info("  %v=false         stops after the first matching message, like %v", "--follow", "--max-messages=1")
+	logger.Info("  %v=string          runs this command for every message instead of printing it, the body", "--exec")
+	logger.Info("                         is sent to its standard input and the properties are SERVICEBUS_ variables")
+	logger.Info("                         like SERVICEBUS_LABEL or SERVICEBUS_PROPERTY_X_TENANT_ID")
+	logger.Info("  %v=url     posts every message to this url instead of printing it, the system", "--forward-http")
+	logger.Info("                         properties are sent in the BrokerProperties header")
+	logger.Info("  %v=string    action when the command does not exit with 0 or the url does not", "--on-failure")
+	logger.Info("                         answer with 2xx, abandon (default) or deadletter")
+	logger.Info("  %v=string        how the handled messages are settled, complete (default), abandon,", "--settle")
+	logger.Info("                         deadletter, defer or none to leave them locked like %v", "--peek")
+	logger.Info("  %v=number   number of messages handled at the same time, defaults to 1", "--concurrency")
+	logger.Info("                         with sessions it is the number of sessions received at the same time")
+	logger.Info("  %v=number      number of messages fetched at once by each receiver", "--prefetch")
+	logger.Info("  %v      renews the lock of the messages while they are handled", "--auto-renew-lock")
+	logger.Info("  %v=duration", "--max-lock-renewal")
+	logger.Info("                         stops renewing the lock after this time, defaults to 5m")
 	logger.Info("")
 	logger.Info("example:")
 	os := runtime.GOOS
@@ -332,11 +701,816 @@ func PrintQueueSubscribeCommandHelper() {
 		logger.Info("")
 		logger.Info("Multiple topics subscriber")
 		color.White("%v queue subscribe %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --queue=example.queue2"))
+		logger.Info("")
+		logger.Info("Receive up to 10 messages with a label:")
+		color.White("%v queue subscribe %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --peek --where=\"sys.Label = 'Orders.Created'\" --max-messages=10 --timeout=30s"))
+		logger.Info("")
+		logger.Info("Process the messages with a local handler:")
+		color.White("%v queue subscribe %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --exec=\"./handler.sh\" --on-failure=deadletter"))
+		logger.Info("")
+		logger.Info("Run a slow handler on 8 messages at the same time:")
+		color.White("%v queue subscribe %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --exec=\"./slow-handler.sh\" --concurrency=8 --prefetch=16 --auto-renew-lock --max-lock-renewal=30m"))
 	case "windows":
 		logger.Info("Single topic subscriber:")
 		color.White("%v queue subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue"))
 		logger.Info("")
 		logger.Info("Multiple topics subscriber")
 		color.White("%v queue subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --topic=example.queue2"))
+		logger.Info("")
+		logger.Info("Receive up to 10 messages with a label:")
+		color.White("%v queue subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --peek --where=\"sys.Label = 'Orders.Created'\" --max-messages=10 --timeout=30s"))
+		logger.Info("")
+		logger.Info("Process the messages with a local handler:")
+		color.White("%v queue subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --exec=\"./handler.sh\" --on-failure=deadletter"))
+		logger.Info("")
+		logger.Info("Run a slow handler on 8 messages at the same time:")
+		color.White("%v queue subscribe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --exec=\"./slow-handler.sh\" --concurrency=8 --prefetch=16 --auto-renew-lock --max-lock-renewal=30m"))
+	}
+}
+
+func PrintTopicListScheduledCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic list-scheduled [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --topic          string  Name of the topic (mandatory)")
+	logger.Info("  --subscription   string  Name of the subscription to look at the scheduled messages (mandatory)")
+	logger.Info("  --max            number  Maximum number of scheduled messages to show, defaults to 50")
+	logger.Info("  -o, --output     string  Output format, json, yaml, table or csv")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic list-scheduled %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example.subscription"))
+	case "windows":
+		color.White("%v topic list-scheduled %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example.subscription"))
+	}
+}
+
+func PrintTopicCancelScheduledCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic cancel-scheduled [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --topic          string  Name of the topic the message was scheduled in (mandatory)")
+	logger.Info("  --sequence       number  Sequence number of the scheduled message to cancel (mandatory)")
+	logger.Info("                           This option can be repeated to cancel more than one message")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic cancel-scheduled %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --sequence=10"))
+	case "windows":
+		color.White("%v topic cancel-scheduled %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --sequence=10"))
+	}
+}
+
+func PrintTopicDeadLetterCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic deadletter [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --topic          string  Name of the topic (mandatory)")
+	logger.Info("  --subscription   string  Name of the subscription to look at the dead letters (mandatory)")
+	logger.Info("  --max            number  Maximum number of dead letters to peek, defaults to 50")
+	logger.Info("  -o, --output     string  Output format of the peeked dead letters, json, yaml, table or csv")
+	logger.Info("  --sequence       number  Sequence number of the dead letter to show, resubmit or purge")
+	logger.Info("                           This option can be repeated to select more than one message")
+	logger.Info("                           if not set all the dead letters will be selected")
+	logger.Info("  --resubmit               Sends the selected dead letters back to the topic and removes them")
+	logger.Info("                           from the dead letter queue, all subscriptions matching the messages")
+	logger.Info("                           will receive a copy")
+	logger.Info("  --keep-message-id        Resubmits the dead letters with their original message id instead of a")
+	logger.Info("                           new one, duplicate detection drops the ones still in its window")
+	logger.Info("  --purge                  Removes the selected dead letters from the dead letter queue")
+	logger.Info("  --all                    Confirms a purge without --sequence removes every dead letter")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic deadletter %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example.subscription"))
+		color.White("%v topic deadletter %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --sequence=10 --resubmit"))
+	case "windows":
+		color.White("%v topic deadletter %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example.subscription"))
+		color.White("%v topic deadletter %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --sequence=10 --resubmit"))
+	}
+}
+
+func PrintQueueListScheduledCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus queue list-scheduled [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --queue          string  Name of the queue to look at the scheduled messages (mandatory)")
+	logger.Info("  --max            number  Maximum number of scheduled messages to show, defaults to 50")
+	logger.Info("  -o, --output     string  Output format, json, yaml, table or csv")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v queue list-scheduled %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue"))
+	case "windows":
+		color.White("%v queue list-scheduled %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue"))
+	}
+}
+
+func PrintQueueCancelScheduledCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus queue cancel-scheduled [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --queue          string  Name of the queue the message was scheduled in (mandatory)")
+	logger.Info("  --sequence       number  Sequence number of the scheduled message to cancel (mandatory)")
+	logger.Info("                           This option can be repeated to cancel more than one message")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v queue cancel-scheduled %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --sequence=10"))
+	case "windows":
+		color.White("%v queue cancel-scheduled %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --sequence=10"))
+	}
+}
+
+func PrintQueueDeadLetterCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus queue deadletter [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --queue          string  Name of the queue to look at the dead letters (mandatory)")
+	logger.Info("  --max            number  Maximum number of dead letters to peek, defaults to 50")
+	logger.Info("  -o, --output     string  Output format of the peeked dead letters, json, yaml, table or csv")
+	logger.Info("  --sequence       number  Sequence number of the dead letter to show, resubmit or purge")
+	logger.Info("                           This option can be repeated to select more than one message")
+	logger.Info("                           if not set all the dead letters will be selected")
+	logger.Info("  --resubmit               Sends the selected dead letters back to the queue and removes them")
+	logger.Info("                           from the dead letter queue")
+	logger.Info("  --keep-message-id        Resubmits the dead letters with their original message id instead of a")
+	logger.Info("                           new one, duplicate detection drops the ones still in its window")
+	logger.Info("  --purge                  Removes the selected dead letters from the dead letter queue")
+	logger.Info("  --all                    Confirms a purge without --sequence removes every dead letter")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v queue deadletter %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue"))
+		color.White("%v queue deadletter %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --purge --all"))
+	case "windows":
+		color.White("%v queue deadletter %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue"))
+		color.White("%v queue deadletter %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --purge --all"))
+	}
+}
+
+func PrintTopicExportCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic export [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --topic          string  Name of the topic (mandatory)")
+	logger.Info("  --subscription   string  Name of the subscription to export the messages from (mandatory)")
+	logger.Info("  --file           string  Path of the json lines file to write, use - for the standard output (mandatory)")
+	logger.Info("  --max            number  Maximum number of messages to export, defaults to all")
+	logger.Info("  --drain                  Receives and removes the messages from the subscription")
+	logger.Info("                           by default the messages are only peeked")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic export %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --file=messages.jsonl"))
+	case "windows":
+		color.White("%v topic export %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --file=messages.jsonl"))
+	}
+}
+
+func PrintTopicPurgeSubscriptionCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic purge-subscription [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --topic          string  Name of the topic (mandatory)")
+	logger.Info("  --subscription   string  Name of the subscription to purge (mandatory)")
+	printPurgeOptions()
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic purge-subscription %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example.subscription"))
+		color.White("%v topic purge-subscription %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --older-than=24h --filter=\"sys.Label = 'example'\""))
+	case "windows":
+		color.White("%v topic purge-subscription %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example.subscription"))
+		color.White("%v topic purge-subscription %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --subscription=example.subscription --older-than=24h --filter=\"sys.Label = 'example'\""))
+	}
+}
+
+func PrintQueuePurgeCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus queue purge [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --queue          string  Name of the queue to purge (mandatory)")
+	printPurgeOptions()
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v queue purge %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue"))
+		color.White("%v queue purge %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --before=2021-01-01T10:00:00Z"))
+	case "windows":
+		color.White("%v queue purge %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue"))
+		color.White("%v queue purge %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --before=2021-01-01T10:00:00Z"))
+	}
+}
+
+func printPurgeOptions() {
+	logger.Info("  --before         string  Only removes the messages enqueued before a RFC3339 date like 2021-01-01T10:00:00Z")
+	logger.Info("  --older-than     string  Only removes the messages older than a duration like 30m or 24h")
+	logger.Info("  --filter         string  Only removes the messages matching a sql filter like the subscribe --where")
+	logger.Info("  --parallel       number  Number of receivers removing messages at the same time, defaults to 4")
+	logger.Info("  --batch-size     number  Number of messages each receiver prefetches, defaults to 100")
+	logger.Info("")
+	logger.Info("All of the messages are received and deleted one by one by each receiver, with --before, --older-than")
+	logger.Info("or --filter the selected messages are found by peeking and the messages received before them are")
+	logger.Info("locked until the purge ends. Scheduled and dead letter messages are kept.")
+}
+
+func PrintTopicImportCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic import [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --topic          string  Name of the topic where to send the messages (mandatory)")
+	logger.Info("  --file           string  Path of the json lines file to read, use - for the standard input (mandatory)")
+	logger.Info("                           the file format is the same generated by the export command")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic import %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --file=messages.jsonl"))
+	case "windows":
+		color.White("%v topic import %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --file=messages.jsonl"))
+	}
+}
+
+func PrintQueueExportCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus queue export [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --queue          string  Name of the queue to export the messages from (mandatory)")
+	logger.Info("  --file           string  Path of the json lines file to write, use - for the standard output (mandatory)")
+	logger.Info("  --max            number  Maximum number of messages to export, defaults to all")
+	logger.Info("  --drain                  Receives and removes the messages from the queue")
+	logger.Info("                           by default the messages are only peeked")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v queue export %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --file=messages.jsonl"))
+	case "windows":
+		color.White("%v queue export %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --file=messages.jsonl"))
+	}
+}
+
+func PrintQueueImportCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus queue import [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --queue          string  Name of the queue where to send the messages (mandatory)")
+	logger.Info("  --file           string  Path of the json lines file to read, use - for the standard input (mandatory)")
+	logger.Info("                           the file format is the same generated by the export command")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v queue import %v", color.HiYellowString("servicebus"), color.HiBlackString("--queue=example.queue --file=messages.jsonl"))
+	case "windows":
+		color.White("%v queue import %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--queue=example.queue --file=messages.jsonl"))
+	}
+}
+
+func PrintPlanCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus plan [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  -f, --file       string  Path of the yaml or json topology file (mandatory)")
+	logger.Info("  --from-namespace string  Plans the topology of another namespace of the connections file instead")
+	logger.Info("                           of a file, this copies it to the current namespace")
+	logger.Info("  --prune                  Also plans the deletion of entities that are not in the topology file")
+	logger.Info("")
+	logger.Info("Topology file:")
+	logger.Info("  topics:")
+	logger.Info("    - name: example.topic")
+	logger.Info("      subscriptions:")
+	logger.Info("        - name: example.subscription")
+	logger.Info("          lockDuration: 1m")
+	logger.Info("          defaultMessageTimeToLive: 24h")
+	logger.Info("          maxDeliveryCount: 5")
+	logger.Info("          forwardTo: queue:example.queue")
+	logger.Info("          rules:")
+	logger.Info("            - name: example.rule")
+	logger.Info("              sqlFilter: Label='example'")
+	logger.Info("  queues:")
+	logger.Info("    - name: example.queue")
+	logger.Info("      autoDeleteOnIdle: 168h")
+	logger.Info("      requiresSession: true")
+	logger.Info("      forwardDeadLetterTo: topic:example.topic")
+	logger.Info("")
+	logger.Info("Properties that are not set are left as they are, use forwardTo: none to remove a forwarding.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v plan %v", color.HiYellowString("servicebus"), color.HiBlackString("--file=topology.yaml"))
+		color.White("%v plan %v", color.HiYellowString("servicebus"), color.HiBlackString("--from-namespace=staging --namespace=dev"))
+	case "windows":
+		color.White("%v plan %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--file=topology.yaml"))
+		color.White("%v plan %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--from-namespace=staging --namespace=dev"))
+	}
+}
+
+func PrintApplyCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus apply [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  -f, --file       string  Path of the yaml or json topology file (mandatory)")
+	logger.Info("                           see the plan command help for the file format")
+	logger.Info("  --from-namespace string  Applies the topology of another namespace of the connections file instead")
+	logger.Info("                           of a file, this copies it to the current namespace")
+	logger.Info("  --prune                  Deletes the entities that are not in the topology file")
+	logger.Info("                           the wiretap subscriptions are never deleted")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v apply %v", color.HiYellowString("servicebus"), color.HiBlackString("-f topology.yaml --prune"))
+		color.White("%v apply %v", color.HiYellowString("servicebus"), color.HiBlackString("--from-namespace=staging --namespace=dev"))
+	case "windows":
+		color.White("%v apply %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("-f topology.yaml --prune"))
+		color.White("%v apply %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--from-namespace=staging --namespace=dev"))
+	}
+}
+
+func PrintExportNamespaceCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus export-namespace [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  -f, --file       string  Path of the yaml or json snapshot file to write, the format is chosen by")
+	logger.Info("                           the file extension (mandatory unless --output is set)")
+	logger.Info("  -o, --output     string  Writes the snapshot to the console as json or yaml instead of a file")
+	logger.Info("")
+	logger.Info("The snapshot has every topic, subscription with its rules and forwarding, and queue with all their")
+	logger.Info("properties, the wiretap subscriptions of the subscribe command are not exported.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v export-namespace %v", color.HiYellowString("servicebus"), color.HiBlackString("--file=production.yaml"))
+		color.White("%v export-namespace %v", color.HiYellowString("servicebus"), color.HiBlackString("--namespace=staging -o json"))
+	case "windows":
+		color.White("%v export-namespace %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--file=production.yaml"))
+		color.White("%v export-namespace %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--namespace=staging -o json"))
+	}
+}
+
+func PrintRestoreNamespaceCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus restore-namespace [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  -f, --file       string  Path of the yaml or json snapshot file written by export-namespace (mandatory)")
+	logger.Info("  --from-namespace string  Restores a namespace of the connections file instead of a snapshot file,")
+	logger.Info("                           this clones it into the current namespace")
+	logger.Info("  --dry-run                Only prints the entities that would be created")
+	logger.Info("")
+	logger.Info("Topics are created first, then the queues with their forward targets before them and then the")
+	logger.Info("subscriptions. Entities that already exist are left untouched so a restore can be run again.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v restore-namespace %v", color.HiYellowString("servicebus"), color.HiBlackString("--file=production.yaml --namespace=disaster-recovery"))
+		color.White("%v restore-namespace %v", color.HiYellowString("servicebus"), color.HiBlackString("--from-namespace=staging --namespace=dev --dry-run"))
+	case "windows":
+		color.White("%v restore-namespace %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--file=production.yaml --namespace=disaster-recovery"))
+		color.White("%v restore-namespace %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--from-namespace=staging --namespace=dev --dry-run"))
+	}
+}
+
+func PrintTransferCommandHelper(command string) {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus " + command + " [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --from           string  Entity to receive the messages from (mandatory)")
+	logger.Info("                           queue:name or subscription:topic/name, add /$deadletterqueue for its dead letters")
+	logger.Info("  --to             string  Entity to send the messages to, queue:name or topic:name (mandatory)")
+	logger.Info("  --to-namespace   string  Namespace of the connections file to send the messages to, defaults to")
+	logger.Info("                           the namespace they are received from")
+	logger.Info("  --filter         string  Only " + command + " the messages matching a sql filter like the subscribe --where")
+	logger.Info("  --limit          number  Maximum number of messages to " + command)
+	logger.Info("  --dry-run                Only counts the messages that would be " + transferVerb(command))
+	logger.Info("  --label          string  Replaces the label of the messages")
+	logger.Info("  --set            string  Sets a user property on the messages like key:value, can be repeated")
+	logger.Info("  --unset          string  Removes a user property from the messages, can be repeated")
+	logger.Info("  --keep-message-id        Sends the messages with their original message id, a destination")
+	logger.Info("                           detecting duplicates drops the ones it has already received")
+	logger.Info("")
+	logger.Info("The body, label, user properties and correlation id of the messages are kept, they get a new")
+	logger.Info("message id and the dead letter reason and description are removed.")
+	if command == "move" {
+		logger.Info("Messages are removed from the source once they are sent, the ones not matching the filter")
+		logger.Info("are left in the source.")
+	} else {
+		logger.Info("Messages are peeked so they stay in the source and are not locked.")
+	}
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v %v %v", color.HiYellowString("servicebus"), command, color.HiBlackString("--from=queue:example.queue/$deadletterqueue --to=queue:example.queue --limit=100"))
+		color.White("%v %v %v", color.HiYellowString("servicebus"), command, color.HiBlackString("--from=subscription:example.topic/example.subscription --to=topic:other.topic --filter=\"sys.Label = 'example'\" --dry-run"))
+		color.White("%v %v %v", color.HiYellowString("servicebus"), command, color.HiBlackString("--namespace=staging --from=queue:example.queue --to=queue:example.queue --to-namespace=dev"))
+	case "windows":
+		color.White("%v %v %v", color.HiYellowString("servicebus.exe"), command, color.HiBlackString("--from=queue:example.queue/$deadletterqueue --to=queue:example.queue --limit=100"))
+		color.White("%v %v %v", color.HiYellowString("servicebus.exe"), command, color.HiBlackString("--from=subscription:example.topic/example.subscription --to=topic:other.topic --filter=\"sys.Label = 'example'\" --dry-run"))
+		color.White("%v %v %v", color.HiYellowString("servicebus.exe"), command, color.HiBlackString("--namespace=staging --from=queue:example.queue --to=queue:example.queue --to-namespace=dev"))
+	}
+}
+
+func transferVerb(command string) string {
+	if command == "copy" {
+		return "copied"
+	}
+
+	return "moved"
+}
+
+func PrintProbeCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus probe [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --topic               string    Name of the topic to send the probe messages to")
+	logger.Info("  --queue               string    Name of the queue to send the probe messages to")
+	logger.Info("                                  one of --topic or --queue is mandatory")
+	logger.Info("  --reply-queue         string    Name of the queue where the probe messages arrive")
+	logger.Info("                                  defaults to --queue when probing a queue")
+	logger.Info("  --reply-subscription  string    Name of the subscription where the probe messages arrive")
+	logger.Info("  --reply-topic         string    Topic of the reply subscription, defaults to --topic")
+	logger.Info("  --iterations          number    Number of probe messages sent one after the other, defaults to 10")
+	logger.Info("  --timeout             duration  Time to wait for each probe message, defaults to 30s")
+	logger.Info("  --interval            duration  Pause between the probe messages")
+	logger.Info("  --label               string    Label of the probe messages, defaults to ServiceBus.Tools.Probe")
+	logger.Info("  --force                         Probes a reply queue that has messages of other consumers")
+	logger.Info("")
+	logger.Info("The probe messages of a reply subscription are received in a temporary subscription of its")
+	logger.Info("topic that only matches their correlation id, it is deleted once the probe ends.")
+	logger.Info("A reply queue is not probed when it has messages of other consumers, or when one arrives during")
+	logger.Info("the probe, unless --force is set, these messages are locked until the probe ends.")
+	logger.Info("The command exits with 1 when a probe message does not arrive.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v probe %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --reply-queue=example.queue --iterations=50"))
+	case "windows":
+		color.White("%v probe %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --reply-queue=example.queue --iterations=50"))
+	}
+}
+
+func PrintTopCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus top [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --interval       duration  Time between two refreshes, defaults to 5s")
+	logger.Info("  --sort           string    Sorts the entities from the highest count, backlog, active, deadletter,")
+	logger.Info("                             scheduled, transfer, rate or name, defaults to backlog")
+	logger.Info("  --limit          number    Maximum number of entities shown")
+	logger.Info("  --topic          string    Only shows the subscriptions of this topic")
+	logger.Info("  --iterations     number    Number of refreshes before exiting, refreshes until ctrl+c when not set")
+	logger.Info("")
+	logger.Info("Every refresh shows the active, dead letter, scheduled and transfer messages of the queues and")
+	logger.Info("subscriptions with their change since the previous refresh and the active and dead letter rates")
+	logger.Info("per second. The backlog is the active and transfer messages waiting to be delivered.")
+	logger.Info("With --output json, yaml or csv the counts of every refresh are written instead of the table.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v top %v", color.HiYellowString("servicebus"), color.HiBlackString("--interval=10s --limit=20"))
+		color.White("%v top %v", color.HiYellowString("servicebus"), color.HiBlackString("--topic=example.topic --sort=deadletter"))
+	case "windows":
+		color.White("%v top %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--interval=10s --limit=20"))
+		color.White("%v top %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--topic=example.topic --sort=deadletter"))
+	}
+}
+
+func PrintGraphCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus graph [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --format         string  Graph format, dot or mermaid, defaults to dot")
+	logger.Info("  -f, --file       string  Path of a yaml or json topology file to draw instead of the Namespace")
+	logger.Info("                           see the plan command help for the file format")
+	logger.Info("")
+	logger.Info("Forward targets that do not exist are drawn in red as missing.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v graph %v", color.HiYellowString("servicebus"), color.HiBlackString("--format=dot | dot -Tsvg -o topology.svg"))
+		color.White("%v graph %v", color.HiYellowString("servicebus"), color.HiBlackString("--format=mermaid --file=topology.yaml"))
+	case "windows":
+		color.White("%v graph %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--format=dot | dot -Tsvg -o topology.svg"))
+		color.White("%v graph %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--format=mermaid --file=topology.yaml"))
+	}
+}
+
+func PrintLintCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus lint [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  -f, --file       string  Path of a yaml or json topology file to check instead of the Namespace")
+	logger.Info("                           see the plan command help for the file format")
+	logger.Info("")
+	logger.Info("Errors:")
+	logger.Info("  Forwarding cycles where messages loop between entities")
+	logger.Info("  Forwards and dead letter forwards to entities that do not exist")
+	logger.Info("  Subscription rules that are not valid")
+	logger.Info("Warnings:")
+	logger.Info("  Subscriptions where none of the rules can match, or without rules in the Namespace")
+	logger.Info("  Rules whose filter is never true, like 1=0 or a='x' AND a='y'")
+	logger.Info("")
+	logger.Info("The command exits with 1 when errors are found.")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v lint", color.HiYellowString("servicebus"))
+		color.White("%v lint %v", color.HiYellowString("servicebus"), color.HiBlackString("--file=topology.yaml -o table"))
+	case "windows":
+		color.White("%v lint", color.HiYellowString("servicebus.exe"))
+		color.White("%v lint %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--file=topology.yaml -o table"))
+	}
+}
+
+func PrintTopicTestRuleCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic test-rule [options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --filter         string  Sql filter expression to test (mandatory)")
+	logger.Info("  --action         string  Sql action expression to apply to the matching messages")
+	logger.Info("  --message        string  Path of a json message or a json lines file generated by the export command")
+	logger.Info("                           use - for the standard input, without it only the syntax is checked")
+	logger.Info("")
+	logger.Info("Message file:")
+	logger.Info("  {\"label\": \"example\", \"id\": \"1\", \"properties\": {\"Priority\": 2}}")
+	logger.Info("")
+	logger.Info("example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic test-rule %v", color.HiYellowString("servicebus"), color.HiBlackString("--filter=\"sys.Label = 'example' AND Priority > 1\" --action=\"SET Routed = TRUE\" --message=message.json"))
+	case "windows":
+		color.White("%v topic test-rule %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--filter=\"sys.Label = 'example' AND Priority > 1\" --action=\"SET Routed = TRUE\" --message=message.json"))
+	}
+}
+
+func PrintTopicListRulesCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic list-rules [Options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --name                   Topic name of the subscription")
+	logger.Info("  --subscription           Subscription name to list the rules from")
+	logger.Info("  -o, --output             Output format, json, yaml, table or csv")
+	logger.Info("")
+	logger.Info("Example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic list-rules %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --subscription=example.subscription"))
+	case "windows":
+		color.White("%v topic list-rules %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --subscription=example.subscription"))
+	}
+}
+
+func PrintTopicAddRuleCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic add-rule [Options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --name                   Topic name of the subscription")
+	logger.Info("  --subscription           Subscription name to add the rule to")
+	logger.Info("  --rule                   Rule name to create")
+	logger.Info("  --filter                 Sql filter expression of the rule")
+	logger.Info("  --action                 Sql action expression executed on the matching messages")
+	logger.Info("")
+	logger.Info("Correlation Filter Options, a message matches if all of them are equal:")
+	logger.Info("  --correlation-id         Message correlation id")
+	logger.Info("  --message-id             Message id")
+	logger.Info("  --to                     Message to address")
+	logger.Info("  --reply-to               Message reply to address")
+	logger.Info("  --label                  Message label")
+	logger.Info("  --session-id             Message session id")
+	logger.Info("  --reply-to-session-id    Message reply to session id")
+	logger.Info("  --content-type           Message content type")
+	logger.Info("  --property               Message user property, you can add more than one")
+	logger.Info("                           the format will be [key]:[value]")
+	logger.Info("")
+	logger.Info("The %v rule accepts every message, delete it to only receive the messages matching the rule", "$Default")
+	logger.Info("")
+	logger.Info("Example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic add-rule %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --subscription=example.subscription --rule=example --filter=\"Priority > 1\""))
+		color.White("%v topic add-rule %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --subscription=example.subscription --rule=example --label=example --property=Domain:example"))
+	case "windows":
+		color.White("%v topic add-rule %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --subscription=example.subscription --rule=example --filter=\"Priority > 1\""))
+		color.White("%v topic add-rule %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --subscription=example.subscription --rule=example --label=example --property=Domain:example"))
+	}
+}
+
+func PrintTopicDeleteRuleCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic delete-rule [Options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --name                   Topic name of the subscription")
+	logger.Info("  --subscription           Subscription name to delete the rule from")
+	logger.Info("  --rule                   Rule name to delete")
+	logger.Info("")
+	logger.Info("Example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic delete-rule %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --subscription=example.subscription --rule=\\$Default"))
+	case "windows":
+		color.White("%v topic delete-rule %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --subscription=example.subscription --rule=$Default"))
+	}
+}
+
+func PrintTopicReplaceRulesCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic replace-rules [Options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --name                   Topic name of the subscription")
+	logger.Info("  --subscription           Subscription name to replace the rules of")
+	logger.Info("  --with-rule              Sql filter/action rule for the subscription, you can add more than one")
+	logger.Info("                           the format will be [rule_name]:[sql_filter_expression]:[sql_action_expression]")
+	logger.Info("  --file                   Yaml or json file with a list of rules in the topology format")
+	logger.Info("                           rules can have a sqlFilter, a sqlAction or a correlationFilter")
+	logger.Info("")
+	logger.Info("The rules that are not in the list are removed, including the %v rule", "$Default")
+	logger.Info("")
+	logger.Info("Example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic replace-rules %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --subscription=example.subscription --with-rule=example:2=2 --file=rules.yaml"))
+	case "windows":
+		color.White("%v topic replace-rules %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --subscription=example.subscription --with-rule=example:2=2 --file=rules.yaml"))
+	}
+}
+
+func PrintTopicUpdateCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic update [Options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --name                   Topic name to update")
+	logger.Info("  --message-ttl            Default time to live of the messages, example: 24h")
+	logger.Info("  --auto-delete-on-idle    Idle time after which the topic is deleted, example: 168h")
+	logger.Info("")
+	logger.Info("Only the options that are set are changed, the changes are shown before being applied")
+	logger.Info("")
+	logger.Info("Example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic update %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --message-ttl=24h"))
+	case "windows":
+		color.White("%v topic update %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --message-ttl=24h"))
+	}
+}
+
+func PrintTopicUpdateSubscriptionCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus topic update-subscription [Options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --name                   Topic name of the subscription")
+	logger.Info("  --subscription           Subscription name to update")
+	logger.Info("  --lock-duration          Time the messages are locked for a receiver, example: 30s")
+	logger.Info("  --message-ttl            Default time to live of the messages, example: 24h")
+	logger.Info("  --auto-delete-on-idle    Idle time after which the subscription is deleted, example: 168h")
+	logger.Info("  --max-delivery-count     Deliveries before a message is dead lettered")
+	logger.Info("  --forward-to             Forwards the messages of the subscription")
+	logger.Info("                           the format will be topic|queue:[name_of_the_target]")
+	logger.Info("                           use none to remove the forwarding")
+	logger.Info("  --forward-deadletter-to  Forwards the dead letters of the subscription")
+	logger.Info("                           the format will be topic|queue:[name_of_the_target]")
+	logger.Info("                           use none to remove the forwarding")
+	logger.Info("")
+	logger.Info("Only the options that are set are changed, the changes are shown before being applied")
+	logger.Info("")
+	logger.Info("Example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v topic update-subscription %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.topic --subscription=example.subscription --lock-duration=1m --max-delivery-count=5"))
+	case "windows":
+		color.White("%v topic update-subscription %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.topic --subscription=example.subscription --lock-duration=1m --max-delivery-count=5"))
+	}
+}
+
+func PrintQueueUpdateCommandHelper() {
+	logger.Info("")
+	logger.Info("Usage:")
+	logger.Info("  servicebus queue update [Options]")
+	logger.Info("")
+	logger.Info("Available Options:")
+	logger.Info("  --name                   Queue name to update")
+	logger.Info("  --lock-duration          Time the messages are locked for a receiver, example: 30s")
+	logger.Info("  --message-ttl            Default time to live of the messages, example: 24h")
+	logger.Info("  --auto-delete-on-idle    Idle time after which the queue is deleted, example: 168h")
+	logger.Info("  --max-delivery-count     Deliveries before a message is dead lettered")
+	logger.Info("  --forward-to             Forwards the messages of the queue")
+	logger.Info("                           the format will be topic|queue:[name_of_the_target]")
+	logger.Info("                           use none to remove the forwarding")
+	logger.Info("  --forward-deadletter-to  Forwards the dead letters of the queue")
+	logger.Info("                           the format will be topic|queue:[name_of_the_target]")
+	logger.Info("                           use none to remove the forwarding")
+	logger.Info("")
+	logger.Info("Only the options that are set are changed, the changes are shown before being applied")
+	logger.Info("")
+	logger.Info("Example:")
+	os := runtime.GOOS
+	switch strings.ToLower(os) {
+	case "linux":
+		color.White("%v queue update %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.queue --lock-duration=1m --forward-deadletter-to=queue:example.errors"))
+		color.White("%v queue update %v", color.HiYellowString("servicebus"), color.HiBlackString("--name=example.queue --forward-to=none"))
+	case "windows":
+		color.White("%v queue update %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.queue --lock-duration=1m --forward-deadletter-to=queue:example.errors"))
+		color.White("%v queue update %v", color.HiYellowString("servicebus.exe"), color.HiBlackString("--name=example.queue --forward-to=none"))
 	}
 }
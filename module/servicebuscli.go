@@ -1,38 +1,57 @@
 package module
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	servicebus "github.com/Azure/azure-service-bus-go"
 	"github.com/cjlapao/common-go/helper"
+	"github.com/cjlapao/common-go/log"
 	"github.com/cjlapao/deployment-tools-go/help"
 	"github.com/cjlapao/deployment-tools-go/servicebuscli"
-
-	"github.com/rs/xid"
 )
 
 func ServiceBusCliModuleProcessor() {
+	// structured outputs and graphs are parsed by other tools so only errors are logged with them
+	output, err := getOutputFormatFlag()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	if output.IsStructured() || (strings.EqualFold(GetModuleArgument(), "graph") && !helper.GetFlagSwitch("help", false)) {
+		logger.LogLevel = log.Error
+	}
+
 	logger.Command("************************************************************")
 	logger.Command("*      Ivanti Cloud Development Service Bus Tool v1.0      *")
 	logger.Command("*                                                          *")
 	logger.Command("*  Author: Carlos Lapao                                    *")
 	logger.Command("************************************************************")
 	connStr := os.Getenv("SERVICEBUS_CONNECTION_STRING")
+	module := GetModuleArgument()
 
-	if connStr == "" {
-		help.PrintMissingServiceBusConnectionHelper()
-		os.Exit(1)
+	// the in memory broker and the rule tester run offline and do not need a connection to the service bus,
+	// the context and auth commands only work with the connections file and connection strings
+	if !strings.EqualFold(module, "context") && !strings.EqualFold(module, "auth") {
+		if strings.EqualFold(helper.GetFlagValue("broker", os.Getenv("SERVICEBUS_BROKER")), "memory") {
+			useMemoryBroker()
+		} else if !useEndpoint() && !useNamespace(connStr) && connStr == "" && !isOfflineCommand(module) {
+			help.PrintMissingServiceBusConnectionHelper()
+			os.Exit(1)
+		}
 	}
 
 	helpArg := helper.GetFlagSwitch("help", false)
 
-	module := GetModuleArgument()
 	if module == "" {
 		help.PrintMainCommandHelper()
 	}
@@ -53,7 +72,8 @@ func ServiceBusCliModuleProcessor() {
 			topics := helper.GetFlagArrayValue("topic")
 			subscription := helper.GetFlagValue("subscription", "")
 			wiretap := helper.GetFlagSwitch("wiretap", false)
-			peek := helper.GetFlagSwitch("peek", false)
+			sessions := helper.GetFlagSwitch("sessions", false)
+			sessionID := helper.GetFlagValue("session-id", "")
 			if len(topics) == 0 {
 				logger.Error("Missing topic name mandatory argument --topic")
 				help.PrintTopicSubscribeCommandHelper()
@@ -64,6 +84,11 @@ func ServiceBusCliModuleProcessor() {
 				help.PrintTopicSubscribeCommandHelper()
 				os.Exit(0)
 			}
+			limits, err := getSubscribeFlags(wiretap)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
 
 			signalChan := make(chan os.Signal, 1)
 			signal.Notify(signalChan, os.Interrupt, os.Kill)
@@ -75,7 +100,9 @@ func ServiceBusCliModuleProcessor() {
 				go func(topicName string) {
 					sbcli := servicebuscli.Get(connStr)
 					sbcli.UseWiretap = wiretap
-					sbcli.Peek = peek
+					sbcli.UseSessions = sessions
+					sbcli.SessionID = sessionID
+					limits.apply(sbcli)
 
 					if sbcli.UseWiretap {
 						subscription = "wiretap"
@@ -87,11 +114,14 @@ func ServiceBusCliModuleProcessor() {
 				}(topic)
 			}
 			logger.Info("Use %v to close connection", "ctrl+c")
-			<-signalChan
-			for _, topicCli := range topicSbClients {
-				topicCli.CloseTopicListener <- true
+			select {
+			case <-signalChan:
+				for _, topicCli := range topicSbClients {
+					topicCli.CloseTopicListener <- true
+				}
+				wg.Wait()
+			case <-waitGroupDone(&wg):
 			}
-			wg.Wait()
 			logger.Info("Bye!!!")
 			os.Exit(0)
 		case "list":
@@ -100,13 +130,19 @@ func ServiceBusCliModuleProcessor() {
 			if err != nil {
 				os.Exit(1)
 			}
-			if len(topics) > 0 {
+			if output.IsStructured() {
+				summaries := make([]servicebuscli.EntitySummary, 0, len(topics))
+				for _, topic := range topics {
+					summaries = append(summaries, servicebuscli.NewTopicSummary(topic))
+				}
+				writeOutput(servicebuscli.WriteEntitySummaries(os.Stdout, output, summaries))
+			} else if len(topics) > 0 {
 				logger.Info("Topics:")
 				for _, topic := range topics {
 					logger.Info("Topics: %v (last updated at: %v)", topic.Name, topic.UpdatedAt.String())
 				}
 			} else {
-				logger.Info("No topics found  in service bus %v", sbcli.Namespace.Name)
+				logger.Info("No topics found  in service bus %v", sbcli.Broker.Name())
 			}
 		case "list-subscriptions":
 			if helpArg {
@@ -126,13 +162,16 @@ func ServiceBusCliModuleProcessor() {
 				os.Exit(1)
 			}
 
-			if len(subscriptions) > 0 {
+			if output.IsStructured() {
+				summaries := make([]servicebuscli.EntitySummary, 0, len(subscriptions))
+				for _, subscription := range subscriptions {
+					summaries = append(summaries, servicebuscli.NewSubscriptionSummary(topic, subscription))
+				}
+				writeOutput(servicebuscli.WriteEntitySummaries(os.Stdout, output, summaries))
+			} else if len(subscriptions) > 0 {
 				logger.Info("Subscriptions:")
 				for _, subscription := range subscriptions {
 					name := subscription.Name
-					if name == "wiretap" {
-						name = name
-					}
 					forwardTo := ""
 					activeMsg := "0"
 					deadletterMsg := "0"
@@ -153,10 +192,38 @@ func ServiceBusCliModuleProcessor() {
 					if subscription.ForwardTo != nil {
 						forwardTo = "forwarding to -> " + *subscription.ForwardTo
 					}
+					if subscription.RequiresSession != nil && *subscription.RequiresSession {
+						forwardTo = strings.TrimSpace("(requires session) " + forwardTo)
+					}
 					logger.Info("Subscription: %v (messages: %v, dead letters: %v, scheduled: %v) %v", name, activeMsg, deadletterMsg, scheduledMsg, forwardTo)
 				}
 			} else {
-				logger.Info("No subscriptions found on topic %v in service bus %v", topic, sbcli.Namespace.Name)
+				logger.Info("No subscriptions found on topic %v in service bus %v", topic, sbcli.Broker.Name())
+			}
+		case "update":
+			if helpArg {
+				help.PrintTopicUpdateCommandHelper()
+				os.Exit(0)
+			}
+			topicName := helper.GetFlagValue("name", "")
+			if topicName == "" {
+				logger.Error("Missing topic name mandatory argument --name")
+				help.PrintTopicUpdateCommandHelper()
+				os.Exit(0)
+			}
+			properties, err := getEntityPropertyFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			topic := servicebuscli.NewTopic(topicName)
+			topic.DefaultMessageTimeToLive = properties.DefaultMessageTimeToLive
+			topic.AutoDeleteOnIdle = properties.AutoDeleteOnIdle
+
+			sbcli := servicebuscli.Get(connStr)
+			if err := sbcli.UpdateTopic(topic); err != nil {
+				os.Exit(1)
 			}
 		case "delete":
 			if helpArg {
@@ -179,14 +246,28 @@ func ServiceBusCliModuleProcessor() {
 				help.PrintTopicCreateTopicCommandHelper()
 				os.Exit(0)
 			}
-			topic := helper.GetFlagValue("name", "")
-			if topic == "" {
+			topicName := helper.GetFlagValue("name", "")
+			if topicName == "" {
 				logger.Error("Missing topic name mandatory argument --name")
 				help.PrintTopicCreateTopicCommandHelper()
 				os.Exit(0)
 			}
+			properties, err := getEntityPropertyFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			topic := servicebuscli.NewTopic(topicName)
+			topic.DefaultMessageTimeToLive = properties.DefaultMessageTimeToLive
+			topic.AutoDeleteOnIdle = properties.AutoDeleteOnIdle
+			topic.MaxSizeInMegabytes = properties.MaxSizeInMegabytes
+			topic.DuplicateDetectionWindow = properties.DuplicateDetectionWindow
+			topic.EnablePartitioning = helper.GetFlagSwitch("enable-partitioning", false)
+			topic.SupportOrdering = helper.GetFlagSwitch("support-ordering", false)
+
 			sbcli := servicebuscli.Get(connStr)
-			err := sbcli.CreateTopic(topic)
+			err = sbcli.CreateTopic(topic)
 			if err != nil {
 				os.Exit(1)
 			}
@@ -200,6 +281,7 @@ func ServiceBusCliModuleProcessor() {
 			forwardTo := helper.GetFlagValue("forward-to", "")
 			forwardDeadLetterTo := helper.GetFlagValue("forward-deadletter-to", "")
 			rules := helper.GetFlagArrayValue("with-rule")
+			requiresSession := helper.GetFlagSwitch("requires-session", false)
 			if topicName == "" {
 				logger.Error("Missing topic name mandatory argument --name")
 				help.PrintTopicCreateSubscriptionCommandHelper()
@@ -215,13 +297,258 @@ func ServiceBusCliModuleProcessor() {
 			subscription := servicebuscli.NewSubscription(topicName, subscriptionName)
 			subscription.MapMessageForwardFlag(forwardTo)
 			subscription.MapDeadLetterForwardFlag(forwardDeadLetterTo)
+			subscription.RequiresSession = requiresSession
 			for _, rule := range rules {
 				subscription.MapRuleFlag(rule)
 			}
+			for _, rule := range subscription.Rules {
+				if err := rule.Validate(); err != nil {
+					logger.Error(err.Error())
+					os.Exit(1)
+				}
+			}
 			err := sbcli.CreateSubscription(subscription)
 			if err != nil {
 				os.Exit(1)
 			}
+		case "test-rule":
+			if helpArg {
+				help.PrintTopicTestRuleCommandHelper()
+				os.Exit(0)
+			}
+			filter := helper.GetFlagValue("filter", "")
+			action := helper.GetFlagValue("action", "")
+			messageFile := helper.GetFlagValue("message", "")
+			if filter == "" && action == "" {
+				logger.Error("Missing filter mandatory argument --filter")
+				help.PrintTopicTestRuleCommandHelper()
+				os.Exit(0)
+			}
+			rule := servicebuscli.RuleEntity{
+				Name:      "test",
+				SQLFilter: filter,
+				SQLAction: action,
+			}
+			if err := rule.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if messageFile == "" {
+				logger.Info("The rule syntax is valid, use %v to test it against a message", "--message")
+				os.Exit(0)
+			}
+
+			messages, err := servicebuscli.LoadMessageEntities(messageFile)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			for i, message := range messages {
+				sqlMessage := servicebuscli.NewSQLMessage(message)
+				matched, result, err := rule.Test(sqlMessage)
+				if err != nil {
+					logger.Error("Message %v: %v", fmt.Sprint(i+1), err.Error())
+					os.Exit(1)
+				}
+				if !matched {
+					logger.LogHighlight("Message %v with label %v does %v the filter", log.Info, fmt.Sprint(i+1), message.Label, "not match")
+					continue
+				}
+				logger.LogHighlight("Message %v with label %v %v the filter", log.Info, fmt.Sprint(i+1), message.Label, "matches")
+				if action != "" {
+					servicebuscli.PrintSQLMessageChanges(sqlMessage, result)
+				}
+			}
+		case "list-rules":
+			if helpArg {
+				help.PrintTopicListRulesCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("name", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --name")
+				help.PrintTopicListRulesCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicListRulesCommandHelper()
+				os.Exit(0)
+			}
+			sbcli := servicebuscli.Get(connStr)
+			rules, err := sbcli.ListSubscriptionRules(topic, subscription)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if output.IsStructured() {
+				summaries := make([]servicebuscli.RuleSummary, 0, len(rules))
+				for _, rule := range rules {
+					summaries = append(summaries, servicebuscli.NewRuleSummary(rule))
+				}
+				writeOutput(servicebuscli.WriteRuleSummaries(os.Stdout, output, summaries))
+			} else if len(rules) > 0 {
+				logger.Info("Rules:")
+				for _, rule := range rules {
+					servicebuscli.PrintRule(rule)
+				}
+			} else {
+				logger.Info("No rules found in subscription %v on topic %v in service bus %v, it will not receive any message", subscription, topic, sbcli.Broker.Name())
+			}
+		case "add-rule":
+			if helpArg {
+				help.PrintTopicAddRuleCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("name", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			ruleName := helper.GetFlagValue("rule", "")
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --name")
+				help.PrintTopicAddRuleCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicAddRuleCommandHelper()
+				os.Exit(0)
+			}
+			if ruleName == "" {
+				logger.Error("Missing rule name mandatory argument --rule")
+				help.PrintTopicAddRuleCommandHelper()
+				os.Exit(0)
+			}
+			rule := servicebuscli.RuleEntity{
+				Name:              ruleName,
+				SQLFilter:         helper.GetFlagValue("filter", ""),
+				SQLAction:         helper.GetFlagValue("action", ""),
+				CorrelationFilter: getCorrelationFilterFlags(),
+			}
+			if rule.SQLFilter == "" && rule.CorrelationFilter == nil {
+				logger.Error("Missing rule filter, use %v or the correlation filter arguments", "--filter")
+				help.PrintTopicAddRuleCommandHelper()
+				os.Exit(0)
+			}
+			if err := rule.Validate(); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			sbcli := servicebuscli.Get(connStr)
+			if err := sbcli.AddSubscriptionRule(topic, subscription, rule); err != nil {
+				os.Exit(1)
+			}
+		case "delete-rule":
+			if helpArg {
+				help.PrintTopicDeleteRuleCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("name", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			ruleName := helper.GetFlagValue("rule", "")
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --name")
+				help.PrintTopicDeleteRuleCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicDeleteRuleCommandHelper()
+				os.Exit(0)
+			}
+			if ruleName == "" {
+				logger.Error("Missing rule name mandatory argument --rule")
+				help.PrintTopicDeleteRuleCommandHelper()
+				os.Exit(0)
+			}
+			sbcli := servicebuscli.Get(connStr)
+			if err := sbcli.DeleteSubscriptionRule(topic, subscription, ruleName); err != nil {
+				os.Exit(1)
+			}
+		case "replace-rules":
+			if helpArg {
+				help.PrintTopicReplaceRulesCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("name", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			rulesFile := helper.GetFlagValue("file", "")
+			ruleFlags := helper.GetFlagArrayValue("with-rule")
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --name")
+				help.PrintTopicReplaceRulesCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicReplaceRulesCommandHelper()
+				os.Exit(0)
+			}
+			if rulesFile == "" && len(ruleFlags) == 0 {
+				logger.Error("Missing rules, use %v or %v", "--with-rule", "--file")
+				help.PrintTopicReplaceRulesCommandHelper()
+				os.Exit(0)
+			}
+
+			subscriptionEntity := servicebuscli.NewSubscription(topic, subscription)
+			for _, rule := range ruleFlags {
+				subscriptionEntity.MapRuleFlag(rule)
+			}
+			if rulesFile != "" {
+				rules, err := servicebuscli.LoadTopologyRules(rulesFile)
+				if err != nil {
+					logger.Error(err.Error())
+					os.Exit(1)
+				}
+				subscriptionEntity.Rules = append(subscriptionEntity.Rules, rules...)
+			}
+			for _, rule := range subscriptionEntity.Rules {
+				if err := rule.Validate(); err != nil {
+					logger.Error(err.Error())
+					os.Exit(1)
+				}
+			}
+			sbcli := servicebuscli.Get(connStr)
+			if err := sbcli.ReplaceSubscriptionRules(topic, subscription, subscriptionEntity.Rules); err != nil {
+				os.Exit(1)
+			}
+		case "update-subscription":
+			if helpArg {
+				help.PrintTopicUpdateSubscriptionCommandHelper()
+				os.Exit(0)
+			}
+			topicName := helper.GetFlagValue("name", "")
+			subscriptionName := helper.GetFlagValue("subscription", "")
+			forwardTo := helper.GetFlagValue("forward-to", "")
+			forwardDeadLetterTo := helper.GetFlagValue("forward-deadletter-to", "")
+			if topicName == "" {
+				logger.Error("Missing topic name mandatory argument --name")
+				help.PrintTopicUpdateSubscriptionCommandHelper()
+				os.Exit(0)
+			}
+			if subscriptionName == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicUpdateSubscriptionCommandHelper()
+				os.Exit(0)
+			}
+			properties, err := getEntityPropertyFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			subscription := servicebuscli.NewSubscription(topicName, subscriptionName)
+			subscription.LockDuration = properties.LockDuration
+			subscription.DefaultMessageTimeToLive = properties.DefaultMessageTimeToLive
+			subscription.AutoDeleteOnIdle = properties.AutoDeleteOnIdle
+			subscription.MaxDeliveryCount = properties.MaxDeliveryCount
+			subscription.MapMessageForwardFlag(forwardTo)
+			subscription.MapDeadLetterForwardFlag(forwardDeadLetterTo)
+
+			sbcli := servicebuscli.Get(connStr)
+			if err := sbcli.UpdateSubscription(subscription); err != nil {
+				os.Exit(1)
+			}
 		case "delete-subscription":
 			if helpArg {
 				help.PrintTopicDeleteSubscriptionCommandHelper()
@@ -250,16 +577,14 @@ func ServiceBusCliModuleProcessor() {
 				os.Exit(0)
 			}
 			topic := helper.GetFlagValue("topic", "")
-			tenantID := helper.GetFlagValue("tenant", "11111111-1111-1111-1111-555555550001")
 			useDefault := helper.GetFlagSwitch("default", false)
-			unoFormat := helper.GetFlagSwitch("uno", false)
-			body := helper.GetFlagValue("body", "")
-			label := helper.GetFlagValue("label", "ServiceBus.Tools")
-			name := helper.GetFlagValue("name", "")
-			domain := helper.GetFlagValue("domain", "")
-			sender := helper.GetFlagValue("sender", "ServiceBus.Tools")
-			version := helper.GetFlagValue("version", "1.0")
 			propertiesFlags := helper.GetFlagArrayValue("property")
+			sessionID := helper.GetFlagValue("session-id", "")
+			scheduledAt, err := getScheduledTimeFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
 
 			if topic == "" {
 				logger.Error("Missing topic name mandatory argument --name")
@@ -267,51 +592,44 @@ func ServiceBusCliModuleProcessor() {
 				os.Exit(0)
 			}
 
-			var message map[string]interface{}
-			if useDefault && body == "" {
-				if !unoFormat {
-					domain = "TimeService"
-					name = "TimePassed"
-				} else {
-					domain = ""
-					name = ""
-				}
-				message = map[string]interface{}{
-					"Timestamp": time.Now().Format("2006-01-02T15:04:05.00000000-07:00"),
-					"TheTime":   time.Now().Format("2006-01-02T15:04:05"),
-				}
-			} else if body != "" {
-				err := json.Unmarshal([]byte(body), &message)
+			if filePath := helper.GetFlagValue("file", ""); filePath != "" {
+				options, err := getBatchSendFlags()
 				if err != nil {
 					logger.Error(err.Error())
 					os.Exit(1)
 				}
-			} else {
-				logger.Error("Missing message body, use %v='{\"example\": \"object\"}' or use the %v flag, this will generate a TimeService sample message", "--body", "--default")
-				help.PrintTopicSendCommandHelper()
+
+				sbcli := servicebuscli.Get(connStr)
+				_, err = sbcli.SendTopicMessageFile(topic, filePath, options)
+				if err != nil {
+					os.Exit(1)
+				}
 				os.Exit(0)
 			}
-			var properties map[string]interface{}
-			if len(propertiesFlags) == 0 || useDefault {
-				if domain != "" && name != "" {
-					label = domain + "." + name
-					diagnosticID := xid.New().String()
-					properties = map[string]interface{}{
-						"X-MsgTypeVersion": version,
-						"X-MsgDomain":      domain,
-						"X-MsgName":        name,
-						"X-Sender":         sender,
-						"X-TenantId":       tenantID,
-						"Diagnostic-Id":    diagnosticID,
-					}
-				} else {
-					label = topic
-					properties = map[string]interface{}{
-						"Serialization": "1",
-						"TenantId":      tenantID,
-					}
+
+			envelope, err := getEnvelopeFlags(topic, useDefault && helper.GetFlagValue("body", "") == "" && helper.GetFlagValue("body-file", "") == "")
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			body, contentType, err := getMessageBodyFlags(envelope.ContentType)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			var message map[string]interface{}
+			if useDefault && body == nil {
+				message = map[string]interface{}{
+					"Timestamp": time.Now().Format("2006-01-02T15:04:05.00000000-07:00"),
+					"TheTime":   time.Now().Format("2006-01-02T15:04:05"),
 				}
+			} else if body == nil {
+				logger.Error("Missing message body, use %v='{\"example\": \"object\"}', %v or use the %v flag, this will generate a TimeService sample message", "--body", "--body-file", "--default")
+				help.PrintTopicSendCommandHelper()
+				os.Exit(0)
 			}
+			properties := envelope.Properties
 			if len(propertiesFlags) > 0 {
 				if properties == nil {
 					properties = make(map[string]interface{})
@@ -325,53 +643,272 @@ func ServiceBusCliModuleProcessor() {
 			}
 
 			sbcli := servicebuscli.Get(connStr)
-			sbcli.SendTopicMessage(topic, message, label, properties)
-		default:
-			logger.Error("Invalid command argument %v, please choose a valid argument", command)
-			help.PrintTopicMainCommandHelper()
-		}
-		os.Exit(0)
-	case "queue":
-		command := GetCommandArgument()
-		if command == "" {
-			help.PrintQueueMainCommandHelper()
-			os.Exit(0)
-		}
-		switch strings.ToLower(command) {
-		case "subscribe":
+			err = sbcli.SendTopicMessageEntity(topic, servicebuscli.MessageEntity{
+				Label:       envelope.Label,
+				Message:     message,
+				Data:        body,
+				ContentType: contentType,
+				Properties:  properties,
+				SessionID:   sessionID,
+				ScheduledAt: scheduledAt,
+			})
+			if err != nil {
+				os.Exit(1)
+			}
+		case "list-scheduled":
 			if helpArg {
-				help.PrintQueueSubscribeCommandHelper()
+				help.PrintTopicListScheduledCommandHelper()
 				os.Exit(0)
 			}
-			queues := helper.GetFlagArrayValue("queue")
-			peek := helper.GetFlagSwitch("peek", false)
-			if len(queues) == 0 {
-				logger.Error("Missing queue name mandatory argument --queue")
-				help.PrintQueueSubscribeCommandHelper()
+			topic := helper.GetFlagValue("topic", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			maxMessages, err := strconv.Atoi(helper.GetFlagValue("max", "50"))
+			if err != nil {
+				logger.Error("Invalid value for argument --max, it needs to be a number")
+				os.Exit(1)
+			}
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --topic")
+				help.PrintTopicListScheduledCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicListScheduledCommandHelper()
 				os.Exit(0)
 			}
 
-			signalChan := make(chan os.Signal, 1)
-			signal.Notify(signalChan, os.Interrupt, os.Kill)
-
-			var wg sync.WaitGroup
-			wg.Add(len(queues))
-			var queueSbClients []*servicebuscli.ServiceBusCli
-			for _, queue := range queues {
+			sbcli := servicebuscli.Get(connStr)
+			messages, err := sbcli.ListScheduledSubscriptionMessages(topic, subscription, maxMessages)
+			if err != nil {
+				os.Exit(1)
+			}
+			printScheduledMessages(messages, output)
+		case "cancel-scheduled":
+			if helpArg {
+				help.PrintTopicCancelScheduledCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("topic", "")
+			sequenceNumbers, err := getSequenceNumberFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --topic")
+				help.PrintTopicCancelScheduledCommandHelper()
+				os.Exit(0)
+			}
+			if len(sequenceNumbers) == 0 {
+				logger.Error("Missing sequence number mandatory argument --sequence")
+				help.PrintTopicCancelScheduledCommandHelper()
+				os.Exit(0)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			err = sbcli.CancelScheduledTopicMessages(topic, sequenceNumbers)
+			if err != nil {
+				os.Exit(1)
+			}
+		case "deadletter":
+			if helpArg {
+				help.PrintTopicDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("topic", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			resubmit := helper.GetFlagSwitch("resubmit", false)
+			purge := helper.GetFlagSwitch("purge", false)
+			all := helper.GetFlagSwitch("all", false)
+			maxMessages, err := strconv.Atoi(helper.GetFlagValue("max", "50"))
+			if err != nil {
+				logger.Error("Invalid value for argument --max, it needs to be a number")
+				os.Exit(1)
+			}
+			sequenceNumbers, err := getSequenceNumberFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --topic")
+				help.PrintTopicDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+			if resubmit && purge {
+				logger.Error("Please choose only one of %v or %v", "--resubmit", "--purge")
+				help.PrintTopicDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+			if purge && len(sequenceNumbers) == 0 && !all {
+				logger.Error("Purging without %v removes every dead letter, please add %v to confirm", "--sequence", "--all")
+				help.PrintTopicDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			switch {
+			case resubmit:
+				_, err = sbcli.ResubmitSubscriptionDeadLetters(topic, subscription, sequenceNumbers, helper.GetFlagSwitch("keep-message-id", false))
+			case purge:
+				_, err = sbcli.PurgeSubscriptionDeadLetters(topic, subscription, sequenceNumbers)
+			default:
+				var messages []*servicebus.Message
+				messages, err = sbcli.PeekSubscriptionDeadLetters(topic, subscription, maxMessages)
+				printDeadLetterMessages(messages, sequenceNumbers, output)
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+		case "export":
+			if helpArg {
+				help.PrintTopicExportCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("topic", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			filePath := helper.GetFlagValue("file", "")
+			drain := helper.GetFlagSwitch("drain", false)
+			maxMessages, err := strconv.Atoi(helper.GetFlagValue("max", "0"))
+			if err != nil {
+				logger.Error("Invalid value for argument --max, it needs to be a number")
+				os.Exit(1)
+			}
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --topic")
+				help.PrintTopicExportCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicExportCommandHelper()
+				os.Exit(0)
+			}
+			if filePath == "" {
+				logger.Error("Missing file mandatory argument --file")
+				help.PrintTopicExportCommandHelper()
+				os.Exit(0)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			_, err = sbcli.ExportSubscriptionMessages(topic, subscription, filePath, drain, maxMessages)
+			if err != nil {
+				os.Exit(1)
+			}
+		case "import":
+			if helpArg {
+				help.PrintTopicImportCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("topic", "")
+			filePath := helper.GetFlagValue("file", "")
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --topic")
+				help.PrintTopicImportCommandHelper()
+				os.Exit(0)
+			}
+			if filePath == "" {
+				logger.Error("Missing file mandatory argument --file")
+				help.PrintTopicImportCommandHelper()
+				os.Exit(0)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			_, failed, err := sbcli.ImportTopicMessages(topic, filePath)
+			if err != nil || failed > 0 {
+				os.Exit(1)
+			}
+		case "purge-subscription":
+			if helpArg {
+				help.PrintTopicPurgeSubscriptionCommandHelper()
+				os.Exit(0)
+			}
+			topic := helper.GetFlagValue("topic", "")
+			subscription := helper.GetFlagValue("subscription", "")
+			if topic == "" {
+				logger.Error("Missing topic name mandatory argument --topic")
+				help.PrintTopicPurgeSubscriptionCommandHelper()
+				os.Exit(0)
+			}
+			if subscription == "" {
+				logger.Error("Missing subscription name mandatory argument --subscription")
+				help.PrintTopicPurgeSubscriptionCommandHelper()
+				os.Exit(0)
+			}
+			options, err := getPurgeFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			_, err = sbcli.PurgeSubscription(topic, subscription, options)
+			if err != nil {
+				os.Exit(1)
+			}
+		default:
+			logger.Error("Invalid command argument %v, please choose a valid argument", command)
+			help.PrintTopicMainCommandHelper()
+		}
+		os.Exit(0)
+	case "queue":
+		command := GetCommandArgument()
+		if command == "" {
+			help.PrintQueueMainCommandHelper()
+			os.Exit(0)
+		}
+		switch strings.ToLower(command) {
+		case "subscribe":
+			if helpArg {
+				help.PrintQueueSubscribeCommandHelper()
+				os.Exit(0)
+			}
+			queues := helper.GetFlagArrayValue("queue")
+			sessions := helper.GetFlagSwitch("sessions", false)
+			sessionID := helper.GetFlagValue("session-id", "")
+			if len(queues) == 0 {
+				logger.Error("Missing queue name mandatory argument --queue")
+				help.PrintQueueSubscribeCommandHelper()
+				os.Exit(0)
+			}
+			limits, err := getSubscribeFlags(false)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			signalChan := make(chan os.Signal, 1)
+			signal.Notify(signalChan, os.Interrupt, os.Kill)
+
+			var wg sync.WaitGroup
+			wg.Add(len(queues))
+			var queueSbClients []*servicebuscli.ServiceBusCli
+			for _, queue := range queues {
 				go func(queueName string) {
 					sbcli := servicebuscli.Get(connStr)
-					sbcli.Peek = peek
+					sbcli.UseSessions = sessions
+					sbcli.SessionID = sessionID
+					limits.apply(sbcli)
 					queueSbClients = append(queueSbClients, sbcli)
 					sbcli.SubscribeToQueue(queueName)
 					defer wg.Done()
 				}(queue)
 			}
 			logger.Info("Use %v to close connection", "ctrl+c")
-			<-signalChan
-			for _, queueCli := range queueSbClients {
-				queueCli.CloseQueueListener <- true
+			select {
+			case <-signalChan:
+				for _, queueCli := range queueSbClients {
+					queueCli.CloseQueueListener <- true
+				}
+				wg.Wait()
+			case <-waitGroupDone(&wg):
 			}
-			wg.Wait()
 			logger.Info("Bye!!!")
 			os.Exit(0)
 		case "list":
@@ -382,7 +919,13 @@ func ServiceBusCliModuleProcessor() {
 				os.Exit(1)
 			}
 
-			if len(queues) > 0 {
+			if output.IsStructured() {
+				summaries := make([]servicebuscli.EntitySummary, 0, len(queues))
+				for _, queue := range queues {
+					summaries = append(summaries, servicebuscli.NewQueueSummary(queue))
+				}
+				writeOutput(servicebuscli.WriteEntitySummaries(os.Stdout, output, summaries))
+			} else if len(queues) > 0 {
 				logger.Info("Queues:")
 				for _, queue := range queues {
 					name := queue.Name
@@ -406,10 +949,44 @@ func ServiceBusCliModuleProcessor() {
 					if queue.ForwardTo != nil && strings.TrimSpace(*queue.ForwardTo) != "" {
 						forwardTo = "forwarding to -> " + strings.TrimSpace(*queue.ForwardTo)
 					}
+					if queue.RequiresSession != nil && *queue.RequiresSession {
+						forwardTo = strings.TrimSpace("(requires session) " + forwardTo)
+					}
 					logger.Info("Queue: %v (messages: %v, dead letters: %v, scheduled: %v) %v", name, activeMsg, deadletterMsg, scheduledMsg, forwardTo)
 				}
 			} else {
-				logger.Info("No Queues found in service bus %v", sbcli.Namespace.Name)
+				logger.Info("No Queues found in service bus %v", sbcli.Broker.Name())
+			}
+		case "update":
+			if helpArg {
+				help.PrintQueueUpdateCommandHelper()
+				os.Exit(0)
+			}
+			queueName := helper.GetFlagValue("name", "")
+			forwardTo := helper.GetFlagValue("forward-to", "")
+			forwardDeadLetterTo := helper.GetFlagValue("forward-deadletter-to", "")
+			if queueName == "" {
+				logger.Error("Missing queue name mandatory argument --name")
+				help.PrintQueueUpdateCommandHelper()
+				os.Exit(0)
+			}
+			properties, err := getEntityPropertyFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			queue := servicebuscli.NewQueue(queueName)
+			queue.LockDuration = properties.LockDuration
+			queue.DefaultMessageTimeToLive = properties.DefaultMessageTimeToLive
+			queue.AutoDeleteOnIdle = properties.AutoDeleteOnIdle
+			queue.MaxDeliveryCount = properties.MaxDeliveryCount
+			queue.MapMessageForwardFlag(forwardTo)
+			queue.MapDeadLetterForwardFlag(forwardDeadLetterTo)
+
+			sbcli := servicebuscli.Get(connStr)
+			if err := sbcli.UpdateQueue(queue); err != nil {
+				os.Exit(1)
 			}
 		case "delete":
 			if helpArg {
@@ -436,19 +1013,34 @@ func ServiceBusCliModuleProcessor() {
 			queueName := helper.GetFlagValue("name", "")
 			forwardTo := helper.GetFlagValue("forward-to", "")
 			forwardDeadLetterTo := helper.GetFlagValue("forward-deadletter-to", "")
+			requiresSession := helper.GetFlagSwitch("requires-session", false)
 			if queueName == "" {
 				logger.Error("Missing queue name mandatory argument --name")
 				help.PrintQueueCreateCommandHelper()
 				os.Exit(0)
 			}
+			properties, err := getEntityPropertyFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
 
 			sbcli := servicebuscli.Get(connStr)
 
 			queue := servicebuscli.NewQueue(queueName)
+			queue.LockDuration = properties.LockDuration
+			queue.DefaultMessageTimeToLive = properties.DefaultMessageTimeToLive
+			queue.AutoDeleteOnIdle = properties.AutoDeleteOnIdle
+			if properties.MaxDeliveryCount > 0 {
+				queue.MaxDeliveryCount = properties.MaxDeliveryCount
+			}
+			queue.DuplicateDetectionWindow = properties.DuplicateDetectionWindow
+			queue.EnablePartitioning = helper.GetFlagSwitch("enable-partitioning", false)
 			queue.MapMessageForwardFlag(forwardTo)
 			queue.MapDeadLetterForwardFlag(forwardDeadLetterTo)
+			queue.RequiresSession = requiresSession
 
-			err := sbcli.CreateQueue(queue)
+			err = sbcli.CreateQueue(queue)
 			if err != nil {
 				os.Exit(1)
 			}
@@ -458,16 +1050,14 @@ func ServiceBusCliModuleProcessor() {
 				os.Exit(0)
 			}
 			queue := helper.GetFlagValue("queue", "")
-			tenantID := helper.GetFlagValue("tenant", "11111111-1111-1111-1111-555555550001")
 			useDefault := helper.GetFlagSwitch("default", false)
-			unoFormat := helper.GetFlagSwitch("uno", false)
-			body := helper.GetFlagValue("body", "")
-			label := helper.GetFlagValue("label", "ServiceBus.Tools")
-			name := helper.GetFlagValue("name", "")
-			domain := helper.GetFlagValue("domain", "")
-			sender := helper.GetFlagValue("sender", "ServiceBus.Tools")
-			version := helper.GetFlagValue("version", "1.0")
 			propertiesFlags := helper.GetFlagArrayValue("property")
+			sessionID := helper.GetFlagValue("session-id", "")
+			scheduledAt, err := getScheduledTimeFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
 
 			if queue == "" {
 				logger.Error("Missing queue name mandatory argument --name")
@@ -475,51 +1065,44 @@ func ServiceBusCliModuleProcessor() {
 				os.Exit(0)
 			}
 
-			var message map[string]interface{}
-			if useDefault && body == "" {
-				if !unoFormat {
-					domain = "TimeService"
-					name = "TimePassed"
-				} else {
-					domain = ""
-					name = ""
-				}
-				message = map[string]interface{}{
-					"Timestamp": time.Now().Format("2006-01-02T15:04:05.00000000-07:00"),
-					"TheTime":   time.Now().Format("2006-01-02T15:04:05"),
-				}
-			} else if body != "" {
-				err := json.Unmarshal([]byte(body), &message)
+			if filePath := helper.GetFlagValue("file", ""); filePath != "" {
+				options, err := getBatchSendFlags()
 				if err != nil {
 					logger.Error(err.Error())
 					os.Exit(1)
 				}
-			} else {
-				logger.Error("Missing message body, use %v='{\"example\": \"object\"}' or use the %v flag, this will generate a TimeService sample message", "--body", "--default")
-				help.PrintTopicSendCommandHelper()
+
+				sbcli := servicebuscli.Get(connStr)
+				_, err = sbcli.SendQueueMessageFile(queue, filePath, options)
+				if err != nil {
+					os.Exit(1)
+				}
 				os.Exit(0)
 			}
-			var properties map[string]interface{}
-			if len(propertiesFlags) == 0 || useDefault {
-				if domain != "" && name != "" {
-					label = domain + "." + name
-					diagnosticID := xid.New().String()
-					properties = map[string]interface{}{
-						"X-MsgTypeVersion": version,
-						"X-MsgDomain":      domain,
-						"X-MsgName":        name,
-						"X-Sender":         sender,
-						"X-TenantId":       tenantID,
-						"Diagnostic-Id":    diagnosticID,
-					}
-				} else {
-					label = queue
-					properties = map[string]interface{}{
-						"Serialization": "1",
-						"TenantId":      tenantID,
-					}
+
+			envelope, err := getEnvelopeFlags(queue, useDefault && helper.GetFlagValue("body", "") == "" && helper.GetFlagValue("body-file", "") == "")
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			body, contentType, err := getMessageBodyFlags(envelope.ContentType)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			var message map[string]interface{}
+			if useDefault && body == nil {
+				message = map[string]interface{}{
+					"Timestamp": time.Now().Format("2006-01-02T15:04:05.00000000-07:00"),
+					"TheTime":   time.Now().Format("2006-01-02T15:04:05"),
 				}
+			} else if body == nil {
+				logger.Error("Missing message body, use %v='{\"example\": \"object\"}', %v or use the %v flag, this will generate a TimeService sample message", "--body", "--body-file", "--default")
+				help.PrintTopicSendCommandHelper()
+				os.Exit(0)
 			}
+			properties := envelope.Properties
 			if len(propertiesFlags) > 0 {
 				if properties == nil {
 					properties = make(map[string]interface{})
@@ -533,30 +1116,1384 @@ func ServiceBusCliModuleProcessor() {
 			}
 
 			sbcli := servicebuscli.Get(connStr)
-			sbcli.SendQueueMessage(queue, message, label, properties)
-
-		default:
-			logger.Error("Invalid command argument %v, please choose a valid argument", command)
-			help.PrintQueueMainCommandHelper()
-		}
-		os.Exit(0)
-	default:
+			err = sbcli.SendQueueMessageEntity(queue, servicebuscli.MessageEntity{
+				Label:       envelope.Label,
+				Message:     message,
+				Data:        body,
+				ContentType: contentType,
+				Properties:  properties,
+				SessionID:   sessionID,
+				ScheduledAt: scheduledAt,
+			})
+			if err != nil {
+				os.Exit(1)
+			}
+		case "list-scheduled":
+			if helpArg {
+				help.PrintQueueListScheduledCommandHelper()
+				os.Exit(0)
+			}
+			queue := helper.GetFlagValue("queue", "")
+			maxMessages, err := strconv.Atoi(helper.GetFlagValue("max", "50"))
+			if err != nil {
+				logger.Error("Invalid value for argument --max, it needs to be a number")
+				os.Exit(1)
+			}
+			if queue == "" {
+				logger.Error("Missing queue name mandatory argument --queue")
+				help.PrintQueueListScheduledCommandHelper()
+				os.Exit(0)
+			}
 
-		help.PrintMainCommandHelper()
-	}
-	if helpArg {
-		help.PrintMainCommandHelper()
-		os.Exit(0)
-	}
-}
+			sbcli := servicebuscli.Get(connStr)
+			messages, err := sbcli.ListScheduledQueueMessages(queue, maxMessages)
+			if err != nil {
+				os.Exit(1)
+			}
+			printScheduledMessages(messages, output)
+		case "cancel-scheduled":
+			if helpArg {
+				help.PrintQueueCancelScheduledCommandHelper()
+				os.Exit(0)
+			}
+			queue := helper.GetFlagValue("queue", "")
+			sequenceNumbers, err := getSequenceNumberFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if queue == "" {
+				logger.Error("Missing queue name mandatory argument --queue")
+				help.PrintQueueCancelScheduledCommandHelper()
+				os.Exit(0)
+			}
+			if len(sequenceNumbers) == 0 {
+				logger.Error("Missing sequence number mandatory argument --sequence")
+				help.PrintQueueCancelScheduledCommandHelper()
+				os.Exit(0)
+			}
 
-func serviceBusCliModuleCommandHelper() {
-	fmt.Println("Please choose a sub command:")
-	fmt.Println()
-	fmt.Println("Usage:")
-	fmt.Println("  DeploymentTools servicebus [subcommand]")
-	fmt.Println()
-	fmt.Println("Available Commands:")
+			sbcli := servicebuscli.Get(connStr)
+			err = sbcli.CancelScheduledQueueMessages(queue, sequenceNumbers)
+			if err != nil {
+				os.Exit(1)
+			}
+		case "deadletter":
+			if helpArg {
+				help.PrintQueueDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+			queue := helper.GetFlagValue("queue", "")
+			resubmit := helper.GetFlagSwitch("resubmit", false)
+			purge := helper.GetFlagSwitch("purge", false)
+			all := helper.GetFlagSwitch("all", false)
+			maxMessages, err := strconv.Atoi(helper.GetFlagValue("max", "50"))
+			if err != nil {
+				logger.Error("Invalid value for argument --max, it needs to be a number")
+				os.Exit(1)
+			}
+			sequenceNumbers, err := getSequenceNumberFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if queue == "" {
+				logger.Error("Missing queue name mandatory argument --queue")
+				help.PrintQueueDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+			if resubmit && purge {
+				logger.Error("Please choose only one of %v or %v", "--resubmit", "--purge")
+				help.PrintQueueDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+			if purge && len(sequenceNumbers) == 0 && !all {
+				logger.Error("Purging without %v removes every dead letter, please add %v to confirm", "--sequence", "--all")
+				help.PrintQueueDeadLetterCommandHelper()
+				os.Exit(0)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			switch {
+			case resubmit:
+				_, err = sbcli.ResubmitQueueDeadLetters(queue, sequenceNumbers, helper.GetFlagSwitch("keep-message-id", false))
+			case purge:
+				_, err = sbcli.PurgeQueueDeadLetters(queue, sequenceNumbers)
+			default:
+				var messages []*servicebus.Message
+				messages, err = sbcli.PeekQueueDeadLetters(queue, maxMessages)
+				printDeadLetterMessages(messages, sequenceNumbers, output)
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+		case "export":
+			if helpArg {
+				help.PrintQueueExportCommandHelper()
+				os.Exit(0)
+			}
+			queue := helper.GetFlagValue("queue", "")
+			filePath := helper.GetFlagValue("file", "")
+			drain := helper.GetFlagSwitch("drain", false)
+			maxMessages, err := strconv.Atoi(helper.GetFlagValue("max", "0"))
+			if err != nil {
+				logger.Error("Invalid value for argument --max, it needs to be a number")
+				os.Exit(1)
+			}
+			if queue == "" {
+				logger.Error("Missing queue name mandatory argument --queue")
+				help.PrintQueueExportCommandHelper()
+				os.Exit(0)
+			}
+			if filePath == "" {
+				logger.Error("Missing file mandatory argument --file")
+				help.PrintQueueExportCommandHelper()
+				os.Exit(0)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			_, err = sbcli.ExportQueueMessages(queue, filePath, drain, maxMessages)
+			if err != nil {
+				os.Exit(1)
+			}
+		case "import":
+			if helpArg {
+				help.PrintQueueImportCommandHelper()
+				os.Exit(0)
+			}
+			queue := helper.GetFlagValue("queue", "")
+			filePath := helper.GetFlagValue("file", "")
+			if queue == "" {
+				logger.Error("Missing queue name mandatory argument --queue")
+				help.PrintQueueImportCommandHelper()
+				os.Exit(0)
+			}
+			if filePath == "" {
+				logger.Error("Missing file mandatory argument --file")
+				help.PrintQueueImportCommandHelper()
+				os.Exit(0)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			_, failed, err := sbcli.ImportQueueMessages(queue, filePath)
+			if err != nil || failed > 0 {
+				os.Exit(1)
+			}
+		case "purge":
+			if helpArg {
+				help.PrintQueuePurgeCommandHelper()
+				os.Exit(0)
+			}
+			queue := helper.GetFlagValue("queue", "")
+			if queue == "" {
+				logger.Error("Missing queue name mandatory argument --queue")
+				help.PrintQueuePurgeCommandHelper()
+				os.Exit(0)
+			}
+			options, err := getPurgeFlags()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+
+			sbcli := servicebuscli.Get(connStr)
+			_, err = sbcli.PurgeQueue(queue, options)
+			if err != nil {
+				os.Exit(1)
+			}
+		default:
+			logger.Error("Invalid command argument %v, please choose a valid argument", command)
+			help.PrintQueueMainCommandHelper()
+		}
+		os.Exit(0)
+	case "context":
+		command := GetCommandArgument()
+		if command == "" {
+			help.PrintContextMainCommandHelper()
+			os.Exit(0)
+		}
+		connectionsPath := servicebuscli.DefaultConnectionsPath()
+		connections, err := servicebuscli.LoadConnections(connectionsPath)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		switch strings.ToLower(command) {
+		case "list":
+			if helpArg {
+				help.PrintContextListCommandHelper()
+				os.Exit(0)
+			}
+			summaries := connections.Summaries()
+			if output.IsStructured() {
+				writeOutput(servicebuscli.WriteNamespaceSummaries(os.Stdout, output, summaries))
+			} else {
+				servicebuscli.PrintNamespaceSummaries(summaries)
+			}
+			os.Exit(0)
+		case "current":
+			if helpArg {
+				help.PrintContextMainCommandHelper()
+				os.Exit(0)
+			}
+			namespace, ok, err := connections.Current()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if !ok {
+				logger.Info("There is no current context, use the context use command to set one")
+				os.Exit(0)
+			}
+			logger.LogHighlight("Current context is %v", log.Info, namespace.Name)
+			os.Exit(0)
+		case "use":
+			name := GetSubCommandArgument()
+			if helpArg || name == "" {
+				if !helpArg {
+					logger.Error("Missing namespace name mandatory argument")
+				}
+				help.PrintContextUseCommandHelper()
+				os.Exit(0)
+			}
+			if err := connections.Use(name); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if err := connections.Save(connectionsPath); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			logger.LogHighlight("Switched to namespace %v", log.Info, connections.CurrentContext)
+			os.Exit(0)
+		case "add":
+			name := GetSubCommandArgument()
+			if helpArg || name == "" {
+				if !helpArg {
+					logger.Error("Missing namespace name mandatory argument")
+				}
+				help.PrintContextAddCommandHelper()
+				os.Exit(0)
+			}
+			namespace := servicebuscli.NamespaceConnection{
+				Name:             name,
+				ConnectionString: helper.GetFlagValue("connection-string", ""),
+				Endpoint:         helper.GetFlagValue("endpoint", ""),
+				SASToken:         helper.GetFlagValue("sas-token", ""),
+				Broker:           helper.GetFlagValue("broker", ""),
+				State:            helper.GetFlagValue("state", ""),
+			}
+			// without a connection string or a shared access signature the azure client credential is used
+			if namespace.ConnectionString == "" && namespace.SASToken == "" {
+				namespace.TenantID = ctx.AzureClient.TenantID
+				namespace.ClientID = ctx.AzureClient.ClientID
+				namespace.ClientSecret = ctx.AzureClient.ClientSecret
+			}
+			if err := connections.Set(namespace); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if helper.GetFlagSwitch("use", false) || connections.CurrentContext == "" {
+				connections.CurrentContext = namespace.Name
+			}
+			if err := connections.Save(connectionsPath); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			logger.LogHighlight("Saved namespace %v in %v", log.Info, namespace.Name, connectionsPath)
+			os.Exit(0)
+		case "remove":
+			name := GetSubCommandArgument()
+			if helpArg || name == "" {
+				if !helpArg {
+					logger.Error("Missing namespace name mandatory argument")
+				}
+				help.PrintContextRemoveCommandHelper()
+				os.Exit(0)
+			}
+			if err := connections.Remove(name); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if err := connections.Save(connectionsPath); err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			logger.LogHighlight("Removed namespace %v from %v", log.Info, name, connectionsPath)
+			os.Exit(0)
+		default:
+			help.PrintContextMainCommandHelper()
+			os.Exit(0)
+		}
+	case "auth":
+		command := GetCommandArgument()
+		if command == "" {
+			help.PrintAuthMainCommandHelper()
+			os.Exit(0)
+		}
+		switch strings.ToLower(command) {
+		case "parse":
+			if helpArg {
+				help.PrintAuthParseCommandHelper()
+				os.Exit(0)
+			}
+			connection, err := getAuthConnectionString(connStr)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if output.IsStructured() {
+				writeOutput(servicebuscli.WriteConnectionStringSummary(os.Stdout, output, connection.Summary()))
+			} else {
+				servicebuscli.PrintConnectionStringSummary(connection.Summary())
+			}
+			os.Exit(0)
+		case "sas-token":
+			if helpArg {
+				help.PrintAuthSASTokenCommandHelper()
+				os.Exit(0)
+			}
+			connection, err := getAuthConnectionString(connStr)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			duration, err := time.ParseDuration(helper.GetFlagValue("expiry", "1h"))
+			if err != nil {
+				logger.Error("Invalid value for argument --expiry, it needs to be a duration like 1h or 30m")
+				os.Exit(1)
+			}
+			entityPath, err := getAuthEntityPathFlag()
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			token, err := servicebuscli.GenerateSASToken(connection, entityPath, duration)
+			if err != nil {
+				logger.Error(err.Error())
+				os.Exit(1)
+			}
+			if output.IsStructured() {
+				writeOutput(servicebuscli.WriteSASToken(os.Stdout, output, token))
+			} else {
+				servicebuscli.PrintSASToken(token)
+			}
+			os.Exit(0)
+		default:
+			help.PrintAuthMainCommandHelper()
+			os.Exit(0)
+		}
+	case "plan", "diff":
+		if helpArg {
+			help.PrintPlanCommandHelper()
+			os.Exit(0)
+		}
+		filePath := getFileFlag()
+		fromNamespace := helper.GetFlagValue("from-namespace", "")
+		prune := helper.GetFlagSwitch("prune", false)
+		if filePath == "" && fromNamespace == "" {
+			logger.Error("Missing mandatory argument --file or --from-namespace")
+			help.PrintPlanCommandHelper()
+			os.Exit(0)
+		}
+		topology, err := getSourceTopology(filePath, fromNamespace)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		sbcli := servicebuscli.Get(connStr)
+		changes, err := sbcli.PlanTopology(topology, prune)
+		if err != nil {
+			os.Exit(1)
+		}
+		servicebuscli.PrintTopologyPlan(changes)
+		os.Exit(0)
+	case "apply":
+		if helpArg {
+			help.PrintApplyCommandHelper()
+			os.Exit(0)
+		}
+		filePath := getFileFlag()
+		fromNamespace := helper.GetFlagValue("from-namespace", "")
+		prune := helper.GetFlagSwitch("prune", false)
+		if filePath == "" && fromNamespace == "" {
+			logger.Error("Missing mandatory argument --file or --from-namespace")
+			help.PrintApplyCommandHelper()
+			os.Exit(0)
+		}
+		topology, err := getSourceTopology(filePath, fromNamespace)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		sbcli := servicebuscli.Get(connStr)
+		changes, err := sbcli.PlanTopology(topology, prune)
+		if err != nil {
+			os.Exit(1)
+		}
+		servicebuscli.PrintTopologyPlan(changes)
+		if len(changes) > 0 {
+			if err := sbcli.ApplyTopology(changes); err != nil {
+				os.Exit(1)
+			}
+		}
+		os.Exit(0)
+	case "export-namespace":
+		if helpArg {
+			help.PrintExportNamespaceCommandHelper()
+			os.Exit(0)
+		}
+		filePath := getFileFlag()
+		if filePath == "" && !output.IsStructured() {
+			logger.Error("Missing mandatory argument --file or --output")
+			help.PrintExportNamespaceCommandHelper()
+			os.Exit(0)
+		}
+
+		sbcli := servicebuscli.Get(connStr)
+		snapshot, err := sbcli.ExportNamespace()
+		if err != nil {
+			os.Exit(1)
+		}
+		if filePath == "" {
+			writeOutput(servicebuscli.WriteNamespaceSnapshot(os.Stdout, output, snapshot))
+			os.Exit(0)
+		}
+		if err := servicebuscli.SaveNamespaceSnapshot(filePath, snapshot); err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		logger.LogHighlight("Namespace snapshot was saved to %v", log.Info, filePath)
+		os.Exit(0)
+	case "restore-namespace":
+		if helpArg {
+			help.PrintRestoreNamespaceCommandHelper()
+			os.Exit(0)
+		}
+		filePath := getFileFlag()
+		fromNamespace := helper.GetFlagValue("from-namespace", "")
+		dryRun := helper.GetFlagSwitch("dry-run", false)
+		if filePath == "" && fromNamespace == "" {
+			logger.Error("Missing mandatory argument --file or --from-namespace")
+			help.PrintRestoreNamespaceCommandHelper()
+			os.Exit(0)
+		}
+		snapshot, err := getSourceSnapshot(filePath, fromNamespace)
+		if err != nil {
+			os.Exit(1)
+		}
+
+		sbcli := servicebuscli.Get(connStr)
+		if err := sbcli.RestoreNamespace(snapshot, dryRun); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "graph":
+		if helpArg {
+			help.PrintGraphCommandHelper()
+			os.Exit(0)
+		}
+		format, err := servicebuscli.ParseGraphFormat(helper.GetFlagValue("format", ""))
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		topology, err := getTopologyFlag(connStr)
+		if err != nil {
+			os.Exit(1)
+		}
+		writeOutput(servicebuscli.WriteTopologyGraph(os.Stdout, format, topology))
+		os.Exit(0)
+	case "lint":
+		if helpArg {
+			help.PrintLintCommandHelper()
+			os.Exit(0)
+		}
+		topology, err := getTopologyFlag(connStr)
+		if err != nil {
+			os.Exit(1)
+		}
+		issues := servicebuscli.LintTopology(topology)
+		if output.IsStructured() {
+			writeOutput(servicebuscli.WriteLintIssues(os.Stdout, output, issues))
+		} else {
+			servicebuscli.PrintLintIssues(issues)
+		}
+		if servicebuscli.HasLintErrors(issues) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "move", "copy":
+		if helpArg {
+			help.PrintTransferCommandHelper(module)
+			os.Exit(0)
+		}
+		fromFlag := helper.GetFlagValue("from", "")
+		toFlag := helper.GetFlagValue("to", "")
+		if fromFlag == "" || toFlag == "" {
+			logger.Error("Missing mandatory arguments --from and --to")
+			help.PrintTransferCommandHelper(module)
+			os.Exit(0)
+		}
+		from, err := servicebuscli.ParseMessageSource(fromFlag)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		to, err := servicebuscli.ParseMessageDestination(toFlag)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		options, err := getTransferFlags()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		options.Copy = module == "copy"
+		if toNamespace := helper.GetFlagValue("to-namespace", ""); toNamespace != "" {
+			options.Target = connectNamespace(toNamespace)
+		}
+
+		sbcli := servicebuscli.Get(connStr)
+		if _, err := sbcli.TransferMessages(from, to, options); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "probe":
+		if helpArg {
+			help.PrintProbeCommandHelper()
+			os.Exit(0)
+		}
+		topic := helper.GetFlagValue("topic", "")
+		queue := helper.GetFlagValue("queue", "")
+		if (topic == "") == (queue == "") {
+			logger.Error("Please choose one of the --topic or --queue mandatory arguments")
+			help.PrintProbeCommandHelper()
+			os.Exit(0)
+		}
+		from := servicebuscli.ForwardEntity{To: queue, In: servicebuscli.ForwardToQueue}
+		if topic != "" {
+			from = servicebuscli.ForwardEntity{To: topic, In: servicebuscli.ForwardToTopic}
+		}
+
+		replyQueue := helper.GetFlagValue("reply-queue", "")
+		replySubscription := helper.GetFlagValue("reply-subscription", "")
+		replyTopic := helper.GetFlagValue("reply-topic", topic)
+		receivePath := replyQueue
+		switch {
+		case replyQueue != "" && replySubscription != "":
+			logger.Error("Please choose only one of --reply-queue or --reply-subscription")
+			os.Exit(1)
+		case replySubscription != "":
+			if replyTopic == "" {
+				logger.Error("Missing topic of the reply subscription argument --reply-topic")
+				help.PrintProbeCommandHelper()
+				os.Exit(0)
+			}
+			receivePath = servicebuscli.SubscriptionEntityPath(replyTopic, replySubscription)
+		case replyQueue == "" && queue != "":
+			receivePath = queue
+		case replyQueue == "":
+			logger.Error("Missing reply mandatory argument --reply-queue or --reply-subscription")
+			help.PrintProbeCommandHelper()
+			os.Exit(0)
+		}
+
+		options, err := getProbeFlags()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		sbcli := servicebuscli.Get(connStr)
+		result, err := sbcli.Probe(from, receivePath, options)
+		if err != nil {
+			os.Exit(1)
+		}
+		summary := result.Summary(from.To, receivePath)
+		if output.IsStructured() {
+			writeOutput(servicebuscli.WriteProbeSummary(os.Stdout, output, summary))
+		} else {
+			servicebuscli.PrintProbeSummary(summary)
+		}
+		if summary.Lost > 0 {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	case "top":
+		if helpArg {
+			help.PrintTopCommandHelper()
+			os.Exit(0)
+		}
+		options, err := getTopFlags()
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+		options.Clear = !output.IsStructured() && isTerminal(os.Stdout)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		signalChan := make(chan os.Signal, 1)
+		signal.Notify(signalChan, os.Interrupt, os.Kill)
+		go func() {
+			<-signalChan
+			cancel()
+		}()
+
+		sbcli := servicebuscli.Get(connStr)
+		if err := sbcli.Top(ctx, os.Stdout, output, options); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	default:
+
+		help.PrintMainCommandHelper()
+	}
+	if helpArg {
+		help.PrintMainCommandHelper()
+		os.Exit(0)
+	}
+}
+
+// getSequenceNumberFlags gets the sequence numbers of every --sequence flag, both the --sequence=10
+// and the --sequence 10 forms, it fails if the flag is set without a number so a typo never
+// selects every message
+func getSequenceNumberFlags() ([]int64, error) {
+	sequenceNumbers := make([]int64, 0)
+	for _, value := range getArgumentValues("--sequence") {
+		if value == "" {
+			return nil, errors.New("Missing value for argument --sequence, it needs to be a number")
+		}
+
+		sequenceNumber, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid sequence number " + value + ", it needs to be a number")
+		}
+		sequenceNumbers = append(sequenceNumbers, sequenceNumber)
+	}
+
+	return sequenceNumbers, nil
+}
+
+// getScheduledTimeFlags gets the time a message needs to be enqueued at from the --schedule-at
+// or the --delay flags, returns nil if the message is not scheduled
+func getScheduledTimeFlags() (*time.Time, error) {
+	scheduleAt := helper.GetFlagValue("schedule-at", "")
+	delay := helper.GetFlagValue("delay", "")
+	if scheduleAt != "" && delay != "" {
+		return nil, errors.New("Please choose only one of --schedule-at or --delay")
+	}
+
+	if scheduleAt != "" {
+		scheduledTime, err := time.Parse(time.RFC3339, scheduleAt)
+		if err != nil {
+			return nil, errors.New("Invalid value for argument --schedule-at, it needs to be a RFC3339 date like 2021-01-01T10:00:00Z")
+		}
+		return &scheduledTime, nil
+	}
+	if delay != "" {
+		duration, err := time.ParseDuration(delay)
+		if err != nil || duration <= 0 {
+			return nil, errors.New("Invalid value for argument --delay, it needs to be a positive duration like 30s or 5m")
+		}
+		scheduledTime := time.Now().Add(duration)
+		return &scheduledTime, nil
+	}
+
+	return nil, nil
+}
+
+// getBatchSendFlags gets the rate, count, concurrency and batch size flags used to send a file
+func getBatchSendFlags() (servicebuscli.BatchSendOptions, error) {
+	options := servicebuscli.BatchSendOptions{}
+	if value := helper.GetFlagValue("rate", ""); value != "" {
+		rate, err := strconv.ParseFloat(value, 64)
+		if err != nil || rate <= 0 {
+			return options, errors.New("Invalid value for argument --rate, it needs to be a positive number")
+		}
+		options.Rate = rate
+	}
+
+	numbers := map[string]*int{
+		"count":       &options.Count,
+		"concurrency": &options.Concurrency,
+		"batch-size":  &options.BatchSize,
+	}
+	for name, target := range numbers {
+		if value := helper.GetFlagValue(name, ""); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number <= 0 {
+				return options, errors.New("Invalid value for argument --" + name + ", it needs to be a positive number")
+			}
+			*target = number
+		}
+	}
+
+	return options, nil
+}
+
+// subscribeFlags holds the filter, limits and consumer of a subscription
+type subscribeFlags struct {
+	Filter         *servicebuscli.SQLFilter
+	MaxMessages    int
+	Timeout        time.Duration
+	Consumer       servicebuscli.MessageConsumer
+	FailureAction  servicebuscli.ConsumerFailureAction
+	Settle         servicebuscli.SettleMode
+	Concurrency    int
+	PrefetchCount  int
+	AutoRenewLock  bool
+	MaxLockRenewal time.Duration
+}
+
+// apply sets the subscribe flags on the service bus cli
+func (f subscribeFlags) apply(sbcli *servicebuscli.ServiceBusCli) {
+	sbcli.Filter = f.Filter
+	sbcli.MaxMessages = f.MaxMessages
+	sbcli.Timeout = f.Timeout
+	sbcli.Consumer = f.Consumer
+	sbcli.ConsumerFailureAction = f.FailureAction
+	sbcli.Settle = f.Settle
+	sbcli.Concurrency = f.Concurrency
+	sbcli.PrefetchCount = f.PrefetchCount
+	sbcli.AutoRenewLock = f.AutoRenewLock
+	if f.MaxLockRenewal > 0 {
+		sbcli.MaxLockRenewal = f.MaxLockRenewal
+	}
+}
+
+// getSubscribeFlags gets the where, max messages, timeout, follow, exec, forward http, on failure, settle
+// and listener flags of the subscribe commands, --follow=false stops the subscription after the first
+// matching message and --peek is the same as --settle=none, --where needs --peek unless the messages
+// come from a wiretap subscription
+func getSubscribeFlags(wiretap bool) (subscribeFlags, error) {
+	flags := subscribeFlags{
+		Concurrency: 1,
+	}
+	if where := helper.GetFlagValue("where", ""); where != "" {
+		filter, err := servicebuscli.ParseMessageFilter(where)
+		if err != nil {
+			return flags, errors.New("Invalid value for argument --where, " + err.Error())
+		}
+		flags.Filter = filter
+	}
+
+	if value := helper.GetFlagValue("max-messages", ""); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number <= 0 {
+			return flags, errors.New("Invalid value for argument --max-messages, it needs to be a positive number")
+		}
+		flags.MaxMessages = number
+	}
+
+	if value := helper.GetFlagValue("timeout", ""); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return flags, errors.New("Invalid value for argument --timeout, it needs to be a positive duration like 30s or 5m")
+		}
+		flags.Timeout = duration
+	}
+
+	if values := helper.GetFlagArrayValue("follow"); len(values) > 0 {
+		follow, err := strconv.ParseBool(values[len(values)-1])
+		if err != nil {
+			return flags, errors.New("Invalid value for argument --follow, it needs to be true or false")
+		}
+		if !follow && flags.MaxMessages == 0 {
+			flags.MaxMessages = 1
+		}
+	}
+
+	command := helper.GetFlagValue("exec", "")
+	url := helper.GetFlagValue("forward-http", "")
+	switch {
+	case command != "" && url != "":
+		return flags, errors.New("Please choose only one of --exec or --forward-http")
+	case command != "":
+		flags.Consumer = servicebuscli.NewExecConsumer(command)
+	case url != "":
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return flags, errors.New("Invalid value for argument --forward-http, it needs to be a http or https url")
+		}
+		flags.Consumer = servicebuscli.NewHTTPConsumer(url)
+	}
+
+	action, err := servicebuscli.ParseConsumerFailureAction(helper.GetFlagValue("on-failure", ""))
+	if err != nil {
+		return flags, errors.New("Invalid value for argument --on-failure, it needs to be abandon or deadletter")
+	}
+	flags.FailureAction = action
+
+	settle, err := servicebuscli.ParseSettleMode(helper.GetFlagValue("settle", ""))
+	if err != nil {
+		return flags, errors.New("Invalid value for argument --settle, it needs to be complete, abandon, deadletter, defer or none")
+	}
+	if helper.GetFlagSwitch("peek", false) {
+		if helper.GetFlagValue("settle", "") != "" && settle != servicebuscli.SettleNone {
+			return flags, errors.New("Please choose only one of --peek or --settle")
+		}
+		settle = servicebuscli.SettleNone
+	}
+	flags.Settle = settle
+	if flags.Filter != nil && settle != servicebuscli.SettleNone && !wiretap {
+		return flags, errors.New("Please add --peek to --where, the messages that do not match would otherwise stay locked and be delivered again")
+	}
+
+	numbers := map[string]*int{
+		"concurrency": &flags.Concurrency,
+		"prefetch":    &flags.PrefetchCount,
+	}
+	for name, target := range numbers {
+		if value := helper.GetFlagValue(name, ""); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number <= 0 {
+				return flags, errors.New("Invalid value for argument --" + name + ", it needs to be a positive number")
+			}
+			*target = number
+		}
+	}
+
+	flags.AutoRenewLock = helper.GetFlagSwitch("auto-renew-lock", false)
+	if value := helper.GetFlagValue("max-lock-renewal", ""); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return flags, errors.New("Invalid value for argument --max-lock-renewal, it needs to be a positive duration like 5m or 1h")
+		}
+		flags.MaxLockRenewal = duration
+		flags.AutoRenewLock = true
+	}
+
+	return flags, nil
+}
+
+// isOfflineCommand checks if the command can run without a connection to the service bus, the rule
+// tester and the graph and lint commands of a topology file do not need one
+func isOfflineCommand(module string) bool {
+	switch module {
+	case "topic":
+		return strings.EqualFold(GetCommandArgument(), "test-rule")
+	case "graph", "lint":
+		return getFileFlag() != ""
+	}
+
+	return false
+}
+
+// getTopologyFlag loads the topology file of the --file flag, or reads the topology of the namespace
+// when it is not set
+func getTopologyFlag(connStr string) (*servicebuscli.TopologyEntity, error) {
+	if filePath := getFileFlag(); filePath != "" {
+		topology, err := servicebuscli.LoadTopology(filePath)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+		return topology, err
+	}
+
+	return servicebuscli.Get(connStr).ReadTopology()
+}
+
+// getSourceTopology loads the topology file, or reads the topology of another namespace of the
+// connections file so it can be copied to the current one
+func getSourceTopology(filePath string, namespaceName string) (*servicebuscli.TopologyEntity, error) {
+	if filePath != "" && namespaceName != "" {
+		err := errors.New("Use either --file or --from-namespace")
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	if namespaceName != "" {
+		return connectNamespace(namespaceName).ReadTopology()
+	}
+
+	topology, err := servicebuscli.LoadTopology(filePath)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return topology, err
+}
+
+// getSourceSnapshot loads the namespace snapshot file, or exports another namespace of the connections
+// file so it can be cloned into the current one
+func getSourceSnapshot(filePath string, namespaceName string) (*servicebuscli.NamespaceSnapshot, error) {
+	if filePath != "" && namespaceName != "" {
+		err := errors.New("Use either --file or --from-namespace")
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	if namespaceName != "" {
+		return connectNamespace(namespaceName).ExportNamespace()
+	}
+
+	snapshot, err := servicebuscli.LoadNamespaceSnapshot(filePath)
+	if err != nil {
+		logger.Error(err.Error())
+	}
+	return snapshot, err
+}
+
+// getPurgeFlags gets the age, filter and parallelism flags of the purge commands
+func getPurgeFlags() (servicebuscli.PurgeOptions, error) {
+	options := servicebuscli.PurgeOptions{}
+	before := helper.GetFlagValue("before", "")
+	olderThan := helper.GetFlagValue("older-than", "")
+	if before != "" && olderThan != "" {
+		return options, errors.New("Please choose only one of --before or --older-than")
+	}
+	if before != "" {
+		beforeTime, err := time.Parse(time.RFC3339, before)
+		if err != nil {
+			return options, errors.New("Invalid value for argument --before, it needs to be a RFC3339 date like 2021-01-01T10:00:00Z")
+		}
+		options.Before = beforeTime
+	}
+	if olderThan != "" {
+		duration, err := time.ParseDuration(olderThan)
+		if err != nil || duration <= 0 {
+			return options, errors.New("Invalid value for argument --older-than, it needs to be a positive duration like 30m or 24h")
+		}
+		options.Before = time.Now().Add(-duration)
+	}
+
+	if filter := helper.GetFlagValue("filter", ""); filter != "" {
+		messageFilter, err := servicebuscli.ParseMessageFilter(filter)
+		if err != nil {
+			return options, errors.New("Invalid value for argument --filter, " + err.Error())
+		}
+		options.Filter = messageFilter
+	}
+
+	numbers := map[string]*int{
+		"parallel":   &options.Parallelism,
+		"batch-size": &options.BatchSize,
+	}
+	for name, target := range numbers {
+		if value := helper.GetFlagValue(name, ""); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number <= 0 {
+				return options, errors.New("Invalid value for argument --" + name + ", it needs to be a positive number")
+			}
+			*target = number
+		}
+	}
+
+	return options, nil
+}
+
+// getTransferFlags gets the filter, limit and rewrites of the move and copy commands
+func getTransferFlags() (servicebuscli.TransferOptions, error) {
+	options := servicebuscli.TransferOptions{
+		DryRun:           helper.GetFlagSwitch("dry-run", false),
+		Label:            helper.GetFlagValue("label", ""),
+		RemoveProperties: helper.GetFlagArrayValue("unset"),
+		KeepMessageID:    helper.GetFlagSwitch("keep-message-id", false),
+	}
+	if filter := helper.GetFlagValue("filter", ""); filter != "" {
+		messageFilter, err := servicebuscli.ParseMessageFilter(filter)
+		if err != nil {
+			return options, errors.New("Invalid value for argument --filter, " + err.Error())
+		}
+		options.Filter = messageFilter
+	}
+
+	if value := helper.GetFlagValue("limit", ""); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number <= 0 {
+			return options, errors.New("Invalid value for argument --limit, it needs to be a positive number")
+		}
+		options.Limit = number
+	}
+
+	for _, property := range helper.GetFlagArrayValue("set") {
+		key, value := helper.MapFlagValue(property)
+		if key == "" {
+			return options, errors.New("Invalid value for argument --set, it needs to be like key:value")
+		}
+		if options.SetProperties == nil {
+			options.SetProperties = make(map[string]interface{})
+		}
+		options.SetProperties[key] = value
+	}
+
+	return options, nil
+}
+
+// getProbeFlags gets the iterations, timeout, interval and label flags of the probe command
+func getProbeFlags() (servicebuscli.ProbeOptions, error) {
+	options := servicebuscli.ProbeOptions{
+		Iterations: 10,
+		Timeout:    30 * time.Second,
+		Label:      helper.GetFlagValue("label", ""),
+		Force:      helper.GetFlagSwitch("force", false),
+	}
+	if value := helper.GetFlagValue("iterations", ""); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number <= 0 {
+			return options, errors.New("Invalid value for argument --iterations, it needs to be a positive number")
+		}
+		options.Iterations = number
+	}
+
+	durations := map[string]*time.Duration{
+		"timeout":  &options.Timeout,
+		"interval": &options.Interval,
+	}
+	for name, target := range durations {
+		if value := helper.GetFlagValue(name, ""); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration <= 0 {
+				return options, errors.New("Invalid value for argument --" + name + ", it needs to be a positive duration like 30s or 5m")
+			}
+			*target = duration
+		}
+	}
+
+	return options, nil
+}
+
+// getTopFlags gets the interval, sort, limit, iterations and topic flags of the top command
+func getTopFlags() (servicebuscli.TopOptions, error) {
+	options := servicebuscli.TopOptions{
+		Interval: 5 * time.Second,
+		Topic:    helper.GetFlagValue("topic", ""),
+	}
+	sortBy, err := servicebuscli.ParseTopSort(helper.GetFlagValue("sort", ""))
+	if err != nil {
+		return options, err
+	}
+	options.Sort = sortBy
+
+	if value := helper.GetFlagValue("interval", ""); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < time.Second {
+			return options, errors.New("Invalid value for argument --interval, it needs to be a duration of at least 1s like 5s or 1m")
+		}
+		options.Interval = duration
+	}
+
+	numbers := map[string]*int{
+		"limit":      &options.Limit,
+		"iterations": &options.Iterations,
+	}
+	for name, target := range numbers {
+		if value := helper.GetFlagValue(name, ""); value != "" {
+			number, err := strconv.Atoi(value)
+			if err != nil || number <= 0 {
+				return options, errors.New("Invalid value for argument --" + name + ", it needs to be a positive number")
+			}
+			*target = number
+		}
+	}
+
+	return options, nil
+}
+
+// isTerminal checks if the file is a terminal, the top command only redraws its table in place on one
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// waitGroupDone returns a channel that is closed when the wait group is done
+func waitGroupDone(wg *sync.WaitGroup) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+// entityPropertyFlags holds the entity properties set with flags, the ones that are not set are zero
+type entityPropertyFlags struct {
+	LockDuration             time.Duration
+	DefaultMessageTimeToLive time.Duration
+	AutoDeleteOnIdle         time.Duration
+	DuplicateDetectionWindow time.Duration
+	MaxDeliveryCount         int32
+	MaxSizeInMegabytes       int32
+}
+
+// getEntityPropertyFlags gets the lock duration, message time to live, auto delete on idle, duplicate
+// detection window, max delivery count and max size flags of a queue, topic or subscription
+func getEntityPropertyFlags() (entityPropertyFlags, error) {
+	properties := entityPropertyFlags{}
+	durations := map[string]*time.Duration{
+		"lock-duration":              &properties.LockDuration,
+		"message-ttl":                &properties.DefaultMessageTimeToLive,
+		"auto-delete-on-idle":        &properties.AutoDeleteOnIdle,
+		"duplicate-detection-window": &properties.DuplicateDetectionWindow,
+	}
+	for name, target := range durations {
+		if value := helper.GetFlagValue(name, ""); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration <= 0 {
+				return properties, errors.New("Invalid value for argument --" + name + ", it needs to be a positive duration like 30s or 5m")
+			}
+			*target = duration
+		}
+	}
+
+	numbers := map[string]*int32{
+		"max-delivery-count": &properties.MaxDeliveryCount,
+		"max-size":           &properties.MaxSizeInMegabytes,
+	}
+	for name, target := range numbers {
+		if value := helper.GetFlagValue(name, ""); value != "" {
+			number, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || number <= 0 {
+				return properties, errors.New("Invalid value for argument --" + name + ", it needs to be a positive number")
+			}
+			*target = int32(number)
+		}
+	}
+
+	return properties, nil
+}
+
+// getCorrelationFilterFlags gets the correlation filter from the message property flags, returns nil
+// if none of them is set
+func getCorrelationFilterFlags() *servicebuscli.CorrelationFilterEntity {
+	filter := servicebuscli.CorrelationFilterEntity{
+		CorrelationID:    helper.GetFlagValue("correlation-id", ""),
+		MessageID:        helper.GetFlagValue("message-id", ""),
+		To:               helper.GetFlagValue("to", ""),
+		ReplyTo:          helper.GetFlagValue("reply-to", ""),
+		Label:            helper.GetFlagValue("label", ""),
+		SessionID:        helper.GetFlagValue("session-id", ""),
+		ReplyToSessionID: helper.GetFlagValue("reply-to-session-id", ""),
+		ContentType:      helper.GetFlagValue("content-type", ""),
+	}
+	for _, property := range helper.GetFlagArrayValue("property") {
+		key, value := helper.MapFlagValue(property)
+		if key != "" {
+			filter.SetProperty(key, value)
+		}
+	}
+
+	if filter.IsEmpty() {
+		return nil
+	}
+
+	return &filter
+}
+
+func printScheduledMessages(messages []*servicebus.Message, output servicebuscli.OutputFormat) {
+	if output.IsStructured() {
+		writeMessageOutput(messages, output)
+		return
+	}
+
+	for _, message := range messages {
+		servicebuscli.PrintScheduledMessage(message)
+	}
+
+	if len(messages) == 0 {
+		logger.Info("No scheduled messages found")
+	}
+}
+
+func printDeadLetterMessages(messages []*servicebus.Message, sequenceNumbers []int64, output servicebuscli.OutputFormat) {
+	filteredMessages := make([]*servicebus.Message, 0)
+	for _, message := range messages {
+		if len(sequenceNumbers) > 0 {
+			found := false
+			for _, sequenceNumber := range sequenceNumbers {
+				if message.SystemProperties != nil && message.SystemProperties.SequenceNumber != nil && *message.SystemProperties.SequenceNumber == sequenceNumber {
+					found = true
+					break
+				}
+			}
+			if !found {
+				continue
+			}
+		}
+		filteredMessages = append(filteredMessages, message)
+	}
+
+	if output.IsStructured() {
+		writeMessageOutput(filteredMessages, output)
+		return
+	}
+
+	for _, message := range filteredMessages {
+		servicebuscli.PrintDeadLetterMessage(message)
+	}
+
+	if len(filteredMessages) == 0 {
+		logger.Info("No dead letters found")
+	}
+}
+
+func writeMessageOutput(messages []*servicebus.Message, output servicebuscli.OutputFormat) {
+	summaries := make([]servicebuscli.MessageSummary, 0, len(messages))
+	for _, message := range messages {
+		summaries = append(summaries, servicebuscli.NewMessageSummary(message))
+	}
+	writeOutput(servicebuscli.WriteMessageSummaries(os.Stdout, output, summaries))
+}
+
+// getMessageBodyFlags gets the message body of the --body or --body-file flags encoded using the
+// --content-type, --raw and --base64 flags, the body is nil if none of them was set, the content type
+// defaults to the one of the envelope profile
+func getMessageBodyFlags(defaultContentType string) ([]byte, string, error) {
+	body := helper.GetFlagValue("body", "")
+	bodyFile := helper.GetFlagValue("body-file", "")
+	options := servicebuscli.MessageBodyOptions{
+		ContentType: helper.GetFlagValue("content-type", defaultContentType),
+		Raw:         helper.GetFlagSwitch("raw", false),
+		Base64:      helper.GetFlagSwitch("base64", false),
+	}
+
+	var content []byte
+	switch {
+	case body != "" && bodyFile != "":
+		return nil, "", errors.New("Please choose only one of --body or --body-file")
+	case bodyFile != "":
+		fileContent, err := servicebuscli.ReadMessageBody(bodyFile)
+		if err != nil {
+			return nil, "", err
+		}
+		content = fileContent
+	case body != "":
+		content = []byte(body)
+	default:
+		return nil, options.ContentType, nil
+	}
+
+	data, err := servicebuscli.EncodeMessageBody(content, options)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, options.ContentType, nil
+}
+
+// getEnvelopeFlags gets the envelope of a sent message using the profile of the --profile flag, the
+// profile variables are set with --var or with a flag of the same name, without a profile the
+// forwarding profile is used when the message domain and name are set, no envelope is used when
+// only properties are set and the uno profile is used otherwise
+func getEnvelopeFlags(entityName string, defaultSample bool) (servicebuscli.Envelope, error) {
+	profiles, err := servicebuscli.LoadEnvelopeProfiles(helper.GetFlagValue("profiles", os.Getenv("SERVICEBUS_PROFILES")))
+	if err != nil {
+		return servicebuscli.Envelope{}, err
+	}
+
+	variables := make(map[string]string)
+	for _, variable := range helper.GetFlagArrayValue("var") {
+		parts := strings.SplitN(variable, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return servicebuscli.Envelope{}, errors.New("Invalid value for argument --var, the format is [name]:[value]")
+		}
+		variables[parts[0]] = parts[1]
+	}
+
+	profileName := helper.GetFlagValue("profile", "")
+	if profileName == "" {
+		switch {
+		case defaultSample && helper.GetFlagSwitch("uno", false):
+			profileName = servicebuscli.UnoProfileName
+		case defaultSample:
+			profileName = servicebuscli.ForwardingProfileName
+			variables["domain"] = "TimeService"
+			variables["name"] = "TimePassed"
+		case len(helper.GetFlagArrayValue("property")) > 0 && !helper.GetFlagSwitch("default", false):
+			profileName = servicebuscli.NoneProfileName
+		case helper.GetFlagValue("domain", "") != "" && helper.GetFlagValue("name", "") != "":
+			profileName = servicebuscli.ForwardingProfileName
+		default:
+			profileName = servicebuscli.UnoProfileName
+		}
+	}
+
+	profile, err := servicebuscli.FindEnvelopeProfile(profiles, profileName)
+	if err != nil {
+		return servicebuscli.Envelope{}, err
+	}
+	for _, name := range profile.VariableNames() {
+		if _, ok := variables[name]; !ok {
+			variables[name] = helper.GetFlagValue(name, "")
+		}
+	}
+
+	envelope, err := profile.Apply(entityName, variables)
+	if err != nil {
+		return envelope, err
+	}
+	if label := helper.GetFlagValue("label", ""); label != "" {
+		envelope.Label = label
+	}
+	if envelope.Label == "" {
+		envelope.Label = "ServiceBus.Tools"
+	}
+
+	return envelope, nil
+}
+
+// writeOutput exits with an error if a structured output could not be written
+func writeOutput(err error) {
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// getFileFlag gets the path of the topology or snapshot file from the --file flag or its -f short form
+func getFileFlag() string {
+	return getFlagValueWithShortForm("file", "f")
+}
+
+// getOutputFormatFlag gets the output format from the --output flag or its -o short form
+func getOutputFormatFlag() (servicebuscli.OutputFormat, error) {
+	return servicebuscli.ParseOutputFormat(getFlagValueWithShortForm("output", "o"))
+}
+
+// getFlagValueWithShortForm gets the value of a flag that also has a single letter short form like
+// -o, the short form wins when both are set
+func getFlagValueWithShortForm(name string, short string) string {
+	value := helper.GetFlagValue(name, "")
+	if values := getArgumentValues("-" + short); len(values) > 0 && values[len(values)-1] != "" {
+		value = values[len(values)-1]
+	}
+
+	return value
+}
+
+// getArgumentValues gets the value of every occurrence of an argument like --sequence or -o, in both
+// the -o=json and the -o json forms, the value is empty when the argument is followed by another flag
+// or by nothing, a single - is kept as a value as it stands for the standard input
+func getArgumentValues(argument string) []string {
+	values := make([]string, 0)
+	args := os.Args
+	for i, arg := range args {
+		if arg == argument {
+			value := ""
+			if i+1 < len(args) && (args[i+1] == "-" || !strings.HasPrefix(args[i+1], "-")) {
+				value = args[i+1]
+			}
+			values = append(values, value)
+		} else if strings.HasPrefix(arg, argument+"=") {
+			values = append(values, strings.Trim(strings.TrimPrefix(arg, argument+"="), "\"'"))
+		}
+	}
+
+	return values
+}
+
+func serviceBusCliModuleCommandHelper() {
+	fmt.Println("Please choose a sub command:")
+	fmt.Println()
+	fmt.Println("Usage:")
+	fmt.Println("  DeploymentTools servicebus [subcommand]")
+	fmt.Println()
+	fmt.Println("Available Commands:")
 	fmt.Println("  topic         Installs Istio in a Kubernetes cluster")
 	fmt.Println("  queue          Removes Istio from a Kubernetes cluster")
 }
@@ -571,3 +2508,152 @@ func serviceBusCliModuleTopicCommandHelper() {
 	fmt.Println("  send         Installs Istio in a Kubernetes cluster")
 	fmt.Println("  listen          Removes Istio from a Kubernetes cluster")
 }
+
+// useNamespace Sets the service bus cli to use the namespace of the --namespace flag, or of the current
+// context when it is not set and there is no SERVICEBUS_CONNECTION_STRING, it returns false when none
+// of them is set
+func useNamespace(connStr string) bool {
+	name := helper.GetFlagValue("namespace", os.Getenv("SERVICEBUS_NAMESPACE"))
+	if name == "" && connStr != "" {
+		return false
+	}
+
+	connections, err := servicebuscli.LoadConnections(servicebuscli.DefaultConnectionsPath())
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	var namespace servicebuscli.NamespaceConnection
+	if name == "" {
+		var ok bool
+		namespace, ok, err = connections.Current()
+		if !ok && err == nil {
+			return false
+		}
+	} else {
+		namespace, err = connections.Get(name)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if _, err := servicebuscli.UseNamespace(namespace); err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	logger.LogHighlight("Using namespace %v", log.Info, namespace.Name)
+	return true
+}
+
+// useEndpoint Sets the service bus cli to use the namespace of the --endpoint flag, authenticated with
+// the shared access signature of the --sas-token flag or with the azure client credential, it returns
+// false when the endpoint is not set
+func useEndpoint() bool {
+	endpoint := helper.GetFlagValue("endpoint", os.Getenv("SERVICEBUS_ENDPOINT"))
+	if endpoint == "" {
+		return false
+	}
+
+	servicebuscli.GetWithCredentials(servicebuscli.AzureCredentials{
+		Endpoint:     endpoint,
+		SASToken:     helper.GetFlagValue("sas-token", os.Getenv("SERVICEBUS_SAS_TOKEN")),
+		TenantID:     ctx.AzureClient.TenantID,
+		ClientID:     ctx.AzureClient.ClientID,
+		ClientSecret: ctx.AzureClient.ClientSecret,
+	})
+
+	logger.LogHighlight("Using endpoint %v", log.Info, endpoint)
+	return true
+}
+
+// getAuthConnectionString gets the connection string of the --connection-string flag, the environment or
+// the namespace of the connections file, in this order
+func getAuthConnectionString(connStr string) (servicebuscli.ConnectionStringEntity, error) {
+	value := helper.GetFlagValue("connection-string", connStr)
+	if value == "" {
+		connections, err := servicebuscli.LoadConnections(servicebuscli.DefaultConnectionsPath())
+		if err != nil {
+			return servicebuscli.ConnectionStringEntity{}, err
+		}
+
+		var namespace servicebuscli.NamespaceConnection
+		if name := helper.GetFlagValue("namespace", os.Getenv("SERVICEBUS_NAMESPACE")); name != "" {
+			namespace, err = connections.Get(name)
+		} else {
+			namespace, _, err = connections.Current()
+		}
+		if err != nil {
+			return servicebuscli.ConnectionStringEntity{}, err
+		}
+		value = namespace.ConnectionString
+	}
+	if value == "" {
+		return servicebuscli.ConnectionStringEntity{}, errors.New("Missing the connection string, use the --connection-string argument, SERVICEBUS_CONNECTION_STRING or a namespace of the connections file")
+	}
+
+	return servicebuscli.ParseConnectionString(value)
+}
+
+// getAuthEntityPathFlag gets the entity the shared access signature is scoped to from the --queue, --topic
+// and --subscription flags, it is empty for the whole namespace
+func getAuthEntityPathFlag() (string, error) {
+	queue := helper.GetFlagValue("queue", "")
+	topic := helper.GetFlagValue("topic", "")
+	subscription := helper.GetFlagValue("subscription", "")
+	switch {
+	case queue != "" && (topic != "" || subscription != ""):
+		return "", errors.New("Use either --queue or --topic")
+	case subscription != "" && topic == "":
+		return "", errors.New("Missing the topic of the subscription, use the --topic argument")
+	case subscription != "":
+		return servicebuscli.SubscriptionEntityPath(topic, subscription), nil
+	case topic != "":
+		return topic, nil
+	}
+
+	return queue, nil
+}
+
+// connectNamespace Connects to a namespace of the connections file for the commands working with two
+// namespaces, it does not change the one used by the other commands
+func connectNamespace(name string) *servicebuscli.ServiceBusCli {
+	connections, err := servicebuscli.LoadConnections(servicebuscli.DefaultConnectionsPath())
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+	namespace, err := connections.Get(name)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	sbcli, err := namespace.Connect()
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	return sbcli
+}
+
+// useMemoryBroker Sets the service bus cli to use the in memory broker, its state is kept in a
+// local file so separate commands share the same entities and messages
+func useMemoryBroker() {
+	statePath := helper.GetFlagValue("state", os.Getenv("SERVICEBUS_MEMORY_STATE"))
+	if statePath == "" {
+		statePath = filepath.Join(os.TempDir(), "servicebus-memory-state.json")
+	}
+
+	broker, err := servicebuscli.NewMemoryBroker(statePath)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	logger.LogHighlight("Using the in memory service bus broker with state file %v", log.Info, statePath)
+	servicebuscli.UseBroker(broker)
+}
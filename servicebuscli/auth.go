@@ -0,0 +1,330 @@
+package servicebuscli
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/v3/aad"
+	"github.com/Azure/azure-amqp-common-go/v3/auth"
+	"github.com/Azure/azure-amqp-common-go/v3/sas"
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/cjlapao/common-go/log"
+)
+
+// Connection string keys
+const (
+	endpointKey              = "Endpoint"
+	sharedAccessKeyNameKey   = "SharedAccessKeyName"
+	sharedAccessKeyKey       = "SharedAccessKey"
+	sharedAccessSignatureKey = "SharedAccessSignature"
+	entityPathKey            = "EntityPath"
+)
+
+// ConnectionStringEntity structure, the parts of a service bus connection string, it is authenticated
+// with a shared access key or with a shared access signature
+type ConnectionStringEntity struct {
+	Endpoint              string
+	Host                  string
+	Namespace             string
+	SharedAccessKeyName   string
+	SharedAccessKey       string
+	SharedAccessSignature string
+	EntityPath            string
+}
+
+// ConnectionStringSummary structure, used to output a connection string without its secrets
+type ConnectionStringSummary struct {
+	Endpoint       string `json:"endpoint" yaml:"endpoint"`
+	Namespace      string `json:"namespace" yaml:"namespace"`
+	Authentication string `json:"authentication" yaml:"authentication"`
+	KeyName        string `json:"keyName,omitempty" yaml:"keyName,omitempty"`
+	EntityPath     string `json:"entityPath,omitempty" yaml:"entityPath,omitempty"`
+	ExpiresAt      string `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+}
+
+// SASToken structure, a shared access signature for a namespace or one of its entities
+type SASToken struct {
+	Resource         string    `json:"resource" yaml:"resource"`
+	KeyName          string    `json:"keyName" yaml:"keyName"`
+	ExpiresAt        time.Time `json:"expiresAt" yaml:"expiresAt"`
+	Token            string    `json:"token" yaml:"token"`
+	ConnectionString string    `json:"connectionString" yaml:"connectionString"`
+}
+
+// AzureCredentials structure, a namespace is authenticated with a connection string, or with the
+// endpoint and a shared access signature or an azure active directory client credential
+type AzureCredentials struct {
+	ConnectionString string
+	// Endpoint is the namespace host, like example.servicebus.windows.net, or its sb:// endpoint
+	Endpoint     string
+	SASToken     string
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+}
+
+// sasTokenProvider authenticates with a shared access signature generated beforehand, it cannot be
+// renewed so the commands fail once it expires
+type sasTokenProvider struct {
+	token  string
+	expiry string
+}
+
+var connectionStringSummaryColumns = []string{"endpoint", "namespace", "authentication", "keyName", "entityPath", "expiresAt"}
+var sasTokenColumns = []string{"resource", "keyName", "expiresAt", "token", "connectionString"}
+
+// ParseConnectionString Parses a service bus connection string, it needs an endpoint and either a shared
+// access key name and key or a shared access signature
+func ParseConnectionString(value string) (ConnectionStringEntity, error) {
+	var result ConnectionStringEntity
+	for _, part := range strings.Split(strings.TrimSpace(value), ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return result, errors.New("Invalid connection string, " + strings.TrimSpace(pair[0]) + " has no value")
+		}
+
+		key := strings.TrimSpace(pair[0])
+		switch {
+		case strings.EqualFold(key, endpointKey):
+			result.Endpoint = strings.TrimSpace(pair[1])
+		case strings.EqualFold(key, sharedAccessKeyNameKey):
+			result.SharedAccessKeyName = pair[1]
+		case strings.EqualFold(key, sharedAccessKeyKey):
+			result.SharedAccessKey = pair[1]
+		case strings.EqualFold(key, sharedAccessSignatureKey):
+			result.SharedAccessSignature = pair[1]
+		case strings.EqualFold(key, entityPathKey):
+			result.EntityPath = pair[1]
+		}
+	}
+
+	if result.Endpoint == "" {
+		return result, errors.New("Invalid connection string, it has no " + endpointKey)
+	}
+	host, err := parseEndpointHost(result.Endpoint)
+	if err != nil {
+		return result, err
+	}
+	result.Host = host
+	result.Namespace = strings.Split(host, ".")[0]
+
+	if result.SharedAccessSignature == "" && (result.SharedAccessKeyName == "" || result.SharedAccessKey == "") {
+		return result, errors.New("Invalid connection string, it needs a " + sharedAccessKeyNameKey + " and " + sharedAccessKeyKey + " or a " + sharedAccessSignatureKey)
+	}
+
+	return result, nil
+}
+
+// String Gets the connection string
+func (c ConnectionStringEntity) String() string {
+	parts := []string{endpointKey + "=" + c.Endpoint}
+	if c.SharedAccessSignature != "" {
+		parts = append(parts, sharedAccessSignatureKey+"="+c.SharedAccessSignature)
+	} else {
+		parts = append(parts, sharedAccessKeyNameKey+"="+c.SharedAccessKeyName, sharedAccessKeyKey+"="+c.SharedAccessKey)
+	}
+	if c.EntityPath != "" {
+		parts = append(parts, entityPathKey+"="+c.EntityPath)
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Summary Gets the parts of the connection string without its secrets
+func (c ConnectionStringEntity) Summary() ConnectionStringSummary {
+	summary := ConnectionStringSummary{
+		Endpoint:       c.Endpoint,
+		Namespace:      c.Namespace,
+		Authentication: "key",
+		KeyName:        c.SharedAccessKeyName,
+		EntityPath:     c.EntityPath,
+	}
+	if c.SharedAccessSignature != "" {
+		summary.Authentication = "sas"
+		summary.KeyName = sasTokenParameter(c.SharedAccessSignature, "skn")
+		if expiresAt, err := sasTokenExpiry(c.SharedAccessSignature); err == nil {
+			summary.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+		}
+	}
+
+	return summary
+}
+
+// PrintConnectionStringSummary Prints the parts of a connection string
+func PrintConnectionStringSummary(summary ConnectionStringSummary) {
+	logger.LogHighlight("Endpoint: %v", log.Info, summary.Endpoint)
+	logger.LogHighlight("Namespace: %v", log.Info, summary.Namespace)
+	logger.LogHighlight("Authentication: %v", log.Info, summary.Authentication)
+	if summary.KeyName != "" {
+		logger.LogHighlight("Key name: %v", log.Info, summary.KeyName)
+	}
+	if summary.EntityPath != "" {
+		logger.LogHighlight("Entity path: %v", log.Info, summary.EntityPath)
+	}
+	if summary.ExpiresAt != "" {
+		logger.LogHighlight("Expires at: %v", log.Info, summary.ExpiresAt)
+	}
+}
+
+// WriteConnectionStringSummary Writes the parts of a connection string as json, yaml, a table or csv
+func WriteConnectionStringSummary(w io.Writer, format OutputFormat, summary ConnectionStringSummary) error {
+	rows := [][]string{{summary.Endpoint, summary.Namespace, summary.Authentication, summary.KeyName, summary.EntityPath, summary.ExpiresAt}}
+
+	return writeOutput(w, format, summary, connectionStringSummaryColumns, rows)
+}
+
+// GenerateSASToken Generates a shared access signature with the key of the connection string valid for
+// the duration, it is scoped to the entity path when it is set or to the whole namespace otherwise
+func GenerateSASToken(connection ConnectionStringEntity, entityPath string, duration time.Duration) (SASToken, error) {
+	var result SASToken
+	if connection.SharedAccessKeyName == "" || connection.SharedAccessKey == "" {
+		return result, errors.New("A shared access signature can only be generated from a connection string with a " + sharedAccessKeyNameKey + " and " + sharedAccessKeyKey)
+	}
+	if duration <= 0 {
+		return result, errors.New("The shared access signature duration needs to be positive")
+	}
+	if entityPath == "" {
+		entityPath = connection.EntityPath
+	}
+
+	result.Resource = "https://" + connection.Host + "/" + strings.Trim(entityPath, "/")
+	result.KeyName = connection.SharedAccessKeyName
+	signature, expiry := sas.NewSigner(connection.SharedAccessKeyName, connection.SharedAccessKey).SignWithDuration(result.Resource, duration)
+	result.Token = signature
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return result, err
+	}
+	result.ExpiresAt = time.Unix(expiresAt, 0).UTC()
+	result.ConnectionString = ConnectionStringEntity{
+		Endpoint:              "sb://" + connection.Host + "/",
+		SharedAccessSignature: signature,
+		EntityPath:            strings.Trim(entityPath, "/"),
+	}.String()
+
+	return result, nil
+}
+
+// PrintSASToken Prints a shared access signature and its connection string
+func PrintSASToken(token SASToken) {
+	logger.LogHighlight("Shared access signature for %v with key %v, expires at %v", log.Info, token.Resource, token.KeyName, token.ExpiresAt.Format(time.RFC3339))
+	logger.Info("Token:")
+	logger.Info("%v", token.Token)
+	logger.Info("Connection string:")
+	logger.Info("%v", token.ConnectionString)
+}
+
+// WriteSASToken Writes a shared access signature as json, yaml, a table or csv
+func WriteSASToken(w io.Writer, format OutputFormat, token SASToken) error {
+	rows := [][]string{{token.Resource, token.KeyName, token.ExpiresAt.Format(time.RFC3339), token.Token, token.ConnectionString}}
+
+	return writeOutput(w, format, token, sasTokenColumns, rows)
+}
+
+// namespaceOptions gets the sdk options to connect with the credentials, connection strings with a key
+// are parsed by the sdk
+func (c AzureCredentials) namespaceOptions() ([]servicebus.NamespaceOption, error) {
+	if c.ConnectionString != "" {
+		connection, err := ParseConnectionString(c.ConnectionString)
+		if err != nil {
+			return nil, err
+		}
+		if connection.SharedAccessSignature == "" {
+			return []servicebus.NamespaceOption{servicebus.NamespaceWithConnectionString(c.ConnectionString)}, nil
+		}
+		c.Endpoint = connection.Host
+		c.SASToken = connection.SharedAccessSignature
+	}
+
+	if c.Endpoint == "" {
+		return nil, errors.New("Missing the service bus connection string or endpoint")
+	}
+	host, err := parseEndpointHost(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	withHost := func(ns *servicebus.Namespace) error {
+		ns.Name = strings.Split(host, ".")[0]
+		ns.Suffix = strings.TrimPrefix(host, ns.Name+".")
+		return nil
+	}
+
+	if c.SASToken != "" {
+		expiresAt, err := sasTokenExpiry(c.SASToken)
+		if err != nil {
+			return nil, err
+		}
+		if time.Now().After(expiresAt) {
+			return nil, errors.New("The shared access signature expired at " + expiresAt.UTC().Format(time.RFC3339))
+		}
+		provider := sasTokenProvider{token: c.SASToken, expiry: strconv.FormatInt(expiresAt.Unix(), 10)}
+		return []servicebus.NamespaceOption{withHost, servicebus.NamespaceWithTokenProvider(provider)}, nil
+	}
+
+	if c.TenantID == "" || c.ClientID == "" || c.ClientSecret == "" {
+		return nil, errors.New("Missing the shared access signature or the azure active directory tenant id, client id and client secret for endpoint " + host)
+	}
+	provider, err := aad.NewJWTProvider(func(config *aad.TokenProviderConfiguration) error {
+		config.TenantID = c.TenantID
+		config.ClientID = c.ClientID
+		config.ClientSecret = c.ClientSecret
+		config.Env = &azure.PublicCloud
+		config.ResourceURI = azure.PublicCloud.ResourceIdentifiers.ServiceBus
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []servicebus.NamespaceOption{withHost, servicebus.NamespaceWithTokenProvider(provider)}, nil
+}
+
+// GetToken Gets the shared access signature for any audience, its scope is checked by the service bus
+func (p sasTokenProvider) GetToken(uri string) (*auth.Token, error) {
+	return auth.NewToken(auth.CBSTokenTypeSAS, p.token, p.expiry), nil
+}
+
+// parseEndpointHost gets the host of an endpoint, sb://example.servicebus.windows.net/ or only the host
+func parseEndpointHost(endpoint string) (string, error) {
+	host := endpoint
+	if strings.Contains(endpoint, "://") {
+		parsed, err := url.Parse(endpoint)
+		if err != nil {
+			return "", errors.New("Invalid endpoint " + endpoint + ": " + err.Error())
+		}
+		host = parsed.Host
+	}
+	host = strings.TrimSuffix(host, "/")
+	if !strings.Contains(host, ".") {
+		return "", errors.New("Invalid endpoint " + endpoint + ", it needs a namespace and a suffix like example.servicebus.windows.net")
+	}
+
+	return host, nil
+}
+
+// sasTokenParameter gets a parameter of a shared access signature
+func sasTokenParameter(token string, name string) string {
+	values, err := url.ParseQuery(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(token), "SharedAccessSignature")))
+	if err != nil {
+		return ""
+	}
+
+	return values.Get(name)
+}
+
+func sasTokenExpiry(token string) (time.Time, error) {
+	expiry, err := strconv.ParseInt(sasTokenParameter(token, "se"), 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("Invalid shared access signature, it has no expiry")
+	}
+
+	return time.Unix(expiry, 0), nil
+}
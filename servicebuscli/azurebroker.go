@@ -0,0 +1,679 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+// AzureBroker is the broker backed by an azure service bus namespace
+type AzureBroker struct {
+	Namespace    *servicebus.Namespace
+	TopicManager *servicebus.TopicManager
+	QueueManager *servicebus.QueueManager
+}
+
+type azureReceiver struct {
+	receiver *servicebus.Receiver
+	settler  messageSettler
+}
+
+// azureSettler settles the messages with the sdk, the lock renewer is the queue or subscription
+// the messages were received from, messages of sessions and dead letter queues cannot be renewed
+type azureSettler struct {
+	renewer azureLockRenewer
+}
+
+// azureLockRenewer is implemented by the sdk queues and subscriptions
+type azureLockRenewer interface {
+	RenewLocks(ctx context.Context, messages ...*servicebus.Message) error
+}
+
+// azureSession is implemented by the sdk queue and subscription sessions
+type azureSession interface {
+	ReceiveOne(ctx context.Context, handler servicebus.SessionHandler) error
+	Close(ctx context.Context) error
+}
+
+// NewAzureBroker Creates a broker connected to the azure service bus namespace of the connection string
+func NewAzureBroker(connectionString string) (*AzureBroker, error) {
+	return NewAzureBrokerWithCredentials(AzureCredentials{ConnectionString: connectionString})
+}
+
+// NewAzureBrokerWithCredentials Creates a broker connected to an azure service bus namespace with a
+// connection string, a shared access signature or an azure active directory client credential
+func NewAzureBrokerWithCredentials(credentials AzureCredentials) (*AzureBroker, error) {
+	logger.Trace("Creating a service bus namespace")
+	options, err := credentials.namespaceOptions()
+	if err != nil {
+		return nil, err
+	}
+	ns, err := servicebus.NewNamespace(options...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AzureBroker{
+		Namespace:    ns,
+		TopicManager: ns.NewTopicManager(),
+		QueueManager: ns.NewQueueManager(),
+	}, nil
+}
+
+// Name Gets the namespace name
+func (b *AzureBroker) Name() string {
+	return b.Namespace.Name
+}
+
+// Close Closes the broker
+func (b *AzureBroker) Close(ctx context.Context) error {
+	return nil
+}
+
+// ListTopics Lists the topics in the namespace
+func (b *AzureBroker) ListTopics(ctx context.Context) ([]*servicebus.TopicEntity, error) {
+	return b.TopicManager.List(ctx)
+}
+
+// GetTopic Gets a topic from the namespace
+func (b *AzureBroker) GetTopic(ctx context.Context, name string) (*servicebus.TopicEntity, error) {
+	return b.TopicManager.Get(ctx, name)
+}
+
+// CreateTopic Creates a topic in the namespace
+func (b *AzureBroker) CreateTopic(ctx context.Context, topic TopicEntity) error {
+	opts := make([]servicebus.TopicManagementOption, 0)
+
+	if topic.DefaultMessageTimeToLive.Microseconds() > 0 {
+		opts = append(opts, servicebus.TopicWithMessageTimeToLive(&topic.DefaultMessageTimeToLive))
+	}
+	if topic.AutoDeleteOnIdle.Microseconds() > 0 {
+		opts = append(opts, servicebus.TopicWithAutoDeleteOnIdle(&topic.AutoDeleteOnIdle))
+	}
+	if topic.MaxSizeInMegabytes > 0 {
+		opts = append(opts, servicebus.TopicWithMaxSizeInMegabytes(int(topic.MaxSizeInMegabytes)))
+	}
+	if topic.DuplicateDetectionWindow.Microseconds() > 0 {
+		opts = append(opts, servicebus.TopicWithDuplicateDetection(&topic.DuplicateDetectionWindow))
+	}
+	if topic.EnablePartitioning {
+		opts = append(opts, servicebus.TopicWithPartitioning())
+	}
+	if topic.SupportOrdering {
+		opts = append(opts, servicebus.TopicWithOrdering())
+	}
+
+	_, err := b.TopicManager.Put(ctx, topic.Name, opts...)
+	return err
+}
+
+// UpdateTopic Updates an existing topic, only the properties set in the topic entity are changed
+func (b *AzureBroker) UpdateTopic(ctx context.Context, topic TopicEntity) error {
+	existingTopic, err := b.TopicManager.Get(ctx, topic.Name)
+	if err != nil || existingTopic == nil {
+		return errors.New("Could not find topic " + topic.Name + " in service bus " + b.Name())
+	}
+
+	description := *existingTopic.TopicDescription
+	clearTopicReadOnlyProperties(&description)
+
+	if topic.DefaultMessageTimeToLive.Microseconds() > 0 {
+		description.DefaultMessageTimeToLive = durationTo8601(topic.DefaultMessageTimeToLive)
+	}
+	if topic.AutoDeleteOnIdle.Microseconds() > 0 {
+		description.AutoDeleteOnIdle = durationTo8601(topic.AutoDeleteOnIdle)
+	}
+
+	return putEntityDescription(ctx, b.TopicManager, "/"+topic.Name, description, nil, nil)
+}
+
+// DeleteTopic Deletes a topic from the namespace
+func (b *AzureBroker) DeleteTopic(ctx context.Context, name string) error {
+	return b.TopicManager.Delete(ctx, name)
+}
+
+// ListQueues Lists the queues in the namespace
+func (b *AzureBroker) ListQueues(ctx context.Context) ([]*servicebus.QueueEntity, error) {
+	return b.QueueManager.List(ctx)
+}
+
+// GetQueue Gets a queue from the namespace
+func (b *AzureBroker) GetQueue(ctx context.Context, name string) (*servicebus.QueueEntity, error) {
+	return b.QueueManager.Get(ctx, name)
+}
+
+// CreateQueue Creates a queue in the namespace
+func (b *AzureBroker) CreateQueue(ctx context.Context, queue QueueEntity) error {
+	opts := make([]servicebus.QueueManagementOption, 0)
+
+	if queue.LockDuration.Milliseconds() > 0 {
+		opts = append(opts, servicebus.QueueEntityWithLockDuration(&queue.LockDuration))
+	}
+	if queue.DefaultMessageTimeToLive.Microseconds() > 0 {
+		opts = append(opts, servicebus.QueueEntityWithMessageTimeToLive(&queue.DefaultMessageTimeToLive))
+	}
+	if queue.AutoDeleteOnIdle.Microseconds() > 0 {
+		opts = append(opts, servicebus.QueueEntityWithAutoDeleteOnIdle(&queue.AutoDeleteOnIdle))
+	}
+	if queue.MaxDeliveryCount > 0 && queue.MaxDeliveryCount != 10 {
+		opts = append(opts, servicebus.QueueEntityWithMaxDeliveryCount(int32(queue.MaxDeliveryCount)))
+	}
+	if queue.RequiresSession {
+		opts = append(opts, servicebus.QueueEntityWithRequiredSessions())
+	}
+	if queue.DuplicateDetectionWindow.Microseconds() > 0 {
+		opts = append(opts, servicebus.QueueEntityWithDuplicateDetection(&queue.DuplicateDetectionWindow))
+	}
+	if queue.EnablePartitioning {
+		opts = append(opts, servicebus.QueueEntityWithPartitioning())
+	}
+
+	// Generating the forward rules, checking if the targets exist or not
+	if queue.Forward.To != "" {
+		target, err := b.getForwardTarget(ctx, queue.Forward)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, servicebus.QueueEntityWithAutoForward(target))
+	}
+	if queue.ForwardDeadLetter.To != "" {
+		target, err := b.getForwardTarget(ctx, queue.ForwardDeadLetter)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, servicebus.QueueEntityWithForwardDeadLetteredMessagesTo(target))
+	}
+
+	_, err := b.QueueManager.Put(ctx, queue.Name, opts...)
+	return err
+}
+
+// UpdateQueue Updates an existing queue, only the properties set in the queue entity are changed
+func (b *AzureBroker) UpdateQueue(ctx context.Context, queue QueueEntity) error {
+	existingQueue, err := b.QueueManager.Get(ctx, queue.Name)
+	if err != nil || existingQueue == nil {
+		return errors.New("Could not find queue " + queue.Name + " in service bus " + b.Name())
+	}
+
+	description := *existingQueue.QueueDescription
+	clearQueueReadOnlyProperties(&description)
+
+	if queue.LockDuration.Milliseconds() > 0 {
+		description.LockDuration = durationTo8601(queue.LockDuration)
+	}
+	if queue.DefaultMessageTimeToLive.Microseconds() > 0 {
+		description.DefaultMessageTimeToLive = durationTo8601(queue.DefaultMessageTimeToLive)
+	}
+	if queue.AutoDeleteOnIdle.Microseconds() > 0 {
+		description.AutoDeleteOnIdle = durationTo8601(queue.AutoDeleteOnIdle)
+	}
+	if queue.MaxDeliveryCount > 0 {
+		description.MaxDeliveryCount = &queue.MaxDeliveryCount
+	}
+	if queue.Forward.Clear {
+		description.ForwardTo = nil
+	} else if queue.Forward.To != "" {
+		target, err := b.getForwardTarget(ctx, queue.Forward)
+		if err != nil {
+			return err
+		}
+		description.ForwardTo = stringPtr(target.TargetURI())
+	}
+	if queue.ForwardDeadLetter.Clear {
+		description.ForwardDeadLetteredMessagesTo = nil
+	} else if queue.ForwardDeadLetter.To != "" {
+		target, err := b.getForwardTarget(ctx, queue.ForwardDeadLetter)
+		if err != nil {
+			return err
+		}
+		description.ForwardDeadLetteredMessagesTo = stringPtr(target.TargetURI())
+	}
+
+	return putEntityDescription(ctx, b.QueueManager, "/"+queue.Name, description, description.ForwardTo, description.ForwardDeadLetteredMessagesTo)
+}
+
+// DeleteQueue Deletes a queue from the namespace
+func (b *AzureBroker) DeleteQueue(ctx context.Context, name string) error {
+	return b.QueueManager.Delete(ctx, name)
+}
+
+// ListSubscriptions Lists the subscriptions of a topic
+func (b *AzureBroker) ListSubscriptions(ctx context.Context, topicName string) ([]*servicebus.SubscriptionEntity, error) {
+	sm, err := b.Namespace.NewSubscriptionManager(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	return sm.List(ctx)
+}
+
+// GetSubscription Gets a subscription from a topic
+func (b *AzureBroker) GetSubscription(ctx context.Context, topicName string, name string) (*servicebus.SubscriptionEntity, error) {
+	sm, err := b.Namespace.NewSubscriptionManager(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	return sm.Get(ctx, name)
+}
+
+// CreateSubscription Creates a subscription on a topic, the rules are not created
+func (b *AzureBroker) CreateSubscription(ctx context.Context, subscription SubscriptionEntity) error {
+	opts := make([]servicebus.SubscriptionManagementOption, 0)
+	sm, err := b.Namespace.NewSubscriptionManager(subscription.TopicName)
+	if err != nil {
+		return err
+	}
+
+	if subscription.LockDuration.Milliseconds() > 0 {
+		opts = append(opts, servicebus.SubscriptionWithLockDuration(&subscription.LockDuration))
+	}
+	if subscription.DefaultMessageTimeToLive.Microseconds() > 0 {
+		opts = append(opts, servicebus.SubscriptionWithMessageTimeToLive(&subscription.DefaultMessageTimeToLive))
+	}
+	if subscription.AutoDeleteOnIdle.Microseconds() > 0 {
+		opts = append(opts, servicebus.SubscriptionWithAutoDeleteOnIdle(&subscription.AutoDeleteOnIdle))
+	}
+	if subscription.MaxDeliveryCount > 0 && subscription.MaxDeliveryCount != 10 {
+		opts = append(opts, subscriptionWithMaxDeliveryCount(subscription.MaxDeliveryCount))
+	}
+	if subscription.RequiresSession {
+		opts = append(opts, servicebus.SubscriptionWithRequiredSessions())
+	}
+
+	// Generating the forward rules, checking if the targets exist or not
+	if subscription.Forward.To != "" {
+		target, err := b.getForwardTarget(ctx, subscription.Forward)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, servicebus.SubscriptionWithAutoForward(target))
+	}
+	if subscription.ForwardDeadLetter.To != "" {
+		target, err := b.getForwardTarget(ctx, subscription.ForwardDeadLetter)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, servicebus.SubscriptionWithForwardDeadLetteredMessagesTo(target))
+	}
+
+	_, err = sm.Put(ctx, subscription.Name, opts...)
+	return err
+}
+
+// UpdateSubscription Updates an existing subscription, only the properties set in the subscription
+// entity are changed and the rules are not changed
+func (b *AzureBroker) UpdateSubscription(ctx context.Context, subscription SubscriptionEntity) error {
+	sm, err := b.Namespace.NewSubscriptionManager(subscription.TopicName)
+	if err != nil {
+		return err
+	}
+
+	existingSubscription, err := sm.Get(ctx, subscription.Name)
+	if err != nil || existingSubscription == nil {
+		return errors.New("Could not find subscription " + subscription.Name + " on topic " + subscription.TopicName + " in service bus " + b.Name())
+	}
+
+	description := *existingSubscription.SubscriptionDescription
+	clearSubscriptionReadOnlyProperties(&description)
+
+	if subscription.LockDuration.Milliseconds() > 0 {
+		description.LockDuration = durationTo8601(subscription.LockDuration)
+	}
+	if subscription.DefaultMessageTimeToLive.Microseconds() > 0 {
+		description.DefaultMessageTimeToLive = durationTo8601(subscription.DefaultMessageTimeToLive)
+	}
+	if subscription.AutoDeleteOnIdle.Microseconds() > 0 {
+		description.AutoDeleteOnIdle = durationTo8601(subscription.AutoDeleteOnIdle)
+	}
+	if subscription.MaxDeliveryCount > 0 {
+		description.MaxDeliveryCount = &subscription.MaxDeliveryCount
+	}
+	if subscription.Forward.Clear {
+		description.ForwardTo = nil
+	} else if subscription.Forward.To != "" {
+		target, err := b.getForwardTarget(ctx, subscription.Forward)
+		if err != nil {
+			return err
+		}
+		description.ForwardTo = stringPtr(target.TargetURI())
+	}
+	if subscription.ForwardDeadLetter.Clear {
+		description.ForwardDeadLetteredMessagesTo = nil
+	} else if subscription.ForwardDeadLetter.To != "" {
+		target, err := b.getForwardTarget(ctx, subscription.ForwardDeadLetter)
+		if err != nil {
+			return err
+		}
+		description.ForwardDeadLetteredMessagesTo = stringPtr(target.TargetURI())
+	}
+
+	return putEntityDescription(ctx, sm, SubscriptionEntityPath(subscription.TopicName, subscription.Name), description, description.ForwardTo, description.ForwardDeadLetteredMessagesTo)
+}
+
+// DeleteSubscription Deletes a subscription from a topic
+func (b *AzureBroker) DeleteSubscription(ctx context.Context, topicName string, name string) error {
+	sm, err := b.Namespace.NewSubscriptionManager(topicName)
+	if err != nil {
+		return err
+	}
+
+	return sm.Delete(ctx, name)
+}
+
+// ListRules Lists the rules of a subscription, the rules are read from the management api as the
+// sdk cannot read correlation filter properties
+func (b *AzureBroker) ListRules(ctx context.Context, topicName string, subscriptionName string) ([]RuleEntity, error) {
+	sm, err := b.Namespace.NewSubscriptionManager(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	feed, err := getEntityFeed(ctx, sm, SubscriptionEntityPath(topicName, subscriptionName)+"/rules")
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RuleEntity, 0)
+	for _, entry := range feed.Entries {
+		if entry.Content == nil {
+			continue
+		}
+		rule, err := parseRuleDescription(entry.Title, entry.Content.Body)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rule)
+	}
+
+	return result, nil
+}
+
+// CreateRule Creates a sql or correlation filter rule, with an optional action, in a subscription
+func (b *AzureBroker) CreateRule(ctx context.Context, topicName string, subscriptionName string, rule RuleEntity) error {
+	sm, err := b.Namespace.NewSubscriptionManager(topicName)
+	if err != nil {
+		return err
+	}
+
+	return putEntityContent(ctx, sm, SubscriptionEntityPath(topicName, subscriptionName)+"/rules/"+rule.Name, formatRuleDescription(rule))
+}
+
+// DeleteRule Deletes a rule from a subscription
+func (b *AzureBroker) DeleteRule(ctx context.Context, topicName string, subscriptionName string, ruleName string) error {
+	sm, err := b.Namespace.NewSubscriptionManager(topicName)
+	if err != nil {
+		return err
+	}
+
+	return sm.DeleteRule(ctx, subscriptionName, ruleName)
+}
+
+// Send Sends a message to a queue or topic
+func (b *AzureBroker) Send(ctx context.Context, entityPath string, msg *servicebus.Message) error {
+	sender, err := b.Namespace.NewSender(ctx, entityPath)
+	if err != nil {
+		return err
+	}
+	defer sender.Close(ctx)
+
+	return sender.Send(ctx, msg)
+}
+
+// SendBatch Sends messages to a queue or topic in as few batches as the message size limit allows
+func (b *AzureBroker) SendBatch(ctx context.Context, entityPath string, msgs []*servicebus.Message) error {
+	// the queue client only uses the path to address the entity, so it can send batches to topics as well
+	entity, err := b.Namespace.NewQueue(entityPath)
+	if err != nil {
+		return err
+	}
+	defer entity.Close(ctx)
+
+	return entity.SendBatch(ctx, servicebus.NewMessageBatchIterator(servicebus.StandardMaxMessageSizeInBytes, msgs...))
+}
+
+// Schedule Sends a message to a queue or topic to be enqueued at the enqueue time
+func (b *AzureBroker) Schedule(ctx context.Context, entityPath string, msg *servicebus.Message, enqueueTime time.Time) (int64, error) {
+	// the queue client only uses the path to address the entity, so it can schedule on topics as well
+	entity, err := b.Namespace.NewQueue(entityPath)
+	if err != nil {
+		return 0, err
+	}
+	defer entity.Close(ctx)
+
+	sequenceNumbers, err := entity.ScheduleAt(ctx, enqueueTime, msg)
+	if err != nil {
+		return 0, err
+	}
+	if len(sequenceNumbers) == 0 {
+		return 0, errors.New("The service bus did not return a sequence number for the scheduled message")
+	}
+
+	return sequenceNumbers[0], nil
+}
+
+// CancelScheduled Cancels scheduled messages of a queue or topic that were not enqueued yet
+func (b *AzureBroker) CancelScheduled(ctx context.Context, entityPath string, sequenceNumbers ...int64) error {
+	entity, err := b.Namespace.NewQueue(entityPath)
+	if err != nil {
+		return err
+	}
+	defer entity.Close(ctx)
+
+	return entity.CancelScheduled(ctx, sequenceNumbers...)
+}
+
+// Peek Peeks the messages of a queue, subscription or dead letter queue without locking them
+func (b *AzureBroker) Peek(ctx context.Context, entityPath string) (servicebus.MessageIterator, error) {
+	// the queue client only uses the path to address the entity, so it can peek any entity
+	entity, err := b.Namespace.NewQueue(entityPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return entity.Peek(ctx)
+}
+
+// NewReceiver Creates a peek lock receiver for a queue, subscription or dead letter queue
+func (b *AzureBroker) NewReceiver(ctx context.Context, entityPath string, options ...ReceiverOption) (Receiver, error) {
+	settings := newReceiverSettings(options)
+	receiverOptions := make([]servicebus.ReceiverOption, 0)
+	var settler messageSettler = azureSettler{renewer: b.lockRenewer(entityPath)}
+	if settings.ReceiveAndDelete {
+		receiverOptions = append(receiverOptions, servicebus.ReceiverWithReceiveMode(servicebus.ReceiveAndDeleteMode))
+		settler = deletedSettler{}
+	}
+	if settings.PrefetchCount > 0 {
+		receiverOptions = append(receiverOptions, servicebus.ReceiverWithPrefetchCount(settings.PrefetchCount))
+	}
+
+	receiver, err := b.Namespace.NewReceiver(ctx, entityPath, receiverOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azureReceiver{receiver: receiver, settler: settler}, nil
+}
+
+// lockRenewer gets the queue or subscription of an entity path to renew the message locks with
+func (b *AzureBroker) lockRenewer(entityPath string) azureLockRenewer {
+	if strings.HasSuffix(strings.ToLower(entityPath), strings.ToLower("/"+servicebus.DeadLetterQueueName)) {
+		return nil
+	}
+
+	if topicName, subscriptionName, ok := SplitSubscriptionEntityPath(entityPath); ok {
+		topic, err := b.Namespace.NewTopic(topicName)
+		if err != nil {
+			return nil
+		}
+		subscription, err := topic.NewSubscription(subscriptionName)
+		if err != nil {
+			return nil
+		}
+		return subscription
+	}
+
+	queue, err := b.Namespace.NewQueue(entityPath)
+	if err != nil {
+		return nil
+	}
+	return queue
+}
+
+// ReceiveSession locks the next available session, or the session id if one is passed, and runs the
+// handler on its messages until none is received for the idle timeout, it returns the session id
+func (b *AzureBroker) ReceiveSession(ctx context.Context, entityPath string, sessionID string, idleTimeout time.Duration, handler MessageHandler) (string, error) {
+	var requestedSession *string
+	if sessionID != "" {
+		requestedSession = &sessionID
+	}
+
+	var session azureSession
+	if topicName, subscriptionName, ok := SplitSubscriptionEntityPath(entityPath); ok {
+		topic, err := b.Namespace.NewTopic(topicName)
+		if err != nil {
+			return "", err
+		}
+		subscription, err := topic.NewSubscription(subscriptionName)
+		if err != nil {
+			return "", err
+		}
+		session = subscription.NewSession(requestedSession)
+	} else {
+		queue, err := b.Namespace.NewQueue(entityPath)
+		if err != nil {
+			return "", err
+		}
+		session = queue.NewSession(requestedSession)
+	}
+	defer session.Close(context.Background())
+
+	acceptedSession := sessionID
+	activity := make(chan bool, 1)
+	done := make(chan bool)
+	defer close(done)
+
+	messageHandler := azureHandler(func(ctx context.Context, msg *ReceivedMessage) error {
+		if msg.SessionID != nil {
+			acceptedSession = *msg.SessionID
+		}
+		select {
+		case activity <- true:
+		default:
+		}
+		return handler(ctx, msg)
+	}, azureSettler{})
+
+	// the sdk keeps the session open until it is closed, so it is closed once it has been idle
+	start := func(messageSession *servicebus.MessageSession) error {
+		go func() {
+			for {
+				select {
+				case <-activity:
+				case <-time.After(idleTimeout):
+					messageSession.Close()
+					return
+				case <-ctx.Done():
+					messageSession.Close()
+					return
+				case <-done:
+					return
+				}
+			}
+		}()
+		return nil
+	}
+
+	err := session.ReceiveOne(ctx, servicebus.NewSessionHandler(messageHandler, start, func() {}))
+	return acceptedSession, err
+}
+
+// subscriptionWithMaxDeliveryCount sets the max delivery count of a subscription when it is created,
+// the sdk only has this option for queues
+func subscriptionWithMaxDeliveryCount(count int32) servicebus.SubscriptionManagementOption {
+	return func(description *servicebus.SubscriptionDescription) error {
+		description.MaxDeliveryCount = &count
+		return nil
+	}
+}
+
+// getForwardTarget gets the forwarding target entity, checking if it exists in the namespace
+func (b *AzureBroker) getForwardTarget(ctx context.Context, forward ForwardEntity) (servicebus.Targetable, error) {
+	switch forward.In {
+	case ForwardToTopic:
+		target, err := b.TopicManager.Get(ctx, forward.To)
+		if err != nil || target == nil {
+			return nil, errors.New("Could not find forwarding topic " + forward.To + " in service bus " + b.Name())
+		}
+		return target, nil
+	default:
+		target, err := b.QueueManager.Get(ctx, forward.To)
+		if err != nil || target == nil {
+			return nil, errors.New("Could not find forwarding queue " + forward.To + " in service bus " + b.Name())
+		}
+		return target, nil
+	}
+}
+
+func (r *azureReceiver) ReceiveOne(ctx context.Context, handler MessageHandler) error {
+	// the sdk does not return the handler error when receiving a single message
+	var handlerError error
+	err := r.receiver.ReceiveOne(ctx, azureHandler(func(ctx context.Context, msg *ReceivedMessage) error {
+		handlerError = handler(ctx, msg)
+		return handlerError
+	}, r.settler))
+	if err != nil {
+		return err
+	}
+
+	return handlerError
+}
+
+func (r *azureReceiver) Listen(ctx context.Context, handler MessageHandler) error {
+	listener := r.receiver.Listen(ctx, azureHandler(handler, r.settler))
+	<-listener.Done()
+
+	err := listener.Err()
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		return nil
+	}
+
+	return err
+}
+
+func (r *azureReceiver) Close(ctx context.Context) error {
+	return r.receiver.Close(ctx)
+}
+
+func azureHandler(handler MessageHandler, settler messageSettler) servicebus.HandlerFunc {
+	return func(ctx context.Context, msg *servicebus.Message) error {
+		return handler(ctx, &ReceivedMessage{Message: msg, settler: settler})
+	}
+}
+
+func (azureSettler) complete(ctx context.Context, msg *ReceivedMessage) error {
+	return msg.Message.Complete(ctx)
+}
+
+func (azureSettler) abandon(ctx context.Context, msg *ReceivedMessage) error {
+	return msg.Message.Abandon(ctx)
+}
+
+func (azureSettler) deadLetter(ctx context.Context, msg *ReceivedMessage, err error) error {
+	return msg.Message.DeadLetter(ctx, err)
+}
+
+func (azureSettler) deferMessage(ctx context.Context, msg *ReceivedMessage) error {
+	return msg.Message.Defer(ctx)
+}
+
+func (s azureSettler) renewLock(ctx context.Context, msg *ReceivedMessage) error {
+	if s.renewer == nil {
+		return errors.New("The lock of message " + msg.ID + " cannot be renewed, only the locks of queue and subscription messages can be renewed")
+	}
+
+	return s.renewer.RenewLocks(ctx, msg.Message)
+}
@@ -0,0 +1,17 @@
+package servicebuscli
+
+import (
+	"testing"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestSubscriptionWithMaxDeliveryCount(t *testing.T) {
+	description := servicebus.SubscriptionDescription{}
+	if err := subscriptionWithMaxDeliveryCount(3)(&description); err != nil {
+		t.Fatalf("subscriptionWithMaxDeliveryCount() error = %v", err)
+	}
+	if description.MaxDeliveryCount == nil || *description.MaxDeliveryCount != 3 {
+		t.Errorf("MaxDeliveryCount = %v, want 3", description.MaxDeliveryCount)
+	}
+}
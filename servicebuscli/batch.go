@@ -0,0 +1,207 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+const (
+	defaultBatchSize   = 100
+	defaultConcurrency = 1
+	// batchesPerSecond is how often batches are dispatched when the send rate is limited
+	batchesPerSecond = 10
+)
+
+// BatchSendOptions Entity
+type BatchSendOptions struct {
+	// Rate is the maximum number of messages sent per second, 0 sends as fast as possible
+	Rate float64
+	// Count is the number of messages to send, the file messages are repeated until it is reached,
+	// 0 sends every message of the file once
+	Count       int
+	Concurrency int
+	BatchSize   int
+}
+
+// BatchSendResult Entity
+type BatchSendResult struct {
+	Sent     int
+	Failed   int
+	Duration time.Duration
+}
+
+// SendQueueMessageFile Sends the messages of a json or json lines file to a queue in batches, use - to
+// read from the standard input
+func (s *ServiceBusCli) SendQueueMessageFile(queueName string, filePath string, options BatchSendOptions) (BatchSendResult, error) {
+	var commonError error
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Broker.Name())
+		return BatchSendResult{}, commonError
+	}
+
+	logger.LogHighlight("Sending messages from %v to queue %v in service bus %v", log.Info, filePath, queueName, s.Broker.Name())
+	return s.sendMessageFile(queueName, filePath, options)
+}
+
+// SendTopicMessageFile Sends the messages of a json or json lines file to a topic in batches, use - to
+// read from the standard input
+func (s *ServiceBusCli) SendTopicMessageFile(topicName string, filePath string, options BatchSendOptions) (BatchSendResult, error) {
+	var commonError error
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
+		return BatchSendResult{}, commonError
+	}
+
+	logger.LogHighlight("Sending messages from %v to topic %v in service bus %v", log.Info, filePath, topicName, s.Broker.Name())
+	return s.sendMessageFile(topicName, filePath, options)
+}
+
+// sendMessageFile loads the file messages and sends them in batches using the concurrent senders,
+// the batches are paced to keep the send rate, scheduled messages are scheduled one by one
+func (s *ServiceBusCli) sendMessageFile(entityPath string, filePath string, options BatchSendOptions) (BatchSendResult, error) {
+	result := BatchSendResult{}
+	entities, err := LoadMessageEntities(filePath)
+	if err != nil {
+		logger.Error(err.Error())
+		return result, err
+	}
+	if len(entities) == 0 {
+		commonError := errors.New("No messages found in " + filePath)
+		logger.Error(commonError.Error())
+		return result, commonError
+	}
+
+	count := options.Count
+	if count <= 0 {
+		count = len(entities)
+	}
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	if options.Rate > 0 && float64(batchSize) > options.Rate/batchesPerSecond {
+		batchSize = int(options.Rate / batchesPerSecond)
+		if batchSize < 1 {
+			batchSize = 1
+		}
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	batches := make(chan []MessageEntity, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				sent, err := s.sendMessageBatch(entityPath, batch)
+				if err != nil {
+					logger.Error(err.Error())
+				}
+
+				mutex.Lock()
+				result.Sent += sent
+				result.Failed += len(batch) - sent
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	startTime := time.Now()
+	for queued := 0; queued < count; {
+		size := batchSize
+		if count-queued < size {
+			size = count - queued
+		}
+
+		batch := make([]MessageEntity, 0, size)
+		for i := 0; i < size; i++ {
+			entity := entities[(queued+i)%len(entities)]
+			if queued+i >= len(entities) {
+				// repeated messages get a new id so duplicate detection does not drop them
+				entity.ID = ""
+			}
+			batch = append(batch, entity)
+		}
+
+		if options.Rate > 0 {
+			// waiting until the messages queued, including this batch, fit in the send rate
+			dispatchTime := startTime.Add(time.Duration(float64(queued+size) / options.Rate * float64(time.Second)))
+			time.Sleep(time.Until(dispatchTime))
+		}
+
+		batches <- batch
+		queued += size
+	}
+	close(batches)
+	wg.Wait()
+
+	result.Duration = time.Since(startTime)
+	rate := float64(result.Sent) / result.Duration.Seconds()
+	logger.LogHighlight("Sent %v messages to %v in service bus %v in %v (%v messages/s)", log.Info, fmt.Sprint(result.Sent), entityPath, s.Broker.Name(), result.Duration.Round(time.Millisecond).String(), fmt.Sprintf("%.1f", rate))
+	if result.Failed > 0 {
+		commonError := errors.New(fmt.Sprint(result.Failed) + " messages could not be sent to " + entityPath)
+		logger.LogHighlight("%v messages could not be sent to %v in service bus %v", log.Error, fmt.Sprint(result.Failed), entityPath, s.Broker.Name())
+		return result, commonError
+	}
+
+	return result, nil
+}
+
+// sendMessageBatch sends a batch of message entities, returns how many of them were sent
+func (s *ServiceBusCli) sendMessageBatch(entityPath string, batch []MessageEntity) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	sent := 0
+	var lastError error
+	messages := make([]*servicebus.Message, 0, len(batch))
+	for _, entity := range batch {
+		msg, err := entity.ToServiceBusMessage()
+		if err != nil {
+			lastError = err
+			continue
+		}
+
+		// scheduled messages cannot be sent in a batch
+		if entity.ScheduledAt != nil {
+			if _, err := s.Broker.Schedule(ctx, entityPath, msg, *entity.ScheduledAt); err != nil {
+				lastError = err
+				continue
+			}
+			sent++
+			continue
+		}
+
+		messages = append(messages, msg)
+	}
+
+	if len(messages) > 0 {
+		if err := s.Broker.SendBatch(ctx, entityPath, messages); err != nil {
+			return sent, err
+		}
+		sent += len(messages)
+	}
+
+	return sent, lastError
+}
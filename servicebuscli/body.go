@@ -0,0 +1,122 @@
+package servicebuscli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MessageBodyOptions structure
+type MessageBodyOptions struct {
+	ContentType string
+	// Raw sends the body bytes as they are, json bodies are not validated or indented
+	Raw bool
+	// Base64 decodes the body before sending it, used for binary payloads like protobuf, the
+	// decoded bytes are sent as they are
+	Base64 bool
+}
+
+// ReadMessageBody Reads a message body from a file, use - to read it from the standard input
+func ReadMessageBody(filePath string) ([]byte, error) {
+	input, closeInput, err := openInput(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeInput()
+
+	return ioutil.ReadAll(input)
+}
+
+// EncodeMessageBody Converts a message body into the bytes sent to the service bus, json bodies are
+// validated and indented, a body without content type is considered json
+func EncodeMessageBody(body []byte, options MessageBodyOptions) ([]byte, error) {
+	if options.Base64 {
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+		if err != nil {
+			return nil, errors.New("Invalid base64 message body: " + err.Error())
+		}
+		return decoded, nil
+	}
+
+	if options.Raw || (options.ContentType != "" && !isJSONContentType(options.ContentType)) {
+		return body, nil
+	}
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		return nil, errors.New("Invalid json message body, use --raw or --content-type to send other content: " + err.Error())
+	}
+
+	return indented.Bytes(), nil
+}
+
+// FormatMessageBody Formats a message body for display using its content type, json is indented, text
+// is shown as it is and binary content is shown as a hex dump, bodies without content type are
+// detected from their content
+func FormatMessageBody(contentType string, data []byte) string {
+	switch {
+	case isJSONContentType(contentType) || (contentType == "" && json.Valid(data)):
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, data, "", "  "); err == nil {
+			return indented.String()
+		}
+	case isTextContentType(contentType) || contentType == "":
+		if isPrintable(data) {
+			return string(data)
+		}
+	}
+
+	return strings.TrimSuffix(hex.Dump(data), "\n")
+}
+
+// isJSONContentType checks if the content type is json or a json based type like application/cloudevents+json
+func isJSONContentType(contentType string) bool {
+	mediaType := parseMediaType(contentType)
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") || mediaType == "text/json"
+}
+
+// isTextContentType checks if the content type can be shown as text
+func isTextContentType(contentType string) bool {
+	mediaType := parseMediaType(contentType)
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"):
+		return true
+	case mediaType == "application/x-www-form-urlencoded", mediaType == "application/yaml":
+		return true
+	}
+
+	return false
+}
+
+func parseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	return mediaType
+}
+
+// isPrintable checks if the data is valid utf8 text without control characters
+func isPrintable(data []byte) bool {
+	if !utf8.Valid(data) {
+		return false
+	}
+
+	for _, r := range string(data) {
+		if unicode.IsControl(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,203 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+// Broker is implemented by the service bus backends, it covers the management and messaging
+// operations used by the cli so they can run against azure or against an in memory broker
+type Broker interface {
+	Name() string
+	Close(ctx context.Context) error
+
+	ListTopics(ctx context.Context) ([]*servicebus.TopicEntity, error)
+	GetTopic(ctx context.Context, name string) (*servicebus.TopicEntity, error)
+	CreateTopic(ctx context.Context, topic TopicEntity) error
+	UpdateTopic(ctx context.Context, topic TopicEntity) error
+	DeleteTopic(ctx context.Context, name string) error
+
+	ListQueues(ctx context.Context) ([]*servicebus.QueueEntity, error)
+	GetQueue(ctx context.Context, name string) (*servicebus.QueueEntity, error)
+	CreateQueue(ctx context.Context, queue QueueEntity) error
+	UpdateQueue(ctx context.Context, queue QueueEntity) error
+	DeleteQueue(ctx context.Context, name string) error
+
+	ListSubscriptions(ctx context.Context, topicName string) ([]*servicebus.SubscriptionEntity, error)
+	GetSubscription(ctx context.Context, topicName string, name string) (*servicebus.SubscriptionEntity, error)
+	CreateSubscription(ctx context.Context, subscription SubscriptionEntity) error
+	UpdateSubscription(ctx context.Context, subscription SubscriptionEntity) error
+	DeleteSubscription(ctx context.Context, topicName string, name string) error
+
+	ListRules(ctx context.Context, topicName string, subscriptionName string) ([]RuleEntity, error)
+	CreateRule(ctx context.Context, topicName string, subscriptionName string, rule RuleEntity) error
+	DeleteRule(ctx context.Context, topicName string, subscriptionName string, ruleName string) error
+
+	Send(ctx context.Context, entityPath string, msg *servicebus.Message) error
+	SendBatch(ctx context.Context, entityPath string, msgs []*servicebus.Message) error
+	// Schedule sends a message to a queue or topic to be enqueued at the enqueue time, it returns the
+	// sequence number that can be used to cancel it
+	Schedule(ctx context.Context, entityPath string, msg *servicebus.Message, enqueueTime time.Time) (int64, error)
+	CancelScheduled(ctx context.Context, entityPath string, sequenceNumbers ...int64) error
+	Peek(ctx context.Context, entityPath string) (servicebus.MessageIterator, error)
+	NewReceiver(ctx context.Context, entityPath string, options ...ReceiverOption) (Receiver, error)
+	// ReceiveSession locks the next available session, or the session id if one is passed, and runs the
+	// handler on its messages until none is received for the idle timeout, it returns the session id
+	ReceiveSession(ctx context.Context, entityPath string, sessionID string, idleTimeout time.Duration, handler MessageHandler) (string, error)
+}
+
+// ReceiverOption configures a receiver created with NewReceiver
+type ReceiverOption func(settings *ReceiverSettings)
+
+// ReceiverSettings structure
+type ReceiverSettings struct {
+	// ReceiveAndDelete removes the messages from the entity as they are received instead of locking them,
+	// they cannot be abandoned or dead lettered
+	ReceiveAndDelete bool
+	// PrefetchCount is the number of messages fetched at once, 0 fetches them one by one
+	PrefetchCount uint32
+}
+
+// WithReceiveAndDelete Receives the messages in receive and delete mode
+func WithReceiveAndDelete() ReceiverOption {
+	return func(settings *ReceiverSettings) {
+		settings.ReceiveAndDelete = true
+	}
+}
+
+// WithPrefetchCount Fetches up to count messages at once
+func WithPrefetchCount(count uint32) ReceiverOption {
+	return func(settings *ReceiverSettings) {
+		settings.PrefetchCount = count
+	}
+}
+
+// Receiver receives messages in peek lock mode, or receive and delete mode, from a queue, a subscription
+// or a dead letter queue
+type Receiver interface {
+	// ReceiveOne waits for the next message and runs the handler on it
+	ReceiveOne(ctx context.Context, handler MessageHandler) error
+	// Listen runs the handler on every message received until the context is cancelled
+	Listen(ctx context.Context, handler MessageHandler) error
+	Close(ctx context.Context) error
+}
+
+// MessageHandler is executed for every message received
+type MessageHandler func(ctx context.Context, msg *ReceivedMessage) error
+
+// ReceivedMessage is a message received in peek lock mode, it needs to be settled
+// with the broker it was received from, in receive and delete mode it is already settled
+type ReceivedMessage struct {
+	*servicebus.Message
+	settler messageSettler
+}
+
+type messageSettler interface {
+	complete(ctx context.Context, msg *ReceivedMessage) error
+	abandon(ctx context.Context, msg *ReceivedMessage) error
+	deadLetter(ctx context.Context, msg *ReceivedMessage, err error) error
+	deferMessage(ctx context.Context, msg *ReceivedMessage) error
+	renewLock(ctx context.Context, msg *ReceivedMessage) error
+}
+
+// deletedSettler settles the messages received in receive and delete mode, they were removed
+// from the entity when received so only completing them succeeds
+type deletedSettler struct{}
+
+// Complete Removes the message from the entity
+func (m *ReceivedMessage) Complete(ctx context.Context) error {
+	return m.settler.complete(ctx, m)
+}
+
+// Abandon Releases the message lock so it can be received again
+func (m *ReceivedMessage) Abandon(ctx context.Context) error {
+	return m.settler.abandon(ctx, m)
+}
+
+// DeadLetter Moves the message into the dead letter sub queue of the entity
+func (m *ReceivedMessage) DeadLetter(ctx context.Context, err error) error {
+	return m.settler.deadLetter(ctx, m, err)
+}
+
+// Defer Keeps the message in the entity without delivering it again, it can only be received
+// again by its sequence number
+func (m *ReceivedMessage) Defer(ctx context.Context) error {
+	return m.settler.deferMessage(ctx, m)
+}
+
+// RenewLock Extends the lock of the message by the lock duration of the entity
+func (m *ReceivedMessage) RenewLock(ctx context.Context) error {
+	return m.settler.renewLock(ctx, m)
+}
+
+// SequenceNumber Gets the message sequence number
+func (m *ReceivedMessage) SequenceNumber() int64 {
+	return getSequenceNumber(m.Message)
+}
+
+func newReceiverSettings(options []ReceiverOption) ReceiverSettings {
+	var settings ReceiverSettings
+	for _, option := range options {
+		option(&settings)
+	}
+
+	return settings
+}
+
+func (deletedSettler) complete(ctx context.Context, msg *ReceivedMessage) error {
+	return nil
+}
+
+func (deletedSettler) abandon(ctx context.Context, msg *ReceivedMessage) error {
+	return errors.New("Message " + msg.ID + " was received in receive and delete mode and cannot be abandoned")
+}
+
+func (deletedSettler) deadLetter(ctx context.Context, msg *ReceivedMessage, err error) error {
+	return errors.New("Message " + msg.ID + " was received in receive and delete mode and cannot be dead lettered")
+}
+
+func (deletedSettler) deferMessage(ctx context.Context, msg *ReceivedMessage) error {
+	return errors.New("Message " + msg.ID + " was received in receive and delete mode and cannot be deferred")
+}
+
+func (deletedSettler) renewLock(ctx context.Context, msg *ReceivedMessage) error {
+	return errors.New("Message " + msg.ID + " was received in receive and delete mode and is not locked")
+}
+
+// SubscriptionEntityPath Gets the entity path of a subscription
+func SubscriptionEntityPath(topicName string, subscriptionName string) string {
+	return strings.Join([]string{topicName, "Subscriptions", subscriptionName}, "/")
+}
+
+// DeadLetterEntityPath Gets the entity path of the dead letter sub queue of a queue or subscription
+func DeadLetterEntityPath(entityPath string) string {
+	return strings.Join([]string{entityPath, servicebus.DeadLetterQueueName}, "/")
+}
+
+// SplitSubscriptionEntityPath Gets the topic and subscription names of a subscription entity path
+func SplitSubscriptionEntityPath(entityPath string) (string, string, bool) {
+	parts := strings.Split(strings.Trim(entityPath, "/"), "/")
+	if len(parts) == 3 && strings.EqualFold(parts[1], "Subscriptions") {
+		return parts[0], parts[2], true
+	}
+
+	return "", "", false
+}
+
+func getSequenceNumber(msg *servicebus.Message) int64 {
+	if msg != nil && msg.SystemProperties != nil && msg.SystemProperties.SequenceNumber != nil {
+		return *msg.SystemProperties.SequenceNumber
+	}
+
+	return 0
+}
+
+func isScheduledMessage(msg *servicebus.Message, now time.Time) bool {
+	return msg.SystemProperties != nil &&
+		msg.SystemProperties.ScheduledEnqueueTime != nil &&
+		msg.SystemProperties.ScheduledEnqueueTime.After(now)
+}
@@ -0,0 +1,305 @@
+package servicebuscli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cjlapao/common-go/log"
+	"gopkg.in/yaml.v2"
+)
+
+// Namespace brokers
+const (
+	AzureNamespaceBroker  = "azure"
+	MemoryNamespaceBroker = "memory"
+)
+
+// ConnectionsEntity structure, the named namespaces of the connections file and the one used when
+// a command does not set one
+type ConnectionsEntity struct {
+	CurrentContext string                `json:"currentContext,omitempty" yaml:"currentContext,omitempty"`
+	Namespaces     []NamespaceConnection `json:"namespaces" yaml:"namespaces"`
+}
+
+// NamespaceConnection structure, a named service bus namespace, azure namespaces are authenticated
+// with a connection string, or with their endpoint and a shared access signature or an azure active
+// directory client credential, the in memory broker namespaces keep their state in their own file
+type NamespaceConnection struct {
+	Name             string `json:"name" yaml:"name"`
+	ConnectionString string `json:"connectionString,omitempty" yaml:"connectionString,omitempty"`
+	Endpoint         string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	SASToken         string `json:"sasToken,omitempty" yaml:"sasToken,omitempty"`
+	TenantID         string `json:"tenantId,omitempty" yaml:"tenantId,omitempty"`
+	ClientID         string `json:"clientId,omitempty" yaml:"clientId,omitempty"`
+	ClientSecret     string `json:"clientSecret,omitempty" yaml:"clientSecret,omitempty"`
+	Broker           string `json:"broker,omitempty" yaml:"broker,omitempty"`
+	State            string `json:"state,omitempty" yaml:"state,omitempty"`
+}
+
+// NamespaceSummary structure, used to output the namespaces of the connections file without their
+// connection strings
+type NamespaceSummary struct {
+	Name     string `json:"name" yaml:"name"`
+	Current  bool   `json:"current" yaml:"current"`
+	Broker   string `json:"broker" yaml:"broker"`
+	Endpoint string `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+}
+
+var namespaceSummaryColumns = []string{"name", "current", "broker", "endpoint"}
+
+// DefaultConnectionsPath Gets the path of the connections file, the SERVICEBUS_CONNECTIONS environment
+// variable or .servicebus/connections.yaml in the user home folder
+func DefaultConnectionsPath() string {
+	if path := os.Getenv("SERVICEBUS_CONNECTIONS"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+
+	return filepath.Join(home, ".servicebus", "connections.yaml")
+}
+
+// LoadConnections Loads the connections file, a file that does not exist has no namespaces
+func LoadConnections(filePath string) (*ConnectionsEntity, error) {
+	connections := ConnectionsEntity{
+		Namespaces: make([]NamespaceConnection, 0),
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &connections, nil
+		}
+		return nil, err
+	}
+
+	if err := yaml.Unmarshal(content, &connections); err != nil {
+		return nil, errors.New("Could not read the connections file " + filePath + ": " + err.Error())
+	}
+	for _, namespace := range connections.Namespaces {
+		if err := namespace.Validate(); err != nil {
+			return nil, errors.New("Invalid connections file " + filePath + ": " + err.Error())
+		}
+	}
+
+	return &connections, nil
+}
+
+// Save Saves the connections file, it is only readable by the user as it has connection strings
+func (c *ConnectionsEntity) Save(filePath string) error {
+	content, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filePath), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filePath, content, 0600)
+}
+
+// Get Gets a namespace by its name
+func (c *ConnectionsEntity) Get(name string) (NamespaceConnection, error) {
+	for _, namespace := range c.Namespaces {
+		if strings.EqualFold(namespace.Name, name) {
+			return namespace, nil
+		}
+	}
+
+	return NamespaceConnection{}, errors.New("Namespace " + name + " was not found in the connections file")
+}
+
+// Current Gets the namespace of the current context, the second value is false when no context is set
+func (c *ConnectionsEntity) Current() (NamespaceConnection, bool, error) {
+	if c.CurrentContext == "" {
+		return NamespaceConnection{}, false, nil
+	}
+
+	namespace, err := c.Get(c.CurrentContext)
+	return namespace, err == nil, err
+}
+
+// Use Sets the current context
+func (c *ConnectionsEntity) Use(name string) error {
+	namespace, err := c.Get(name)
+	if err != nil {
+		return err
+	}
+
+	c.CurrentContext = namespace.Name
+	return nil
+}
+
+// Set Adds a namespace or replaces the one with the same name
+func (c *ConnectionsEntity) Set(namespace NamespaceConnection) error {
+	if err := namespace.Validate(); err != nil {
+		return err
+	}
+
+	for i := range c.Namespaces {
+		if strings.EqualFold(c.Namespaces[i].Name, namespace.Name) {
+			c.Namespaces[i] = namespace
+			return nil
+		}
+	}
+	c.Namespaces = append(c.Namespaces, namespace)
+	sort.SliceStable(c.Namespaces, func(i, j int) bool { return c.Namespaces[i].Name < c.Namespaces[j].Name })
+
+	return nil
+}
+
+// Remove Removes a namespace, the current context is cleared when it is the removed one
+func (c *ConnectionsEntity) Remove(name string) error {
+	for i := range c.Namespaces {
+		if strings.EqualFold(c.Namespaces[i].Name, name) {
+			if strings.EqualFold(c.CurrentContext, name) {
+				c.CurrentContext = ""
+			}
+			c.Namespaces = append(c.Namespaces[:i], c.Namespaces[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.New("Namespace " + name + " was not found in the connections file")
+}
+
+// Summaries Gets the namespaces without their connection strings
+func (c *ConnectionsEntity) Summaries() []NamespaceSummary {
+	result := make([]NamespaceSummary, 0, len(c.Namespaces))
+	for _, namespace := range c.Namespaces {
+		result = append(result, NamespaceSummary{
+			Name:     namespace.Name,
+			Current:  strings.EqualFold(namespace.Name, c.CurrentContext),
+			Broker:   namespace.broker(),
+			Endpoint: namespace.Location(),
+		})
+	}
+
+	return result
+}
+
+// PrintNamespaceSummaries Prints the namespaces marking the current context
+func PrintNamespaceSummaries(summaries []NamespaceSummary) {
+	if len(summaries) == 0 {
+		logger.Info("There are no namespaces in the connections file")
+		return
+	}
+
+	for _, summary := range summaries {
+		name := summary.Name
+		if summary.Current {
+			name += " (current)"
+		}
+		logger.LogHighlight("%v: %v %v", log.Info, name, summary.Broker, summary.Endpoint)
+	}
+	logger.Info("Found %v namespaces", fmt.Sprint(len(summaries)))
+}
+
+// WriteNamespaceSummaries Writes the namespaces as json, yaml, a table or csv
+func WriteNamespaceSummaries(w io.Writer, format OutputFormat, summaries []NamespaceSummary) error {
+	rows := make([][]string, 0, len(summaries))
+	for _, summary := range summaries {
+		rows = append(rows, []string{summary.Name, fmt.Sprint(summary.Current), summary.Broker, summary.Endpoint})
+	}
+
+	return writeOutput(w, format, summaries, namespaceSummaryColumns, rows)
+}
+
+// Validate Checks the namespace has a name and a connection string or an endpoint with a shared access
+// signature or a client credential, the in memory broker ones do not need them
+func (n NamespaceConnection) Validate() error {
+	if n.Name == "" {
+		return errors.New("Namespaces need a name")
+	}
+
+	switch n.broker() {
+	case AzureNamespaceBroker:
+		if n.ConnectionString == "" && n.Endpoint == "" {
+			return errors.New("Namespace " + n.Name + " needs a connection string or an endpoint")
+		}
+		if n.ConnectionString == "" && n.SASToken == "" && (n.TenantID == "" || n.ClientID == "" || n.ClientSecret == "") {
+			return errors.New("Namespace " + n.Name + " needs a shared access signature or a tenant id, client id and client secret")
+		}
+	case MemoryNamespaceBroker:
+	default:
+		return errors.New("Invalid broker " + n.Broker + " for namespace " + n.Name + ", use azure or memory")
+	}
+
+	return nil
+}
+
+// Location Gets the endpoint of the namespace, or the state file of the in memory broker
+func (n NamespaceConnection) Location() string {
+	if n.broker() == MemoryNamespaceBroker {
+		return n.statePath()
+	}
+	if n.ConnectionString == "" {
+		return n.Endpoint
+	}
+
+	connection, err := ParseConnectionString(n.ConnectionString)
+	if err != nil {
+		return ""
+	}
+
+	return connection.Endpoint
+}
+
+// Connect Creates a ServiceBusCli for the namespace, unlike Get it is not shared so commands can use
+// two namespaces at the same time
+func (n NamespaceConnection) Connect() (*ServiceBusCli, error) {
+	if err := n.Validate(); err != nil {
+		return nil, err
+	}
+
+	if n.broker() == MemoryNamespaceBroker {
+		broker, err := NewMemoryBroker(n.statePath())
+		if err != nil {
+			return nil, err
+		}
+		return New(broker), nil
+	}
+
+	broker, err := NewAzureBrokerWithCredentials(AzureCredentials{
+		ConnectionString: n.ConnectionString,
+		Endpoint:         n.Endpoint,
+		SASToken:         n.SASToken,
+		TenantID:         n.TenantID,
+		ClientID:         n.ClientID,
+		ClientSecret:     n.ClientSecret,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := New(broker)
+	result.ConnectionString = n.ConnectionString
+
+	return result, nil
+}
+
+func (n NamespaceConnection) broker() string {
+	if n.Broker == "" {
+		return AzureNamespaceBroker
+	}
+
+	return strings.ToLower(n.Broker)
+}
+
+// statePath gets the state file of an in memory broker namespace, each namespace has its own file in
+// the temp folder when it is not set
+func (n NamespaceConnection) statePath() string {
+	if n.State != "" {
+		return n.State
+	}
+
+	return filepath.Join(os.TempDir(), "servicebus-memory-"+strings.ToLower(n.Name)+".json")
+}
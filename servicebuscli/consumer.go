@@ -0,0 +1,249 @@
+package servicebuscli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cjlapao/common-go/log"
+)
+
+// ConsumerFailureAction Enum
+type ConsumerFailureAction int
+
+// ConsumerFailureAction Enum definition
+const (
+	AbandonOnFailure ConsumerFailureAction = iota
+	DeadLetterOnFailure
+)
+
+// defaultHTTPConsumerTimeout is the time a webhook has to answer before the message is considered failed
+const defaultHTTPConsumerTimeout = 60 * time.Second
+
+var environmentVariableNameRegex = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// MessageConsumer processes the received messages of a subscription instead of printing them, the
+// message is completed when the consumer succeeds
+type MessageConsumer interface {
+	Consume(ctx context.Context, entityName string, msg *ReceivedMessage) error
+	String() string
+}
+
+// ExecConsumer structure, runs a command for every message with the body in the standard input and the
+// message properties as SERVICEBUS_ environment variables, the message fails if the exit code is not 0
+type ExecConsumer struct {
+	Command string
+}
+
+// HTTPConsumer structure, posts every message to an url with the broker properties in the BrokerProperties
+// header and the user properties as headers like the service bus rest api, the message fails if the
+// response status is not 2xx
+type HTTPConsumer struct {
+	URL    string
+	Client *http.Client
+}
+
+// ParseConsumerFailureAction Parses the action taken when a consumer fails, abandon or deadletter
+func ParseConsumerFailureAction(value string) (ConsumerFailureAction, error) {
+	switch strings.ToLower(strings.Replace(value, "-", "", -1)) {
+	case "", "abandon":
+		return AbandonOnFailure, nil
+	case "deadletter":
+		return DeadLetterOnFailure, nil
+	}
+
+	return AbandonOnFailure, errors.New("Invalid failure action " + value + ", use abandon or deadletter")
+}
+
+// NewExecConsumer Creates a consumer running a command with the system shell
+func NewExecConsumer(command string) *ExecConsumer {
+	return &ExecConsumer{
+		Command: command,
+	}
+}
+
+// NewHTTPConsumer Creates a consumer posting the messages to an url
+func NewHTTPConsumer(url string) *HTTPConsumer {
+	return &HTTPConsumer{
+		URL: url,
+		Client: &http.Client{
+			Timeout: defaultHTTPConsumerTimeout,
+		},
+	}
+}
+
+// Consume Runs the command for the message, its output is written to the cli output
+func (c *ExecConsumer) Consume(ctx context.Context, entityName string, msg *ReceivedMessage) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", c.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", c.Command)
+	}
+
+	cmd.Stdin = bytes.NewReader(msg.Data)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), messageEnvironment(entityName, msg)...)
+
+	if err := cmd.Run(); err != nil {
+		var exitError *exec.ExitError
+		if errors.As(err, &exitError) {
+			return fmt.Errorf("Command exited with code %v", exitError.ExitCode())
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (c *ExecConsumer) String() string {
+	return c.Command
+}
+
+// Consume Posts the message to the url
+func (c *HTTPConsumer) Consume(ctx context.Context, entityName string, msg *ReceivedMessage) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(msg.Data))
+	if err != nil {
+		return err
+	}
+
+	contentType := msg.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	request.Header.Set("Content-Type", contentType)
+	brokerProperties, err := json.Marshal(messageBrokerProperties(entityName, msg))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("BrokerProperties", string(brokerProperties))
+	for key, value := range msg.UserProperties {
+		request.Header.Set(key, fmt.Sprint(value))
+	}
+
+	response, err := c.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	ioutil.ReadAll(response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return errors.New("Endpoint answered with status " + response.Status)
+	}
+
+	return nil
+}
+
+func (c *HTTPConsumer) String() string {
+	return c.URL
+}
+
+// consumeMessage runs the consumer on a message, the message is settled with the settle mode when the
+// consumer succeeds and abandoned or dead lettered when it fails, unless the messages are not settled
+func (s *ServiceBusCli) consumeMessage(ctx context.Context, entityName string, msg *ReceivedMessage) error {
+	err := s.Consumer.Consume(ctx, entityName, msg)
+	if err == nil {
+		logger.LogHighlight("Message %v was processed by %v", log.Info, msg.ID, s.Consumer.String())
+		return s.settleMessage(ctx, msg)
+	}
+
+	if ctx.Err() != nil {
+		return err
+	}
+	if s.Settle == SettleNone {
+		logger.LogHighlight("Message %v failed in %v: %v", log.Warning, msg.ID, s.Consumer.String(), err.Error())
+		return nil
+	}
+	if s.ConsumerFailureAction == DeadLetterOnFailure {
+		logger.LogHighlight("Message %v failed in %v: %v, dead lettering it", log.Warning, msg.ID, s.Consumer.String(), err.Error())
+		return msg.DeadLetter(ctx, err)
+	}
+
+	logger.LogHighlight("Message %v failed in %v: %v, abandoning it", log.Warning, msg.ID, s.Consumer.String(), err.Error())
+	return msg.Abandon(ctx)
+}
+
+// messageBrokerProperties gets the system properties of a message using the service bus rest api names
+func messageBrokerProperties(entityName string, msg *ReceivedMessage) map[string]interface{} {
+	properties := map[string]interface{}{
+		"MessageId":     msg.ID,
+		"DeliveryCount": msg.DeliveryCount,
+		"Entity":        entityName,
+	}
+	setIfNotEmpty := func(name string, value string) {
+		if value != "" {
+			properties[name] = value
+		}
+	}
+	setIfNotEmpty("Label", msg.Label)
+	setIfNotEmpty("CorrelationId", msg.CorrelationID)
+	setIfNotEmpty("ContentType", msg.ContentType)
+	setIfNotEmpty("ReplyTo", msg.ReplyTo)
+	setIfNotEmpty("To", msg.To)
+	if msg.SessionID != nil {
+		setIfNotEmpty("SessionId", *msg.SessionID)
+	}
+	if msg.SystemProperties != nil {
+		if msg.SystemProperties.SequenceNumber != nil {
+			properties["SequenceNumber"] = *msg.SystemProperties.SequenceNumber
+		}
+		if msg.SystemProperties.EnqueuedTime != nil {
+			properties["EnqueuedTimeUtc"] = msg.SystemProperties.EnqueuedTime.UTC().Format(time.RFC3339Nano)
+		}
+	}
+
+	return properties
+}
+
+// messageEnvironment gets the environment variables passed to the exec consumer, the broker properties
+// are SERVICEBUS_ variables, the user properties are SERVICEBUS_PROPERTY_ variables and the whole
+// set of user properties is in SERVICEBUS_PROPERTIES as json
+func messageEnvironment(entityName string, msg *ReceivedMessage) []string {
+	brokerProperties := messageBrokerProperties(entityName, msg)
+	names := make([]string, 0, len(brokerProperties))
+	for name := range brokerProperties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	environment := make([]string, 0, len(brokerProperties)+len(msg.UserProperties)+1)
+	for _, name := range names {
+		environment = append(environment, environmentVariableName("SERVICEBUS_", name)+"="+fmt.Sprint(brokerProperties[name]))
+	}
+	for key, value := range msg.UserProperties {
+		environment = append(environment, environmentVariableName("SERVICEBUS_PROPERTY_", key)+"="+fmt.Sprint(value))
+	}
+
+	userProperties, _ := json.Marshal(msg.UserProperties)
+	environment = append(environment, "SERVICEBUS_PROPERTIES="+string(userProperties))
+
+	return environment
+}
+
+// environmentVariableName converts a property name into an environment variable name, MessageId becomes
+// MESSAGE_ID and X-TenantId becomes X_TENANT_ID
+func environmentVariableName(prefix string, name string) string {
+	var result strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if i > 0 && r >= 'A' && r <= 'Z' && runes[i-1] >= 'a' && runes[i-1] <= 'z' {
+			result.WriteRune('_')
+		}
+		result.WriteRune(r)
+	}
+
+	return prefix + environmentVariableNameRegex.ReplaceAllString(strings.ToUpper(result.String()), "_")
+}
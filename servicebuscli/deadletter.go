@@ -0,0 +1,352 @@
+package servicebuscli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+// Dead letter user properties set by the broker when a message is dead lettered
+const (
+	DeadLetterReasonProperty      = "DeadLetterReason"
+	DeadLetterDescriptionProperty = "DeadLetterErrorDescription"
+)
+
+// DeadLetterHandler is executed for every selected dead letter message before it is completed
+type DeadLetterHandler func(ctx context.Context, msg *servicebus.Message) error
+
+// PeekQueueDeadLetters Peeks the messages in the dead letter sub queue of a queue without locking them
+func (s *ServiceBusCli) PeekQueueDeadLetters(queueName string, maxMessages int) ([]*servicebus.Message, error) {
+	var commonError error
+	if queueName == "" {
+		commonError = errors.New("Queue cannot be null")
+		logger.Error(commonError.Error())
+		return nil, commonError
+	}
+
+	logger.LogHighlight("Peeking dead letters for queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
+	return s.peekDeadLetters(queueName, maxMessages)
+}
+
+// PeekSubscriptionDeadLetters Peeks the messages in the dead letter sub queue of a subscription without locking them
+func (s *ServiceBusCli) PeekSubscriptionDeadLetters(topicName string, subscriptionName string, maxMessages int) ([]*servicebus.Message, error) {
+	var commonError error
+	if topicName == "" || subscriptionName == "" {
+		commonError = errors.New("Topic and subscription cannot be null")
+		logger.Error(commonError.Error())
+		return nil, commonError
+	}
+
+	logger.LogHighlight("Peeking dead letters for subscription %v on topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+	return s.peekDeadLetters(SubscriptionEntityPath(topicName, subscriptionName), maxMessages)
+}
+
+// ResubmitQueueDeadLetters Sends the dead letters of a queue back to the queue, if no sequence numbers
+// are passed all of the dead letters will be resubmitted. The messages get a new id unless
+// keepMessageID is set
+func (s *ServiceBusCli) ResubmitQueueDeadLetters(queueName string, sequenceNumbers []int64, keepMessageID bool) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Broker.Name())
+		return 0, commonError
+	}
+
+	logger.LogHighlight("Resubmitting dead letters to queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
+	if keepMessageID && queue.RequiresDuplicateDetection != nil && *queue.RequiresDuplicateDetection {
+		logger.LogHighlight("Queue %v detects duplicates, the dead letters still in its detection window are dropped", log.Warning, queueName)
+	}
+	resubmitted, err := s.processDeadLetters(queueName, sequenceNumbers, func(ctx context.Context, msg *servicebus.Message) error {
+		return s.Broker.Send(ctx, queueName, NewMessageFromReceived(msg, keepMessageID))
+	})
+
+	logger.LogHighlight("Resubmitted %v dead letters to queue %v in service bus %v", log.Info, fmt.Sprint(resubmitted), queueName, s.Broker.Name())
+	return resubmitted, err
+}
+
+// ResubmitSubscriptionDeadLetters Sends the dead letters of a subscription back to its topic, if no sequence
+// numbers are passed all of the dead letters will be resubmitted. The messages get a new id unless
+// keepMessageID is set
+func (s *ServiceBusCli) ResubmitSubscriptionDeadLetters(topicName string, subscriptionName string, sequenceNumbers []int64, keepMessageID bool) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
+		return 0, commonError
+	}
+
+	logger.LogHighlight("Resubmitting dead letters of subscription %v to topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+	logger.LogHighlight("Messages are sent to the topic, every subscription matching them will receive a copy", log.Warning)
+	if keepMessageID && topic.RequiresDuplicateDetection != nil && *topic.RequiresDuplicateDetection {
+		logger.LogHighlight("Topic %v detects duplicates, the dead letters still in its detection window are dropped", log.Warning, topicName)
+	}
+	resubmitted, err := s.processDeadLetters(SubscriptionEntityPath(topicName, subscriptionName), sequenceNumbers, func(ctx context.Context, msg *servicebus.Message) error {
+		return s.Broker.Send(ctx, topicName, NewMessageFromReceived(msg, keepMessageID))
+	})
+
+	logger.LogHighlight("Resubmitted %v dead letters to topic %v in service bus %v", log.Info, fmt.Sprint(resubmitted), topicName, s.Broker.Name())
+	return resubmitted, err
+}
+
+// PurgeQueueDeadLetters Removes the dead letters of a queue, if no sequence numbers are passed all of
+// the dead letters will be removed
+func (s *ServiceBusCli) PurgeQueueDeadLetters(queueName string, sequenceNumbers []int64) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Broker.Name())
+		return 0, commonError
+	}
+
+	logger.LogHighlight("Purging dead letters from queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
+	purged, err := s.processDeadLetters(queueName, sequenceNumbers, nil)
+
+	logger.LogHighlight("Purged %v dead letters from queue %v in service bus %v", log.Info, fmt.Sprint(purged), queueName, s.Broker.Name())
+	return purged, err
+}
+
+// PurgeSubscriptionDeadLetters Removes the dead letters of a subscription, if no sequence numbers are passed
+// all of the dead letters will be removed
+func (s *ServiceBusCli) PurgeSubscriptionDeadLetters(topicName string, subscriptionName string, sequenceNumbers []int64) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
+		return 0, commonError
+	}
+
+	logger.LogHighlight("Purging dead letters from subscription %v on topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+	purged, err := s.processDeadLetters(SubscriptionEntityPath(topicName, subscriptionName), sequenceNumbers, nil)
+
+	logger.LogHighlight("Purged %v dead letters from subscription %v on topic %v in service bus %v", log.Info, fmt.Sprint(purged), subscriptionName, topicName, s.Broker.Name())
+	return purged, err
+}
+
+// PrintDeadLetterMessage Prints a dead letter message with the reason it was dead lettered
+func PrintDeadLetterMessage(msg *servicebus.Message) {
+	sequenceNumber := ""
+	enqueuedTime := ""
+	if msg.SystemProperties != nil {
+		if msg.SystemProperties.SequenceNumber != nil {
+			sequenceNumber = fmt.Sprint(*msg.SystemProperties.SequenceNumber)
+		}
+		if msg.SystemProperties.EnqueuedTime != nil {
+			enqueuedTime = msg.SystemProperties.EnqueuedTime.String()
+		}
+	}
+
+	reason, description := GetDeadLetterReason(msg)
+	logger.LogHighlight("%v Dead letter %v (sequence: %v, delivery count: %v) with label %v", log.Info, enqueuedTime, msg.ID, sequenceNumber, fmt.Sprint(msg.DeliveryCount), msg.Label)
+	logger.LogHighlight("Reason: %v", log.Info, reason)
+	logger.LogHighlight("Description: %v", log.Info, description)
+	logger.Info("User Properties:")
+	jsonString, _ := json.MarshalIndent(msg.UserProperties, "", "  ")
+	fmt.Println(string(jsonString))
+	logger.Info("Message Body:")
+	fmt.Println(FormatMessageBody(msg.ContentType, msg.Data))
+}
+
+// GetDeadLetterReason Gets the dead letter reason and description from the message user properties
+func GetDeadLetterReason(msg *servicebus.Message) (string, string) {
+	reason := ""
+	description := ""
+	if msg.UserProperties != nil {
+		if value, ok := msg.UserProperties[DeadLetterReasonProperty]; ok {
+			reason = fmt.Sprint(value)
+		}
+		if value, ok := msg.UserProperties[DeadLetterDescriptionProperty]; ok {
+			description = fmt.Sprint(value)
+		}
+	}
+
+	return reason, description
+}
+
+func (s *ServiceBusCli) peekDeadLetters(entityPath string, maxMessages int) ([]*servicebus.Message, error) {
+	result := make([]*servicebus.Message, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	iterator, err := s.Broker.Peek(ctx, DeadLetterEntityPath(entityPath))
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	for maxMessages <= 0 || len(result) < maxMessages {
+		msg, err := iterator.Next(ctx)
+		if err != nil {
+			var noMessages servicebus.ErrNoMessages
+			if errors.As(err, &noMessages) {
+				break
+			}
+			logger.Error(err.Error())
+			return result, err
+		}
+		result = append(result, msg)
+	}
+
+	return result, nil
+}
+
+// processDeadLetters receives the dead letters of an entity one by one, running the handler on the
+// selected ones and completing them. When sequence numbers are passed the dead letters are peeked first,
+// the ones that are not found are reported and the scan stops once the others were handled, the dead
+// letters received on the way are kept locked until the scan ends and then abandoned
+func (s *ServiceBusCli) processDeadLetters(entityPath string, sequenceNumbers []int64, handler DeadLetterHandler) (int, error) {
+	processed := 0
+	targets := make(map[int64]bool)
+	if len(sequenceNumbers) > 0 {
+		peeked, err := s.peekDeadLetters(entityPath, 0)
+		if err != nil {
+			return processed, err
+		}
+		for _, msg := range peeked {
+			if sequenceNumber := getSequenceNumber(msg); containsSequenceNumber(sequenceNumbers, sequenceNumber) {
+				targets[sequenceNumber] = true
+			}
+		}
+		for _, sequenceNumber := range sequenceNumbers {
+			if !targets[sequenceNumber] {
+				logger.LogHighlight("Could not find dead letter with sequence number %v in %v", log.Warning, fmt.Sprint(sequenceNumber), entityPath)
+			}
+		}
+		if len(targets) == 0 {
+			return processed, nil
+		}
+	}
+
+	receiveCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	receiver, err := s.Broker.NewReceiver(receiveCtx, DeadLetterEntityPath(entityPath))
+	if err != nil {
+		logger.Error(err.Error())
+		return processed, err
+	}
+	defer receiver.Close(receiveCtx)
+
+	var mutex sync.Mutex
+	skipped := make(map[int64]*ReceivedMessage)
+	renewCtx, stopRenewal := context.WithCancel(receiveCtx)
+	go renewHeldLocks(renewCtx, s.entityLockDuration(receiveCtx, entityPath), func() []*ReceivedMessage {
+		mutex.Lock()
+		defer mutex.Unlock()
+		held := make([]*ReceivedMessage, 0, len(skipped))
+		for _, msg := range skipped {
+			held = append(held, msg)
+		}
+		return held
+	})
+	hold := func(msg *ReceivedMessage) {
+		mutex.Lock()
+		skipped[msg.SequenceNumber()] = msg
+		mutex.Unlock()
+	}
+
+	defer func() {
+		stopRenewal()
+		ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+		defer cancel()
+		for _, msg := range skipped {
+			msg.Abandon(ctx)
+		}
+		for _, sequenceNumber := range sequenceNumbers {
+			if targets[sequenceNumber] {
+				logger.LogHighlight("Dead letter with sequence number %v was not received from %v", log.Warning, fmt.Sprint(sequenceNumber), entityPath)
+			}
+		}
+	}()
+
+	seen := make(map[int64]bool)
+	for len(sequenceNumbers) == 0 || len(targets) > 0 {
+		var handlerError error
+		done := false
+
+		ctx, cancel := context.WithTimeout(receiveCtx, 10*time.Second)
+		err := receiver.ReceiveOne(ctx, func(ctx context.Context, msg *ReceivedMessage) error {
+			sequenceNumber := msg.SequenceNumber()
+			if len(sequenceNumbers) == 0 {
+				// every dead letter was received once, the ones received again were released by the handler
+				if seen[sequenceNumber] {
+					done = true
+					hold(msg)
+					return nil
+				}
+				seen[sequenceNumber] = true
+			} else if !targets[sequenceNumber] {
+				// a dead letter whose lock could not be renewed is received again and held with its new lock
+				hold(msg)
+				return nil
+			}
+
+			if handler != nil {
+				// the lock of the dead letter is also renewed while the handler runs
+				hold(msg)
+				err := handler(ctx, msg.Message)
+				mutex.Lock()
+				delete(skipped, sequenceNumber)
+				mutex.Unlock()
+				if err != nil {
+					handlerError = err
+					return msg.Abandon(ctx)
+				}
+			}
+
+			processed++
+			delete(targets, sequenceNumber)
+			return msg.Complete(ctx)
+		})
+		timedOut := ctx.Err() != nil
+		cancel()
+
+		if handlerError != nil {
+			logger.Error(handlerError.Error())
+			return processed, handlerError
+		}
+		if timedOut || done {
+			break
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			return processed, err
+		}
+	}
+
+	return processed, nil
+}
+
+func containsSequenceNumber(sequenceNumbers []int64, sequenceNumber int64) bool {
+	if len(sequenceNumbers) == 0 {
+		return true
+	}
+
+	for _, value := range sequenceNumbers {
+		if value == sequenceNumber {
+			return true
+		}
+	}
+
+	return false
+}
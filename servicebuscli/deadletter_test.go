@@ -0,0 +1,122 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestResubmitQueueDeadLettersDuplicateDetection(t *testing.T) {
+	tests := []struct {
+		name          string
+		keepMessageID bool
+		want          int
+	}{
+		{"new message id", false, 1},
+		{"original message id", true, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sbcli := newMemoryServiceBusCli(t)
+			queue := NewQueue("orders")
+			queue.DuplicateDetectionWindow = 10 * time.Minute
+			if err := sbcli.CreateQueue(queue); err != nil {
+				t.Fatalf("CreateQueue() error = %v", err)
+			}
+
+			msg := servicebus.NewMessageFromString("order")
+			msg.ID = "order-1"
+			if err := sbcli.Broker.Send(context.Background(), "orders", msg); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+			sequenceNumber := deadLetterOne(t, sbcli, "orders")
+
+			resubmitted, err := sbcli.ResubmitQueueDeadLetters("orders", []int64{sequenceNumber}, test.keepMessageID)
+			if err != nil || resubmitted != 1 {
+				t.Fatalf("ResubmitQueueDeadLetters() = %v, %v, want 1 resubmitted", resubmitted, err)
+			}
+
+			if got := countMessages(t, sbcli, "orders"); got != test.want {
+				t.Errorf("messages in the queue = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestProcessDeadLettersBySequenceNumber(t *testing.T) {
+	sbcli := newMemoryServiceBusCli(t)
+	queue := NewQueue("orders")
+	queue.LockDuration = time.Second
+	if err := sbcli.CreateQueue(queue); err != nil {
+		t.Fatalf("CreateQueue() error = %v", err)
+	}
+	sequenceNumbers := make([]int64, 0)
+	for _, body := range []string{"kept", "first", "second"} {
+		if err := sbcli.Broker.Send(context.Background(), "orders", servicebus.NewMessageFromString(body)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+		sequenceNumbers = append(sequenceNumbers, deadLetterOne(t, sbcli, "orders"))
+	}
+
+	// the slow handler outlives the lock of the kept dead letter, it is renewed so the scan does not
+	// receive it again and stop before the second one, the missing sequence number is reported
+	handled := make([]string, 0)
+	processed, err := sbcli.processDeadLetters("orders", []int64{sequenceNumbers[1], sequenceNumbers[2], 999}, func(ctx context.Context, msg *servicebus.Message) error {
+		handled = append(handled, string(msg.Data))
+		time.Sleep(1500 * time.Millisecond)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("processDeadLetters() error = %v", err)
+	}
+	if processed != 2 || len(handled) != 2 {
+		t.Errorf("processDeadLetters() = %v, handled %v, want the first and second dead letters", processed, handled)
+	}
+	if got := countMessages(t, sbcli, DeadLetterEntityPath("orders")); got != 1 {
+		t.Errorf("dead letters = %v, want the kept one", got)
+	}
+}
+
+// deadLetterOne receives the next message of an entity and dead letters it, returning its sequence number
+func deadLetterOne(t *testing.T, sbcli *ServiceBusCli, entityPath string) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	receiver, err := sbcli.Broker.NewReceiver(ctx, entityPath)
+	if err != nil {
+		t.Fatalf("NewReceiver(%v) error = %v", entityPath, err)
+	}
+	defer receiver.Close(ctx)
+
+	var sequenceNumber int64
+	err = receiver.ReceiveOne(ctx, func(ctx context.Context, msg *ReceivedMessage) error {
+		sequenceNumber = msg.SequenceNumber()
+		return msg.DeadLetter(ctx, errors.New("test"))
+	})
+	if err != nil {
+		t.Fatalf("ReceiveOne(%v) error = %v", entityPath, err)
+	}
+
+	return sequenceNumber
+}
+
+func countMessages(t *testing.T, sbcli *ServiceBusCli, entityPath string) int {
+	iterator, err := sbcli.Broker.Peek(context.Background(), entityPath)
+	if err != nil {
+		t.Fatalf("Peek(%v) error = %v", entityPath, err)
+	}
+
+	count := 0
+	for !iterator.Done() {
+		if _, err := iterator.Next(context.Background()); err != nil {
+			break
+		}
+		count++
+	}
+
+	return count
+}
@@ -0,0 +1,262 @@
+package servicebuscli
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	"gopkg.in/yaml.v2"
+)
+
+// Envelope profile names of the built in profiles
+const (
+	ForwardingProfileName  = "forwarding"
+	UnoProfileName         = "uno"
+	CloudEventsProfileName = "cloudevents"
+	NoneProfileName        = "none"
+)
+
+// DefaultTenantID is the tenant used by the built in profiles when none is set
+const DefaultTenantID = "11111111-1111-1111-1111-555555550001"
+
+var envelopeVariableRegex = regexp.MustCompile(`\{\{\s*([\w-]+)\s*\}\}`)
+
+// EnvelopeProfilesEntity structure, the format of the envelope profiles file
+type EnvelopeProfilesEntity struct {
+	Profiles []EnvelopeProfile `json:"profiles" yaml:"profiles"`
+}
+
+// EnvelopeProfile structure, an envelope profile defines the label, content type and user properties
+// of the messages sent with it, their values can use {{variable}} templates with the profile variables
+// or the generated entity, xid, uuid and now values
+type EnvelopeProfile struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Label       string `json:"label,omitempty" yaml:"label,omitempty"`
+	ContentType string `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	// Variables are the variables of the profile with their default value
+	Variables map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+	// Required are the variables that need a value to send a message
+	Required []string `json:"required,omitempty" yaml:"required,omitempty"`
+	// Properties are the user properties of the message, properties with an empty value are not sent
+	Properties map[string]string `json:"properties,omitempty" yaml:"properties,omitempty"`
+}
+
+// Envelope structure, the label, content type and user properties rendered from a profile
+type Envelope struct {
+	Label       string
+	ContentType string
+	Properties  map[string]interface{}
+}
+
+// DefaultEnvelopeProfiles Gets the built in envelope profiles
+func DefaultEnvelopeProfiles() []EnvelopeProfile {
+	return []EnvelopeProfile{
+		{
+			Name:        ForwardingProfileName,
+			Description: "Forwarding topology message type headers",
+			Label:       "{{domain}}.{{name}}",
+			Variables: map[string]string{
+				"domain":  "",
+				"name":    "",
+				"sender":  "ServiceBus.Tools",
+				"tenant":  DefaultTenantID,
+				"version": "1.0",
+			},
+			Required: []string{"domain", "name"},
+			Properties: map[string]string{
+				"X-MsgTypeVersion": "{{version}}",
+				"X-MsgDomain":      "{{domain}}",
+				"X-MsgName":        "{{name}}",
+				"X-Sender":         "{{sender}}",
+				"X-TenantId":       "{{tenant}}",
+				"Diagnostic-Id":    "{{xid}}",
+			},
+		},
+		{
+			Name:        UnoProfileName,
+			Description: "Uno serialization and tenant headers",
+			Label:       "{{entity}}",
+			Variables: map[string]string{
+				"serialization": "1",
+				"tenant":        DefaultTenantID,
+			},
+			Properties: map[string]string{
+				"Serialization": "{{serialization}}",
+				"TenantId":      "{{tenant}}",
+			},
+		},
+		{
+			Name:        CloudEventsProfileName,
+			Description: "CloudEvents 1.0 attributes using the amqp binary content mode",
+			Label:       "{{type}}",
+			ContentType: "application/json",
+			Variables: map[string]string{
+				"source":  "/servicebus-tools",
+				"type":    "ServiceBus.Tools.Message",
+				"subject": "",
+			},
+			Properties: map[string]string{
+				"cloudEvents_specversion": "1.0",
+				"cloudEvents_id":          "{{uuid}}",
+				"cloudEvents_source":      "{{source}}",
+				"cloudEvents_type":        "{{type}}",
+				"cloudEvents_subject":     "{{subject}}",
+				"cloudEvents_time":        "{{now}}",
+			},
+		},
+		{
+			Name:        NoneProfileName,
+			Description: "No envelope, only the label and properties set in the command",
+		},
+	}
+}
+
+// LoadEnvelopeProfiles Loads the envelope profiles of a json or yaml file, the format is chosen by the
+// file extension defaulting to yaml, file profiles replace the built in profiles with the same name
+func LoadEnvelopeProfiles(filePath string) ([]EnvelopeProfile, error) {
+	profiles := DefaultEnvelopeProfiles()
+	if filePath == "" {
+		return profiles, nil
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var file EnvelopeProfilesEntity
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		err = json.Unmarshal(content, &file)
+	default:
+		err = yaml.Unmarshal(content, &file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, profile := range file.Profiles {
+		if profile.Name == "" {
+			return nil, errors.New("Envelope profiles in " + filePath + " need a name")
+		}
+
+		replaced := false
+		for i := range profiles {
+			if strings.EqualFold(profiles[i].Name, profile.Name) {
+				profiles[i] = profile
+				replaced = true
+			}
+		}
+		if !replaced {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	return profiles, nil
+}
+
+// FindEnvelopeProfile Finds a profile by its name
+func FindEnvelopeProfile(profiles []EnvelopeProfile, name string) (*EnvelopeProfile, error) {
+	names := make([]string, 0, len(profiles))
+	for i := range profiles {
+		if strings.EqualFold(profiles[i].Name, name) {
+			return &profiles[i], nil
+		}
+		names = append(names, profiles[i].Name)
+	}
+
+	return nil, errors.New("Envelope profile " + name + " was not found, available profiles are " + strings.Join(names, ", "))
+}
+
+// VariableNames Gets the sorted names of the profile variables, including the required ones
+func (p EnvelopeProfile) VariableNames() []string {
+	names := make([]string, 0, len(p.Variables)+len(p.Required))
+	for name := range p.Variables {
+		names = append(names, name)
+	}
+	for _, name := range p.Required {
+		if _, ok := p.Variables[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Apply Renders the profile envelope for a message sent to an entity, the variables replace the
+// profile defaults when they are not empty
+func (p EnvelopeProfile) Apply(entityName string, variables map[string]string) (Envelope, error) {
+	id, err := newUUID()
+	if err != nil {
+		return Envelope{}, err
+	}
+
+	values := map[string]string{
+		"entity": entityName,
+		"xid":    xid.New().String(),
+		"uuid":   id,
+		"now":    time.Now().UTC().Format(time.RFC3339),
+	}
+	for name, value := range p.Variables {
+		values[name] = value
+	}
+	for name, value := range variables {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	for _, name := range p.Required {
+		if values[name] == "" {
+			return Envelope{}, errors.New("Envelope profile " + p.Name + " needs a value for " + name + ", use --" + name + " or --var=" + name + ":value")
+		}
+	}
+
+	result := Envelope{
+		ContentType: p.ContentType,
+	}
+
+	label, err := renderEnvelopeTemplate(p.Label, values)
+	if err != nil {
+		return Envelope{}, err
+	}
+	result.Label = label
+
+	if len(p.Properties) > 0 {
+		result.Properties = make(map[string]interface{})
+	}
+	for name, template := range p.Properties {
+		value, err := renderEnvelopeTemplate(template, values)
+		if err != nil {
+			return Envelope{}, err
+		}
+		if value != "" {
+			result.Properties[name] = value
+		}
+	}
+
+	return result, nil
+}
+
+// renderEnvelopeTemplate replaces the {{variable}} templates with their value, unknown variables
+// are an error
+func renderEnvelopeTemplate(template string, values map[string]string) (string, error) {
+	var commonError error
+	result := envelopeVariableRegex.ReplaceAllStringFunc(template, func(match string) string {
+		name := envelopeVariableRegex.FindStringSubmatch(match)[1]
+		value, ok := values[name]
+		if !ok && commonError == nil {
+			commonError = errors.New("Unknown envelope variable " + name + " in " + template)
+		}
+		return value
+	})
+
+	return result, commonError
+}
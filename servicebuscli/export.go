@@ -0,0 +1,308 @@
+package servicebuscli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+// ExportQueueMessages Exports the messages of a queue into a json lines file, when drain is set the
+// messages are received and removed from the queue otherwise they are only peeked
+func (s *ServiceBusCli) ExportQueueMessages(queueName string, filePath string, drain bool, maxMessages int) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Broker.Name())
+		return 0, commonError
+	}
+
+	logger.LogHighlight("Exporting messages from queue %v in service bus %v to %v", log.Info, queueName, s.Broker.Name(), filePath)
+	var exported int
+	if drain {
+		receiver, receiverErr := s.Broker.NewReceiver(ctx, queueName)
+		if receiverErr != nil {
+			logger.Error(receiverErr.Error())
+			return 0, receiverErr
+		}
+		defer receiver.Close(ctx)
+		exported, err = exportReceivedMessages(receiver, filePath, maxMessages)
+	} else {
+		iterator, iteratorErr := s.Broker.Peek(ctx, queueName)
+		if iteratorErr != nil {
+			logger.Error(iteratorErr.Error())
+			return 0, iteratorErr
+		}
+		exported, err = exportPeekedMessages(iterator, filePath, maxMessages)
+	}
+
+	if err != nil {
+		logger.Error(err.Error())
+		return exported, err
+	}
+
+	logger.LogHighlight("Exported %v messages from queue %v in service bus %v", log.Info, fmt.Sprint(exported), queueName, s.Broker.Name())
+	return exported, nil
+}
+
+// ExportSubscriptionMessages Exports the messages of a subscription into a json lines file, when drain is set
+// the messages are received and removed from the subscription otherwise they are only peeked
+func (s *ServiceBusCli) ExportSubscriptionMessages(topicName string, subscriptionName string, filePath string, drain bool, maxMessages int) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscription, err := s.Broker.GetSubscription(ctx, topicName, subscriptionName)
+	if err != nil || subscription == nil {
+		commonError = errors.New("Could not find subscription " + subscriptionName + " on topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find subscription %v on topic %v in service bus %v", log.Error, subscriptionName, topicName, s.Broker.Name())
+		return 0, commonError
+	}
+	entityPath := SubscriptionEntityPath(topicName, subscriptionName)
+
+	logger.LogHighlight("Exporting messages from subscription %v on topic %v in service bus %v to %v", log.Info, subscriptionName, topicName, s.Broker.Name(), filePath)
+	var exported int
+	if drain {
+		receiver, receiverErr := s.Broker.NewReceiver(ctx, entityPath)
+		if receiverErr != nil {
+			logger.Error(receiverErr.Error())
+			return 0, receiverErr
+		}
+		defer receiver.Close(ctx)
+		exported, err = exportReceivedMessages(receiver, filePath, maxMessages)
+	} else {
+		iterator, iteratorErr := s.Broker.Peek(ctx, entityPath)
+		if iteratorErr != nil {
+			logger.Error(iteratorErr.Error())
+			return 0, iteratorErr
+		}
+		exported, err = exportPeekedMessages(iterator, filePath, maxMessages)
+	}
+
+	if err != nil {
+		logger.Error(err.Error())
+		return exported, err
+	}
+
+	logger.LogHighlight("Exported %v messages from subscription %v on topic %v in service bus %v", log.Info, fmt.Sprint(exported), subscriptionName, topicName, s.Broker.Name())
+	return exported, nil
+}
+
+// ImportQueueMessages Replays the messages of a json lines file into a queue
+func (s *ServiceBusCli) ImportQueueMessages(queueName string, filePath string) (int, int, error) {
+	logger.LogHighlight("Importing messages from %v to queue %v in service bus %v", log.Info, filePath, queueName, s.Broker.Name())
+	sent, failed, err := importMessages(filePath, func(entity MessageEntity) error {
+		return s.SendQueueMessageEntity(queueName, entity)
+	})
+
+	logger.LogHighlight("Imported %v messages to queue %v in service bus %v, %v failed", log.Info, fmt.Sprint(sent), queueName, s.Broker.Name(), fmt.Sprint(failed))
+	return sent, failed, err
+}
+
+// ImportTopicMessages Replays the messages of a json lines file into a topic
+func (s *ServiceBusCli) ImportTopicMessages(topicName string, filePath string) (int, int, error) {
+	logger.LogHighlight("Importing messages from %v to topic %v in service bus %v", log.Info, filePath, topicName, s.Broker.Name())
+	sent, failed, err := importMessages(filePath, func(entity MessageEntity) error {
+		return s.SendTopicMessageEntity(topicName, entity)
+	})
+
+	logger.LogHighlight("Imported %v messages to topic %v in service bus %v, %v failed", log.Info, fmt.Sprint(sent), topicName, s.Broker.Name(), fmt.Sprint(failed))
+	return sent, failed, err
+}
+
+// ReadMessageEntities Reads a json lines file into message entities, use - to read from the standard input
+func ReadMessageEntities(filePath string, handler func(line int, entity MessageEntity, err error) error) error {
+	reader, closeReader, err := openInput(filePath)
+	if err != nil {
+		return err
+	}
+	defer closeReader()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		content := scanner.Bytes()
+		if len(content) == 0 {
+			continue
+		}
+
+		var entity MessageEntity
+		err := json.Unmarshal(content, &entity)
+		if err := handler(line, entity, err); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// LoadMessageEntities Loads the messages of a file, the file can either contain a single json
+// message or a json lines file as generated by the export command
+func LoadMessageEntities(filePath string) ([]MessageEntity, error) {
+	reader, closeReader, err := openInput(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer closeReader()
+
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	var entity MessageEntity
+	if err := json.Unmarshal(content, &entity); err == nil {
+		return []MessageEntity{entity}, nil
+	}
+
+	result := make([]MessageEntity, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entity MessageEntity
+		if err := json.Unmarshal(scanner.Bytes(), &entity); err != nil {
+			return nil, errors.New("Could not parse line " + fmt.Sprint(line) + ": " + err.Error())
+		}
+		result = append(result, entity)
+	}
+
+	return result, scanner.Err()
+}
+
+func importMessages(filePath string, send func(entity MessageEntity) error) (int, int, error) {
+	sent := 0
+	failed := 0
+	err := ReadMessageEntities(filePath, func(line int, entity MessageEntity, err error) error {
+		if err != nil {
+			logger.Error("Could not parse line %v: %v", fmt.Sprint(line), err.Error())
+			failed++
+			return nil
+		}
+		if err := send(entity); err != nil {
+			failed++
+			return nil
+		}
+		sent++
+		return nil
+	})
+
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	return sent, failed, err
+}
+
+func exportPeekedMessages(iterator servicebus.MessageIterator, filePath string, maxMessages int) (int, error) {
+	writer, closeWriter, err := openOutput(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer closeWriter()
+
+	encoder := json.NewEncoder(writer)
+	exported := 0
+	for maxMessages <= 0 || exported < maxMessages {
+		ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+		msg, err := iterator.Next(ctx)
+		cancel()
+		if err != nil {
+			var noMessages servicebus.ErrNoMessages
+			if errors.As(err, &noMessages) {
+				break
+			}
+			return exported, err
+		}
+
+		if err := encoder.Encode(NewMessageEntity(msg)); err != nil {
+			return exported, err
+		}
+		exported++
+	}
+
+	return exported, nil
+}
+
+func exportReceivedMessages(receiver Receiver, filePath string, maxMessages int) (int, error) {
+	writer, closeWriter, err := openOutput(filePath)
+	if err != nil {
+		return 0, err
+	}
+	defer closeWriter()
+
+	encoder := json.NewEncoder(writer)
+	exported := 0
+	for maxMessages <= 0 || exported < maxMessages {
+		var handlerError error
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		err := receiver.ReceiveOne(ctx, func(ctx context.Context, msg *ReceivedMessage) error {
+			if err := encoder.Encode(NewMessageEntity(msg.Message)); err != nil {
+				handlerError = err
+				return msg.Abandon(ctx)
+			}
+			exported++
+			return msg.Complete(ctx)
+		})
+		timedOut := ctx.Err() != nil
+		cancel()
+
+		if handlerError != nil {
+			return exported, handlerError
+		}
+		if timedOut {
+			break
+		}
+		if err != nil {
+			return exported, err
+		}
+	}
+
+	return exported, nil
+}
+
+func openOutput(filePath string) (io.Writer, func(), error) {
+	if filePath == "" || filePath == "-" {
+		return os.Stdout, func() {}, nil
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, func() { file.Close() }, nil
+}
+
+func openInput(filePath string) (io.Reader, func(), error) {
+	if filePath == "" || filePath == "-" {
+		return os.Stdin, func() {}, nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, func() { file.Close() }, nil
+}
@@ -0,0 +1,57 @@
+package servicebuscli
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestExportImportQueueMessages(t *testing.T) {
+	sbcli := newMemoryServiceBusCli(t)
+	for _, name := range []string{"source", "target"} {
+		if err := sbcli.CreateQueue(NewQueue(name)); err != nil {
+			t.Fatalf("CreateQueue(%v) error = %v", name, err)
+		}
+	}
+
+	bodies := [][]byte{
+		[]byte(`{"order":1}`),
+		[]byte(`plain text`),
+		[]byte(`[1,2,3]`),
+		{0x00, 0xff, 0x10},
+	}
+	for _, body := range bodies {
+		if err := sbcli.Broker.Send(context.Background(), "source", servicebus.NewMessage(body)); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	filePath := filepath.Join(t.TempDir(), "messages.jsonl")
+	exported, err := sbcli.ExportQueueMessages("source", filePath, false, 0)
+	if err != nil || exported != len(bodies) {
+		t.Fatalf("ExportQueueMessages() = %v, %v, want %v messages", exported, err, len(bodies))
+	}
+
+	sent, failed, err := sbcli.ImportQueueMessages("target", filePath)
+	if err != nil || sent != len(bodies) || failed != 0 {
+		t.Fatalf("ImportQueueMessages() = %v sent, %v failed, %v, want %v sent", sent, failed, err, len(bodies))
+	}
+
+	iterator, err := sbcli.Broker.Peek(context.Background(), "target")
+	if err != nil {
+		t.Fatalf("Peek() error = %v", err)
+	}
+	for i := 0; !iterator.Done() && i < len(bodies); i++ {
+		msg, err := iterator.Next(context.Background())
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		// json object bodies are indented when they are sent again
+		if i > 0 && !bytes.Equal(msg.Data, bodies[i]) {
+			t.Errorf("imported body %v = %q, want %q", i, msg.Data, bodies[i])
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package servicebuscli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// GraphFormat Enum
+type GraphFormat string
+
+// GraphFormat Enum definition
+const (
+	GraphDOT     GraphFormat = "dot"
+	GraphMermaid GraphFormat = "mermaid"
+)
+
+// Topology graph node kinds
+const (
+	graphTopicNode        = "topic"
+	graphQueueNode        = "queue"
+	graphSubscriptionNode = "subscription"
+)
+
+// Topology graph edge kinds
+const (
+	graphSubscriptionEdge = "subscription"
+	graphForwardEdge      = "forward"
+	graphDeadLetterEdge   = "dead letter"
+)
+
+// topologyGraph holds the entities of a topology as nodes and the message flows between them as edges,
+// topics flow into their subscriptions and queues and subscriptions flow into their forward targets
+type topologyGraph struct {
+	nodes map[string]*topologyNode
+	order []string
+	edges []topologyEdge
+}
+
+type topologyNode struct {
+	id      string
+	kind    string
+	name    string
+	missing bool
+}
+
+type topologyEdge struct {
+	from  string
+	to    string
+	kind  string
+	rules []string
+}
+
+// ParseGraphFormat Parses a graph format, dot or mermaid
+func ParseGraphFormat(value string) (GraphFormat, error) {
+	switch GraphFormat(strings.ToLower(value)) {
+	case "", GraphDOT:
+		return GraphDOT, nil
+	case GraphMermaid:
+		return GraphMermaid, nil
+	}
+
+	return GraphDOT, errors.New("Invalid graph format " + value + ", use dot or mermaid")
+}
+
+// WriteTopologyGraph Writes the topics, subscriptions with their rules, queues and forwarding edges of
+// the topology as a graphviz dot or mermaid graph, forward targets that do not exist are marked as missing
+func WriteTopologyGraph(w io.Writer, format GraphFormat, topology *TopologyEntity) error {
+	graph := newTopologyGraph(topology)
+	switch format {
+	case GraphDOT:
+		return graph.writeDOT(w)
+	case GraphMermaid:
+		return graph.writeMermaid(w)
+	}
+
+	return errors.New("Graph format " + string(format) + " is not supported")
+}
+
+func newTopologyGraph(topology *TopologyEntity) *topologyGraph {
+	graph := topologyGraph{
+		nodes: make(map[string]*topologyNode),
+		order: make([]string, 0),
+		edges: make([]topologyEdge, 0),
+	}
+
+	for _, topic := range topology.Topics {
+		graph.addNode(graphTopicNode, topic.Name, false)
+	}
+	for _, queue := range topology.Queues {
+		graph.addNode(graphQueueNode, queue.Name, false)
+	}
+
+	for _, topic := range topology.Topics {
+		topicID := graph.addNode(graphTopicNode, topic.Name, false)
+		for _, subscription := range topic.Subscriptions {
+			subscriptionID := graph.addNode(graphSubscriptionNode, topic.Name+"/"+subscription.Name, false)
+			rules := make([]string, 0, len(subscription.Rules))
+			for _, rule := range subscription.Rules {
+				rules = append(rules, describeTopologyRule(rule))
+			}
+			graph.edges = append(graph.edges, topologyEdge{from: topicID, to: subscriptionID, kind: graphSubscriptionEdge, rules: rules})
+
+			entity, _ := subscription.ToSubscriptionEntity(topic.Name)
+			graph.addForwardEdge(subscriptionID, entity.Forward, graphForwardEdge)
+			graph.addForwardEdge(subscriptionID, entity.ForwardDeadLetter, graphDeadLetterEdge)
+		}
+	}
+
+	for _, queue := range topology.Queues {
+		queueID := graph.addNode(graphQueueNode, queue.Name, false)
+		entity, _ := queue.ToQueueEntity()
+		graph.addForwardEdge(queueID, entity.Forward, graphForwardEdge)
+		graph.addForwardEdge(queueID, entity.ForwardDeadLetter, graphDeadLetterEdge)
+	}
+
+	return &graph
+}
+
+// addNode adds a node if it does not exist yet and returns its id
+func (g *topologyGraph) addNode(kind string, name string, missing bool) string {
+	id := kind + ":" + strings.ToLower(name)
+	if _, ok := g.nodes[id]; !ok {
+		g.nodes[id] = &topologyNode{id: id, kind: kind, name: name, missing: missing}
+		g.order = append(g.order, id)
+	}
+
+	return id
+}
+
+func (n *topologyNode) String() string {
+	return n.kind + ":" + n.name
+}
+
+func (g *topologyGraph) addForwardEdge(from string, forward ForwardEntity, kind string) {
+	if forward.To == "" {
+		return
+	}
+
+	nodeKind := graphQueueNode
+	if forward.In == ForwardToTopic {
+		nodeKind = graphTopicNode
+	}
+	to := g.addNode(nodeKind, forward.To, true)
+	g.edges = append(g.edges, topologyEdge{from: from, to: to, kind: kind})
+}
+
+// missingNodes gets the forward targets that are not in the topology
+func (g *topologyGraph) missingNodes() []*topologyNode {
+	result := make([]*topologyNode, 0)
+	for _, id := range g.order {
+		if g.nodes[id].missing {
+			result = append(result, g.nodes[id])
+		}
+	}
+
+	return result
+}
+
+func (g *topologyGraph) writeDOT(w io.Writer) error {
+	var builder strings.Builder
+	builder.WriteString("digraph servicebus {\n")
+	builder.WriteString("  rankdir=LR;\n")
+	builder.WriteString("  node [fontname=\"Helvetica\"];\n")
+	builder.WriteString("  edge [fontname=\"Helvetica\", fontsize=10];\n")
+	for _, id := range g.order {
+		node := g.nodes[id]
+		label := node.name
+		if node.kind == graphSubscriptionNode {
+			label = node.name[strings.Index(node.name, "/")+1:]
+		}
+		attributes := []string{"label=" + dotQuote(label)}
+		switch node.kind {
+		case graphTopicNode:
+			attributes = append(attributes, "shape=box", "style=filled", "fillcolor=\"#dae8fc\"")
+		case graphQueueNode:
+			attributes = append(attributes, "shape=cylinder", "style=filled", "fillcolor=\"#d5e8d4\"")
+		case graphSubscriptionNode:
+			attributes = append(attributes, "shape=ellipse")
+		}
+		if node.missing {
+			attributes = append(attributes, "color=red", "fontcolor=red", "xlabel=\"missing\"")
+		}
+		builder.WriteString(fmt.Sprintf("  %v [%v];\n", dotQuote(id), strings.Join(attributes, ", ")))
+	}
+	for _, edge := range g.edges {
+		attributes := make([]string, 0)
+		switch edge.kind {
+		case graphSubscriptionEdge:
+			if len(edge.rules) > 0 {
+				attributes = append(attributes, "label="+dotQuote(strings.Join(edge.rules, "\n")))
+			}
+		case graphForwardEdge:
+			attributes = append(attributes, "label=\"forward\"", "penwidth=2")
+		case graphDeadLetterEdge:
+			attributes = append(attributes, "label=\"dead letter\"", "style=dashed", "color=gray40")
+		}
+		line := fmt.Sprintf("  %v -> %v", dotQuote(edge.from), dotQuote(edge.to))
+		if len(attributes) > 0 {
+			line += " [" + strings.Join(attributes, ", ") + "]"
+		}
+		builder.WriteString(line + ";\n")
+	}
+	builder.WriteString("}\n")
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+func (g *topologyGraph) writeMermaid(w io.Writer) error {
+	ids := make(map[string]string)
+	for i, id := range g.order {
+		ids[id] = fmt.Sprintf("n%v", i+1)
+	}
+
+	var builder strings.Builder
+	builder.WriteString("flowchart LR\n")
+	for _, id := range g.order {
+		node := g.nodes[id]
+		label := node.name
+		if node.kind == graphSubscriptionNode {
+			label = node.name[strings.Index(node.name, "/")+1:]
+		}
+		label = mermaidQuote(label)
+		switch node.kind {
+		case graphTopicNode:
+			builder.WriteString(fmt.Sprintf("  %v[[%v]]", ids[id], label))
+		case graphQueueNode:
+			builder.WriteString(fmt.Sprintf("  %v[(%v)]", ids[id], label))
+		default:
+			builder.WriteString(fmt.Sprintf("  %v([%v])", ids[id], label))
+		}
+		if node.missing {
+			builder.WriteString(":::missing")
+		}
+		builder.WriteString("\n")
+	}
+	for _, edge := range g.edges {
+		switch edge.kind {
+		case graphSubscriptionEdge:
+			if len(edge.rules) > 0 {
+				builder.WriteString(fmt.Sprintf("  %v -->|%v| %v\n", ids[edge.from], mermaidQuote(strings.Join(edge.rules, "<br/>")), ids[edge.to]))
+			} else {
+				builder.WriteString(fmt.Sprintf("  %v --> %v\n", ids[edge.from], ids[edge.to]))
+			}
+		case graphForwardEdge:
+			builder.WriteString(fmt.Sprintf("  %v ==>|forward| %v\n", ids[edge.from], ids[edge.to]))
+		case graphDeadLetterEdge:
+			builder.WriteString(fmt.Sprintf("  %v -.->|dead letter| %v\n", ids[edge.from], ids[edge.to]))
+		}
+	}
+	if len(g.missingNodes()) > 0 {
+		builder.WriteString("  classDef missing stroke:#f00,color:#f00,stroke-dasharray: 5 5\n")
+	}
+
+	_, err := io.WriteString(w, builder.String())
+	return err
+}
+
+// describeTopologyRule gets a short description of a rule filter and action for the graph edges
+func describeTopologyRule(rule TopologyRuleEntity) string {
+	description := rule.SQLFilter
+	if rule.CorrelationFilter != nil {
+		filter := rule.ToRuleEntity().CorrelationFilter
+		parts := make([]string, 0)
+		for name, value := range filter.systemProperties() {
+			parts = append(parts, name+"="+value)
+		}
+		for name, value := range filter.Properties {
+			parts = append(parts, name+"="+fmt.Sprint(value))
+		}
+		sort.Strings(parts)
+		description = "correlation " + strings.Join(parts, ", ")
+	} else if description == "" {
+		description = "1=1"
+	}
+	if rule.SQLAction != "" {
+		description += " / " + rule.SQLAction
+	}
+
+	return rule.Name + ": " + description
+}
+
+func dotQuote(value string) string {
+	value = strings.Replace(value, "\\", "\\\\", -1)
+	value = strings.Replace(value, "\"", "\\\"", -1)
+	value = strings.Replace(value, "\n", "\\n", -1)
+	return "\"" + value + "\""
+}
+
+func mermaidQuote(value string) string {
+	return "\"" + strings.Replace(value, "\"", "#quot;", -1) + "\""
+}
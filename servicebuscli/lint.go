@@ -0,0 +1,389 @@
+package servicebuscli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/cjlapao/common-go/log"
+)
+
+// Lint issue severities
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintIssue structure, a problem found in a topology
+type LintIssue struct {
+	Severity string `json:"severity" yaml:"severity"`
+	Entity   string `json:"entity" yaml:"entity"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+var lintIssueColumns = []string{"severity", "entity", "message"}
+
+// LintTopology Checks the topology for forwards to missing entities, forwarding cycles where messages
+// can loop until they reach the hop limit, and subscriptions or rules that can never match a message
+func LintTopology(topology *TopologyEntity) []LintIssue {
+	issues := make([]LintIssue, 0)
+	graph := newTopologyGraph(topology)
+
+	for _, edge := range graph.edges {
+		target := graph.nodes[edge.to]
+		if edge.kind == graphSubscriptionEdge || !target.missing {
+			continue
+		}
+		issues = append(issues, LintIssue{
+			Severity: LintError,
+			Entity:   graph.nodes[edge.from].String(),
+			Message:  fmt.Sprintf("Forwards %v to %v %v which does not exist", lintForwardName(edge.kind), target.kind, target.name),
+		})
+	}
+
+	for _, cycle := range graph.forwardingCycles() {
+		names := make([]string, 0, len(cycle)+1)
+		for _, id := range append(cycle, cycle[0]) {
+			names = append(names, graph.nodes[id].String())
+		}
+		issues = append(issues, LintIssue{
+			Severity: LintError,
+			Entity:   names[0],
+			Message:  "Forwarding cycle, messages loop through " + strings.Join(names, " -> "),
+		})
+	}
+
+	for _, topic := range topology.Topics {
+		for _, subscription := range topic.Subscriptions {
+			issues = append(issues, lintSubscriptionRules(topic.Name, subscription, topology.live)...)
+		}
+	}
+
+	sortLintIssues(issues)
+	return issues
+}
+
+// PrintLintIssues Prints the lint issues
+func PrintLintIssues(issues []LintIssue) {
+	if len(issues) == 0 {
+		logger.Success("No issues found in the topology")
+		return
+	}
+
+	errorCount := 0
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			errorCount++
+			logger.LogHighlight("%v: %v", log.Error, issue.Entity, issue.Message)
+		} else {
+			logger.LogHighlight("%v: %v", log.Warning, issue.Entity, issue.Message)
+		}
+	}
+
+	logger.Info("Found %v errors and %v warnings", fmt.Sprint(errorCount), fmt.Sprint(len(issues)-errorCount))
+}
+
+// WriteLintIssues Writes the lint issues as json, yaml, a table or csv
+func WriteLintIssues(w io.Writer, format OutputFormat, issues []LintIssue) error {
+	rows := make([][]string, 0, len(issues))
+	for _, issue := range issues {
+		rows = append(rows, []string{issue.Severity, issue.Entity, issue.Message})
+	}
+
+	return writeOutput(w, format, issues, lintIssueColumns, rows)
+}
+
+// HasLintErrors Checks if any of the issues is an error
+func HasLintErrors(issues []LintIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == LintError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwardingCycles finds the groups of entities where a message can flow back to where it started,
+// dead letter forwards are not followed as they only move messages that failed
+func (g *topologyGraph) forwardingCycles() [][]string {
+	next := make(map[string][]string)
+	for _, edge := range g.edges {
+		if edge.kind != graphDeadLetterEdge {
+			next[edge.from] = append(next[edge.from], edge.to)
+		}
+	}
+
+	// tarjan strongly connected components
+	index := 0
+	indexes := make(map[string]int)
+	lowLinks := make(map[string]int)
+	onStack := make(map[string]bool)
+	stack := make([]string, 0)
+	cycles := make([][]string, 0)
+
+	var connect func(id string)
+	connect = func(id string) {
+		indexes[id] = index
+		lowLinks[id] = index
+		index++
+		stack = append(stack, id)
+		onStack[id] = true
+
+		selfLoop := false
+		for _, to := range next[id] {
+			if to == id {
+				selfLoop = true
+			}
+			if _, visited := indexes[to]; !visited {
+				connect(to)
+				if lowLinks[to] < lowLinks[id] {
+					lowLinks[id] = lowLinks[to]
+				}
+			} else if onStack[to] && indexes[to] < lowLinks[id] {
+				lowLinks[id] = indexes[to]
+			}
+		}
+
+		if lowLinks[id] != indexes[id] {
+			return
+		}
+		component := make([]string, 0)
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			component = append(component, last)
+			if last == id {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop {
+			cycles = append(cycles, g.orderCycle(component, next))
+		}
+	}
+
+	for _, id := range g.order {
+		if _, visited := indexes[id]; !visited {
+			connect(id)
+		}
+	}
+
+	return cycles
+}
+
+// orderCycle orders the entities of a cycle following the message flow, starting with the first one in
+// the topology order
+func (g *topologyGraph) orderCycle(component []string, next map[string][]string) []string {
+	members := make(map[string]bool)
+	for _, id := range component {
+		members[id] = true
+	}
+	start := component[0]
+	for _, id := range g.order {
+		if members[id] {
+			start = id
+			break
+		}
+	}
+
+	result := []string{start}
+	visited := map[string]bool{start: true}
+	current := start
+	for {
+		found := ""
+		for _, to := range next[current] {
+			if members[to] && !visited[to] {
+				found = to
+				break
+			}
+		}
+		if found == "" {
+			break
+		}
+		result = append(result, found)
+		visited[found] = true
+		current = found
+	}
+
+	// entities of the component that are not on the simple path are added in topology order
+	for _, id := range g.order {
+		if members[id] && !visited[id] {
+			result = append(result, id)
+		}
+	}
+
+	return result
+}
+
+// lintSubscriptionRules checks the rules of a subscription, a subscription where all of the rules can
+// never match does not receive any message. Only a subscription of the namespace can have no rules,
+// in a topology file it means its rules are not managed and it keeps the default rule
+func lintSubscriptionRules(topicName string, subscription TopologySubscriptionEntity, live bool) []LintIssue {
+	issues := make([]LintIssue, 0)
+	entity := graphSubscriptionNode + ":" + topicName + "/" + subscription.Name
+	if len(subscription.Rules) == 0 {
+		if !live {
+			return issues
+		}
+		return append(issues, LintIssue{Severity: LintWarning, Entity: entity, Message: "Subscription has no rules, it does not receive any message"})
+	}
+
+	neverMatching := 0
+	for _, topologyRule := range subscription.Rules {
+		rule := topologyRule.ToRuleEntity()
+		if err := rule.Validate(); err != nil {
+			issues = append(issues, LintIssue{Severity: LintError, Entity: entity, Message: err.Error()})
+			neverMatching++
+			continue
+		}
+		if rule.CorrelationFilter != nil {
+			continue
+		}
+
+		filter, err := ParseSQLFilter(rule.filterExpression())
+		if err == nil && sqlNeverMatches(filter.root) {
+			neverMatching++
+			issues = append(issues, LintIssue{Severity: LintWarning, Entity: entity, Message: "Rule " + rule.Name + " can never match, its filter " + rule.SQLFilter + " is never true"})
+		}
+	}
+
+	if neverMatching == len(subscription.Rules) {
+		issues = append(issues, LintIssue{Severity: LintWarning, Entity: entity, Message: "None of the subscription rules can match, it does not receive any message"})
+	}
+
+	return issues
+}
+
+func lintForwardName(kind string) string {
+	if kind == graphDeadLetterEdge {
+		return "dead letters"
+	}
+
+	return "messages"
+}
+
+// sqlNeverMatches checks if a filter expression is not true for any message, expressions that do not
+// use any property are evaluated and conjunctions are checked for a property compared to different values
+func sqlNeverMatches(expression sqlExpression) bool {
+	if isConstantSQLExpression(expression) {
+		value, err := expression.evaluate(&SQLMessage{
+			SystemProperties: make(map[string]interface{}),
+			UserProperties:   make(map[string]interface{}),
+		})
+		return err == nil && value != true
+	}
+
+	if binary, ok := expression.(*sqlBinaryExpression); ok {
+		switch binary.operator {
+		case "AND":
+			if sqlNeverMatches(binary.left) || sqlNeverMatches(binary.right) {
+				return true
+			}
+			return hasConflictingConditions(flattenSQLConjunction(binary))
+		case "OR":
+			return sqlNeverMatches(binary.left) && sqlNeverMatches(binary.right)
+		}
+	}
+
+	return false
+}
+
+// isConstantSQLExpression checks if the expression does not depend on the message
+func isConstantSQLExpression(expression sqlExpression) bool {
+	switch e := expression.(type) {
+	case *sqlLiteral:
+		return true
+	case *sqlUnaryExpression:
+		return isConstantSQLExpression(e.operand)
+	case *sqlBinaryExpression:
+		return isConstantSQLExpression(e.left) && isConstantSQLExpression(e.right)
+	case *sqlLikeExpression:
+		return isConstantSQLExpression(e.operand)
+	case *sqlIsNullExpression:
+		return isConstantSQLExpression(e.operand)
+	case *sqlInExpression:
+		if !isConstantSQLExpression(e.operand) {
+			return false
+		}
+		for _, value := range e.values {
+			if !isConstantSQLExpression(value) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+func flattenSQLConjunction(expression sqlExpression) []sqlExpression {
+	if binary, ok := expression.(*sqlBinaryExpression); ok && binary.operator == "AND" {
+		return append(flattenSQLConjunction(binary.left), flattenSQLConjunction(binary.right)...)
+	}
+
+	return []sqlExpression{expression}
+}
+
+// hasConflictingConditions checks if the conditions require a property to be equal to two different
+// values, or to be equal to a value and null at the same time
+func hasConflictingConditions(conditions []sqlExpression) bool {
+	equals := make(map[string]interface{})
+	isNull := make(map[string]bool)
+	for _, condition := range conditions {
+		switch e := condition.(type) {
+		case *sqlBinaryExpression:
+			if e.operator != "=" {
+				continue
+			}
+			property, value, ok := propertyComparedToLiteral(e)
+			if !ok {
+				continue
+			}
+			if existing, found := equals[property]; found && evaluateSQLComparison("=", existing, value) == false {
+				return true
+			}
+			equals[property] = value
+		case *sqlIsNullExpression:
+			if property, ok := e.operand.(*sqlPropertyExpression); ok && !e.negate {
+				isNull[property.String()] = true
+			}
+		}
+	}
+
+	for property := range isNull {
+		if _, found := equals[property]; found {
+			return true
+		}
+	}
+
+	return false
+}
+
+func propertyComparedToLiteral(expression *sqlBinaryExpression) (string, interface{}, bool) {
+	property, literal := expression.left, expression.right
+	if _, ok := property.(*sqlPropertyExpression); !ok {
+		property, literal = literal, property
+	}
+	propertyExpression, ok := property.(*sqlPropertyExpression)
+	if !ok {
+		return "", nil, false
+	}
+	literalExpression, ok := literal.(*sqlLiteral)
+	if !ok || literalExpression.value == nil {
+		return "", nil, false
+	}
+
+	return propertyExpression.String(), literalExpression.value, true
+}
+
+// sortLintIssues orders the issues by severity and entity
+func sortLintIssues(issues []LintIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Severity != issues[j].Severity {
+			return issues[i].Severity == LintError
+		}
+		return issues[i].Entity < issues[j].Entity
+	})
+}
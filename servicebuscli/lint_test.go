@@ -0,0 +1,79 @@
+package servicebuscli
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLintSubscriptionRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		live  bool
+		rules []TopologyRuleEntity
+		want  []string
+	}{
+		{"unmanaged rules in a file", false, nil, []string{}},
+		{"no rules in the namespace", true, []TopologyRuleEntity{}, []string{"Subscription has no rules, it does not receive any message"}},
+		{"matching rule", false, []TopologyRuleEntity{{Name: "big", SQLFilter: "amount > 100"}}, []string{}},
+		{
+			name:  "one rule never matches",
+			rules: []TopologyRuleEntity{{Name: "never", SQLFilter: "1=0"}, {Name: "big", SQLFilter: "amount > 100"}},
+			want:  []string{"Rule never can never match, its filter 1=0 is never true"},
+		},
+		{
+			name:  "no rule can match",
+			live:  true,
+			rules: []TopologyRuleEntity{{Name: "never", SQLFilter: "a = 'x' AND a = 'y'"}},
+			want: []string{
+				"Rule never can never match, its filter a = 'x' AND a = 'y' is never true",
+				"None of the subscription rules can match, it does not receive any message",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			topology := &TopologyEntity{
+				Topics: []TopologyTopicEntity{
+					{Name: "t", Subscriptions: []TopologySubscriptionEntity{{Name: "s", Rules: test.rules}}},
+				},
+				live: test.live,
+			}
+
+			issues := LintTopology(topology)
+			if len(issues) != len(test.want) {
+				t.Fatalf("LintTopology() = %+v, want %v", issues, test.want)
+			}
+			for i, issue := range issues {
+				if issue.Message != test.want[i] || issue.Severity != LintWarning {
+					t.Errorf("issue %v = %+v, want warning %v", i, issue, test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLintReadTopologyDefaultRule(t *testing.T) {
+	sbcli := newMemoryServiceBusCli(t)
+	if err := sbcli.CreateTopic(TopicEntity{Name: "t"}); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	for _, name := range []string{"default", "empty"} {
+		if err := sbcli.CreateSubscription(NewSubscription("t", name)); err != nil {
+			t.Fatalf("CreateSubscription(%v) error = %v", name, err)
+		}
+	}
+	if err := sbcli.Broker.DeleteRule(context.Background(), "t", "empty", DefaultRuleName); err != nil {
+		t.Fatalf("DeleteRule() error = %v", err)
+	}
+
+	topology, err := sbcli.ReadTopology()
+	if err != nil {
+		t.Fatalf("ReadTopology() error = %v", err)
+	}
+
+	issues := LintTopology(topology)
+	if len(issues) != 1 || issues[0].Entity != graphSubscriptionNode+":t/empty" {
+		t.Errorf("LintTopology() = %+v, want a single warning for the subscription without rules", issues)
+	}
+}
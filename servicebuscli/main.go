@@ -1,11 +1,12 @@
 package servicebuscli
 
 import (
-	"fmt"
+	"context"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/cjlapao/common-go/log"
-
-	servicebus "github.com/Azure/azure-service-bus-go"
 )
 
 // ForwardingDestination Enum
@@ -17,65 +18,113 @@ const (
 	ForwardToQueue
 )
 
+// ForwardNone is the forward flag value that removes the forwarding of an entity on an update
+const ForwardNone = "none"
+
 // ForwardEntity struct
 type ForwardEntity struct {
 	To string
 	In ForwardingDestination
+	// Clear removes the forwarding on an update, an empty To leaves it as it is
+	Clear bool
 }
 
 // ServiceBusCli Entity
 type ServiceBusCli struct {
-	ConnectionString          string
-	Namespace                 *servicebus.Namespace
-	TopicManager              *servicebus.TopicManager
-	QueueManager              *servicebus.QueueManager
-	ActiveTopic               *servicebus.Topic
-	ActiveSubscription        *servicebus.Subscription
-	ActiveQueue               *servicebus.Queue
-	ActiveQueueListenerHandle *servicebus.ListenerHandle
-	ActiveTopicListenerHandle *servicebus.ListenerHandle
-	Peek                      bool
-	UseWiretap                bool
-	DeleteWiretap             bool
-	CloseTopicListener        chan bool
-	CloseQueueListener        chan bool
+	ConnectionString    string
+	Broker              Broker
+	ActiveTopic         string
+	ActiveSubscription  string
+	ActiveQueue         string
+	ActiveQueueReceiver Receiver
+	ActiveTopicReceiver Receiver
+	// Settle is how the received messages are settled once handled
+	Settle        SettleMode
+	UseWiretap    bool
+	DeleteWiretap bool
+	UseSessions   bool
+	SessionID     string
+	Filter        *SQLFilter
+	MaxMessages   int
+	Timeout       time.Duration
+	// Concurrency is the number of messages, or sessions, handled at the same time
+	Concurrency int
+	// PrefetchCount is the number of messages each receiver fetches at once
+	PrefetchCount int
+	// AutoRenewLock renews the lock of the messages while they are handled for up to MaxLockRenewal
+	AutoRenewLock  bool
+	MaxLockRenewal time.Duration
+	// Consumer processes the received messages instead of printing them
+	Consumer              MessageConsumer
+	ConsumerFailureAction ConsumerFailureAction
+	CloseTopicListener    chan bool
+	CloseQueueListener    chan bool
+	stopQueueListener     context.CancelFunc
+	stopTopicListener     context.CancelFunc
+	printMutex            sync.Mutex
 }
 
 var serviceBusCli *ServiceBusCli
 var logger = log.Get()
 
-// Get creates a new ServiceBusCli
+// Get creates a new ServiceBusCli connected to the azure service bus of the connection string
 func Get(connectionString string) *ServiceBusCli {
+	return GetWithCredentials(AzureCredentials{ConnectionString: connectionString})
+}
+
+// GetWithCredentials creates a new ServiceBusCli connected to the azure service bus with a connection
+// string, a shared access signature or an azure active directory client credential
+func GetWithCredentials(credentials AzureCredentials) *ServiceBusCli {
 	if serviceBusCli != nil {
 		return serviceBusCli
 	}
 
-	serviceBusCli = &ServiceBusCli{
-		Peek:             false,
-		UseWiretap:       false,
-		DeleteWiretap:    false,
-		ConnectionString: connectionString,
+	broker, err := NewAzureBrokerWithCredentials(credentials)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
 	}
 
-	serviceBusCli.CloseTopicListener = make(chan bool, 1)
-	serviceBusCli.CloseQueueListener = make(chan bool, 1)
-	serviceBusCli.GetNamespace()
+	UseBroker(broker)
+	serviceBusCli.ConnectionString = credentials.ConnectionString
 
 	return serviceBusCli
 }
 
-// GetNamespace gets a new Service Bus connection namespace
-func (s *ServiceBusCli) GetNamespace() (*servicebus.Namespace, error) {
-	logger.Trace("Creating a service bus namespace")
+// UseBroker creates a new ServiceBusCli on top of a broker, any later call to Get will
+// return it, this is used to run the cli against the in memory broker
+func UseBroker(broker Broker) *ServiceBusCli {
+	serviceBusCli = New(broker)
 
-	ns, err := servicebus.NewNamespace(servicebus.NamespaceWithConnectionString(s.ConnectionString))
+	return serviceBusCli
+}
 
+// UseNamespace creates a new ServiceBusCli connected to a namespace of the connections file, any
+// later call to Get will return it
+func UseNamespace(namespace NamespaceConnection) (*ServiceBusCli, error) {
+	result, err := namespace.Connect()
 	if err != nil {
-		fmt.Println(err)
 		return nil, err
 	}
 
-	s.Namespace = ns
+	serviceBusCli = result
+	return serviceBusCli, nil
+}
+
+// New creates a ServiceBusCli on top of a broker that is not returned by Get, it is used when
+// a command works with more than one namespace
+func New(broker Broker) *ServiceBusCli {
+	result := ServiceBusCli{
+		Broker:         broker,
+		Settle:         SettleComplete,
+		UseWiretap:     false,
+		DeleteWiretap:  false,
+		Concurrency:    1,
+		MaxLockRenewal: defaultMaxLockRenewal,
+	}
+
+	result.CloseTopicListener = make(chan bool, 1)
+	result.CloseQueueListener = make(chan bool, 1)
 
-	return s.Namespace, nil
+	return &result
 }
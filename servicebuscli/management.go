@@ -0,0 +1,329 @@
+package servicebuscli
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-amqp-common-go/v3/auth"
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/Azure/azure-service-bus-go/atom"
+)
+
+const (
+	serviceBusSchema = "http://schemas.microsoft.com/netservices/2010/10/servicebus/connect"
+	schemaInstance   = "http://www.w3.org/2001/XMLSchema-instance"
+	atomSchema       = "http://www.w3.org/2005/Atom"
+	applicationXML   = "application/xml"
+)
+
+var iso8601DurationRegex = regexp.MustCompile(`^P(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// PropertyChange structure
+type PropertyChange struct {
+	Name string
+	From string
+	To   string
+}
+
+// entityExecutor is implemented by the service bus queue, topic and subscription managers
+type entityExecutor interface {
+	Execute(ctx context.Context, method string, entityPath string, body io.Reader, mw ...servicebus.MiddlewareFunc) (*http.Response, error)
+	TokenProvider() auth.TokenProvider
+}
+
+// putEntityDescription updates an existing entity in place, the service bus management api will only
+// update an entity if the If-Match header is sent, otherwise it refuses as the entity already exists
+func putEntityDescription(ctx context.Context, executor entityExecutor, entityPath string, description interface{}, forwardTo *string, forwardDeadLetterTo *string) error {
+	content, err := xml.Marshal(description)
+	if err != nil {
+		return err
+	}
+
+	mw := []servicebus.MiddlewareFunc{addHeader("If-Match", "*")}
+	if forwardTo != nil && *forwardTo != "" {
+		mw = append(mw, addTokenHeader("ServiceBusSupplementaryAuthorization", *forwardTo, executor.TokenProvider()))
+	}
+	if forwardDeadLetterTo != nil && *forwardDeadLetterTo != "" {
+		mw = append(mw, addTokenHeader("ServiceBusDlqSupplementaryAuthorization", *forwardDeadLetterTo, executor.TokenProvider()))
+	}
+
+	body := strings.Replace(string(content), `xmlns:XMLSchema-instance="`+schemaInstance+`" XMLSchema-instance:type`, `xmlns:i="`+schemaInstance+`" i:type`, -1)
+	return putEntityContent(ctx, executor, entityPath, body, mw...)
+}
+
+// putEntityContent wraps the entity xml content in an atom entry and sends it to the service bus
+// management api
+func putEntityContent(ctx context.Context, executor entityExecutor, entityPath string, content string, mw ...servicebus.MiddlewareFunc) error {
+	entry := atom.Entry{
+		AtomSchema: atomSchema,
+		Content: &atom.Content{
+			Type: applicationXML,
+			Body: content,
+		},
+	}
+
+	body, err := xml.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	res, err := executor.Execute(ctx, http.MethodPut, entityPath, bytes.NewReader([]byte(xml.Header+string(body))), mw...)
+	if res != nil && res.Body != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 300 {
+		responseBody, _ := ioutil.ReadAll(res.Body)
+		return errors.New("Service bus management returned " + res.Status + ": " + string(responseBody))
+	}
+
+	return nil
+}
+
+// getEntityFeed gets an atom feed, like the rules of a subscription, from the service bus management api
+func getEntityFeed(ctx context.Context, executor entityExecutor, entityPath string) (*atom.Feed, error) {
+	res, err := executor.Execute(ctx, http.MethodGet, entityPath, nil)
+	if res != nil && res.Body != nil {
+		defer res.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	responseBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= 300 {
+		return nil, errors.New("Service bus management returned " + res.Status + ": " + string(responseBody))
+	}
+
+	var feed atom.Feed
+	if err := xml.Unmarshal(responseBody, &feed); err != nil {
+		return nil, err
+	}
+
+	return &feed, nil
+}
+
+// printPropertyChanges prints the properties of an entity that are going to be changed
+func printPropertyChanges(changes []PropertyChange) {
+	for _, change := range changes {
+		logger.Info("  %v: %v -> %v", change.Name, change.From, change.To)
+	}
+}
+
+func addHeader(name string, value string) servicebus.MiddlewareFunc {
+	return func(next servicebus.RestHandler) servicebus.RestHandler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			req.Header.Set(name, value)
+			return next(ctx, req)
+		}
+	}
+}
+
+func addTokenHeader(name string, targetURI string, tp auth.TokenProvider) servicebus.MiddlewareFunc {
+	return func(next servicebus.RestHandler) servicebus.RestHandler {
+		return func(ctx context.Context, req *http.Request) (*http.Response, error) {
+			signature, err := tp.GetToken(targetURI)
+			if err != nil {
+				return nil, err
+			}
+
+			req.Header.Set(name, signature.Token)
+			return next(ctx, req)
+		}
+	}
+}
+
+// clearTopicReadOnlyProperties removes the runtime properties returned by the service bus so the
+// description can be sent back on an update
+func clearTopicReadOnlyProperties(description *servicebus.TopicDescription) {
+	description.ServiceBusSchema = stringPtr(serviceBusSchema)
+	description.InstanceMetadataSchema = stringPtr(schemaInstance)
+	description.SizeInBytes = nil
+	description.CountDetails = nil
+	description.CreatedAt = nil
+	description.UpdatedAt = nil
+}
+
+// clearQueueReadOnlyProperties removes the runtime properties returned by the service bus so the
+// description can be sent back on an update
+func clearQueueReadOnlyProperties(description *servicebus.QueueDescription) {
+	description.ServiceBusSchema = stringPtr(serviceBusSchema)
+	description.InstanceMetadataSchema = stringPtr(schemaInstance)
+	description.SizeInBytes = nil
+	description.MessageCount = nil
+	description.CountDetails = nil
+	description.CreatedAt = nil
+	description.UpdatedAt = nil
+}
+
+func clearSubscriptionReadOnlyProperties(description *servicebus.SubscriptionDescription) {
+	description.ServiceBusSchema = stringPtr(serviceBusSchema)
+	description.InstanceMetadataSchema = stringPtr(schemaInstance)
+	description.MessageCount = nil
+	description.CountDetails = nil
+	description.CreatedAt = nil
+	description.UpdatedAt = nil
+	description.AccessedAt = nil
+	description.DefaultRuleDescription = nil
+}
+
+// durationTo8601 converts a duration into a ISO 8601 duration string
+func durationTo8601(duration time.Duration) *string {
+	value := fmt.Sprintf("PT%vS", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64))
+	return &value
+}
+
+// durationFrom8601 converts a ISO 8601 duration string into a duration, values bigger than
+// the maximum duration are capped
+func durationFrom8601(value *string) time.Duration {
+	if value == nil {
+		return 0
+	}
+
+	matches := iso8601DurationRegex.FindStringSubmatch(strings.TrimSpace(*value))
+	if matches == nil {
+		return 0
+	}
+
+	var seconds float64
+	multipliers := []float64{86400, 3600, 60, 1}
+	for i, multiplier := range multipliers {
+		if matches[i+1] == "" {
+			continue
+		}
+		part, err := strconv.ParseFloat(matches[i+1], 64)
+		if err != nil {
+			return 0
+		}
+		seconds += part * multiplier
+	}
+
+	if seconds >= float64(1<<63-1)/float64(time.Second) {
+		return time.Duration(1<<63 - 1)
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// forwardTargetName gets the entity name from a forwarding address
+func forwardTargetName(value *string) string {
+	if value == nil {
+		return ""
+	}
+
+	target := strings.TrimSpace(*value)
+	if address, err := url.Parse(target); err == nil && address.Host != "" {
+		target = strings.Trim(address.Path, "/")
+	}
+
+	return target
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+// formatDuration formats a duration for display, the service bus uses the maximum duration
+// value to represent an infinite one
+func formatDuration(duration time.Duration) string {
+	if duration == time.Duration(1<<63-1) {
+		return "infinite"
+	}
+	if duration == 0 {
+		return "not set"
+	}
+
+	return duration.String()
+}
+
+func formatForward(forward ForwardEntity) string {
+	if forward.In == ForwardToTopic {
+		return "topic:" + forward.To
+	}
+
+	return "queue:" + forward.To
+}
+
+func compareDuration(changes []PropertyChange, name string, live *string, desired time.Duration) []PropertyChange {
+	if desired <= 0 {
+		return changes
+	}
+
+	current := durationFrom8601(live)
+	if current != desired {
+		changes = append(changes, PropertyChange{
+			Name: name,
+			From: formatDuration(current),
+			To:   formatDuration(desired),
+		})
+	}
+
+	return changes
+}
+
+func compareForward(changes []PropertyChange, name string, live *string, desired ForwardEntity) []PropertyChange {
+	current := forwardTargetName(live)
+	if desired.Clear {
+		if current != "" {
+			changes = append(changes, PropertyChange{
+				Name: name,
+				From: current,
+				To:   "not set",
+			})
+		}
+		return changes
+	}
+	if desired.To == "" {
+		return changes
+	}
+
+	if !strings.EqualFold(current, desired.To) {
+		if current == "" {
+			current = "not set"
+		}
+		changes = append(changes, PropertyChange{
+			Name: name,
+			From: current,
+			To:   formatForward(desired),
+		})
+	}
+
+	return changes
+}
+
+func compareInt32(changes []PropertyChange, name string, live *int32, desired int32) []PropertyChange {
+	if desired <= 0 {
+		return changes
+	}
+
+	current := "not set"
+	if live != nil {
+		if *live == desired {
+			return changes
+		}
+		current = fmt.Sprint(*live)
+	}
+
+	return append(changes, PropertyChange{
+		Name: name,
+		From: current,
+		To:   fmt.Sprint(desired),
+	})
+}
@@ -0,0 +1,83 @@
+package servicebuscli
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCompareForward(t *testing.T) {
+	live := "target"
+	tests := []struct {
+		name    string
+		live    *string
+		desired ForwardEntity
+		want    int
+	}{
+		{name: "not set", live: &live, desired: ForwardEntity{}, want: 0},
+		{name: "same target", live: &live, desired: ForwardEntity{To: "target"}, want: 0},
+		{name: "new target", live: &live, desired: ForwardEntity{To: "other"}, want: 1},
+		{name: "clear", live: &live, desired: ForwardEntity{Clear: true}, want: 1},
+		{name: "clear without forwarding", live: nil, desired: ForwardEntity{Clear: true}, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes := compareForward(nil, "forward to", test.live, test.desired)
+			if len(changes) != test.want {
+				t.Errorf("compareForward() = %v, want %v changes", changes, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateClearsForwarding(t *testing.T) {
+	ctx := context.Background()
+	sbcli := newMemoryServiceBusCli(t)
+	for _, name := range []string{"target", "orders"} {
+		queue := NewQueue(name)
+		if name == "orders" {
+			queue.MapMessageForwardFlag("queue:target")
+			queue.MapDeadLetterForwardFlag("queue:target")
+		}
+		if err := sbcli.CreateQueue(queue); err != nil {
+			t.Fatalf("CreateQueue(%v) error = %v", name, err)
+		}
+	}
+	if err := sbcli.CreateTopic(NewTopic("events")); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	subscription := NewSubscription("events", "audit")
+	subscription.MapMessageForwardFlag("queue:target")
+	subscription.MapDeadLetterForwardFlag("queue:target")
+	if err := sbcli.CreateSubscription(subscription); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	queue := NewQueue("orders")
+	queue.MapMessageForwardFlag(ForwardNone)
+	queue.MapDeadLetterForwardFlag(ForwardNone)
+	if err := sbcli.UpdateQueue(queue); err != nil {
+		t.Fatalf("UpdateQueue() error = %v", err)
+	}
+	existingQueue, err := sbcli.Broker.GetQueue(ctx, "orders")
+	if err != nil {
+		t.Fatalf("GetQueue() error = %v", err)
+	}
+	if existingQueue.ForwardTo != nil || existingQueue.ForwardDeadLetteredMessagesTo != nil {
+		t.Errorf("queue forwarding = %v, %v, want none", existingQueue.ForwardTo, existingQueue.ForwardDeadLetteredMessagesTo)
+	}
+
+	subscription = NewSubscription("events", "audit")
+	subscription.MapMessageForwardFlag(ForwardNone)
+	subscription.MapDeadLetterForwardFlag(ForwardNone)
+	if err := sbcli.UpdateSubscription(subscription); err != nil {
+		t.Fatalf("UpdateSubscription() error = %v", err)
+	}
+	existingSubscription, err := sbcli.Broker.GetSubscription(ctx, "events", "audit")
+	if err != nil {
+		t.Fatalf("GetSubscription() error = %v", err)
+	}
+	if existingSubscription.ForwardTo != nil || existingSubscription.ForwardDeadLetteredMessagesTo != nil {
+		t.Errorf("subscription forwarding = %v, %v, want none", existingSubscription.ForwardTo, existingSubscription.ForwardDeadLetteredMessagesTo)
+	}
+}
@@ -0,0 +1,1631 @@
+package servicebuscli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/Azure/go-autorest/autorest/date"
+)
+
+const (
+	memoryBrokerName          = "memory"
+	memoryPollInterval        = 100 * time.Millisecond
+	memoryDefaultLockDuration = time.Minute
+	memoryDefaultMaxDelivery  = 10
+	memoryMaxForwardingHops   = 4
+	memoryInfiniteDuration    = time.Duration(1<<63 - 1)
+)
+
+// MemoryBroker is an in memory service bus broker for tests and local demos, it supports topics,
+// subscriptions with sql rules, queues, forwarding, dead lettering and peek lock. When a state file
+// is used the entities and messages are kept in it so they are shared between commands
+type MemoryBroker struct {
+	statePath string
+	stateTime time.Time
+	mutex     sync.Mutex
+	state     *memoryState
+}
+
+type memoryState struct {
+	SequenceNumber int64                   `json:"sequenceNumber"`
+	Topics         map[string]*memoryTopic `json:"topics"`
+	Queues         map[string]*memoryQueue `json:"queues"`
+	changed        bool
+}
+
+type memoryTopic struct {
+	Name                     string                    `json:"name"`
+	DefaultMessageTimeToLive time.Duration             `json:"defaultMessageTimeToLive,omitempty"`
+	AutoDeleteOnIdle         time.Duration             `json:"autoDeleteOnIdle,omitempty"`
+	MaxSizeInMegabytes       int32                     `json:"maxSizeInMegabytes,omitempty"`
+	EnablePartitioning       bool                      `json:"enablePartitioning,omitempty"`
+	SupportOrdering          bool                      `json:"supportOrdering,omitempty"`
+	DuplicateDetection       *memoryDuplicateDetection `json:"duplicateDetection,omitempty"`
+	CreatedAt                time.Time                 `json:"createdAt"`
+	UpdatedAt                time.Time                 `json:"updatedAt"`
+	Subscriptions            map[string]*memoryQueue   `json:"subscriptions"`
+}
+
+// memoryQueue holds a queue or a topic subscription
+type memoryQueue struct {
+	Name                     string                    `json:"name"`
+	TopicName                string                    `json:"topicName,omitempty"`
+	LockDuration             time.Duration             `json:"lockDuration"`
+	DefaultMessageTimeToLive time.Duration             `json:"defaultMessageTimeToLive"`
+	AutoDeleteOnIdle         time.Duration             `json:"autoDeleteOnIdle"`
+	MaxDeliveryCount         int32                     `json:"maxDeliveryCount"`
+	RequiresSession          bool                      `json:"requiresSession,omitempty"`
+	EnablePartitioning       bool                      `json:"enablePartitioning,omitempty"`
+	DuplicateDetection       *memoryDuplicateDetection `json:"duplicateDetection,omitempty"`
+	Forward                  ForwardEntity             `json:"forward"`
+	ForwardDeadLetter        ForwardEntity             `json:"forwardDeadLetter"`
+	Rules                    []RuleEntity              `json:"rules,omitempty"`
+	Messages                 []*memoryMessage          `json:"messages"`
+	DeadLetters              []*memoryMessage          `json:"deadLetters"`
+	Sessions                 map[string]*memoryLock    `json:"sessions,omitempty"`
+	CreatedAt                time.Time                 `json:"createdAt"`
+	UpdatedAt                time.Time                 `json:"updatedAt"`
+}
+
+type memoryMessage struct {
+	Message     *servicebus.Message `json:"message"`
+	LockToken   string              `json:"lockToken,omitempty"`
+	LockedUntil time.Time           `json:"lockedUntil,omitempty"`
+	Deferred    bool                `json:"deferred,omitempty"`
+}
+
+// memoryDuplicateDetection keeps the ids of the messages sent to an entity during the duplicate
+// detection window
+type memoryDuplicateDetection struct {
+	Window     time.Duration        `json:"window"`
+	MessageIDs map[string]time.Time `json:"messageIds,omitempty"`
+}
+
+// memoryLock is the lock of a session accepted by a receiver
+type memoryLock struct {
+	LockToken   string    `json:"lockToken"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+type memoryReceiver struct {
+	broker           *MemoryBroker
+	entityPath       string
+	receiveAndDelete bool
+}
+
+type memorySettler struct {
+	broker     *MemoryBroker
+	entityPath string
+	lockToken  string
+}
+
+// NewMemoryBroker Creates an in memory broker, if a state file path is passed the state is loaded
+// from it and saved to it after every change
+func NewMemoryBroker(statePath string) (*MemoryBroker, error) {
+	broker := MemoryBroker{
+		statePath: statePath,
+	}
+
+	err := broker.do(func(state *memoryState) error {
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &broker, nil
+}
+
+// Name Gets the broker name
+func (b *MemoryBroker) Name() string {
+	return memoryBrokerName
+}
+
+// Close Closes the broker
+func (b *MemoryBroker) Close(ctx context.Context) error {
+	return nil
+}
+
+// ListTopics Lists the topics in the broker
+func (b *MemoryBroker) ListTopics(ctx context.Context) ([]*servicebus.TopicEntity, error) {
+	result := make([]*servicebus.TopicEntity, 0)
+	err := b.do(func(state *memoryState) error {
+		for _, name := range sortedKeys(state.Topics) {
+			result = append(result, state.Topics[name].toEntity())
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// GetTopic Gets a topic from the broker
+func (b *MemoryBroker) GetTopic(ctx context.Context, name string) (*servicebus.TopicEntity, error) {
+	var result *servicebus.TopicEntity
+	err := b.do(func(state *memoryState) error {
+		topic, err := state.getTopic(name)
+		if err != nil {
+			return err
+		}
+		result = topic.toEntity()
+		return nil
+	})
+
+	return result, err
+}
+
+// CreateTopic Creates a topic in the broker
+func (b *MemoryBroker) CreateTopic(ctx context.Context, topic TopicEntity) error {
+	return b.do(func(state *memoryState) error {
+		if err := state.checkNameIsFree(topic.Name); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		state.Topics[strings.ToLower(topic.Name)] = &memoryTopic{
+			Name:                     topic.Name,
+			DefaultMessageTimeToLive: topic.DefaultMessageTimeToLive,
+			AutoDeleteOnIdle:         topic.AutoDeleteOnIdle,
+			MaxSizeInMegabytes:       topic.MaxSizeInMegabytes,
+			EnablePartitioning:       topic.EnablePartitioning,
+			SupportOrdering:          topic.SupportOrdering,
+			DuplicateDetection:       newMemoryDuplicateDetection(topic.DuplicateDetectionWindow),
+			CreatedAt:                now,
+			UpdatedAt:                now,
+			Subscriptions:            make(map[string]*memoryQueue),
+		}
+		state.changed = true
+		return nil
+	})
+}
+
+// UpdateTopic Updates an existing topic, only the properties set in the topic entity are changed
+func (b *MemoryBroker) UpdateTopic(ctx context.Context, topic TopicEntity) error {
+	return b.do(func(state *memoryState) error {
+		entity, err := state.getTopic(topic.Name)
+		if err != nil {
+			return err
+		}
+
+		if topic.DefaultMessageTimeToLive > 0 {
+			entity.DefaultMessageTimeToLive = topic.DefaultMessageTimeToLive
+		}
+		if topic.AutoDeleteOnIdle > 0 {
+			entity.AutoDeleteOnIdle = topic.AutoDeleteOnIdle
+		}
+		entity.UpdatedAt = time.Now().UTC()
+		state.changed = true
+		return nil
+	})
+}
+
+// DeleteTopic Deletes a topic and its subscriptions from the broker
+func (b *MemoryBroker) DeleteTopic(ctx context.Context, name string) error {
+	return b.do(func(state *memoryState) error {
+		if _, err := state.getTopic(name); err != nil {
+			return err
+		}
+		delete(state.Topics, strings.ToLower(name))
+		state.changed = true
+		return nil
+	})
+}
+
+// ListQueues Lists the queues in the broker
+func (b *MemoryBroker) ListQueues(ctx context.Context) ([]*servicebus.QueueEntity, error) {
+	result := make([]*servicebus.QueueEntity, 0)
+	err := b.do(func(state *memoryState) error {
+		now := time.Now().UTC()
+		for _, name := range sortedKeys(state.Queues) {
+			queue := state.Queues[name]
+			state.cleanup(queue, now)
+			result = append(result, queue.toQueueEntity(now))
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// GetQueue Gets a queue from the broker
+func (b *MemoryBroker) GetQueue(ctx context.Context, name string) (*servicebus.QueueEntity, error) {
+	var result *servicebus.QueueEntity
+	err := b.do(func(state *memoryState) error {
+		queue, err := state.getQueue(name)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		state.cleanup(queue, now)
+		result = queue.toQueueEntity(now)
+		return nil
+	})
+
+	return result, err
+}
+
+// CreateQueue Creates a queue in the broker
+func (b *MemoryBroker) CreateQueue(ctx context.Context, queue QueueEntity) error {
+	return b.do(func(state *memoryState) error {
+		if err := state.checkNameIsFree(queue.Name); err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		entity := &memoryQueue{
+			Name:               queue.Name,
+			LockDuration:       memoryDefaultLockDuration,
+			MaxDeliveryCount:   memoryDefaultMaxDelivery,
+			RequiresSession:    queue.RequiresSession,
+			EnablePartitioning: queue.EnablePartitioning,
+			DuplicateDetection: newMemoryDuplicateDetection(queue.DuplicateDetectionWindow),
+			Messages:           make([]*memoryMessage, 0),
+			DeadLetters:        make([]*memoryMessage, 0),
+			CreatedAt:          now,
+		}
+		if err := state.applySettings(entity, queue.LockDuration, queue.DefaultMessageTimeToLive, queue.AutoDeleteOnIdle, queue.MaxDeliveryCount, queue.Forward, queue.ForwardDeadLetter, now); err != nil {
+			return err
+		}
+
+		state.Queues[strings.ToLower(queue.Name)] = entity
+		state.changed = true
+		return nil
+	})
+}
+
+// UpdateQueue Updates an existing queue, only the properties set in the queue entity are changed
+func (b *MemoryBroker) UpdateQueue(ctx context.Context, queue QueueEntity) error {
+	return b.do(func(state *memoryState) error {
+		entity, err := state.getQueue(queue.Name)
+		if err != nil {
+			return err
+		}
+
+		state.changed = true
+		return state.applySettings(entity, queue.LockDuration, queue.DefaultMessageTimeToLive, queue.AutoDeleteOnIdle, queue.MaxDeliveryCount, queue.Forward, queue.ForwardDeadLetter, time.Now().UTC())
+	})
+}
+
+// DeleteQueue Deletes a queue from the broker
+func (b *MemoryBroker) DeleteQueue(ctx context.Context, name string) error {
+	return b.do(func(state *memoryState) error {
+		if _, err := state.getQueue(name); err != nil {
+			return err
+		}
+		delete(state.Queues, strings.ToLower(name))
+		state.changed = true
+		return nil
+	})
+}
+
+// ListSubscriptions Lists the subscriptions of a topic
+func (b *MemoryBroker) ListSubscriptions(ctx context.Context, topicName string) ([]*servicebus.SubscriptionEntity, error) {
+	result := make([]*servicebus.SubscriptionEntity, 0)
+	err := b.do(func(state *memoryState) error {
+		topic, err := state.getTopic(topicName)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, name := range sortedKeys(topic.Subscriptions) {
+			subscription := topic.Subscriptions[name]
+			state.cleanup(subscription, now)
+			result = append(result, subscription.toSubscriptionEntity(now))
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// GetSubscription Gets a subscription from a topic
+func (b *MemoryBroker) GetSubscription(ctx context.Context, topicName string, name string) (*servicebus.SubscriptionEntity, error) {
+	var result *servicebus.SubscriptionEntity
+	err := b.do(func(state *memoryState) error {
+		subscription, err := state.getSubscription(topicName, name)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		state.cleanup(subscription, now)
+		result = subscription.toSubscriptionEntity(now)
+		return nil
+	})
+
+	return result, err
+}
+
+// CreateSubscription Creates a subscription on a topic with the default rule, the rules in the
+// subscription entity are not created
+func (b *MemoryBroker) CreateSubscription(ctx context.Context, subscription SubscriptionEntity) error {
+	return b.do(func(state *memoryState) error {
+		topic, err := state.getTopic(subscription.TopicName)
+		if err != nil {
+			return err
+		}
+		if _, ok := topic.Subscriptions[strings.ToLower(subscription.Name)]; ok {
+			return errors.New("Subscription " + subscription.Name + " already exists on topic " + subscription.TopicName + " in service bus " + memoryBrokerName)
+		}
+
+		now := time.Now().UTC()
+		entity := &memoryQueue{
+			Name:             subscription.Name,
+			TopicName:        topic.Name,
+			LockDuration:     memoryDefaultLockDuration,
+			MaxDeliveryCount: memoryDefaultMaxDelivery,
+			RequiresSession:  subscription.RequiresSession,
+			Rules: []RuleEntity{
+				{Name: DefaultRuleName, SQLFilter: "1=1"},
+			},
+			Messages:    make([]*memoryMessage, 0),
+			DeadLetters: make([]*memoryMessage, 0),
+			CreatedAt:   now,
+		}
+		if err := state.applySettings(entity, subscription.LockDuration, subscription.DefaultMessageTimeToLive, subscription.AutoDeleteOnIdle, subscription.MaxDeliveryCount, subscription.Forward, subscription.ForwardDeadLetter, now); err != nil {
+			return err
+		}
+
+		topic.Subscriptions[strings.ToLower(subscription.Name)] = entity
+		state.changed = true
+		return nil
+	})
+}
+
+// UpdateSubscription Updates an existing subscription, only the properties set in the subscription
+// entity are changed and the rules are not changed
+func (b *MemoryBroker) UpdateSubscription(ctx context.Context, subscription SubscriptionEntity) error {
+	return b.do(func(state *memoryState) error {
+		entity, err := state.getSubscription(subscription.TopicName, subscription.Name)
+		if err != nil {
+			return err
+		}
+
+		state.changed = true
+		return state.applySettings(entity, subscription.LockDuration, subscription.DefaultMessageTimeToLive, subscription.AutoDeleteOnIdle, subscription.MaxDeliveryCount, subscription.Forward, subscription.ForwardDeadLetter, time.Now().UTC())
+	})
+}
+
+// DeleteSubscription Deletes a subscription from a topic
+func (b *MemoryBroker) DeleteSubscription(ctx context.Context, topicName string, name string) error {
+	return b.do(func(state *memoryState) error {
+		topic, err := state.getTopic(topicName)
+		if err != nil {
+			return err
+		}
+		if _, err := state.getSubscription(topicName, name); err != nil {
+			return err
+		}
+		delete(topic.Subscriptions, strings.ToLower(name))
+		state.changed = true
+		return nil
+	})
+}
+
+// ListRules Lists the rules of a subscription
+func (b *MemoryBroker) ListRules(ctx context.Context, topicName string, subscriptionName string) ([]RuleEntity, error) {
+	result := make([]RuleEntity, 0)
+	err := b.do(func(state *memoryState) error {
+		subscription, err := state.getSubscription(topicName, subscriptionName)
+		if err != nil {
+			return err
+		}
+		for _, rule := range subscription.Rules {
+			result = append(result, rule)
+		}
+		return nil
+	})
+
+	return result, err
+}
+
+// CreateRule Creates a sql or correlation filter rule, with an optional action, in a subscription
+func (b *MemoryBroker) CreateRule(ctx context.Context, topicName string, subscriptionName string, rule RuleEntity) error {
+	if err := rule.Validate(); err != nil {
+		return err
+	}
+
+	return b.do(func(state *memoryState) error {
+		subscription, err := state.getSubscription(topicName, subscriptionName)
+		if err != nil {
+			return err
+		}
+		for _, existingRule := range subscription.Rules {
+			if strings.EqualFold(existingRule.Name, rule.Name) {
+				return errors.New("Rule " + rule.Name + " already exists in subscription " + subscriptionName + " on topic " + topicName)
+			}
+		}
+
+		subscription.Rules = append(subscription.Rules, rule)
+		sort.SliceStable(subscription.Rules, func(i, j int) bool {
+			return subscription.Rules[i].Name < subscription.Rules[j].Name
+		})
+		state.changed = true
+		return nil
+	})
+}
+
+// DeleteRule Deletes a rule from a subscription
+func (b *MemoryBroker) DeleteRule(ctx context.Context, topicName string, subscriptionName string, ruleName string) error {
+	return b.do(func(state *memoryState) error {
+		subscription, err := state.getSubscription(topicName, subscriptionName)
+		if err != nil {
+			return err
+		}
+		for i, rule := range subscription.Rules {
+			if strings.EqualFold(rule.Name, ruleName) {
+				subscription.Rules = append(subscription.Rules[:i], subscription.Rules[i+1:]...)
+				state.changed = true
+				return nil
+			}
+		}
+
+		return errors.New("Could not find rule " + ruleName + " in subscription " + subscriptionName + " on topic " + topicName)
+	})
+}
+
+// Send Sends a message to a queue or topic, following the forwarding rules of the entities
+func (b *MemoryBroker) Send(ctx context.Context, entityPath string, msg *servicebus.Message) error {
+	if strings.Contains(entityPath, "/") {
+		return errors.New("Messages can only be sent to queues and topics, " + entityPath + " is not a valid entity")
+	}
+	if msg.ID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return err
+		}
+		msg.ID = id
+	}
+
+	return b.do(func(state *memoryState) error {
+		return state.deliver(entityPath, msg, 0, time.Now().UTC())
+	})
+}
+
+// SendBatch Sends messages to a queue or topic, either all of the messages are delivered or none is
+func (b *MemoryBroker) SendBatch(ctx context.Context, entityPath string, msgs []*servicebus.Message) error {
+	if strings.Contains(entityPath, "/") {
+		return errors.New("Messages can only be sent to queues and topics, " + entityPath + " is not a valid entity")
+	}
+	for _, msg := range msgs {
+		if msg.ID == "" {
+			id, err := newUUID()
+			if err != nil {
+				return err
+			}
+			msg.ID = id
+		}
+	}
+
+	return b.do(func(state *memoryState) error {
+		now := time.Now().UTC()
+		for _, msg := range msgs {
+			if err := state.check(entityPath, msg, 0); err != nil {
+				return err
+			}
+		}
+		for _, msg := range msgs {
+			if err := state.deliver(entityPath, msg, 0, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Schedule Sends a message to a queue or topic to be enqueued at the enqueue time, every copy of
+// the message gets the same sequence number so they can be cancelled together
+func (b *MemoryBroker) Schedule(ctx context.Context, entityPath string, msg *servicebus.Message, enqueueTime time.Time) (int64, error) {
+	if strings.Contains(entityPath, "/") {
+		return 0, errors.New("Messages can only be scheduled in queues and topics, " + entityPath + " is not a valid entity")
+	}
+	if msg.ID == "" {
+		id, err := newUUID()
+		if err != nil {
+			return 0, err
+		}
+		msg.ID = id
+	}
+
+	var sequenceNumber int64
+	err := b.do(func(state *memoryState) error {
+		state.SequenceNumber++
+		sequenceNumber = state.SequenceNumber
+		scheduledTime := enqueueTime.UTC()
+		scheduled := cloneMessage(msg)
+		scheduled.SystemProperties = &servicebus.SystemProperties{
+			SequenceNumber:       &sequenceNumber,
+			ScheduledEnqueueTime: &scheduledTime,
+		}
+		state.changed = true
+		return state.deliver(entityPath, scheduled, 0, time.Now().UTC())
+	})
+
+	return sequenceNumber, err
+}
+
+// CancelScheduled Cancels scheduled messages of a queue or topic that were not enqueued yet
+func (b *MemoryBroker) CancelScheduled(ctx context.Context, entityPath string, sequenceNumbers ...int64) error {
+	return b.do(func(state *memoryState) error {
+		if _, err := state.getQueue(entityPath); err != nil {
+			if _, err := state.getTopic(entityPath); err != nil {
+				return errors.New("Could not find queue or topic " + entityPath + " in service bus " + memoryBrokerName)
+			}
+		}
+
+		now := time.Now().UTC()
+		for _, sequenceNumber := range sequenceNumbers {
+			cancelled := false
+			// scheduled messages can be forwarded, so every entity is checked for copies of the message
+			for _, entity := range state.entities() {
+				for i := len(entity.Messages) - 1; i >= 0; i-- {
+					message := entity.Messages[i]
+					if message.isScheduled(now) && getSequenceNumber(message.Message) == sequenceNumber {
+						entity.remove(false, i)
+						cancelled = true
+					}
+				}
+			}
+			if !cancelled {
+				return errors.New("Could not find scheduled message with sequence number " + fmt.Sprint(sequenceNumber) + " in " + entityPath)
+			}
+			state.changed = true
+		}
+
+		return nil
+	})
+}
+
+// Peek Peeks the messages of a queue, subscription or dead letter queue without locking them
+func (b *MemoryBroker) Peek(ctx context.Context, entityPath string) (servicebus.MessageIterator, error) {
+	messages := make([]*servicebus.Message, 0)
+	err := b.do(func(state *memoryState) error {
+		entity, deadLetter, err := state.resolve(entityPath)
+		if err != nil {
+			return err
+		}
+
+		state.cleanup(entity, time.Now().UTC())
+		for _, message := range entity.list(deadLetter) {
+			messages = append(messages, cloneMessage(message.Message))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return servicebus.AsMessageSliceIterator(messages), nil
+}
+
+// NewReceiver Creates a peek lock, or receive and delete, receiver for a queue, subscription or dead
+// letter queue, messages are always received one by one
+func (b *MemoryBroker) NewReceiver(ctx context.Context, entityPath string, options ...ReceiverOption) (Receiver, error) {
+	err := b.do(func(state *memoryState) error {
+		entity, deadLetter, err := state.resolve(entityPath)
+		if err != nil {
+			return err
+		}
+		if entity.RequiresSession && !deadLetter {
+			return errors.New("It is not possible for an entity that requires sessions to create a non-sessionful message receiver, " + entityPath + " requires sessions")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	settings := newReceiverSettings(options)
+	return &memoryReceiver{broker: b, entityPath: entityPath, receiveAndDelete: settings.ReceiveAndDelete}, nil
+}
+
+// ReceiveSession locks the next available session, or the session id if one is passed, and runs the
+// handler on its messages until none is received for the idle timeout, it returns the session id
+func (b *MemoryBroker) ReceiveSession(ctx context.Context, entityPath string, sessionID string, idleTimeout time.Duration, handler MessageHandler) (string, error) {
+	var acceptedSession, lockToken string
+	for acceptedSession == "" {
+		var err error
+		acceptedSession, lockToken, err = b.lockSession(entityPath, sessionID)
+		if err != nil {
+			return "", err
+		}
+		if acceptedSession != "" {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(memoryPollInterval):
+		}
+	}
+	defer b.unlockSession(entityPath, acceptedSession, lockToken)
+
+	lastActivity := time.Now()
+	for {
+		msg, err := b.lockNext(entityPath, &acceptedSession)
+		if err != nil {
+			return acceptedSession, err
+		}
+		if msg != nil {
+			if err := handler(ctx, msg); err != nil {
+				return acceptedSession, err
+			}
+			lastActivity = time.Now()
+			continue
+		}
+		if time.Since(lastActivity) >= idleTimeout {
+			return acceptedSession, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return acceptedSession, ctx.Err()
+		case <-time.After(memoryPollInterval):
+		}
+	}
+}
+
+// do runs an operation on the broker state, reloading the state file if it was changed by
+// another process and saving it if the operation changed the state
+func (b *MemoryBroker) do(operation func(state *memoryState) error) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if err := b.load(); err != nil {
+		return err
+	}
+
+	err := operation(b.state)
+	if b.state.changed {
+		b.state.changed = false
+		if saveErr := b.save(); saveErr != nil && err == nil {
+			err = saveErr
+		}
+	}
+
+	return err
+}
+
+func (b *MemoryBroker) load() error {
+	if b.state == nil {
+		b.state = &memoryState{
+			Topics: make(map[string]*memoryTopic),
+			Queues: make(map[string]*memoryQueue),
+		}
+	}
+	if b.statePath == "" {
+		return nil
+	}
+
+	info, err := os.Stat(b.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(b.stateTime) {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(b.statePath)
+	if err != nil {
+		return err
+	}
+
+	var state memoryState
+	if err := json.Unmarshal(content, &state); err != nil {
+		return errors.New("Could not read the memory broker state " + b.statePath + ": " + err.Error())
+	}
+	if state.Topics == nil {
+		state.Topics = make(map[string]*memoryTopic)
+	}
+	if state.Queues == nil {
+		state.Queues = make(map[string]*memoryQueue)
+	}
+
+	b.state = &state
+	b.stateTime = info.ModTime()
+	return nil
+}
+
+func (b *MemoryBroker) save() error {
+	if b.statePath == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(b.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// writing to a temporary file first so other processes never read a partial state
+	temporaryPath := filepath.Join(filepath.Dir(b.statePath), "."+filepath.Base(b.statePath)+".tmp")
+	if err := ioutil.WriteFile(temporaryPath, content, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temporaryPath, b.statePath); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(b.statePath)
+	if err != nil {
+		return err
+	}
+	b.stateTime = info.ModTime()
+	return nil
+}
+
+// lockSession locks the session id, or the session of the next available message if no session id
+// is passed, returns an empty session id if the session is not available
+func (b *MemoryBroker) lockSession(entityPath string, sessionID string) (string, string, error) {
+	var acceptedSession, lockToken string
+	err := b.do(func(state *memoryState) error {
+		entity, deadLetter, err := state.resolve(entityPath)
+		if err != nil {
+			return err
+		}
+		if !entity.RequiresSession || deadLetter {
+			return errors.New("The entity " + entityPath + " does not require sessions, use a non-sessionful receiver")
+		}
+
+		now := time.Now().UTC()
+		state.cleanup(entity, now)
+		if entity.Sessions == nil {
+			entity.Sessions = make(map[string]*memoryLock)
+		}
+
+		candidate := sessionID
+		if candidate == "" {
+			for _, message := range entity.Messages {
+				if message.Message.SessionID == nil || !message.isAvailable(now) {
+					continue
+				}
+				if _, locked := entity.Sessions[*message.Message.SessionID]; !locked {
+					candidate = *message.Message.SessionID
+					break
+				}
+			}
+		}
+		if candidate == "" {
+			return nil
+		}
+		if _, locked := entity.Sessions[candidate]; locked {
+			return nil
+		}
+
+		token, err := newUUID()
+		if err != nil {
+			return err
+		}
+		entity.Sessions[candidate] = &memoryLock{
+			LockToken:   token,
+			LockedUntil: now.Add(entity.LockDuration),
+		}
+		state.changed = true
+		acceptedSession = candidate
+		lockToken = token
+		return nil
+	})
+
+	return acceptedSession, lockToken, err
+}
+
+// unlockSession releases a session lock so the session can be accepted by another receiver
+func (b *MemoryBroker) unlockSession(entityPath string, sessionID string, lockToken string) error {
+	return b.do(func(state *memoryState) error {
+		entity, _, err := state.resolve(entityPath)
+		if err != nil {
+			return err
+		}
+		if lock, ok := entity.Sessions[sessionID]; ok && lock.LockToken == lockToken {
+			delete(entity.Sessions, sessionID)
+			state.changed = true
+		}
+		return nil
+	})
+}
+
+// lockNext locks the next available message of an entity, if a session id is passed only the messages
+// of that session are locked and the session lock is renewed, returns nil if there is none
+func (b *MemoryBroker) lockNext(entityPath string, sessionID *string) (*ReceivedMessage, error) {
+	var result *ReceivedMessage
+	err := b.do(func(state *memoryState) error {
+		entity, deadLetter, err := state.resolve(entityPath)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		state.cleanup(entity, now)
+		if sessionID != nil {
+			if lock, ok := entity.Sessions[*sessionID]; ok {
+				lock.LockedUntil = now.Add(entity.LockDuration)
+				state.changed = true
+			}
+		}
+		for _, message := range entity.list(deadLetter) {
+			if !message.isAvailable(now) {
+				continue
+			}
+			if sessionID != nil && (message.Message.SessionID == nil || *message.Message.SessionID != *sessionID) {
+				continue
+			}
+
+			lockToken, err := newUUID()
+			if err != nil {
+				return err
+			}
+			message.LockToken = lockToken
+			message.LockedUntil = now.Add(entity.LockDuration)
+			message.Message.DeliveryCount++
+			if message.Message.SystemProperties != nil {
+				lockedUntil := message.LockedUntil
+				message.Message.SystemProperties.LockedUntil = &lockedUntil
+			}
+			state.changed = true
+
+			result = &ReceivedMessage{
+				Message: cloneMessage(message.Message),
+				settler: &memorySettler{
+					broker:     b,
+					entityPath: entityPath,
+					lockToken:  message.LockToken,
+				},
+			}
+			return nil
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+func (r *memoryReceiver) ReceiveOne(ctx context.Context, handler MessageHandler) error {
+	for {
+		msg, err := r.broker.lockNext(r.entityPath, nil)
+		if err != nil {
+			return err
+		}
+		if msg != nil {
+			if r.receiveAndDelete {
+				if err := msg.Complete(ctx); err != nil {
+					return err
+				}
+				msg.settler = deletedSettler{}
+			}
+			return handler(ctx, msg)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(memoryPollInterval):
+		}
+	}
+}
+
+func (r *memoryReceiver) Listen(ctx context.Context, handler MessageHandler) error {
+	for {
+		err := r.ReceiveOne(ctx, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (r *memoryReceiver) Close(ctx context.Context) error {
+	return nil
+}
+
+func (s *memorySettler) complete(ctx context.Context, msg *ReceivedMessage) error {
+	return s.settle(func(state *memoryState, entity *memoryQueue, deadLetter bool, index int) {
+		entity.remove(deadLetter, index)
+	})
+}
+
+func (s *memorySettler) abandon(ctx context.Context, msg *ReceivedMessage) error {
+	return s.settle(func(state *memoryState, entity *memoryQueue, deadLetter bool, index int) {
+		message := entity.list(deadLetter)[index]
+		message.unlock()
+		if !deadLetter && message.Message.DeliveryCount >= uint32(entity.MaxDeliveryCount) {
+			state.deadLetter(entity, index, "MaxDeliveryCountExceeded", fmt.Sprintf("Message could not be consumed after %v delivery attempts.", entity.MaxDeliveryCount), time.Now().UTC())
+		}
+	})
+}
+
+func (s *memorySettler) deadLetter(ctx context.Context, msg *ReceivedMessage, err error) error {
+	if strings.HasSuffix(strings.ToLower(s.entityPath), strings.ToLower("/"+servicebus.DeadLetterQueueName)) {
+		return errors.New("Messages in a dead letter queue cannot be dead lettered")
+	}
+
+	description := ""
+	if err != nil {
+		description = err.Error()
+	}
+
+	return s.settle(func(state *memoryState, entity *memoryQueue, deadLetter bool, index int) {
+		state.deadLetter(entity, index, string(servicebus.ErrorInternalError), description, time.Now().UTC())
+	})
+}
+
+func (s *memorySettler) deferMessage(ctx context.Context, msg *ReceivedMessage) error {
+	return s.settle(func(state *memoryState, entity *memoryQueue, deadLetter bool, index int) {
+		message := entity.list(deadLetter)[index]
+		message.unlock()
+		message.Deferred = true
+	})
+}
+
+func (s *memorySettler) renewLock(ctx context.Context, msg *ReceivedMessage) error {
+	return s.settle(func(state *memoryState, entity *memoryQueue, deadLetter bool, index int) {
+		message := entity.list(deadLetter)[index]
+		message.LockedUntil = time.Now().UTC().Add(entity.LockDuration)
+		if message.Message.SystemProperties != nil {
+			lockedUntil := message.LockedUntil
+			message.Message.SystemProperties.LockedUntil = &lockedUntil
+		}
+	})
+}
+
+// settle finds the message locked with the settler lock token and runs the settlement on it
+func (s *memorySettler) settle(settlement func(state *memoryState, entity *memoryQueue, deadLetter bool, index int)) error {
+	return s.broker.do(func(state *memoryState) error {
+		entity, deadLetter, err := state.resolve(s.entityPath)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for i, message := range entity.list(deadLetter) {
+			if message.LockToken == s.lockToken && now.Before(message.LockedUntil) {
+				settlement(state, entity, deadLetter, i)
+				state.changed = true
+				return nil
+			}
+		}
+
+		return errors.New("The lock supplied is invalid, either the lock expired or the message was already removed from " + s.entityPath)
+	})
+}
+
+// entities gets all the queues and subscriptions of the broker
+func (s *memoryState) entities() []*memoryQueue {
+	result := make([]*memoryQueue, 0)
+	for _, name := range sortedKeys(s.Queues) {
+		result = append(result, s.Queues[name])
+	}
+	for _, topicName := range sortedKeys(s.Topics) {
+		topic := s.Topics[topicName]
+		for _, name := range sortedKeys(topic.Subscriptions) {
+			result = append(result, topic.Subscriptions[name])
+		}
+	}
+
+	return result
+}
+
+func (s *memoryState) checkNameIsFree(name string) error {
+	if name == "" || strings.Contains(name, "/") {
+		return errors.New("Invalid entity name " + name)
+	}
+	if _, ok := s.Topics[strings.ToLower(name)]; ok {
+		return errors.New("Topic " + name + " already exists in service bus " + memoryBrokerName)
+	}
+	if _, ok := s.Queues[strings.ToLower(name)]; ok {
+		return errors.New("Queue " + name + " already exists in service bus " + memoryBrokerName)
+	}
+
+	return nil
+}
+
+func (s *memoryState) getTopic(name string) (*memoryTopic, error) {
+	topic, ok := s.Topics[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.New("Could not find topic " + name + " in service bus " + memoryBrokerName)
+	}
+
+	return topic, nil
+}
+
+func (s *memoryState) getQueue(name string) (*memoryQueue, error) {
+	queue, ok := s.Queues[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.New("Could not find queue " + name + " in service bus " + memoryBrokerName)
+	}
+
+	return queue, nil
+}
+
+func (s *memoryState) getSubscription(topicName string, name string) (*memoryQueue, error) {
+	topic, err := s.getTopic(topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	subscription, ok := topic.Subscriptions[strings.ToLower(name)]
+	if !ok {
+		return nil, errors.New("Could not find subscription " + name + " on topic " + topicName + " in service bus " + memoryBrokerName)
+	}
+
+	return subscription, nil
+}
+
+// resolve gets the queue or subscription of an entity path and if the path is for its dead letter queue
+func (s *memoryState) resolve(entityPath string) (*memoryQueue, bool, error) {
+	deadLetter := false
+	path := strings.Trim(entityPath, "/")
+	suffix := "/" + strings.ToLower(servicebus.DeadLetterQueueName)
+	if strings.HasSuffix(strings.ToLower(path), suffix) {
+		deadLetter = true
+		path = path[:len(path)-len(suffix)]
+	}
+
+	parts := strings.Split(path, "/")
+	switch {
+	case len(parts) == 1:
+		queue, err := s.getQueue(parts[0])
+		return queue, deadLetter, err
+	case len(parts) == 3 && strings.EqualFold(parts[1], "Subscriptions"):
+		subscription, err := s.getSubscription(parts[0], parts[2])
+		return subscription, deadLetter, err
+	}
+
+	return nil, false, errors.New("Invalid entity path " + entityPath)
+}
+
+func (s *memoryState) applySettings(entity *memoryQueue, lockDuration time.Duration, timeToLive time.Duration, autoDeleteOnIdle time.Duration, maxDeliveryCount int32, forward ForwardEntity, forwardDeadLetter ForwardEntity, now time.Time) error {
+	if forward.Clear {
+		entity.Forward = ForwardEntity{}
+	} else if forward.To != "" {
+		if err := s.checkForwardTarget(forward); err != nil {
+			return err
+		}
+		entity.Forward = forward
+	}
+	if forwardDeadLetter.Clear {
+		entity.ForwardDeadLetter = ForwardEntity{}
+	} else if forwardDeadLetter.To != "" {
+		if err := s.checkForwardTarget(forwardDeadLetter); err != nil {
+			return err
+		}
+		entity.ForwardDeadLetter = forwardDeadLetter
+	}
+	if lockDuration > 0 {
+		entity.LockDuration = lockDuration
+	}
+	if timeToLive > 0 {
+		entity.DefaultMessageTimeToLive = timeToLive
+	}
+	if autoDeleteOnIdle > 0 {
+		entity.AutoDeleteOnIdle = autoDeleteOnIdle
+	}
+	if maxDeliveryCount > 0 {
+		entity.MaxDeliveryCount = maxDeliveryCount
+	}
+	entity.UpdatedAt = now
+
+	return nil
+}
+
+func (s *memoryState) checkForwardTarget(forward ForwardEntity) error {
+	var err error
+	switch forward.In {
+	case ForwardToTopic:
+		_, err = s.getTopic(forward.To)
+	default:
+		_, err = s.getQueue(forward.To)
+	}
+	if err != nil {
+		return errors.New("Could not find forwarding target " + formatForward(forward) + " in service bus " + memoryBrokerName)
+	}
+
+	return nil
+}
+
+// deliver sends a message to a queue or to the subscriptions of a topic following the forwarding
+// rules, a subscription gets a copy of the message for every rule that matches it
+func (s *memoryState) deliver(name string, msg *servicebus.Message, hops int, now time.Time) error {
+	if hops == 0 {
+		if err := s.check(name, msg, hops); err != nil {
+			return err
+		}
+	}
+	if hops > memoryMaxForwardingHops {
+		return errors.New("Message " + msg.ID + " exceeded the maximum number of forwarding hops")
+	}
+
+	if queue, ok := s.Queues[strings.ToLower(name)]; ok {
+		if queue.DuplicateDetection.isDuplicate(msg.ID, now) {
+			s.changed = true
+			return nil
+		}
+		if queue.Forward.To != "" {
+			return s.deliver(queue.Forward.To, msg, hops+1, now)
+		}
+		if err := queue.checkSession(msg); err != nil {
+			return err
+		}
+		s.enqueue(queue, msg, now)
+		return nil
+	}
+
+	topic, err := s.getTopic(name)
+	if err != nil {
+		return err
+	}
+
+	if topic.DuplicateDetection.isDuplicate(msg.ID, now) {
+		s.changed = true
+		return nil
+	}
+
+	// the topic time to live is used by the messages that do not have their own
+	if msg.TTL == nil && topic.DefaultMessageTimeToLive > 0 {
+		timeToLive := topic.DefaultMessageTimeToLive
+		msg = cloneMessage(msg)
+		msg.TTL = &timeToLive
+	}
+
+	for _, subscriptionName := range sortedKeys(topic.Subscriptions) {
+		subscription := topic.Subscriptions[subscriptionName]
+		for _, copy := range subscription.match(msg) {
+			if subscription.Forward.To != "" {
+				if err := s.deliver(subscription.Forward.To, copy, hops+1, now); err != nil {
+					return err
+				}
+				continue
+			}
+			s.enqueue(subscription, copy, now)
+		}
+	}
+
+	return nil
+}
+
+// check checks if a message can be delivered to a queue or topic without changing the state, so a
+// message is never delivered only to some of the subscriptions
+func (s *memoryState) check(name string, msg *servicebus.Message, hops int) error {
+	if hops > memoryMaxForwardingHops {
+		return errors.New("Message " + msg.ID + " exceeded the maximum number of forwarding hops")
+	}
+
+	if queue, ok := s.Queues[strings.ToLower(name)]; ok {
+		if queue.Forward.To != "" {
+			return s.check(queue.Forward.To, msg, hops+1)
+		}
+		return queue.checkSession(msg)
+	}
+
+	topic, err := s.getTopic(name)
+	if err != nil {
+		return err
+	}
+
+	for _, subscriptionName := range sortedKeys(topic.Subscriptions) {
+		subscription := topic.Subscriptions[subscriptionName]
+		for _, copy := range subscription.match(msg) {
+			if subscription.Forward.To != "" {
+				if err := s.check(subscription.Forward.To, copy, hops+1); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := subscription.checkSession(copy); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryState) enqueue(entity *memoryQueue, msg *servicebus.Message, now time.Time) {
+	var sequenceNumber int64
+	if isScheduledMessage(msg, now) && msg.SystemProperties.SequenceNumber != nil {
+		// scheduled messages keep the sequence number returned when they were scheduled
+		sequenceNumber = *msg.SystemProperties.SequenceNumber
+	} else {
+		s.SequenceNumber++
+		sequenceNumber = s.SequenceNumber
+	}
+	enqueuedTime := now
+
+	message := cloneMessage(msg)
+	message.DeliveryCount = 0
+	systemProperties := servicebus.SystemProperties{
+		SequenceNumber: &sequenceNumber,
+		EnqueuedTime:   &enqueuedTime,
+	}
+	if msg.SystemProperties != nil {
+		systemProperties.ScheduledEnqueueTime = msg.SystemProperties.ScheduledEnqueueTime
+		systemProperties.DeadLetterSource = msg.SystemProperties.DeadLetterSource
+	}
+	message.SystemProperties = &systemProperties
+	if message.TTL == nil && entity.DefaultMessageTimeToLive > 0 {
+		timeToLive := entity.DefaultMessageTimeToLive
+		message.TTL = &timeToLive
+	}
+
+	entity.Messages = append(entity.Messages, &memoryMessage{Message: message})
+	s.changed = true
+}
+
+// deadLetter moves a message into the dead letter queue of the entity or into the dead letter
+// forwarding target if there is one
+func (s *memoryState) deadLetter(entity *memoryQueue, index int, reason string, description string, now time.Time) {
+	message := entity.Messages[index]
+	entity.remove(false, index)
+	message.unlock()
+
+	if message.Message.UserProperties == nil {
+		message.Message.UserProperties = make(map[string]interface{})
+	}
+	message.Message.UserProperties[DeadLetterReasonProperty] = reason
+	message.Message.UserProperties[DeadLetterDescriptionProperty] = description
+	s.changed = true
+
+	if entity.ForwardDeadLetter.To != "" {
+		source := entity.path()
+		if message.Message.SystemProperties == nil {
+			message.Message.SystemProperties = &servicebus.SystemProperties{}
+		}
+		message.Message.SystemProperties.DeadLetterSource = &source
+		if err := s.deliver(entity.ForwardDeadLetter.To, message.Message, 1, now); err == nil {
+			return
+		}
+	}
+
+	entity.DeadLetters = append(entity.DeadLetters, message)
+}
+
+// cleanup removes the expired messages and releases the expired locks, the messages that reached
+// the maximum delivery count are dead lettered
+func (s *memoryState) cleanup(entity *memoryQueue, now time.Time) {
+	for i := len(entity.Messages) - 1; i >= 0; i-- {
+		message := entity.Messages[i]
+		if message.isExpired(now) {
+			entity.remove(false, i)
+			s.changed = true
+			continue
+		}
+		if message.LockToken != "" && !now.Before(message.LockedUntil) {
+			message.unlock()
+			s.changed = true
+			if message.Message.DeliveryCount >= uint32(entity.MaxDeliveryCount) {
+				s.deadLetter(entity, i, "MaxDeliveryCountExceeded", fmt.Sprintf("Message could not be consumed after %v delivery attempts.", entity.MaxDeliveryCount), now)
+			}
+		}
+	}
+
+	for _, message := range entity.DeadLetters {
+		if message.LockToken != "" && !now.Before(message.LockedUntil) {
+			message.unlock()
+			s.changed = true
+		}
+	}
+
+	for sessionID, lock := range entity.Sessions {
+		if !now.Before(lock.LockedUntil) {
+			delete(entity.Sessions, sessionID)
+			s.changed = true
+		}
+	}
+}
+
+// match gets the copies of the message selected by the subscription rules
+func (q *memoryQueue) match(msg *servicebus.Message) []*servicebus.Message {
+	result := make([]*servicebus.Message, 0)
+	for _, rule := range q.Rules {
+		matched, sqlMessage, err := rule.Test(NewSQLMessageFromMessage(msg))
+		if err != nil || !matched {
+			continue
+		}
+
+		copy := cloneMessage(msg)
+		sqlMessage.ApplyTo(copy)
+		result = append(result, copy)
+	}
+
+	return result
+}
+
+// checkSession checks if the message can be sent to the entity, entities that require sessions only
+// accept messages with a session id
+func (q *memoryQueue) checkSession(msg *servicebus.Message) error {
+	if q.RequiresSession && (msg.SessionID == nil || *msg.SessionID == "") {
+		return errors.New("The SessionId was not set on a message, and it cannot be sent to the entity " + q.path() + " which requires sessions")
+	}
+
+	return nil
+}
+
+func (q *memoryQueue) list(deadLetter bool) []*memoryMessage {
+	if deadLetter {
+		return q.DeadLetters
+	}
+
+	return q.Messages
+}
+
+func (q *memoryQueue) remove(deadLetter bool, index int) {
+	if deadLetter {
+		q.DeadLetters = append(q.DeadLetters[:index], q.DeadLetters[index+1:]...)
+		return
+	}
+
+	q.Messages = append(q.Messages[:index], q.Messages[index+1:]...)
+}
+
+func (q *memoryQueue) path() string {
+	if q.TopicName != "" {
+		return SubscriptionEntityPath(q.TopicName, q.Name)
+	}
+
+	return q.Name
+}
+
+func (q *memoryQueue) countDetails(now time.Time) *servicebus.CountDetails {
+	var active, scheduled int32
+	for _, message := range q.Messages {
+		if message.isScheduled(now) {
+			scheduled++
+		} else {
+			active++
+		}
+	}
+	deadLetters := int32(len(q.DeadLetters))
+	var transfer int32
+
+	return &servicebus.CountDetails{
+		ActiveMessageCount:             &active,
+		DeadLetterMessageCount:         &deadLetters,
+		ScheduledMessageCount:          &scheduled,
+		TransferDeadLetterMessageCount: &transfer,
+		TransferMessageCount:           &transfer,
+	}
+}
+
+func (q *memoryQueue) toQueueEntity(now time.Time) *servicebus.QueueEntity {
+	messageCount := int64(len(q.Messages) + len(q.DeadLetters))
+	maxDeliveryCount := q.MaxDeliveryCount
+	requiresSession := q.RequiresSession
+	enablePartitioning := q.EnablePartitioning
+	requiresDuplicateDetection := q.DuplicateDetection != nil
+	description := servicebus.QueueDescription{
+		LockDuration:               durationTo8601(q.LockDuration),
+		DefaultMessageTimeToLive:   durationTo8601(infiniteIfNotSet(q.DefaultMessageTimeToLive)),
+		AutoDeleteOnIdle:           durationTo8601(infiniteIfNotSet(q.AutoDeleteOnIdle)),
+		MaxDeliveryCount:           &maxDeliveryCount,
+		RequiresSession:            &requiresSession,
+		EnablePartitioning:         &enablePartitioning,
+		RequiresDuplicateDetection: &requiresDuplicateDetection,
+		MessageCount:               &messageCount,
+		CreatedAt:                  &date.Time{Time: q.CreatedAt},
+		UpdatedAt:                  &date.Time{Time: q.UpdatedAt},
+		CountDetails:               q.countDetails(now),
+	}
+	if q.DuplicateDetection != nil {
+		description.DuplicateDetectionHistoryTimeWindow = durationTo8601(q.DuplicateDetection.Window)
+	}
+	if q.Forward.To != "" {
+		description.ForwardTo = stringPtr(q.Forward.To)
+	}
+	if q.ForwardDeadLetter.To != "" {
+		description.ForwardDeadLetteredMessagesTo = stringPtr(q.ForwardDeadLetter.To)
+	}
+
+	return &servicebus.QueueEntity{
+		QueueDescription: &description,
+		Entity: &servicebus.Entity{
+			Name: q.Name,
+			ID:   q.Name,
+		},
+	}
+}
+
+func (q *memoryQueue) toSubscriptionEntity(now time.Time) *servicebus.SubscriptionEntity {
+	messageCount := int64(len(q.Messages) + len(q.DeadLetters))
+	maxDeliveryCount := q.MaxDeliveryCount
+	requiresSession := q.RequiresSession
+	description := servicebus.SubscriptionDescription{
+		LockDuration:             durationTo8601(q.LockDuration),
+		DefaultMessageTimeToLive: durationTo8601(infiniteIfNotSet(q.DefaultMessageTimeToLive)),
+		AutoDeleteOnIdle:         durationTo8601(infiniteIfNotSet(q.AutoDeleteOnIdle)),
+		MaxDeliveryCount:         &maxDeliveryCount,
+		RequiresSession:          &requiresSession,
+		MessageCount:             &messageCount,
+		CreatedAt:                &date.Time{Time: q.CreatedAt},
+		UpdatedAt:                &date.Time{Time: q.UpdatedAt},
+		CountDetails:             q.countDetails(now),
+	}
+	if q.Forward.To != "" {
+		description.ForwardTo = stringPtr(q.Forward.To)
+	}
+	if q.ForwardDeadLetter.To != "" {
+		description.ForwardDeadLetteredMessagesTo = stringPtr(q.ForwardDeadLetter.To)
+	}
+
+	return &servicebus.SubscriptionEntity{
+		SubscriptionDescription: &description,
+		Entity: &servicebus.Entity{
+			Name: q.Name,
+			ID:   SubscriptionEntityPath(q.TopicName, q.Name),
+		},
+	}
+}
+
+func (t *memoryTopic) toEntity() *servicebus.TopicEntity {
+	enablePartitioning := t.EnablePartitioning
+	supportOrdering := t.SupportOrdering
+	requiresDuplicateDetection := t.DuplicateDetection != nil
+	description := servicebus.TopicDescription{
+		DefaultMessageTimeToLive:   durationTo8601(infiniteIfNotSet(t.DefaultMessageTimeToLive)),
+		AutoDeleteOnIdle:           durationTo8601(infiniteIfNotSet(t.AutoDeleteOnIdle)),
+		EnablePartitioning:         &enablePartitioning,
+		SupportOrdering:            &supportOrdering,
+		RequiresDuplicateDetection: &requiresDuplicateDetection,
+		CreatedAt:                  &date.Time{Time: t.CreatedAt},
+		UpdatedAt:                  &date.Time{Time: t.UpdatedAt},
+	}
+	if t.MaxSizeInMegabytes > 0 {
+		maxSizeInMegabytes := t.MaxSizeInMegabytes
+		description.MaxSizeInMegabytes = &maxSizeInMegabytes
+	}
+	if t.DuplicateDetection != nil {
+		description.DuplicateDetectionHistoryTimeWindow = durationTo8601(t.DuplicateDetection.Window)
+	}
+
+	return &servicebus.TopicEntity{
+		TopicDescription: &description,
+		Entity: &servicebus.Entity{
+			Name: t.Name,
+			ID:   t.Name,
+		},
+	}
+}
+
+func newMemoryDuplicateDetection(window time.Duration) *memoryDuplicateDetection {
+	if window <= 0 {
+		return nil
+	}
+
+	return &memoryDuplicateDetection{
+		Window:     window,
+		MessageIDs: make(map[string]time.Time),
+	}
+}
+
+// isDuplicate checks if a message with the same id was sent during the window, otherwise the id is
+// kept so the next messages with it are dropped, the ids older than the window are removed
+func (d *memoryDuplicateDetection) isDuplicate(messageID string, now time.Time) bool {
+	if d == nil || messageID == "" {
+		return false
+	}
+	if d.MessageIDs == nil {
+		d.MessageIDs = make(map[string]time.Time)
+	}
+
+	for id, sentAt := range d.MessageIDs {
+		if sentAt.Add(d.Window).Before(now) {
+			delete(d.MessageIDs, id)
+		}
+	}
+	if _, ok := d.MessageIDs[messageID]; ok {
+		return true
+	}
+
+	d.MessageIDs[messageID] = now
+	return false
+}
+
+func (m *memoryMessage) isExpired(now time.Time) bool {
+	if m.Message.TTL == nil || m.Message.SystemProperties == nil || m.Message.SystemProperties.EnqueuedTime == nil {
+		return false
+	}
+
+	return m.Message.SystemProperties.EnqueuedTime.Add(*m.Message.TTL).Before(now)
+}
+
+func (m *memoryMessage) isScheduled(now time.Time) bool {
+	return isScheduledMessage(m.Message, now)
+}
+
+func (m *memoryMessage) isAvailable(now time.Time) bool {
+	return m.LockToken == "" && !m.Deferred && !m.isScheduled(now)
+}
+
+func (m *memoryMessage) unlock() {
+	m.LockToken = ""
+	m.LockedUntil = time.Time{}
+	if m.Message.SystemProperties != nil {
+		m.Message.SystemProperties.LockedUntil = nil
+	}
+}
+
+// cloneMessage copies the message fields so the copy can be changed without changing the original
+func cloneMessage(msg *servicebus.Message) *servicebus.Message {
+	result := servicebus.Message{
+		ContentType:    msg.ContentType,
+		CorrelationID:  msg.CorrelationID,
+		DeliveryCount:  msg.DeliveryCount,
+		ID:             msg.ID,
+		Label:          msg.Label,
+		ReplyTo:        msg.ReplyTo,
+		ReplyToGroupID: msg.ReplyToGroupID,
+		To:             msg.To,
+		Format:         msg.Format,
+	}
+
+	if msg.Data != nil {
+		result.Data = append([]byte{}, msg.Data...)
+	}
+	if msg.SessionID != nil {
+		sessionID := *msg.SessionID
+		result.SessionID = &sessionID
+	}
+	if msg.TTL != nil {
+		timeToLive := *msg.TTL
+		result.TTL = &timeToLive
+	}
+	if msg.SystemProperties != nil {
+		systemProperties := *msg.SystemProperties
+		result.SystemProperties = &systemProperties
+	}
+	if msg.UserProperties != nil {
+		result.UserProperties = make(map[string]interface{})
+		for key, value := range msg.UserProperties {
+			result.UserProperties[key] = value
+		}
+	}
+
+	return &result
+}
+
+func infiniteIfNotSet(duration time.Duration) time.Duration {
+	if duration <= 0 {
+		return memoryInfiniteDuration
+	}
+
+	return duration
+}
+
+func sortedKeys(values interface{}) []string {
+	keys := make([]string, 0)
+	switch entities := values.(type) {
+	case map[string]*memoryTopic:
+		for key := range entities {
+			keys = append(keys, key)
+		}
+	case map[string]*memoryQueue:
+		for key := range entities {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range entities {
+			keys = append(keys, key)
+		}
+	case map[string]interface{}:
+		for key := range entities {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,309 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func newMemoryBroker(t *testing.T) *MemoryBroker {
+	broker, err := NewMemoryBroker("")
+	if err != nil {
+		t.Fatalf("NewMemoryBroker() error = %v", err)
+	}
+
+	return broker
+}
+
+func TestMemoryBrokerCreateSubscriptionMaxDeliveryCount(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxDeliveryCount int32
+		want             int32
+	}{
+		{"default", 0, memoryDefaultMaxDelivery},
+		{"set", 3, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			broker := newMemoryBroker(t)
+			if err := broker.CreateTopic(ctx, TopicEntity{Name: "orders"}); err != nil {
+				t.Fatalf("CreateTopic() error = %v", err)
+			}
+			subscription := NewSubscription("orders", "billing")
+			subscription.MaxDeliveryCount = test.maxDeliveryCount
+			if err := broker.CreateSubscription(ctx, subscription); err != nil {
+				t.Fatalf("CreateSubscription() error = %v", err)
+			}
+
+			entity, err := broker.GetSubscription(ctx, "orders", "billing")
+			if err != nil {
+				t.Fatalf("GetSubscription() error = %v", err)
+			}
+			if entity.MaxDeliveryCount == nil || *entity.MaxDeliveryCount != test.want {
+				t.Errorf("MaxDeliveryCount = %v, want %v", entity.MaxDeliveryCount, test.want)
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerRuleRouting(t *testing.T) {
+	ctx := context.Background()
+	broker := newMemoryBroker(t)
+	if err := broker.CreateTopic(ctx, TopicEntity{Name: "orders"}); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	rules := map[string][]RuleEntity{
+		"all": nil,
+		"big": {{Name: "big", SQLFilter: "amount > 100", SQLAction: "SET sys.Label = 'big'"}},
+		"eu":  {{Name: "eu", CorrelationFilter: &CorrelationFilterEntity{Properties: map[string]interface{}{"region": "eu"}}}},
+		// every matching rule delivers its own copy of the message
+		"twice": {{Name: "any", SQLFilter: "1=1"}, {Name: "eu", SQLFilter: "region = 'eu'"}},
+	}
+	for name, subscriptionRules := range rules {
+		if err := broker.CreateSubscription(ctx, NewSubscription("orders", name)); err != nil {
+			t.Fatalf("CreateSubscription(%v) error = %v", name, err)
+		}
+		if subscriptionRules == nil {
+			continue
+		}
+		if err := broker.DeleteRule(ctx, "orders", name, DefaultRuleName); err != nil {
+			t.Fatalf("DeleteRule(%v) error = %v", name, err)
+		}
+		for _, rule := range subscriptionRules {
+			if err := broker.CreateRule(ctx, "orders", name, rule); err != nil {
+				t.Fatalf("CreateRule(%v, %v) error = %v", name, rule.Name, err)
+			}
+		}
+	}
+
+	for _, properties := range []map[string]interface{}{
+		{"amount": 50, "region": "eu"},
+		{"amount": 150, "region": "us"},
+	} {
+		msg := servicebus.NewMessageFromString("order")
+		msg.UserProperties = properties
+		if err := broker.Send(ctx, "orders", msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		subscription string
+		want         int
+	}{
+		{"all", 2},
+		{"big", 1},
+		{"eu", 1},
+		{"twice", 3},
+	}
+	for _, test := range tests {
+		t.Run(test.subscription, func(t *testing.T) {
+			messages := peekMessages(t, broker, SubscriptionEntityPath("orders", test.subscription))
+			if len(messages) != test.want {
+				t.Fatalf("messages = %v, want %v", len(messages), test.want)
+			}
+			if test.subscription == "big" && messages[0].Label != "big" {
+				t.Errorf("Label = %q, want the label set by the rule action", messages[0].Label)
+			}
+		})
+	}
+}
+
+func TestMemoryBrokerForwarding(t *testing.T) {
+	ctx := context.Background()
+	broker := newMemoryBroker(t)
+	if err := broker.CreateQueue(ctx, NewQueue("target")); err != nil {
+		t.Fatalf("CreateQueue() error = %v", err)
+	}
+	inbox := NewQueue("inbox")
+	inbox.MapMessageForwardFlag("queue:target")
+	worker := NewQueue("worker")
+	worker.MapDeadLetterForwardFlag("queue:target")
+	for _, queue := range []QueueEntity{inbox, worker} {
+		if err := broker.CreateQueue(ctx, queue); err != nil {
+			t.Fatalf("CreateQueue(%v) error = %v", queue.Name, err)
+		}
+	}
+	if err := broker.CreateTopic(ctx, TopicEntity{Name: "orders"}); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	subscription := NewSubscription("orders", "forwarded")
+	subscription.MapMessageForwardFlag("queue:inbox")
+	if err := broker.CreateSubscription(ctx, subscription); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+
+	for _, entityPath := range []string{"inbox", "orders", "worker"} {
+		if err := broker.Send(ctx, entityPath, servicebus.NewMessageFromString(entityPath)); err != nil {
+			t.Fatalf("Send(%v) error = %v", entityPath, err)
+		}
+	}
+	msg := receiveNext(t, broker, "worker", time.Second)
+	if msg == nil {
+		t.Fatal("no message received from worker")
+	}
+	if err := msg.DeadLetter(ctx, errors.New("failed")); err != nil {
+		t.Fatalf("DeadLetter() error = %v", err)
+	}
+
+	tests := []struct {
+		entityPath string
+		want       int
+	}{
+		{"inbox", 0},
+		{SubscriptionEntityPath("orders", "forwarded"), 0},
+		{"worker", 0},
+		{DeadLetterEntityPath("worker"), 0},
+		{"target", 3},
+	}
+	for _, test := range tests {
+		if got := len(peekMessages(t, broker, test.entityPath)); got != test.want {
+			t.Errorf("messages in %v = %v, want %v", test.entityPath, got, test.want)
+		}
+	}
+
+	for _, msg := range peekMessages(t, broker, "target") {
+		if string(msg.Data) != "worker" {
+			continue
+		}
+		if msg.SystemProperties.DeadLetterSource == nil || *msg.SystemProperties.DeadLetterSource != "worker" {
+			t.Errorf("DeadLetterSource = %v, want worker", msg.SystemProperties.DeadLetterSource)
+		}
+	}
+}
+
+func TestMemoryBrokerPeekLockCycle(t *testing.T) {
+	ctx := context.Background()
+	broker := newMemoryBroker(t)
+	queue := NewQueue("orders")
+	queue.MaxDeliveryCount = 2
+	if err := broker.CreateQueue(ctx, queue); err != nil {
+		t.Fatalf("CreateQueue() error = %v", err)
+	}
+	if err := broker.Send(ctx, "orders", servicebus.NewMessageFromString("order")); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	for delivery := uint32(1); delivery <= 2; delivery++ {
+		msg := receiveNext(t, broker, "orders", time.Second)
+		if msg == nil {
+			t.Fatalf("delivery %v: no message received", delivery)
+		}
+		if msg.DeliveryCount != delivery {
+			t.Errorf("delivery %v: DeliveryCount = %v", delivery, msg.DeliveryCount)
+		}
+		// a locked message is not received again until it is settled
+		if locked := receiveNext(t, broker, "orders", 200*time.Millisecond); locked != nil {
+			t.Fatalf("delivery %v: locked message %v was received again", delivery, locked.ID)
+		}
+		if err := msg.Abandon(ctx); err != nil {
+			t.Fatalf("delivery %v: Abandon() error = %v", delivery, err)
+		}
+	}
+
+	if got := len(peekMessages(t, broker, "orders")); got != 0 {
+		t.Errorf("messages in the queue = %v, want 0 after the max delivery count", got)
+	}
+	deadLetter := receiveNext(t, broker, DeadLetterEntityPath("orders"), time.Second)
+	if deadLetter == nil {
+		t.Fatal("the abandoned message was not dead lettered")
+	}
+	if reason := deadLetter.UserProperties[DeadLetterReasonProperty]; reason != "MaxDeliveryCountExceeded" {
+		t.Errorf("%v = %v, want MaxDeliveryCountExceeded", DeadLetterReasonProperty, reason)
+	}
+	if err := deadLetter.Complete(ctx); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if err := deadLetter.Complete(ctx); err == nil {
+		t.Error("Complete() of a settled message error = nil, want an invalid lock error")
+	}
+	if got := len(peekMessages(t, broker, DeadLetterEntityPath("orders"))); got != 0 {
+		t.Errorf("dead letters = %v, want 0 after completing", got)
+	}
+}
+
+func TestMemoryBrokerScheduledDelivery(t *testing.T) {
+	ctx := context.Background()
+	broker := newMemoryBroker(t)
+	if err := broker.CreateQueue(ctx, NewQueue("orders")); err != nil {
+		t.Fatalf("CreateQueue() error = %v", err)
+	}
+
+	sequenceNumber, err := broker.Schedule(ctx, "orders", servicebus.NewMessageFromString("later"), time.Now().Add(300*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	cancelled, err := broker.Schedule(ctx, "orders", servicebus.NewMessageFromString("cancelled"), time.Now().Add(300*time.Millisecond))
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if err := broker.CancelScheduled(ctx, "orders", cancelled); err != nil {
+		t.Fatalf("CancelScheduled() error = %v", err)
+	}
+
+	if msg := receiveNext(t, broker, "orders", 100*time.Millisecond); msg != nil {
+		t.Fatalf("scheduled message %v was received before its enqueue time", msg.ID)
+	}
+
+	msg := receiveNext(t, broker, "orders", 2*time.Second)
+	if msg == nil {
+		t.Fatal("scheduled message was not received after its enqueue time")
+	}
+	if string(msg.Data) != "later" || msg.SequenceNumber() != sequenceNumber {
+		t.Errorf("received %q with sequence number %v, want later with %v", msg.Data, msg.SequenceNumber(), sequenceNumber)
+	}
+	if err := msg.Complete(ctx); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if msg := receiveNext(t, broker, "orders", 500*time.Millisecond); msg != nil {
+		t.Errorf("cancelled message %q was received", msg.Data)
+	}
+}
+
+// receiveNext receives the next message of an entity in peek lock mode, it returns nil when none is
+// received before the timeout
+func receiveNext(t *testing.T, broker *MemoryBroker, entityPath string, timeout time.Duration) *ReceivedMessage {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	receiver, err := broker.NewReceiver(ctx, entityPath)
+	if err != nil {
+		t.Fatalf("NewReceiver(%v) error = %v", entityPath, err)
+	}
+	defer receiver.Close(ctx)
+
+	var result *ReceivedMessage
+	err = receiver.ReceiveOne(ctx, func(ctx context.Context, msg *ReceivedMessage) error {
+		result = msg
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		t.Fatalf("ReceiveOne(%v) error = %v", entityPath, err)
+	}
+
+	return result
+}
+
+func peekMessages(t *testing.T, broker *MemoryBroker, entityPath string) []*servicebus.Message {
+	iterator, err := broker.Peek(context.Background(), entityPath)
+	if err != nil {
+		t.Fatalf("Peek(%v) error = %v", entityPath, err)
+	}
+
+	result := make([]*servicebus.Message, 0)
+	for !iterator.Done() {
+		msg, err := iterator.Next(context.Background())
+		if err != nil {
+			break
+		}
+		result = append(result, msg)
+	}
+
+	return result
+}
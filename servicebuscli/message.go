@@ -1,8 +1,140 @@
 package servicebuscli
 
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
 // MessageEntity Entity
 type MessageEntity struct {
-	Label      string                 `json:"label"`
-	Message    map[string]interface{} `json:"message"`
-	Properties map[string]interface{} `json:"properties"`
+	Label            string                   `json:"label"`
+	Message          map[string]interface{}   `json:"message"`
+	Properties       map[string]interface{}   `json:"properties"`
+	Data             []byte                   `json:"data,omitempty"`
+	ID               string                   `json:"id,omitempty"`
+	CorrelationID    string                   `json:"correlationId,omitempty"`
+	ContentType      string                   `json:"contentType,omitempty"`
+	SessionID        string                   `json:"sessionId,omitempty"`
+	ScheduledAt      *time.Time               `json:"scheduledAt,omitempty"`
+	SystemProperties *MessageSystemProperties `json:"systemProperties,omitempty"`
+}
+
+// MessageSystemProperties Entity
+type MessageSystemProperties struct {
+	SequenceNumber   int64      `json:"sequenceNumber"`
+	DeliveryCount    uint32     `json:"deliveryCount"`
+	EnqueuedTime     *time.Time `json:"enqueuedTime,omitempty"`
+	DeadLetterSource string     `json:"deadLetterSource,omitempty"`
+}
+
+// NewMessageEntity Creates a message entity from a received message, if the body is a json object
+// it will be kept in the message field otherwise the raw bytes are kept in the data field
+func NewMessageEntity(msg *servicebus.Message) MessageEntity {
+	result := MessageEntity{
+		Label:         msg.Label,
+		Properties:    msg.UserProperties,
+		ID:            msg.ID,
+		CorrelationID: msg.CorrelationID,
+		ContentType:   msg.ContentType,
+		SystemProperties: &MessageSystemProperties{
+			DeliveryCount: msg.DeliveryCount,
+		},
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(msg.Data, &body); err == nil && body != nil {
+		result.Message = body
+	} else {
+		result.Data = msg.Data
+	}
+
+	if msg.SessionID != nil {
+		result.SessionID = *msg.SessionID
+	}
+	if msg.SystemProperties != nil {
+		if msg.SystemProperties.SequenceNumber != nil {
+			result.SystemProperties.SequenceNumber = *msg.SystemProperties.SequenceNumber
+		}
+		result.SystemProperties.EnqueuedTime = msg.SystemProperties.EnqueuedTime
+		if msg.SystemProperties.DeadLetterSource != nil {
+			result.SystemProperties.DeadLetterSource = *msg.SystemProperties.DeadLetterSource
+		}
+	}
+
+	return result
+}
+
+// ToServiceBusMessage Creates a message to be sent from the message entity, a json message is
+// serialized into the body otherwise the raw data is used
+func (m MessageEntity) ToServiceBusMessage() (*servicebus.Message, error) {
+	result := servicebus.Message{
+		Data:           m.Data,
+		Label:          m.Label,
+		UserProperties: m.Properties,
+		ID:             m.ID,
+		CorrelationID:  m.CorrelationID,
+		ContentType:    m.ContentType,
+	}
+
+	if m.Message != nil {
+		messageData, err := json.MarshalIndent(m.Message, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		result.Data = messageData
+	}
+	if m.SessionID != "" {
+		sessionID := m.SessionID
+		result.SessionID = &sessionID
+	}
+
+	return &result, nil
+}
+
+// NewMessageFromReceived Creates a new message to be sent from a received message, keeping the
+// body, label, correlation and user properties but dropping the broker dead letter properties.
+// The message gets a new id when it is sent unless keepMessageID is set, an entity detecting
+// duplicates drops the messages sent again with their original id
+func NewMessageFromReceived(msg *servicebus.Message, keepMessageID bool) *servicebus.Message {
+	result := servicebus.Message{
+		ContentType:    msg.ContentType,
+		CorrelationID:  msg.CorrelationID,
+		Data:           msg.Data,
+		Label:          msg.Label,
+		ReplyTo:        msg.ReplyTo,
+		ReplyToGroupID: msg.ReplyToGroupID,
+		To:             msg.To,
+		SessionID:      msg.SessionID,
+		TTL:            msg.TTL,
+	}
+
+	if msg.UserProperties != nil {
+		result.UserProperties = make(map[string]interface{})
+		for key, value := range msg.UserProperties {
+			if key == DeadLetterReasonProperty || key == DeadLetterDescriptionProperty {
+				continue
+			}
+			result.UserProperties[key] = value
+		}
+	}
+	if keepMessageID {
+		result.ID = msg.ID
+	}
+
+	return &result
+}
+
+// requiresDuplicateDetection checks if the queue or topic messages are sent to drops the ones with
+// an id it has already received
+func (s *ServiceBusCli) requiresDuplicateDetection(ctx context.Context, to ForwardEntity) bool {
+	if to.In == ForwardToTopic {
+		topic, err := s.Broker.GetTopic(ctx, to.To)
+		return err == nil && topic != nil && topic.RequiresDuplicateDetection != nil && *topic.RequiresDuplicateDetection
+	}
+
+	queue, err := s.Broker.GetQueue(ctx, to.To)
+	return err == nil && queue != nil && queue.RequiresDuplicateDetection != nil && *queue.RequiresDuplicateDetection
 }
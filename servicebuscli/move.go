@@ -0,0 +1,356 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+// MessageSource structure, a queue or a subscription, or their dead letter sub queue, messages are
+// received from
+type MessageSource struct {
+	Queue        string
+	Topic        string
+	Subscription string
+	DeadLetter   bool
+}
+
+// TransferOptions structure
+type TransferOptions struct {
+	// Copy leaves the messages in the source entity, otherwise they are removed once sent
+	Copy bool
+	// DryRun only counts the messages that would be transferred
+	DryRun bool
+	// Filter selects the messages to transfer, the others stay in the source entity
+	Filter *SQLFilter
+	// Limit is the maximum number of messages to transfer, 0 transfers all of them
+	Limit int
+	// Label replaces the label of the messages when set
+	Label string
+	// SetProperties are user properties added to the messages or replacing existing ones
+	SetProperties map[string]interface{}
+	// RemoveProperties are user properties removed from the messages
+	RemoveProperties []string
+	// KeepMessageID sends the messages with their original id instead of a new one
+	KeepMessageID bool
+	// Target is the service bus the messages are sent to, when it is nil they are sent to the same one
+	Target *ServiceBusCli
+}
+
+// TransferResult structure
+type TransferResult struct {
+	// Matched is the number of messages selected by the filter
+	Matched int
+	// Transferred is the number of messages sent to the destination
+	Transferred int
+}
+
+// ParseMessageSource Parses a source entity, queue:name or subscription:topic/name, with a
+// /$deadletterqueue suffix for the dead letter sub queue
+func ParseMessageSource(value string) (MessageSource, error) {
+	var result MessageSource
+	invalid := errors.New("Invalid source " + value + ", use queue:name or subscription:topic/name with an optional /$deadletterqueue suffix")
+
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return result, invalid
+	}
+	name := parts[1]
+	if strings.HasSuffix(strings.ToLower(name), "/"+strings.ToLower(servicebus.DeadLetterQueueName)) {
+		result.DeadLetter = true
+		name = name[:len(name)-len(servicebus.DeadLetterQueueName)-1]
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "queue":
+		if name == "" || strings.Contains(name, "/") {
+			return result, invalid
+		}
+		result.Queue = name
+	case "subscription":
+		names := strings.Split(name, "/")
+		if len(names) != 2 || names[0] == "" || names[1] == "" {
+			return result, invalid
+		}
+		result.Topic = names[0]
+		result.Subscription = names[1]
+	default:
+		return result, invalid
+	}
+
+	return result, nil
+}
+
+// ParseMessageDestination Parses a destination entity, queue:name or topic:name
+func ParseMessageDestination(value string) (ForwardEntity, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) == 2 && parts[1] != "" && !strings.Contains(parts[1], "/") {
+		switch strings.ToLower(parts[0]) {
+		case "queue":
+			return ForwardEntity{To: parts[1], In: ForwardToQueue}, nil
+		case "topic":
+			return ForwardEntity{To: parts[1], In: ForwardToTopic}, nil
+		}
+	}
+
+	return ForwardEntity{}, errors.New("Invalid destination " + value + ", use queue:name or topic:name")
+}
+
+// EntityPath Gets the entity path messages are received from
+func (m MessageSource) EntityPath() string {
+	entityPath := m.Queue
+	if m.Queue == "" {
+		entityPath = SubscriptionEntityPath(m.Topic, m.Subscription)
+	}
+	if m.DeadLetter {
+		entityPath = DeadLetterEntityPath(entityPath)
+	}
+
+	return entityPath
+}
+
+func (m MessageSource) String() string {
+	result := "queue " + m.Queue
+	if m.Queue == "" {
+		result = "subscription " + m.Subscription + " on topic " + m.Topic
+	}
+	if m.DeadLetter {
+		result = "dead letters of " + result
+	}
+
+	return result
+}
+
+// TransferMessages Moves or copies the messages of a queue, a subscription or a dead letter sub queue
+// to a queue or a topic, keeping their body, label, user properties and correlation id, the dead
+// letter reason is removed and they get a new message id unless KeepMessageID is set. Copies and dry runs peek the messages so they are not locked, moved
+// messages are completed once sent and the ones not selected by the filter are released at the end
+func (s *ServiceBusCli) TransferMessages(from MessageSource, to ForwardEntity, options TransferOptions) (TransferResult, error) {
+	var result TransferResult
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if options.Target == nil {
+		options.Target = s
+	}
+	if err := s.checkTransferEntities(ctx, from, to, options.Target); err != nil {
+		logger.Error(err.Error())
+		return result, err
+	}
+
+	action := "Moving"
+	if options.Copy {
+		action = "Copying"
+	}
+	if options.DryRun {
+		action = "Counting"
+	}
+	if options.Target == s {
+		logger.LogHighlight("%v messages from %v to %v in service bus %v", log.Info, action, from.String(), formatForward(to), s.Broker.Name())
+	} else {
+		logger.LogHighlight("%v messages from %v in service bus %v to %v in service bus %v", log.Info, action, from.String(), s.Broker.Name(), formatForward(to), options.Target.Broker.Name())
+	}
+	if options.Filter != nil {
+		logger.LogHighlight("Only the messages matching %v are selected", log.Info, options.Filter.Expression)
+	}
+	if options.KeepMessageID && !options.DryRun && options.Target.requiresDuplicateDetection(ctx, to) {
+		logger.LogHighlight("%v detects duplicates, the messages it has received in its detection window are dropped", log.Warning, formatForward(to))
+	}
+
+	var err error
+	if options.Copy || options.DryRun {
+		result, err = s.transferPeekedMessages(ctx, from, to, options)
+	} else {
+		result, err = s.transferReceivedMessages(from, to, options)
+	}
+	if err != nil {
+		logger.Error(err.Error())
+	}
+
+	switch {
+	case options.DryRun && options.Copy:
+		logger.LogHighlight("%v messages would be copied from %v to %v", log.Info, fmt.Sprint(result.Matched), from.String(), formatForward(to))
+	case options.DryRun:
+		logger.LogHighlight("%v messages would be moved from %v to %v", log.Info, fmt.Sprint(result.Matched), from.String(), formatForward(to))
+	case options.Copy:
+		logger.LogHighlight("Copied %v messages from %v to %v", log.Info, fmt.Sprint(result.Transferred), from.String(), formatForward(to))
+	default:
+		logger.LogHighlight("Moved %v messages from %v to %v", log.Info, fmt.Sprint(result.Transferred), from.String(), formatForward(to))
+	}
+
+	return result, err
+}
+
+// checkTransferEntities checks the source exists in the service bus and the destination in the target one
+func (s *ServiceBusCli) checkTransferEntities(ctx context.Context, from MessageSource, to ForwardEntity, target *ServiceBusCli) error {
+	if from.Queue != "" {
+		if queue, err := s.Broker.GetQueue(ctx, from.Queue); err != nil || queue == nil {
+			return errors.New("Could not find queue " + from.Queue + " in service bus " + s.Broker.Name())
+		}
+	} else if subscription, err := s.Broker.GetSubscription(ctx, from.Topic, from.Subscription); err != nil || subscription == nil {
+		return errors.New("Could not find subscription " + from.Subscription + " on topic " + from.Topic + " in service bus " + s.Broker.Name())
+	}
+
+	if to.In == ForwardToTopic {
+		if topic, err := target.Broker.GetTopic(ctx, to.To); err != nil || topic == nil {
+			return errors.New("Could not find topic " + to.To + " in service bus " + target.Broker.Name())
+		}
+	} else if queue, err := target.Broker.GetQueue(ctx, to.To); err != nil || queue == nil {
+		return errors.New("Could not find queue " + to.To + " in service bus " + target.Broker.Name())
+	}
+
+	if target == s && from.Queue != "" && !from.DeadLetter && to.In == ForwardToQueue && strings.EqualFold(from.Queue, to.To) {
+		return errors.New("Cannot transfer the messages of queue " + from.Queue + " to itself")
+	}
+
+	return nil
+}
+
+// transferPeekedMessages copies the peeked messages, or only counts them on a dry run
+func (s *ServiceBusCli) transferPeekedMessages(ctx context.Context, from MessageSource, to ForwardEntity, options TransferOptions) (TransferResult, error) {
+	var result TransferResult
+	iterator, err := s.Broker.Peek(ctx, from.EntityPath())
+	if err != nil {
+		return result, err
+	}
+
+	now := time.Now()
+	for options.Limit <= 0 || result.Matched < options.Limit {
+		peekCtx, peekCancel := context.WithTimeout(ctx, 40*time.Second)
+		msg, err := iterator.Next(peekCtx)
+		peekCancel()
+		if err != nil {
+			var noMessages servicebus.ErrNoMessages
+			if errors.As(err, &noMessages) {
+				break
+			}
+			return result, err
+		}
+		if isScheduledMessage(msg, now) || !options.matches(msg) {
+			continue
+		}
+
+		result.Matched++
+		if options.DryRun {
+			continue
+		}
+		if err := options.Target.Broker.Send(ctx, to.To, options.message(msg)); err != nil {
+			return result, err
+		}
+		result.Transferred++
+		logger.LogHighlight("Copied message %v to %v", log.Info, msg.ID, formatForward(to))
+	}
+
+	return result, nil
+}
+
+// transferReceivedMessages receives the messages one by one, sending the selected ones to the
+// destination and completing them, like the dead letter commands the other ones are kept locked
+// until the end so they are not received twice
+func (s *ServiceBusCli) transferReceivedMessages(from MessageSource, to ForwardEntity, options TransferOptions) (TransferResult, error) {
+	var result TransferResult
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiver, err := s.Broker.NewReceiver(ctx, from.EntityPath())
+	if err != nil {
+		return result, err
+	}
+	defer receiver.Close(ctx)
+
+	seen := make(map[int64]bool)
+	skipped := make([]*ReceivedMessage, 0)
+	defer func() {
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 40*time.Second)
+		defer releaseCancel()
+		for _, msg := range skipped {
+			msg.Abandon(releaseCtx)
+		}
+	}()
+
+	for options.Limit <= 0 || result.Matched < options.Limit {
+		var handlerError error
+		done := false
+
+		receiveCtx, receiveCancel := context.WithTimeout(ctx, 10*time.Second)
+		err := receiver.ReceiveOne(receiveCtx, func(ctx context.Context, msg *ReceivedMessage) error {
+			sequenceNumber := msg.SequenceNumber()
+			if seen[sequenceNumber] {
+				done = true
+				skipped = append(skipped, msg)
+				return nil
+			}
+			seen[sequenceNumber] = true
+
+			if !options.matches(msg.Message) {
+				skipped = append(skipped, msg)
+				return nil
+			}
+
+			result.Matched++
+			if err := options.Target.Broker.Send(ctx, to.To, options.message(msg.Message)); err != nil {
+				handlerError = err
+				return msg.Abandon(ctx)
+			}
+			if err := msg.Complete(ctx); err != nil {
+				handlerError = errors.New("Message " + msg.ID + " was sent to " + formatForward(to) + " but could not be removed from the source: " + err.Error())
+				return nil
+			}
+
+			result.Transferred++
+			logger.LogHighlight("Moved message %v to %v", log.Info, msg.ID, formatForward(to))
+			return nil
+		})
+		timedOut := receiveCtx.Err() != nil
+		receiveCancel()
+
+		if handlerError != nil {
+			return result, handlerError
+		}
+		if timedOut || done {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (o TransferOptions) matches(msg *servicebus.Message) bool {
+	if o.Filter == nil {
+		return true
+	}
+
+	matched, err := o.Filter.Match(NewSQLMessageFromMessage(msg))
+	if err != nil {
+		logger.LogHighlight("Could not evaluate the filter on message %v: %v", log.Warning, msg.ID, err.Error())
+	}
+
+	return matched
+}
+
+// message creates the message sent to the destination with the label and property rewrites
+func (o TransferOptions) message(msg *servicebus.Message) *servicebus.Message {
+	result := NewMessageFromReceived(msg, o.KeepMessageID)
+	if o.Label != "" {
+		result.Label = o.Label
+	}
+	if len(o.SetProperties) > 0 && result.UserProperties == nil {
+		result.UserProperties = make(map[string]interface{})
+	}
+	for key, value := range o.SetProperties {
+		result.UserProperties[key] = value
+	}
+	for _, key := range o.RemoveProperties {
+		delete(result.UserProperties, key)
+	}
+
+	return result
+}
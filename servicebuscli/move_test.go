@@ -0,0 +1,51 @@
+package servicebuscli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestTransferMessagesDuplicateDetection(t *testing.T) {
+	tests := []struct {
+		name          string
+		keepMessageID bool
+		want          int
+	}{
+		{"new message id", false, 2},
+		{"original message id", true, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sbcli := newMemoryServiceBusCli(t)
+			target := NewQueue("target")
+			target.DuplicateDetectionWindow = 10 * time.Minute
+			for _, queue := range []QueueEntity{NewQueue("source"), target} {
+				if err := sbcli.CreateQueue(queue); err != nil {
+					t.Fatalf("CreateQueue(%v) error = %v", queue.Name, err)
+				}
+			}
+
+			// the target has already received a message with the same id
+			for _, queue := range []string{"source", "target"} {
+				msg := servicebus.NewMessageFromString("order")
+				msg.ID = "order-1"
+				if err := sbcli.Broker.Send(context.Background(), queue, msg); err != nil {
+					t.Fatalf("Send(%v) error = %v", queue, err)
+				}
+			}
+
+			options := TransferOptions{Limit: 1, KeepMessageID: test.keepMessageID}
+			if _, err := sbcli.TransferMessages(MessageSource{Queue: "source"}, ForwardEntity{To: "target", In: ForwardToQueue}, options); err != nil {
+				t.Fatalf("TransferMessages() error = %v", err)
+			}
+
+			if got := countMessages(t, sbcli, "target"); got != test.want {
+				t.Errorf("messages in the target = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,369 @@
+package servicebuscli
+
+import (
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/Azure/go-autorest/autorest/date"
+	"gopkg.in/yaml.v2"
+)
+
+// OutputFormat Enum
+type OutputFormat string
+
+// OutputFormat Enum definition, the log format keeps the human readable log lines
+const (
+	OutputLog   OutputFormat = ""
+	OutputJSON  OutputFormat = "json"
+	OutputYAML  OutputFormat = "yaml"
+	OutputTable OutputFormat = "table"
+	OutputCSV   OutputFormat = "csv"
+)
+
+// EntitySummary structure, it has the same fields for queues, topics and subscriptions so the
+// listings can be parsed the same way
+type EntitySummary struct {
+	Type                       string     `json:"type" yaml:"type"`
+	Name                       string     `json:"name" yaml:"name"`
+	Topic                      string     `json:"topic,omitempty" yaml:"topic,omitempty"`
+	Status                     string     `json:"status" yaml:"status"`
+	ActiveMessages             int32      `json:"activeMessages" yaml:"activeMessages"`
+	DeadLetterMessages         int32      `json:"deadLetterMessages" yaml:"deadLetterMessages"`
+	ScheduledMessages          int32      `json:"scheduledMessages" yaml:"scheduledMessages"`
+	TransferMessages           int32      `json:"transferMessages" yaml:"transferMessages"`
+	TransferDeadLetterMessages int32      `json:"transferDeadLetterMessages" yaml:"transferDeadLetterMessages"`
+	SizeInBytes                int64      `json:"sizeInBytes" yaml:"sizeInBytes"`
+	RequiresSession            bool       `json:"requiresSession" yaml:"requiresSession"`
+	ForwardTo                  string     `json:"forwardTo,omitempty" yaml:"forwardTo,omitempty"`
+	ForwardDeadLetterTo        string     `json:"forwardDeadLetterTo,omitempty" yaml:"forwardDeadLetterTo,omitempty"`
+	UpdatedAt                  *time.Time `json:"updatedAt,omitempty" yaml:"updatedAt,omitempty"`
+}
+
+// MessageSummary structure, used to output scheduled messages and dead letters
+type MessageSummary struct {
+	SequenceNumber        int64                  `json:"sequenceNumber" yaml:"sequenceNumber"`
+	ID                    string                 `json:"id" yaml:"id"`
+	Label                 string                 `json:"label,omitempty" yaml:"label,omitempty"`
+	CorrelationID         string                 `json:"correlationId,omitempty" yaml:"correlationId,omitempty"`
+	SessionID             string                 `json:"sessionId,omitempty" yaml:"sessionId,omitempty"`
+	ContentType           string                 `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	DeliveryCount         uint32                 `json:"deliveryCount" yaml:"deliveryCount"`
+	EnqueuedAt            *time.Time             `json:"enqueuedAt,omitempty" yaml:"enqueuedAt,omitempty"`
+	ScheduledAt           *time.Time             `json:"scheduledAt,omitempty" yaml:"scheduledAt,omitempty"`
+	DeadLetterReason      string                 `json:"deadLetterReason,omitempty" yaml:"deadLetterReason,omitempty"`
+	DeadLetterDescription string                 `json:"deadLetterDescription,omitempty" yaml:"deadLetterDescription,omitempty"`
+	Properties            map[string]interface{} `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Body                  string                 `json:"body" yaml:"body"`
+	// BodyEncoding is base64 when the body is binary content
+	BodyEncoding string `json:"bodyEncoding,omitempty" yaml:"bodyEncoding,omitempty"`
+}
+
+// RuleSummary structure
+type RuleSummary struct {
+	Name   string `json:"name" yaml:"name"`
+	Type   string `json:"type" yaml:"type"`
+	Filter string `json:"filter" yaml:"filter"`
+	Action string `json:"action,omitempty" yaml:"action,omitempty"`
+}
+
+var entitySummaryColumns = []string{"type", "name", "topic", "status", "activeMessages", "deadLetterMessages", "scheduledMessages", "transferMessages", "transferDeadLetterMessages", "sizeInBytes", "requiresSession", "forwardTo", "forwardDeadLetterTo", "updatedAt"}
+var messageSummaryColumns = []string{"sequenceNumber", "id", "label", "correlationId", "sessionId", "contentType", "deliveryCount", "enqueuedAt", "scheduledAt", "deadLetterReason", "deadLetterDescription", "properties", "bodyEncoding", "body"}
+var ruleSummaryColumns = []string{"name", "type", "filter", "action"}
+
+// ParseOutputFormat Parses the value of the output flag, an empty value keeps the log output
+func ParseOutputFormat(value string) (OutputFormat, error) {
+	format := OutputFormat(strings.ToLower(strings.TrimSpace(value)))
+	switch format {
+	case OutputLog, OutputJSON, OutputYAML, OutputTable, OutputCSV:
+		return format, nil
+	}
+
+	return OutputLog, errors.New("Invalid output format " + value + ", it needs to be one of json, yaml, table or csv")
+}
+
+// IsStructured Checks if the output format is meant to be parsed instead of the log lines
+func (f OutputFormat) IsStructured() bool {
+	return f != OutputLog
+}
+
+// NewQueueSummary Creates an entity summary from a service bus queue
+func NewQueueSummary(queue *servicebus.QueueEntity) EntitySummary {
+	result := EntitySummary{
+		Type: "queue",
+		Name: queue.Name,
+	}
+	if queue.QueueDescription == nil {
+		return result
+	}
+
+	result.setCountDetails(queue.CountDetails)
+	result.setStatus(queue.Status)
+	result.SizeInBytes = int64Value(queue.SizeInBytes)
+	result.RequiresSession = queue.RequiresSession != nil && *queue.RequiresSession
+	result.ForwardTo = forwardTargetName(queue.ForwardTo)
+	result.ForwardDeadLetterTo = forwardTargetName(queue.ForwardDeadLetteredMessagesTo)
+	result.UpdatedAt = dateValue(queue.UpdatedAt)
+
+	return result
+}
+
+// NewTopicSummary Creates an entity summary from a service bus topic
+func NewTopicSummary(topic *servicebus.TopicEntity) EntitySummary {
+	result := EntitySummary{
+		Type: "topic",
+		Name: topic.Name,
+	}
+	if topic.TopicDescription == nil {
+		return result
+	}
+
+	result.setCountDetails(topic.CountDetails)
+	result.setStatus(topic.Status)
+	result.SizeInBytes = int64Value(topic.SizeInBytes)
+	result.UpdatedAt = dateValue(topic.UpdatedAt)
+
+	return result
+}
+
+// NewSubscriptionSummary Creates an entity summary from a service bus topic subscription
+func NewSubscriptionSummary(topicName string, subscription *servicebus.SubscriptionEntity) EntitySummary {
+	result := EntitySummary{
+		Type:  "subscription",
+		Name:  subscription.Name,
+		Topic: topicName,
+	}
+	if subscription.SubscriptionDescription == nil {
+		return result
+	}
+
+	result.setCountDetails(subscription.CountDetails)
+	result.setStatus(subscription.Status)
+	result.RequiresSession = subscription.RequiresSession != nil && *subscription.RequiresSession
+	result.ForwardTo = forwardTargetName(subscription.ForwardTo)
+	result.ForwardDeadLetterTo = forwardTargetName(subscription.ForwardDeadLetteredMessagesTo)
+	result.UpdatedAt = dateValue(subscription.UpdatedAt)
+
+	return result
+}
+
+// NewMessageSummary Creates a message summary from a service bus message
+func NewMessageSummary(msg *servicebus.Message) MessageSummary {
+	result := MessageSummary{
+		ID:            msg.ID,
+		Label:         msg.Label,
+		CorrelationID: msg.CorrelationID,
+		ContentType:   msg.ContentType,
+		DeliveryCount: msg.DeliveryCount,
+		Properties:    msg.UserProperties,
+		Body:          string(msg.Data),
+	}
+	if !isPrintable(msg.Data) {
+		result.Body = base64.StdEncoding.EncodeToString(msg.Data)
+		result.BodyEncoding = "base64"
+	}
+	if msg.SessionID != nil {
+		result.SessionID = *msg.SessionID
+	}
+	if msg.SystemProperties != nil {
+		if msg.SystemProperties.SequenceNumber != nil {
+			result.SequenceNumber = *msg.SystemProperties.SequenceNumber
+		}
+		result.EnqueuedAt = msg.SystemProperties.EnqueuedTime
+		result.ScheduledAt = msg.SystemProperties.ScheduledEnqueueTime
+	}
+	result.DeadLetterReason, result.DeadLetterDescription = GetDeadLetterReason(msg)
+
+	return result
+}
+
+// NewRuleSummary Creates a rule summary from a rule entity
+func NewRuleSummary(rule RuleEntity) RuleSummary {
+	result := RuleSummary{
+		Name:   rule.Name,
+		Type:   "sql",
+		Filter: rule.filterExpression(),
+		Action: rule.SQLAction,
+	}
+	if rule.CorrelationFilter != nil {
+		result.Type = "correlation"
+		result.Filter = rule.CorrelationFilter.String()
+	}
+
+	return result
+}
+
+// WriteEntitySummaries Writes the entity summaries in the output format
+func WriteEntitySummaries(w io.Writer, format OutputFormat, summaries []EntitySummary) error {
+	rows := make([][]string, 0, len(summaries))
+	for _, summary := range summaries {
+		updatedAt := ""
+		if summary.UpdatedAt != nil {
+			updatedAt = summary.UpdatedAt.UTC().Format(time.RFC3339)
+		}
+		rows = append(rows, []string{
+			summary.Type,
+			summary.Name,
+			summary.Topic,
+			summary.Status,
+			fmt.Sprint(summary.ActiveMessages),
+			fmt.Sprint(summary.DeadLetterMessages),
+			fmt.Sprint(summary.ScheduledMessages),
+			fmt.Sprint(summary.TransferMessages),
+			fmt.Sprint(summary.TransferDeadLetterMessages),
+			fmt.Sprint(summary.SizeInBytes),
+			fmt.Sprint(summary.RequiresSession),
+			summary.ForwardTo,
+			summary.ForwardDeadLetterTo,
+			updatedAt,
+		})
+	}
+
+	return writeOutput(w, format, summaries, entitySummaryColumns, rows)
+}
+
+// WriteMessageSummaries Writes the message summaries in the output format, the table format does not
+// include the message properties and body
+func WriteMessageSummaries(w io.Writer, format OutputFormat, summaries []MessageSummary) error {
+	rows := make([][]string, 0, len(summaries))
+	for _, summary := range summaries {
+		enqueuedAt := ""
+		if summary.EnqueuedAt != nil {
+			enqueuedAt = summary.EnqueuedAt.UTC().Format(time.RFC3339)
+		}
+		scheduledAt := ""
+		if summary.ScheduledAt != nil {
+			scheduledAt = summary.ScheduledAt.UTC().Format(time.RFC3339)
+		}
+		properties := ""
+		if len(summary.Properties) > 0 {
+			jsonProperties, _ := json.Marshal(summary.Properties)
+			properties = string(jsonProperties)
+		}
+		rows = append(rows, []string{
+			fmt.Sprint(summary.SequenceNumber),
+			summary.ID,
+			summary.Label,
+			summary.CorrelationID,
+			summary.SessionID,
+			summary.ContentType,
+			fmt.Sprint(summary.DeliveryCount),
+			enqueuedAt,
+			scheduledAt,
+			summary.DeadLetterReason,
+			summary.DeadLetterDescription,
+			properties,
+			summary.BodyEncoding,
+			summary.Body,
+		})
+	}
+
+	columns := messageSummaryColumns
+	if format == OutputTable {
+		columns = columns[:len(columns)-3]
+		for i := range rows {
+			rows[i] = rows[i][:len(columns)]
+		}
+	}
+
+	return writeOutput(w, format, summaries, columns, rows)
+}
+
+// WriteRuleSummaries Writes the rule summaries in the output format
+func WriteRuleSummaries(w io.Writer, format OutputFormat, summaries []RuleSummary) error {
+	rows := make([][]string, 0, len(summaries))
+	for _, summary := range summaries {
+		rows = append(rows, []string{summary.Name, summary.Type, summary.Filter, summary.Action})
+	}
+
+	return writeOutput(w, format, summaries, ruleSummaryColumns, rows)
+}
+
+// writeOutput writes the records as json or yaml, or the rows as a table or csv
+func writeOutput(w io.Writer, format OutputFormat, records interface{}, columns []string, rows [][]string) error {
+	switch format {
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case OutputYAML:
+		content, err := yaml.Marshal(records)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(content)
+		return err
+	case OutputTable:
+		writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		headers := make([]string, 0, len(columns))
+		for _, column := range columns {
+			headers = append(headers, strings.ToUpper(column))
+		}
+		fmt.Fprintln(writer, strings.Join(headers, "\t"))
+		for _, row := range rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	case OutputCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		if err := writer.WriteAll(rows); err != nil {
+			return err
+		}
+		return writer.Error()
+	}
+
+	return errors.New("Output format " + string(format) + " is not supported")
+}
+
+func (e *EntitySummary) setCountDetails(details *servicebus.CountDetails) {
+	if details == nil {
+		return
+	}
+
+	e.ActiveMessages = int32Value(details.ActiveMessageCount)
+	e.DeadLetterMessages = int32Value(details.DeadLetterMessageCount)
+	e.ScheduledMessages = int32Value(details.ScheduledMessageCount)
+	e.TransferMessages = int32Value(details.TransferMessageCount)
+	e.TransferDeadLetterMessages = int32Value(details.TransferDeadLetterMessageCount)
+}
+
+func (e *EntitySummary) setStatus(status *servicebus.EntityStatus) {
+	if status != nil {
+		e.Status = string(*status)
+	}
+}
+
+func int32Value(value *int32) int32 {
+	if value == nil {
+		return 0
+	}
+
+	return *value
+}
+
+func int64Value(value *int64) int64 {
+	if value == nil {
+		return 0
+	}
+
+	return *value
+}
+
+func dateValue(value *date.Time) *time.Time {
+	if value == nil {
+		return nil
+	}
+
+	result := value.Time
+	return &result
+}
@@ -0,0 +1,424 @@
+package servicebuscli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+// ProbeLabel is the default label of the probe messages
+const ProbeLabel = "ServiceBus.Tools.Probe"
+
+// probeSubscriptionAutoDelete removes the temporary probe subscription if it could not be deleted
+const probeSubscriptionAutoDelete = 5 * time.Minute
+
+// ProbeOptions structure
+type ProbeOptions struct {
+	// Iterations is the number of probe messages sent one after the other
+	Iterations int
+	// Timeout is the time to wait for each probe message to arrive
+	Timeout time.Duration
+	// Interval is the pause between two iterations
+	Interval time.Duration
+	Label    string
+	// Force probes a reply queue that has messages of other consumers, they stay locked while the
+	// probe runs and are abandoned at the end
+	Force bool
+}
+
+// ProbeResult structure, the latencies of the probe messages that arrived, the lost messages did not
+// arrive before the timeout
+type ProbeResult struct {
+	Sent      int
+	Received  int
+	Lost      int
+	Latencies []time.Duration
+}
+
+// ProbeSummary structure, the probe result with the latency percentiles in milliseconds
+type ProbeSummary struct {
+	From      string  `json:"from" yaml:"from"`
+	To        string  `json:"to" yaml:"to"`
+	Sent      int     `json:"sent" yaml:"sent"`
+	Received  int     `json:"received" yaml:"received"`
+	Lost      int     `json:"lost" yaml:"lost"`
+	MinMs     float64 `json:"minMs" yaml:"minMs"`
+	AverageMs float64 `json:"averageMs" yaml:"averageMs"`
+	P50Ms     float64 `json:"p50Ms" yaml:"p50Ms"`
+	P90Ms     float64 `json:"p90Ms" yaml:"p90Ms"`
+	P95Ms     float64 `json:"p95Ms" yaml:"p95Ms"`
+	P99Ms     float64 `json:"p99Ms" yaml:"p99Ms"`
+	MaxMs     float64 `json:"maxMs" yaml:"maxMs"`
+}
+
+var probeSummaryColumns = []string{"from", "to", "sent", "received", "lost", "minMs", "averageMs", "p50Ms", "p90Ms", "p95Ms", "p99Ms", "maxMs"}
+
+// probeListener receives the probe messages and matches them by their message id
+type probeListener struct {
+	mutex   sync.Mutex
+	sent    map[string]time.Time
+	arrived map[string]chan time.Time
+	// owned is set when the receive entity only exists for the probe, other messages are completed
+	owned   bool
+	stopped bool
+	skipped []*ReceivedMessage
+	// foreign gets a signal when a message of another consumer is received
+	foreign chan string
+}
+
+// Probe Sends probe messages with a unique message id and the correlation id of the run to a topic or
+// queue and waits for each of them to arrive in the receive entity, a queue or a subscription entity
+// path, measuring the end to end latency of the forwarding chain between them. A subscription is not
+// received from, the probe messages are received in a temporary subscription of the same topic with a
+// correlation filter on the run. A queue is only probed when no other message is in it unless the
+// probe is forced, the messages of other consumers received during the probe are abandoned at the end
+func (s *ServiceBusCli) Probe(from ForwardEntity, receivePath string, options ProbeOptions) (ProbeResult, error) {
+	result := ProbeResult{
+		Latencies: make([]time.Duration, 0, options.Iterations),
+	}
+	if options.Iterations <= 0 {
+		options.Iterations = 1
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 30 * time.Second
+	}
+	if options.Label == "" {
+		options.Label = ProbeLabel
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if from.In == ForwardToTopic {
+		if topic, err := s.Broker.GetTopic(ctx, from.To); err != nil || topic == nil {
+			commonError := errors.New("Could not find topic " + from.To + " in service bus " + s.Broker.Name())
+			logger.Error(commonError.Error())
+			return result, commonError
+		}
+	} else {
+		if queue, err := s.Broker.GetQueue(ctx, from.To); err != nil || queue == nil {
+			commonError := errors.New("Could not find queue " + from.To + " in service bus " + s.Broker.Name())
+			logger.Error(commonError.Error())
+			return result, commonError
+		}
+	}
+
+	runID, err := newUUID()
+	if err != nil {
+		return result, err
+	}
+	listener := probeListener{
+		sent:    make(map[string]time.Time),
+		arrived: make(map[string]chan time.Time),
+		skipped: make([]*ReceivedMessage, 0),
+		foreign: make(chan string, 1),
+	}
+	receiveFrom := receivePath
+	if topicName, subscriptionName, ok := SplitSubscriptionEntityPath(receivePath); ok {
+		probeSubscription, err := s.createProbeSubscription(ctx, topicName, subscriptionName, runID)
+		if err != nil {
+			logger.Error(err.Error())
+			return result, err
+		}
+		defer s.deleteProbeSubscription(topicName, probeSubscription)
+		receiveFrom = SubscriptionEntityPath(topicName, probeSubscription)
+		listener.owned = true
+		logger.LogHighlight("Receiving the probe messages of subscription %v in the temporary subscription %v", log.Info, subscriptionName, probeSubscription)
+	} else if err := s.checkProbeQueue(ctx, receivePath, options.Force); err != nil {
+		logger.Error(err.Error())
+		return result, err
+	}
+
+	receiver, err := s.Broker.NewReceiver(ctx, receiveFrom)
+	if err != nil {
+		commonError := errors.New("Could not receive from " + receivePath + " in service bus " + s.Broker.Name() + ": " + err.Error())
+		logger.Error(commonError.Error())
+		return result, commonError
+	}
+	listenCtx, listenCancel := context.WithCancel(ctx)
+	defer func() {
+		listenCancel()
+		closeCtx, closeCancel := context.WithTimeout(context.Background(), 40*time.Second)
+		defer closeCancel()
+		listener.release(closeCtx)
+		receiver.Close(closeCtx)
+	}()
+	go func() {
+		if err := receiver.Listen(listenCtx, listener.handle); err != nil && listenCtx.Err() == nil {
+			logger.Error(err.Error())
+		}
+	}()
+
+	// a forced probe keeps going when it receives the messages of other consumers
+	foreign := listener.foreign
+	if options.Force {
+		foreign = nil
+	}
+
+	logger.LogHighlight("Probing %v to %v in service bus %v with %v messages", log.Info, from.To, receivePath, s.Broker.Name(), fmt.Sprint(options.Iterations))
+	for i := 1; i <= options.Iterations; i++ {
+		if i > 1 && options.Interval > 0 {
+			time.Sleep(options.Interval)
+		}
+
+		id, err := newUUID()
+		if err != nil {
+			return result, err
+		}
+		data, _ := json.Marshal(map[string]interface{}{
+			"probe":     id,
+			"iteration": i,
+			"sentAt":    time.Now().UTC().Format(time.RFC3339Nano),
+		})
+		msg := servicebus.NewMessage(data)
+		msg.ID = id
+		msg.CorrelationID = runID
+		msg.Label = options.Label
+		msg.ContentType = "application/json"
+		// the copies received by the other subscriptions of the chain expire once the probe gives up
+		timeToLive := options.Timeout
+		msg.TTL = &timeToLive
+
+		arrived := listener.expect(id)
+		if err := s.Broker.Send(ctx, from.To, msg); err != nil {
+			logger.Error(err.Error())
+			return result, err
+		}
+		result.Sent++
+
+		select {
+		case receivedAt := <-arrived:
+			latency := receivedAt.Sub(listener.sentAt(id))
+			result.Received++
+			result.Latencies = append(result.Latencies, latency)
+			logger.LogHighlight("Probe %v of %v arrived in %v", log.Info, fmt.Sprint(i), fmt.Sprint(options.Iterations), latency.Round(time.Microsecond).String())
+		case <-time.After(options.Timeout):
+			result.Lost++
+			logger.LogHighlight("Probe %v of %v did not arrive in %v", log.Warning, fmt.Sprint(i), fmt.Sprint(options.Iterations), options.Timeout.String())
+		case messageID := <-foreign:
+			commonError := errors.New("Received message " + messageID + " of another consumer from queue " + receivePath + ", stopping the probe so its messages are not locked, use --force to probe it anyway")
+			logger.Error(commonError.Error())
+			return result, commonError
+		}
+	}
+
+	return result, nil
+}
+
+// createProbeSubscription creates a temporary subscription on the topic of the reply subscription that
+// only receives the messages with the correlation id of the probe run, the reply subscription consumers
+// keep receiving their messages
+func (s *ServiceBusCli) createProbeSubscription(ctx context.Context, topicName string, subscriptionName string, runID string) (string, error) {
+	if subscription, err := s.Broker.GetSubscription(ctx, topicName, subscriptionName); err != nil || subscription == nil {
+		return "", errors.New("Could not find subscription " + subscriptionName + " on topic " + topicName + " in service bus " + s.Broker.Name())
+	}
+
+	name := "probe-" + runID[:8]
+	subscription := NewSubscription(topicName, name)
+	subscription.AutoDeleteOnIdle = probeSubscriptionAutoDelete
+	if err := s.Broker.CreateSubscription(ctx, subscription); err != nil {
+		return "", errors.New("Could not create the temporary probe subscription " + name + " on topic " + topicName + ": " + err.Error())
+	}
+
+	err := s.Broker.DeleteRule(ctx, topicName, name, DefaultRuleName)
+	if err == nil {
+		err = s.Broker.CreateRule(ctx, topicName, name, RuleEntity{
+			Name:              "probe",
+			CorrelationFilter: &CorrelationFilterEntity{CorrelationID: runID},
+		})
+	}
+	if err != nil {
+		s.deleteProbeSubscription(topicName, name)
+		return "", errors.New("Could not filter the temporary probe subscription " + name + " on topic " + topicName + ": " + err.Error())
+	}
+
+	return name, nil
+}
+
+// deleteProbeSubscription deletes the temporary probe subscription, if it fails the subscription is
+// deleted by the service bus once it is idle
+func (s *ServiceBusCli) deleteProbeSubscription(topicName string, name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	if err := s.Broker.DeleteSubscription(ctx, topicName, name); err != nil {
+		logger.LogHighlight("Could not delete the temporary probe subscription %v on topic %v, it is deleted after %v idle: %v", log.Warning, name, topicName, probeSubscriptionAutoDelete.String(), err.Error())
+	}
+}
+
+// checkProbeQueue checks the reply queue exists and, unless the probe is forced, that it has no message
+// of other consumers that the probe would lock
+func (s *ServiceBusCli) checkProbeQueue(ctx context.Context, name string, force bool) error {
+	queue, err := s.Broker.GetQueue(ctx, name)
+	if err != nil || queue == nil {
+		return errors.New("Could not find queue " + name + " in service bus " + s.Broker.Name())
+	}
+	if force || queue.CountDetails == nil {
+		return nil
+	}
+
+	if count := int32Value(queue.CountDetails.ActiveMessageCount); count > 0 {
+		return errors.New("Queue " + name + " has " + fmt.Sprint(count) + " messages of other consumers that the probe would lock, use --force to probe it anyway")
+	}
+
+	return nil
+}
+
+// expect registers a probe message before sending it, the returned channel gets its arrival time
+func (l *probeListener) expect(id string) chan time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	arrived := make(chan time.Time, 1)
+	l.sent[id] = time.Now()
+	l.arrived[id] = arrived
+	return arrived
+}
+
+func (l *probeListener) sentAt(id string) time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.sent[id]
+}
+
+// handle completes the probe messages, including the ones arriving after their timeout. The messages
+// of other consumers are kept locked until the probe ends, abandoning them would receive them again
+// right away, unless the receive entity only exists for the probe
+func (l *probeListener) handle(ctx context.Context, msg *ReceivedMessage) error {
+	receivedAt := time.Now()
+	l.mutex.Lock()
+	arrived, ok := l.arrived[msg.ID]
+	if ok {
+		delete(l.arrived, msg.ID)
+	}
+	_, probe := l.sent[msg.ID]
+	l.mutex.Unlock()
+
+	if ok {
+		arrived <- receivedAt
+	}
+	if probe || l.owned {
+		return msg.Complete(ctx)
+	}
+
+	l.mutex.Lock()
+	stopped := l.stopped
+	if !stopped {
+		l.skipped = append(l.skipped, msg)
+	}
+	l.mutex.Unlock()
+	if stopped {
+		return msg.Abandon(ctx)
+	}
+
+	select {
+	case l.foreign <- msg.ID:
+	default:
+	}
+	return nil
+}
+
+// release abandons the messages of other consumers once the probe ends
+func (l *probeListener) release(ctx context.Context) {
+	l.mutex.Lock()
+	l.stopped = true
+	skipped := l.skipped
+	l.skipped = nil
+	l.mutex.Unlock()
+
+	for _, msg := range skipped {
+		msg.Abandon(ctx)
+	}
+}
+
+// Summary Gets the latency percentiles of the probe
+func (r ProbeResult) Summary(from string, to string) ProbeSummary {
+	summary := ProbeSummary{
+		From:     from,
+		To:       to,
+		Sent:     r.Sent,
+		Received: r.Received,
+		Lost:     r.Lost,
+	}
+	if len(r.Latencies) == 0 {
+		return summary
+	}
+
+	latencies := make([]time.Duration, len(r.Latencies))
+	copy(latencies, r.Latencies)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	var total time.Duration
+	for _, latency := range latencies {
+		total += latency
+	}
+	summary.MinMs = durationMilliseconds(latencies[0])
+	summary.MaxMs = durationMilliseconds(latencies[len(latencies)-1])
+	summary.AverageMs = durationMilliseconds(total / time.Duration(len(latencies)))
+	summary.P50Ms = durationMilliseconds(percentile(latencies, 50))
+	summary.P90Ms = durationMilliseconds(percentile(latencies, 90))
+	summary.P95Ms = durationMilliseconds(percentile(latencies, 95))
+	summary.P99Ms = durationMilliseconds(percentile(latencies, 99))
+
+	return summary
+}
+
+// PrintProbeSummary Prints the probe result
+func PrintProbeSummary(summary ProbeSummary) {
+	logger.LogHighlight("Probe from %v to %v: %v sent, %v received, %v lost", log.Info, summary.From, summary.To, fmt.Sprint(summary.Sent), fmt.Sprint(summary.Received), fmt.Sprint(summary.Lost))
+	if summary.Received == 0 {
+		return
+	}
+	logger.LogHighlight("Latency min %v, avg %v, max %v", log.Info, formatMilliseconds(summary.MinMs), formatMilliseconds(summary.AverageMs), formatMilliseconds(summary.MaxMs))
+	logger.LogHighlight("Latency p50 %v, p90 %v, p95 %v, p99 %v", log.Info, formatMilliseconds(summary.P50Ms), formatMilliseconds(summary.P90Ms), formatMilliseconds(summary.P95Ms), formatMilliseconds(summary.P99Ms))
+}
+
+// percentile gets the nearest rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, value float64) time.Duration {
+	rank := int(math.Ceil(value / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+func durationMilliseconds(value time.Duration) float64 {
+	return math.Round(float64(value)/float64(time.Millisecond)*1000) / 1000
+}
+
+func formatMilliseconds(value float64) string {
+	return fmt.Sprintf("%.3fms", value)
+}
+
+// WriteProbeSummary Writes the probe summary as json, yaml, a table or csv
+func WriteProbeSummary(w io.Writer, format OutputFormat, summary ProbeSummary) error {
+	formatFloat := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', 3, 64)
+	}
+	rows := [][]string{{
+		summary.From,
+		summary.To,
+		fmt.Sprint(summary.Sent),
+		fmt.Sprint(summary.Received),
+		fmt.Sprint(summary.Lost),
+		formatFloat(summary.MinMs),
+		formatFloat(summary.AverageMs),
+		formatFloat(summary.P50Ms),
+		formatFloat(summary.P90Ms),
+		formatFloat(summary.P95Ms),
+		formatFloat(summary.P99Ms),
+		formatFloat(summary.MaxMs),
+	}}
+
+	return writeOutput(w, format, summary, probeSummaryColumns, rows)
+}
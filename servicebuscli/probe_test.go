@@ -0,0 +1,109 @@
+package servicebuscli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestProbeReplySubscription(t *testing.T) {
+	sbcli := newMemoryServiceBusCli(t)
+	if err := sbcli.CreateTopic(TopicEntity{Name: "orders"}); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	if err := sbcli.CreateSubscription(NewSubscription("orders", "billing")); err != nil {
+		t.Fatalf("CreateSubscription() error = %v", err)
+	}
+	if err := sbcli.Broker.Send(context.Background(), "orders", servicebus.NewMessageFromString("order")); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	options := ProbeOptions{Iterations: 2, Timeout: 2 * time.Second}
+	result, err := sbcli.Probe(ForwardEntity{To: "orders", In: ForwardToTopic}, SubscriptionEntityPath("orders", "billing"), options)
+	if err != nil {
+		t.Fatalf("Probe() error = %v", err)
+	}
+	if result.Received != 2 || result.Lost != 0 {
+		t.Errorf("Probe() = %+v, want 2 received", result)
+	}
+
+	// the message of the subscription consumers was never locked by the probe
+	msg := receiveNext(t, sbcli.Broker.(*MemoryBroker), SubscriptionEntityPath("orders", "billing"), time.Second)
+	if msg == nil || string(msg.Data) != "order" || msg.DeliveryCount != 1 {
+		t.Errorf("first message of the subscription = %+v, want the order delivered once", msg)
+	}
+
+	subscriptions, err := sbcli.Broker.ListSubscriptions(context.Background(), "orders")
+	if err != nil {
+		t.Fatalf("ListSubscriptions() error = %v", err)
+	}
+	if len(subscriptions) != 1 {
+		t.Errorf("subscriptions = %v, want the temporary probe subscription to be deleted", len(subscriptions))
+	}
+}
+
+func TestProbeReplyQueueWithOtherMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		force   bool
+		wantErr bool
+	}{
+		{"refused", false, true},
+		{"forced", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sbcli := newMemoryServiceBusCli(t)
+			if err := sbcli.CreateQueue(NewQueue("orders")); err != nil {
+				t.Fatalf("CreateQueue() error = %v", err)
+			}
+			if err := sbcli.Broker.Send(context.Background(), "orders", servicebus.NewMessageFromString("order")); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			options := ProbeOptions{Iterations: 1, Timeout: 2 * time.Second, Force: test.force}
+			result, err := sbcli.Probe(ForwardEntity{To: "orders", In: ForwardToQueue}, "orders", options)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("Probe() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if !test.wantErr && result.Received != 1 {
+				t.Errorf("Probe() = %+v, want 1 received", result)
+			}
+
+			// the order is available again right away and only the probe messages were removed
+			messages := peekMessages(t, sbcli.Broker.(*MemoryBroker), "orders")
+			if len(messages) != 1 || string(messages[0].Data) != "order" {
+				t.Fatalf("messages in the queue = %v, want only the order", len(messages))
+			}
+			if msg := receiveNext(t, sbcli.Broker.(*MemoryBroker), "orders", time.Second); msg == nil {
+				t.Error("the order is still locked by the probe")
+			}
+		})
+	}
+}
+
+func TestProbeReplyQueueOtherMessageArrives(t *testing.T) {
+	sbcli := newMemoryServiceBusCli(t)
+	if err := sbcli.CreateQueue(NewQueue("orders")); err != nil {
+		t.Fatalf("CreateQueue() error = %v", err)
+	}
+	// the probe is sent to the topic, the other consumer sends directly to the reply queue
+	if err := sbcli.CreateTopic(TopicEntity{Name: "events"}); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		sbcli.Broker.Send(context.Background(), "orders", servicebus.NewMessageFromString("order"))
+	}()
+
+	options := ProbeOptions{Iterations: 1, Timeout: 2 * time.Second}
+	if _, err := sbcli.Probe(ForwardEntity{To: "events", In: ForwardToTopic}, "orders", options); err == nil {
+		t.Fatal("Probe() error = nil, want an error when a message of another consumer arrives")
+	}
+	if msg := receiveNext(t, sbcli.Broker.(*MemoryBroker), "orders", time.Second); msg == nil || string(msg.Data) != "order" {
+		t.Errorf("received %+v, want the order to be abandoned when the probe stops", msg)
+	}
+}
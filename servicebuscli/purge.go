@@ -0,0 +1,343 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+// Purge defaults
+const (
+	defaultPurgeParallelism = 4
+	defaultPurgeBatchSize   = 100
+	purgeIdleTimeout        = 5 * time.Second
+	purgeProgressInterval   = 2 * time.Second
+)
+
+// PurgeOptions structure
+type PurgeOptions struct {
+	// Before only removes the messages enqueued before this time
+	Before time.Time
+	// Filter only removes the messages matching it
+	Filter *SQLFilter
+	// Parallelism is the number of receivers removing messages at the same time
+	Parallelism int
+	// BatchSize is the number of messages each receiver prefetches when removing all of them
+	BatchSize int
+}
+
+// purger removes the messages of an entity with parallel receivers
+type purger struct {
+	options  PurgeOptions
+	purged   int64
+	mutex    sync.Mutex
+	seen     map[int64]bool
+	skipped  []*ReceivedMessage
+	errors   []error
+	selected bool
+	// targets are the sequence numbers of the selected messages that were not removed yet, they are
+	// found by peeking the entity before receiving
+	targets     map[int64]bool
+	stopRenewal context.CancelFunc
+}
+
+// PurgeQueue Removes the active messages of a queue keeping its configuration, when a time or a filter
+// is set only the messages enqueued before it or matching it are removed
+func (s *ServiceBusCli) PurgeQueue(queueName string, options PurgeOptions) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Broker.Name())
+		return 0, commonError
+	}
+	if queue.RequiresSession != nil && *queue.RequiresSession {
+		commonError = errors.New("Queue " + queueName + " requires sessions and cannot be purged")
+		logger.Error(commonError.Error())
+		return 0, commonError
+	}
+
+	logger.LogHighlight("Purging messages from queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
+	purged, err := s.purge(queueName, options, durationFrom8601(queue.LockDuration), func(ctx context.Context) (int64, error) {
+		queue, err := s.Broker.GetQueue(ctx, queueName)
+		if err != nil || queue == nil {
+			return 0, err
+		}
+		return activeMessageCount(queue.CountDetails, queue.MessageCount), nil
+	})
+
+	logger.LogHighlight("Purged %v messages from queue %v in service bus %v", log.Info, fmt.Sprint(purged), queueName, s.Broker.Name())
+	return purged, err
+}
+
+// PurgeSubscription Removes the active messages of a subscription keeping its configuration and rules,
+// when a time or a filter is set only the messages enqueued before it or matching it are removed
+func (s *ServiceBusCli) PurgeSubscription(topicName string, subscriptionName string, options PurgeOptions) (int, error) {
+	var commonError error
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	subscription, err := s.Broker.GetSubscription(ctx, topicName, subscriptionName)
+	if err != nil || subscription == nil {
+		commonError = errors.New("Could not find subscription " + subscriptionName + " on topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find subscription %v on topic %v in service bus %v", log.Error, subscriptionName, topicName, s.Broker.Name())
+		return 0, commonError
+	}
+	if subscription.RequiresSession != nil && *subscription.RequiresSession {
+		commonError = errors.New("Subscription " + subscriptionName + " on topic " + topicName + " requires sessions and cannot be purged")
+		logger.Error(commonError.Error())
+		return 0, commonError
+	}
+
+	logger.LogHighlight("Purging messages from subscription %v on topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+	purged, err := s.purge(SubscriptionEntityPath(topicName, subscriptionName), options, durationFrom8601(subscription.LockDuration), func(ctx context.Context) (int64, error) {
+		subscription, err := s.Broker.GetSubscription(ctx, topicName, subscriptionName)
+		if err != nil || subscription == nil {
+			return 0, err
+		}
+		return activeMessageCount(subscription.CountDetails, subscription.MessageCount), nil
+	})
+
+	logger.LogHighlight("Purged %v messages from subscription %v on topic %v in service bus %v", log.Info, fmt.Sprint(purged), subscriptionName, topicName, s.Broker.Name())
+	return purged, err
+}
+
+// purge runs the receivers until none of them receives a message, all of the messages are received
+// in receive and delete mode, when only some of them are selected they are found by peeking the entity
+// first and received in peek lock mode until all of them were removed, the other messages received on
+// the way are kept locked and released at the end so their delivery count is only raised once
+func (s *ServiceBusCli) purge(entityPath string, options PurgeOptions, lockDuration time.Duration, activeMessages func(ctx context.Context) (int64, error)) (int, error) {
+	if options.Parallelism <= 0 {
+		options.Parallelism = defaultPurgeParallelism
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultPurgeBatchSize
+	}
+
+	p := purger{
+		options:  options,
+		seen:     make(map[int64]bool),
+		skipped:  make([]*ReceivedMessage, 0),
+		errors:   make([]error, 0),
+		selected: !options.Before.IsZero() || options.Filter != nil,
+	}
+	if !options.Before.IsZero() {
+		logger.LogHighlight("Only the messages enqueued before %v are removed", log.Info, options.Before.Format(time.RFC3339))
+	}
+	if options.Filter != nil {
+		logger.LogHighlight("Only the messages matching %v are removed", log.Info, options.Filter.Expression)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	receiverOptions := []ReceiverOption{WithReceiveAndDelete(), WithPrefetchCount(uint32(options.BatchSize))}
+	if p.selected {
+		receiverOptions = nil
+		targets, err := s.purgeTargets(ctx, entityPath, &p)
+		if err != nil {
+			logger.Error(err.Error())
+			return 0, err
+		}
+		if len(targets) == 0 {
+			logger.LogHighlight("No message in %v was selected, nothing to remove", log.Info, entityPath)
+			return 0, nil
+		}
+		logger.LogHighlight("Found %v messages to remove in %v", log.Info, fmt.Sprint(len(targets)), entityPath)
+		p.targets = targets
+		renewCtx, stopRenewal := context.WithCancel(ctx)
+		defer stopRenewal()
+		p.stopRenewal = stopRenewal
+		go renewHeldLocks(renewCtx, lockDuration, p.held)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < options.Parallelism; i++ {
+		receiver, err := s.Broker.NewReceiver(ctx, entityPath, receiverOptions...)
+		if err != nil {
+			logger.Error(err.Error())
+			cancel()
+			wg.Wait()
+			return int(atomic.LoadInt64(&p.purged)), err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer receiver.Close(context.Background())
+			p.run(ctx, receiver)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(purgeProgressInterval)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-ticker.C:
+			countCtx, countCancel := context.WithTimeout(ctx, 10*time.Second)
+			active, err := activeMessages(countCtx)
+			countCancel()
+			if err == nil {
+				logger.LogHighlight("Purged %v messages, %v active messages left", log.Info, fmt.Sprint(atomic.LoadInt64(&p.purged)), fmt.Sprint(active))
+			}
+		}
+	}
+
+	p.release()
+	if len(p.errors) > 0 {
+		logger.Error(p.errors[0].Error())
+		return int(atomic.LoadInt64(&p.purged)), p.errors[0]
+	}
+
+	return int(atomic.LoadInt64(&p.purged)), nil
+}
+
+// run receives messages until none arrives in the idle timeout, all of the selected messages were
+// seen or another receiver failed
+func (p *purger) run(ctx context.Context, receiver Receiver) {
+	for {
+		done := false
+		receiveCtx, receiveCancel := context.WithTimeout(ctx, purgeIdleTimeout)
+		err := receiver.ReceiveOne(receiveCtx, func(ctx context.Context, msg *ReceivedMessage) error {
+			if !p.selected {
+				atomic.AddInt64(&p.purged, 1)
+				return msg.Complete(ctx)
+			}
+
+			p.mutex.Lock()
+			sequenceNumber := msg.SequenceNumber()
+			if p.seen[sequenceNumber] || len(p.targets) == 0 {
+				done = true
+				p.skipped = append(p.skipped, msg)
+				p.mutex.Unlock()
+				return nil
+			}
+			p.seen[sequenceNumber] = true
+			if !p.targets[sequenceNumber] {
+				p.skipped = append(p.skipped, msg)
+				p.mutex.Unlock()
+				return nil
+			}
+			p.mutex.Unlock()
+
+			if err := msg.Complete(ctx); err != nil {
+				return err
+			}
+			atomic.AddInt64(&p.purged, 1)
+			p.mutex.Lock()
+			delete(p.targets, sequenceNumber)
+			done = len(p.targets) == 0
+			p.mutex.Unlock()
+			return nil
+		})
+		timedOut := receiveCtx.Err() != nil
+		receiveCancel()
+
+		if timedOut || done || p.failed() {
+			return
+		}
+		if err != nil {
+			p.mutex.Lock()
+			p.errors = append(p.errors, err)
+			p.mutex.Unlock()
+			return
+		}
+	}
+}
+
+// purgeTargets peeks the active messages of the entity and returns the sequence numbers of the ones
+// selected by the time and the filter
+func (s *ServiceBusCli) purgeTargets(ctx context.Context, entityPath string, p *purger) (map[int64]bool, error) {
+	iterator, err := s.Broker.Peek(ctx, entityPath)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := make(map[int64]bool)
+	now := time.Now().UTC()
+	for {
+		msg, err := iterator.Next(ctx)
+		if err != nil {
+			var noMessages servicebus.ErrNoMessages
+			if errors.As(err, &noMessages) {
+				return targets, nil
+			}
+			return nil, err
+		}
+		if !isScheduledMessage(msg, now) && p.matches(msg) {
+			targets[getSequenceNumber(msg)] = true
+		}
+	}
+}
+
+func (p *purger) matches(msg *servicebus.Message) bool {
+	if !p.options.Before.IsZero() {
+		if msg.SystemProperties == nil || msg.SystemProperties.EnqueuedTime == nil || !msg.SystemProperties.EnqueuedTime.Before(p.options.Before) {
+			return false
+		}
+	}
+	if p.options.Filter != nil {
+		matched, err := p.options.Filter.Match(NewSQLMessageFromMessage(msg))
+		if err != nil {
+			logger.LogHighlight("Could not evaluate the filter on message %v: %v", log.Warning, msg.ID, err.Error())
+		}
+		return matched
+	}
+
+	return true
+}
+
+func (p *purger) failed() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return len(p.errors) > 0
+}
+
+// held gets the messages that were not selected, they stay locked until the purge ends
+func (p *purger) held() []*ReceivedMessage {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]*ReceivedMessage(nil), p.skipped...)
+}
+
+// release stops renewing the locks and abandons the messages that were not selected so they can be
+// received again
+func (p *purger) release() {
+	if p.stopRenewal != nil {
+		p.stopRenewal()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	for _, msg := range p.skipped {
+		msg.Abandon(ctx)
+	}
+}
+
+// activeMessageCount gets the active messages of the count details, or the total count of messages
+// when the details are not available
+func activeMessageCount(details *servicebus.CountDetails, messageCount *int64) int64 {
+	if details != nil && details.ActiveMessageCount != nil {
+		return int64(*details.ActiveMessageCount)
+	}
+	if messageCount != nil {
+		return *messageCount
+	}
+
+	return 0
+}
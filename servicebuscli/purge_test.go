@@ -0,0 +1,54 @@
+package servicebuscli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestPurgeQueueKeepsTheMessagesThatAreNotSelected(t *testing.T) {
+	ctx := context.Background()
+	broker := newMemoryBroker(t)
+	queue := NewQueue("orders")
+	queue.LockDuration = time.Second
+	queue.MaxDeliveryCount = 2
+	if err := broker.CreateQueue(ctx, queue); err != nil {
+		t.Fatalf("CreateQueue() error = %v", err)
+	}
+	for _, value := range []string{"keep", "drop"} {
+		msg := servicebus.NewMessageFromString(value)
+		msg.UserProperties = map[string]interface{}{"action": value}
+		if err := broker.Send(ctx, "orders", msg); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+
+	sbcli := New(broker)
+	filter, err := ParseMessageFilter("action = 'drop'")
+	if err != nil {
+		t.Fatalf("ParseMessageFilter() error = %v", err)
+	}
+	// the purges after the first one find nothing to remove so the kept message is not received again
+	for run, want := range []int{1, 0, 0} {
+		purged, err := sbcli.PurgeQueue("orders", PurgeOptions{Filter: filter, Parallelism: 1})
+		if err != nil {
+			t.Fatalf("run %v: PurgeQueue() error = %v", run, err)
+		}
+		if purged != want {
+			t.Errorf("run %v: purged = %v, want %v", run, purged, want)
+		}
+	}
+
+	messages := peekMessages(t, broker, "orders")
+	if len(messages) != 1 || string(messages[0].Data) != "keep" {
+		t.Fatalf("messages in the queue = %v, want only the kept one", len(messages))
+	}
+	if messages[0].DeliveryCount > 1 {
+		t.Errorf("DeliveryCount = %v, want at most 1", messages[0].DeliveryCount)
+	}
+	if got := len(peekMessages(t, broker, DeadLetterEntityPath("orders"))); got != 0 {
+		t.Errorf("dead letters = %v, want 0", got)
+	}
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"os"
 	"strings"
 	"time"
 
@@ -22,6 +21,11 @@ type QueueEntity struct {
 	MaxDeliveryCount         int32
 	Forward                  ForwardEntity
 	ForwardDeadLetter        ForwardEntity
+	RequiresSession          bool
+	// DuplicateDetectionWindow enables the duplicate detection when it is set, it can only be set
+	// when the queue is created
+	DuplicateDetectionWindow time.Duration
+	EnablePartitioning       bool
 }
 
 // NewQueue Creates a Queue entity
@@ -38,6 +42,11 @@ func NewQueue(name string) QueueEntity {
 
 // MapMessageForwardFlag Maps a forward flag string into it's sub components
 func (s *QueueEntity) MapMessageForwardFlag(value string) {
+	if strings.EqualFold(value, ForwardNone) {
+		s.Forward.To = ""
+		s.Forward.Clear = true
+		return
+	}
 	if value != "" {
 		forwardMapped := strings.Split(value, ":")
 		if len(forwardMapped) == 1 {
@@ -56,6 +65,11 @@ func (s *QueueEntity) MapMessageForwardFlag(value string) {
 
 // MapDeadLetterForwardFlag Maps a forward dead letter flag string into it's sub components
 func (s *QueueEntity) MapDeadLetterForwardFlag(value string) {
+	if strings.EqualFold(value, ForwardNone) {
+		s.ForwardDeadLetter.To = ""
+		s.ForwardDeadLetter.Clear = true
+		return
+	}
 	if value != "" {
 		forwardMapped := strings.Split(value, ":")
 		if len(forwardMapped) == 1 {
@@ -72,64 +86,36 @@ func (s *QueueEntity) MapDeadLetterForwardFlag(value string) {
 	}
 }
 
-// GetQueueManager creates a Service Bus Queue manager
-func (s *ServiceBusCli) GetQueueManager() *servicebus.QueueManager {
-	logger.Trace("Creating a service bus queue manager for service bus " + s.Namespace.Name)
-	if s.Namespace == nil {
-		_, err := s.GetNamespace()
-		if err != nil {
-			return nil
-		}
-	}
-
-	s.QueueManager = s.Namespace.NewQueueManager()
-	return s.QueueManager
-}
-
-// GetQueue Gets a Queue object from the Service Bus Namespace
-func (s *ServiceBusCli) GetQueue(queueName string) *servicebus.Queue {
-	logger.Trace("Getting queue " + queueName + " from service bus " + s.Namespace.Name)
-	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
-	defer cancel()
-	if queueName == "" {
-		return nil
-	}
-	if s.QueueManager == nil {
-		s.GetQueueManager()
-	}
-
-	qe, err := s.QueueManager.Get(ctx, queueName)
-
-	if err != nil {
-		fmt.Println(err)
-		return nil
+// GetChanges Gets the properties that are different between the queue entity and an existing
+// service bus queue, properties not set in the queue entity are ignored
+func (s *QueueEntity) GetChanges(existing *servicebus.QueueEntity) []PropertyChange {
+	changes := make([]PropertyChange, 0)
+	if existing == nil || existing.QueueDescription == nil {
+		return changes
 	}
 
-	queue, err := s.Namespace.NewQueue(qe.Name)
+	changes = compareDuration(changes, "lock duration", existing.LockDuration, s.LockDuration)
+	changes = compareDuration(changes, "default message time to live", existing.DefaultMessageTimeToLive, s.DefaultMessageTimeToLive)
+	changes = compareDuration(changes, "auto delete on idle", existing.AutoDeleteOnIdle, s.AutoDeleteOnIdle)
+	changes = compareInt32(changes, "max delivery count", existing.MaxDeliveryCount, s.MaxDeliveryCount)
+	changes = compareForward(changes, "forward to", existing.ForwardTo, s.Forward)
+	changes = compareForward(changes, "forward dead letters to", existing.ForwardDeadLetteredMessagesTo, s.ForwardDeadLetter)
 
-	return queue
+	return changes
 }
 
 // ListQueues Lists all the Queues in a Service Bus
 func (s *ServiceBusCli) ListQueues() ([]*servicebus.QueueEntity, error) {
-	logger.LogHighlight("Getting all queues from %v service bus ", log.Info, s.Namespace.Name)
+	logger.LogHighlight("Getting all queues from %v service bus ", log.Info, s.Broker.Name())
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	qm := s.GetQueueManager()
-	if qm == nil {
-		commonError := errors.New("There was an error getting the queue manager, check your internet connection")
-		logger.LogHighlight("There was an error getting the %v, check your internet connection", log.Error, "queue manager")
-		return nil, commonError
-	}
 
-	return qm.List(ctx)
+	return s.Broker.ListQueues(ctx)
 }
 
 // CreateQueue Creates a queue in the service bus namespace
 func (s *ServiceBusCli) CreateQueue(queue QueueEntity) error {
 	var commonError error
-	opts := make([]servicebus.QueueManagementOption, 0)
-
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
 	if queue.Name == "" {
@@ -137,83 +123,60 @@ func (s *ServiceBusCli) CreateQueue(queue QueueEntity) error {
 		logger.Error(commonError.Error())
 		return commonError
 	}
-	logger.LogHighlight("Creating queue %v in service bus %v", log.Info, queue.Name, s.Namespace.Name)
-
-	qm := s.GetQueueManager()
+	logger.LogHighlight("Creating queue %v in service bus %v", log.Info, queue.Name, s.Broker.Name())
 
 	// Checking if the queue already exists in the namespace
-	existingSubscription, err := qm.Get(ctx, queue.Name)
-	if existingSubscription != nil {
-		commonError = errors.New("Subscription " + queue.Name + " already exists  in service bus" + s.Namespace.Name)
-		logger.LogHighlight("Subscription %v already exists in service bus %v", log.Error, queue.Name, s.Namespace.Name)
+	existingQueue, _ := s.Broker.GetQueue(ctx, queue.Name)
+	if existingQueue != nil {
+		commonError = errors.New("Queue " + queue.Name + " already exists in service bus " + s.Broker.Name())
+		logger.LogHighlight("Queue %v already exists in service bus %v", log.Error, queue.Name, s.Broker.Name())
 		return commonError
 	}
 
-	// Generating subscription options
-	if queue.LockDuration.Milliseconds() > 0 {
-		opts = append(opts, servicebus.QueueEntityWithLockDuration(&queue.LockDuration))
-	}
-	if queue.DefaultMessageTimeToLive.Microseconds() > 0 {
-		opts = append(opts, servicebus.QueueEntityWithMessageTimeToLive(&queue.DefaultMessageTimeToLive))
-	}
-	if queue.AutoDeleteOnIdle.Microseconds() > 0 {
-		opts = append(opts, servicebus.QueueEntityWithAutoDeleteOnIdle(&queue.AutoDeleteOnIdle))
+	err := s.Broker.CreateQueue(ctx, queue)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
 	}
-	if queue.MaxDeliveryCount > 0 && queue.MaxDeliveryCount != 10 {
-		opts = append(opts, servicebus.QueueEntityWithMaxDeliveryCount(int32(queue.MaxDeliveryCount)))
+
+	logger.LogHighlight("Queue %v was created successfully in service bus %v", log.Info, queue.Name, s.Broker.Name())
+	return nil
+}
+
+// UpdateQueue Updates an existing queue in the service bus namespace, only the properties
+// set in the queue entity are changed and the changes are printed before being applied
+func (s *ServiceBusCli) UpdateQueue(queue QueueEntity) error {
+	var commonError error
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	if queue.Name == "" {
+		commonError = errors.New("Queue name cannot be null")
+		logger.Error(commonError.Error())
+		return commonError
 	}
+	logger.LogHighlight("Updating queue %v in service bus %v", log.Info, queue.Name, s.Broker.Name())
 
-	// Generating the forward rule, checking if the target exists or not
-	if queue.Forward.To != "" {
-		switch queue.Forward.In {
-		case ForwardToTopic:
-			tm := s.GetTopicManager()
-			target, err := tm.Get(ctx, queue.Forward.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding topic %v in service bus %v", log.Error, queue.Forward.To, s.Namespace.Name)
-				return err
-			}
-			opts = append(opts, servicebus.QueueEntityWithAutoForward(target))
-		case ForwardToQueue:
-			qm := s.GetQueueManager()
-			target, err := qm.Get(ctx, queue.Forward.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding queue %v in service bus %v", log.Error, queue.Forward.To, s.Namespace.Name)
-				return err
-			}
-			opts = append(opts, servicebus.QueueEntityWithForwardDeadLetteredMessagesTo(target))
-		}
+	existingQueue, err := s.Broker.GetQueue(ctx, queue.Name)
+	if err != nil || existingQueue == nil {
+		commonError = errors.New("Could not find queue " + queue.Name + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queue.Name, s.Broker.Name())
+		return commonError
 	}
 
-	// Generating the Dead Letter forwarding rule, checking if the target exist or not
-	if queue.ForwardDeadLetter.To != "" {
-		switch queue.ForwardDeadLetter.In {
-		case ForwardToTopic:
-			tm := s.GetTopicManager()
-			target, err := tm.Get(ctx, queue.ForwardDeadLetter.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding topic %v in service bus %v", log.Error, queue.Forward.To, s.Namespace.Name)
-				return err
-			}
-			opts = append(opts, servicebus.QueueEntityWithAutoForward(target))
-		case ForwardToQueue:
-			qm := s.GetQueueManager()
-			target, err := qm.Get(ctx, queue.ForwardDeadLetter.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding queue %v in service bus %v", log.Error, queue.Forward.To, s.Namespace.Name)
-				return err
-			}
-			opts = append(opts, servicebus.QueueEntityWithAutoForward(target))
-		}
+	changes := queue.GetChanges(existingQueue)
+	if len(changes) == 0 {
+		logger.LogHighlight("Queue %v is already up to date in service bus %v", log.Info, queue.Name, s.Broker.Name())
+		return nil
 	}
+	printPropertyChanges(changes)
 
-	_, err = qm.Put(ctx, queue.Name, opts...)
+	err = s.Broker.UpdateQueue(ctx, queue)
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
 
-	logger.LogHighlight("Queue %v was created successfully in service bus %v", log.Info, queue.Name, s.Namespace.Name)
+	logger.LogHighlight("Queue %v was updated successfully in service bus %v", log.Info, queue.Name, s.Broker.Name())
 	return nil
 }
 
@@ -228,22 +191,31 @@ func (s *ServiceBusCli) DeleteQueue(queueName string) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	logger.LogHighlight("Removing queue %v in service bus %v", log.Info, queueName, s.Namespace.Name)
-	qm := s.GetQueueManager()
+	logger.LogHighlight("Removing queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
 
-	err := qm.Delete(ctx, queueName)
+	err := s.Broker.DeleteQueue(ctx, queueName)
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
-	logger.LogHighlight("Queue %v was removed successfully from service bus %v", log.Info, queueName, s.Namespace.Name)
+	logger.LogHighlight("Queue %v was removed successfully from service bus %v", log.Info, queueName, s.Broker.Name())
 	return nil
 }
 
 // SendQueueMessage Sends a Service Bus Message to a Queue
 func (s *ServiceBusCli) SendQueueMessage(queueName string, message map[string]interface{}, label string, userParameters map[string]interface{}) error {
+	return s.SendQueueMessageEntity(queueName, MessageEntity{
+		Label:      label,
+		Message:    message,
+		Properties: userParameters,
+	})
+}
+
+// SendQueueMessageEntity Sends a message entity to a Queue, keeping its id, correlation and session,
+// if the message has a scheduled time it is scheduled instead and its sequence number is logged
+func (s *ServiceBusCli) SendQueueMessageEntity(queueName string, message MessageEntity) error {
 	var commonError error
-	logger.LogHighlight("Sending a service bus queue message to %v queue in service bus %v", log.Info, queueName, s.Namespace.Name)
+	logger.LogHighlight("Sending a service bus queue message to %v queue in service bus %v", log.Info, queueName, s.Broker.Name())
 	if queueName == "" {
 		commonError = errors.New("Queue cannot be null")
 		logger.Error(commonError.Error())
@@ -253,38 +225,43 @@ func (s *ServiceBusCli) SendQueueMessage(queueName string, message map[string]in
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	queue := s.GetQueue(queueName)
-	if queue == nil {
-		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Namespace.Name)
-		logger.LogHighlight("Could not find queue %v in service bus %v", log.Info, queueName, s.Namespace.Name)
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
 		return commonError
 	}
 
-	messageData, err := json.MarshalIndent(message, "", "  ")
+	sbMessage, err := message.ToServiceBusMessage()
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
 
-	sbMessage := servicebus.Message{
-		Data:           messageData,
-		UserProperties: userParameters,
-	}
+	if message.ScheduledAt != nil {
+		sequenceNumber, err := s.Broker.Schedule(ctx, queueName, sbMessage, *message.ScheduledAt)
+		if err != nil {
+			logger.Error(err.Error())
+			return err
+		}
 
-	if label != "" {
-		sbMessage.Label = label
-	}
+		logger.LogHighlight("Service bus queue message was scheduled successfully to %v queue in service bus %v", log.Info, queueName, s.Broker.Name())
+		logger.LogHighlight("Scheduled at: %v, sequence number: %v", log.Info, message.ScheduledAt.UTC().Format(time.RFC3339), fmt.Sprint(sequenceNumber))
+	} else {
+		err = s.Broker.Send(ctx, queueName, sbMessage)
 
-	err = queue.Send(ctx, &sbMessage)
+		if err != nil {
+			logger.Error(err.Error())
+			return err
+		}
 
-	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		logger.LogHighlight("Service bus queue message was sent successfully to %v queue in service bus %v", log.Info, queueName, s.Broker.Name())
+	}
+	if message.SessionID != "" {
+		logger.LogHighlight("Session: %v", log.Info, message.SessionID)
 	}
-
-	logger.LogHighlight("Service bus queue message was sent successfully to %v queue in service bus %v", log.Info, queueName, s.Namespace.Name)
 	logger.Info("Message:")
-	logger.Info(string(messageData))
+	fmt.Println(FormatMessageBody(sbMessage.ContentType, sbMessage.Data))
 	return nil
 }
 
@@ -292,21 +269,23 @@ func (s *ServiceBusCli) SendQueueMessage(queueName string, message map[string]in
 func (s *ServiceBusCli) SubscribeToQueue(queueName string) error {
 	var commonError error
 
-	var concurrentHandler servicebus.HandlerFunc = func(ctx context.Context, msg *servicebus.Message) error {
+	var concurrentHandler MessageHandler = func(ctx context.Context, msg *ReceivedMessage) error {
 		logger.LogHighlight("%v Received message %v on queue %v with label %v", log.Info, msg.SystemProperties.EnqueuedTime.String(), msg.ID, queueName, msg.Label)
+		if s.Consumer != nil {
+			return s.consumeMessage(ctx, queueName, msg)
+		}
+		s.printMutex.Lock()
 		logger.Info("User Properties:")
 		jsonString, _ := json.MarshalIndent(msg.UserProperties, "", "  ")
 		fmt.Println(string(jsonString))
 		logger.Info("Message Body:")
-		fmt.Println(string(msg.Data))
+		fmt.Println(FormatMessageBody(msg.ContentType, msg.Data))
+		s.printMutex.Unlock()
 
-		if !s.Peek {
-			return msg.Complete(ctx)
-		}
-		return nil
+		return s.settleMessage(ctx, msg)
 	}
 
-	logger.LogHighlight("Subscribing to queue %v in service bus %v", log.Info, queueName, s.Namespace.Name)
+	logger.LogHighlight("Subscribing to queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
 	if queueName == "" {
 		commonError = errors.New("Queue " + queueName + " cannot be null")
 		logger.LogHighlight("Queue %v cannot be null", log.Error, queueName)
@@ -316,26 +295,49 @@ func (s *ServiceBusCli) SubscribeToQueue(queueName string) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	queue := s.GetQueue(queueName)
-	if queue == nil {
-		commonError = errors.New("Could not find queue " + queueName + " in service bus" + s.Namespace.Name)
-		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Namespace.Name)
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Broker.Name())
 		return commonError
 	}
-	s.ActiveQueue = queue
-
-	logger.LogHighlight("Starting to receive messages queue %v for service bus %v", log.Info, queueName, s.Namespace.Name)
-	receiver, err := queue.NewReceiver(ctx)
+	s.ActiveQueue = queueName
 
+	limiter, err := s.newMessageLimiter(queueName, false, func() {
+		select {
+		case s.CloseQueueListener <- true:
+		default:
+		}
+	})
 	if err != nil {
-		commonError := errors.New("Could not create channel for queue " + queueName + " in " + s.Namespace.Name + " bus, subscription was not found")
-		logger.LogHighlight("Could not create channel for queue %v for service bus %v, subscription was not found", log.Error, queueName, s.Namespace.Name)
-		return commonError
+		logger.Error(err.Error())
+		return err
 	}
+	defer limiter.close()
+	concurrentHandler = limiter.wrap(concurrentHandler)
+
+	if (s.UseSessions || s.SessionID != "") && !s.peeksMessages() {
+		logger.LogHighlight("Starting to receive sessions in queue %v for service bus %v", log.Info, queueName, s.Broker.Name())
+		s.stopQueueListener = cancel
+		s.listenToSessionsConcurrently(ctx, queueName, concurrentHandler)
+	} else {
+		logger.LogHighlight("Starting to receive messages queue %v for service bus %v", log.Info, queueName, s.Broker.Name())
+		receiver, err := s.newListener(ctx, queueName)
 
-	listenerHandler := receiver.Listen(ctx, concurrentHandler)
-	s.ActiveQueueListenerHandle = listenerHandler
-	defer listenerHandler.Close(ctx)
+		if err != nil {
+			commonError := errors.New("Could not create channel for queue " + queueName + " in " + s.Broker.Name() + " bus, subscription was not found")
+			logger.LogHighlight("Could not create channel for queue %v for service bus %v, subscription was not found", log.Error, queueName, s.Broker.Name())
+			return commonError
+		}
+
+		s.ActiveQueueReceiver = receiver
+		s.stopQueueListener = cancel
+		go func() {
+			if err := receiver.Listen(ctx, s.withLockRenewal(concurrentHandler)); err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+	}
 
 	if <-s.CloseQueueListener {
 		s.CloseQueueSubscription()
@@ -345,12 +347,16 @@ func (s *ServiceBusCli) SubscribeToQueue(queueName string) error {
 
 // CloseQueueSubscription closes the subscription to a queue
 func (s *ServiceBusCli) CloseQueueSubscription() error {
-	logger.LogHighlight("Closing the subscription for %v queue in service bus %v", log.Info, s.ActiveQueue.Name, s.Namespace.Name)
+	logger.LogHighlight("Closing the subscription for %v queue in service bus %v", log.Info, s.ActiveQueue, s.Broker.Name())
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	s.ActiveQueueListenerHandle.Close(ctx)
-	s.ActiveQueue = nil
-	s.ActiveQueueListenerHandle = nil
+	s.stopQueueListener()
+	if s.ActiveQueueReceiver != nil {
+		s.ActiveQueueReceiver.Close(ctx)
+	}
+	s.ActiveQueue = ""
+	s.ActiveQueueReceiver = nil
+	s.stopQueueListener = nil
 	s.CloseQueueListener <- false
 	return nil
 }
@@ -0,0 +1,265 @@
+package servicebuscli
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultRuleName is the name of the rule the service bus creates in every new subscription, it
+// accepts every message
+const DefaultRuleName = "$Default"
+
+// CorrelationFilterEntity structure, a correlation filter matches the messages where all of the
+// properties set in the filter are equal to the message ones
+type CorrelationFilterEntity struct {
+	CorrelationID    string
+	MessageID        string
+	To               string
+	ReplyTo          string
+	Label            string
+	SessionID        string
+	ReplyToSessionID string
+	ContentType      string
+	Properties       map[string]interface{}
+}
+
+// IsEmpty Checks if the correlation filter has no property to match
+func (c *CorrelationFilterEntity) IsEmpty() bool {
+	return len(c.systemProperties()) == 0 && len(c.Properties) == 0
+}
+
+// Match Checks if the message matches all of the correlation filter properties, user properties are
+// compared by their text value
+func (c *CorrelationFilterEntity) Match(message *SQLMessage) bool {
+	for name, value := range c.systemProperties() {
+		messageValue, ok := message.SystemProperties[name]
+		if !ok || fmt.Sprint(messageValue) != value {
+			return false
+		}
+	}
+	for name, value := range c.Properties {
+		messageValue, ok := message.UserProperties[name]
+		if !ok || fmt.Sprint(messageValue) != fmt.Sprint(value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Equals Compares two correlation filters
+func (c *CorrelationFilterEntity) Equals(filter *CorrelationFilterEntity) bool {
+	if c == nil || filter == nil {
+		return c == nil && filter == nil
+	}
+
+	return c.String() == filter.String()
+}
+
+// String Gets the correlation filter properties as a string
+func (c *CorrelationFilterEntity) String() string {
+	conditions := make([]string, 0)
+	systemProperties := c.systemProperties()
+	for _, name := range sortedKeys(systemProperties) {
+		conditions = append(conditions, "sys."+name+" = '"+systemProperties[name]+"'")
+	}
+	for _, name := range sortedKeys(c.Properties) {
+		conditions = append(conditions, name+" = '"+fmt.Sprint(c.Properties[name])+"'")
+	}
+
+	return "correlation(" + strings.Join(conditions, ", ") + ")"
+}
+
+// SetProperty Sets a user property the message needs to have to match the correlation filter
+func (c *CorrelationFilterEntity) SetProperty(name string, value interface{}) {
+	if c.Properties == nil {
+		c.Properties = make(map[string]interface{})
+	}
+	c.Properties[name] = value
+}
+
+// systemProperties gets the message system properties set in the filter by their sql name
+func (c *CorrelationFilterEntity) systemProperties() map[string]string {
+	result := make(map[string]string)
+	setIfNotEmpty := func(name string, value string) {
+		if value != "" {
+			result[name] = value
+		}
+	}
+	setIfNotEmpty("CorrelationId", c.CorrelationID)
+	setIfNotEmpty("MessageId", c.MessageID)
+	setIfNotEmpty("To", c.To)
+	setIfNotEmpty("ReplyTo", c.ReplyTo)
+	setIfNotEmpty("Label", c.Label)
+	setIfNotEmpty("SessionId", c.SessionID)
+	setIfNotEmpty("ReplyToSessionId", c.ReplyToSessionID)
+	setIfNotEmpty("ContentType", c.ContentType)
+
+	return result
+}
+
+// ruleDescriptionXML is the rule description returned by the service bus management api, the sdk one
+// cannot read the correlation filter properties
+type ruleDescriptionXML struct {
+	XMLName xml.Name `xml:"RuleDescription"`
+	Filter  struct {
+		Type             string            `xml:"type,attr"`
+		SQLExpression    string            `xml:"SqlExpression"`
+		CorrelationID    string            `xml:"CorrelationId"`
+		MessageID        string            `xml:"MessageId"`
+		To               string            `xml:"To"`
+		ReplyTo          string            `xml:"ReplyTo"`
+		Label            string            `xml:"Label"`
+		SessionID        string            `xml:"SessionId"`
+		ReplyToSessionID string            `xml:"ReplyToSessionId"`
+		ContentType      string            `xml:"ContentType"`
+		Properties       []rulePropertyXML `xml:"Properties>KeyValueOfstringanyType"`
+	} `xml:"Filter"`
+	Action struct {
+		Type          string `xml:"type,attr"`
+		SQLExpression string `xml:"SqlExpression"`
+	} `xml:"Action"`
+	Name string `xml:"Name"`
+}
+
+type rulePropertyXML struct {
+	Key   string `xml:"Key"`
+	Value struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Value"`
+}
+
+// parseRuleDescription converts the xml content of a rule entry into a rule entity
+func parseRuleDescription(name string, content string) (RuleEntity, error) {
+	var description ruleDescriptionXML
+	if err := xml.Unmarshal([]byte(content), &description); err != nil {
+		return RuleEntity{}, err
+	}
+
+	result := RuleEntity{
+		Name: description.Name,
+	}
+	if result.Name == "" {
+		result.Name = name
+	}
+
+	if description.Filter.Type == "CorrelationFilter" {
+		filter := description.Filter
+		result.CorrelationFilter = &CorrelationFilterEntity{
+			CorrelationID:    filter.CorrelationID,
+			MessageID:        filter.MessageID,
+			To:               filter.To,
+			ReplyTo:          filter.ReplyTo,
+			Label:            filter.Label,
+			SessionID:        filter.SessionID,
+			ReplyToSessionID: filter.ReplyToSessionID,
+			ContentType:      filter.ContentType,
+		}
+		for _, property := range filter.Properties {
+			result.CorrelationFilter.SetProperty(property.Key, parseRulePropertyValue(property.Value.Type, property.Value.Value))
+		}
+	} else {
+		result.SQLFilter = description.Filter.SQLExpression
+	}
+
+	if description.Action.Type == "SqlRuleAction" {
+		result.SQLAction = description.Action.SQLExpression
+	}
+
+	return result, nil
+}
+
+// formatRuleDescription converts a rule entity into the xml content of a rule entry, the elements
+// need to be in the order the service bus expects them
+func formatRuleDescription(rule RuleEntity) string {
+	var content strings.Builder
+	writeElement := func(name string, value string) {
+		if value == "" {
+			return
+		}
+		content.WriteString("<" + name + ">")
+		xml.EscapeText(&content, []byte(value))
+		content.WriteString("</" + name + ">")
+	}
+
+	content.WriteString(`<RuleDescription xmlns="` + serviceBusSchema + `" xmlns:i="` + schemaInstance + `">`)
+	if rule.CorrelationFilter != nil {
+		filter := rule.CorrelationFilter
+		content.WriteString(`<Filter i:type="CorrelationFilter">`)
+		writeElement("CorrelationId", filter.CorrelationID)
+		writeElement("MessageId", filter.MessageID)
+		writeElement("To", filter.To)
+		writeElement("ReplyTo", filter.ReplyTo)
+		writeElement("Label", filter.Label)
+		writeElement("SessionId", filter.SessionID)
+		writeElement("ReplyToSessionId", filter.ReplyToSessionID)
+		writeElement("ContentType", filter.ContentType)
+		if len(filter.Properties) > 0 {
+			content.WriteString("<Properties>")
+			for _, name := range sortedKeys(filter.Properties) {
+				content.WriteString("<KeyValueOfstringanyType>")
+				writeElement("Key", name)
+				content.WriteString(`<Value i:type="d6p1:` + rulePropertyType(filter.Properties[name]) + `" xmlns:d6p1="http://www.w3.org/2001/XMLSchema">`)
+				xml.EscapeText(&content, []byte(fmt.Sprint(filter.Properties[name])))
+				content.WriteString("</Value></KeyValueOfstringanyType>")
+			}
+			content.WriteString("</Properties>")
+		}
+		content.WriteString("</Filter>")
+	} else {
+		content.WriteString(`<Filter i:type="SqlFilter">`)
+		writeElement("SqlExpression", rule.filterExpression())
+		content.WriteString("<CompatibilityLevel>20</CompatibilityLevel></Filter>")
+	}
+
+	if rule.SQLAction != "" {
+		content.WriteString(`<Action i:type="SqlRuleAction">`)
+		writeElement("SqlExpression", rule.SQLAction)
+		content.WriteString("<CompatibilityLevel>20</CompatibilityLevel></Action>")
+	}
+	writeElement("Name", rule.Name)
+	content.WriteString("</RuleDescription>")
+
+	return content.String()
+}
+
+// rulePropertyType gets the xml schema type of a correlation filter property value
+func rulePropertyType(value interface{}) string {
+	switch value.(type) {
+	case bool:
+		return "boolean"
+	case int, int32, int64:
+		return "long"
+	case float32, float64:
+		return "double"
+	default:
+		return "string"
+	}
+}
+
+// parseRulePropertyValue converts a correlation filter property value using its xml schema type
+func parseRulePropertyValue(valueType string, value string) interface{} {
+	if index := strings.Index(valueType, ":"); index >= 0 {
+		valueType = valueType[index+1:]
+	}
+
+	switch valueType {
+	case "boolean":
+		if result, err := strconv.ParseBool(value); err == nil {
+			return result
+		}
+	case "int", "long", "short", "byte":
+		if result, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return result
+		}
+	case "double", "float", "decimal":
+		if result, err := strconv.ParseFloat(value, 64); err == nil {
+			return result
+		}
+	}
+
+	return value
+}
@@ -0,0 +1,140 @@
+package servicebuscli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+// ListScheduledQueueMessages Peeks the messages of a queue that are scheduled and were not enqueued yet
+func (s *ServiceBusCli) ListScheduledQueueMessages(queueName string, maxMessages int) ([]*servicebus.Message, error) {
+	var commonError error
+	if queueName == "" {
+		commonError = errors.New("Queue cannot be null")
+		logger.Error(commonError.Error())
+		return nil, commonError
+	}
+
+	logger.LogHighlight("Peeking scheduled messages for queue %v in service bus %v", log.Info, queueName, s.Broker.Name())
+	return s.peekScheduled(queueName, maxMessages)
+}
+
+// ListScheduledSubscriptionMessages Peeks the messages of a subscription that are scheduled and were not enqueued yet
+func (s *ServiceBusCli) ListScheduledSubscriptionMessages(topicName string, subscriptionName string, maxMessages int) ([]*servicebus.Message, error) {
+	var commonError error
+	if topicName == "" || subscriptionName == "" {
+		commonError = errors.New("Topic and subscription cannot be null")
+		logger.Error(commonError.Error())
+		return nil, commonError
+	}
+
+	logger.LogHighlight("Peeking scheduled messages for subscription %v on topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+	return s.peekScheduled(SubscriptionEntityPath(topicName, subscriptionName), maxMessages)
+}
+
+// CancelScheduledQueueMessages Cancels scheduled messages of a queue using their sequence numbers
+func (s *ServiceBusCli) CancelScheduledQueueMessages(queueName string, sequenceNumbers []int64) error {
+	var commonError error
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	queue, err := s.Broker.GetQueue(ctx, queueName)
+	if err != nil || queue == nil {
+		commonError = errors.New("Could not find queue " + queueName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find queue %v in service bus %v", log.Error, queueName, s.Broker.Name())
+		return commonError
+	}
+
+	return s.cancelScheduled(ctx, queueName, sequenceNumbers)
+}
+
+// CancelScheduledTopicMessages Cancels scheduled messages of a topic using their sequence numbers, the
+// message is removed from all the subscriptions it was scheduled in
+func (s *ServiceBusCli) CancelScheduledTopicMessages(topicName string, sequenceNumbers []int64) error {
+	var commonError error
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
+		return commonError
+	}
+
+	return s.cancelScheduled(ctx, topicName, sequenceNumbers)
+}
+
+// PrintScheduledMessage Prints a scheduled message with the time it will be enqueued at
+func PrintScheduledMessage(msg *servicebus.Message) {
+	sequenceNumber := ""
+	scheduledTime := ""
+	if msg.SystemProperties != nil {
+		if msg.SystemProperties.SequenceNumber != nil {
+			sequenceNumber = fmt.Sprint(*msg.SystemProperties.SequenceNumber)
+		}
+		if msg.SystemProperties.ScheduledEnqueueTime != nil {
+			scheduledTime = msg.SystemProperties.ScheduledEnqueueTime.UTC().Format(time.RFC3339)
+		}
+	}
+
+	logger.LogHighlight("%v Scheduled message %v (sequence: %v) with label %v", log.Info, scheduledTime, msg.ID, sequenceNumber, msg.Label)
+	logger.Info("User Properties:")
+	jsonString, _ := json.MarshalIndent(msg.UserProperties, "", "  ")
+	fmt.Println(string(jsonString))
+	logger.Info("Message Body:")
+	fmt.Println(FormatMessageBody(msg.ContentType, msg.Data))
+}
+
+func (s *ServiceBusCli) cancelScheduled(ctx context.Context, entityPath string, sequenceNumbers []int64) error {
+	if len(sequenceNumbers) == 0 {
+		commonError := errors.New("At least one sequence number is needed to cancel scheduled messages")
+		logger.Error(commonError.Error())
+		return commonError
+	}
+
+	logger.LogHighlight("Cancelling %v scheduled messages in %v in service bus %v", log.Info, fmt.Sprint(len(sequenceNumbers)), entityPath, s.Broker.Name())
+	if err := s.Broker.CancelScheduled(ctx, entityPath, sequenceNumbers...); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	logger.LogHighlight("Cancelled %v scheduled messages in %v in service bus %v", log.Info, fmt.Sprint(len(sequenceNumbers)), entityPath, s.Broker.Name())
+	return nil
+}
+
+// peekScheduled peeks the entity messages keeping only the ones scheduled in the future
+func (s *ServiceBusCli) peekScheduled(entityPath string, maxMessages int) ([]*servicebus.Message, error) {
+	result := make([]*servicebus.Message, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	iterator, err := s.Broker.Peek(ctx, entityPath)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	now := time.Now()
+	for maxMessages <= 0 || len(result) < maxMessages {
+		msg, err := iterator.Next(ctx)
+		if err != nil {
+			var noMessages servicebus.ErrNoMessages
+			if errors.As(err, &noMessages) {
+				break
+			}
+			logger.Error(err.Error())
+			return result, err
+		}
+		if isScheduledMessage(msg, now) {
+			result = append(result, msg)
+		}
+	}
+
+	return result, nil
+}
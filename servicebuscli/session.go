@@ -0,0 +1,60 @@
+package servicebuscli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cjlapao/common-go/log"
+)
+
+// sessionIdleTimeout is the time a session is kept locked without receiving messages before
+// moving to the next available session
+const sessionIdleTimeout = 5 * time.Second
+
+// listenToSessionsConcurrently accepts as many sessions at the same time as the concurrency, a single
+// session is accepted when the session id is set
+func (s *ServiceBusCli) listenToSessionsConcurrently(ctx context.Context, entityPath string, handler MessageHandler) {
+	concurrency := s.Concurrency
+	if concurrency < 1 || s.SessionID != "" {
+		concurrency = 1
+	}
+	if concurrency > 1 {
+		logger.LogHighlight("Handling up to %v sessions at the same time from %v", log.Info, fmt.Sprint(concurrency), entityPath)
+	}
+
+	for i := 0; i < concurrency; i++ {
+		go s.listenToSessions(ctx, entityPath, handler)
+	}
+}
+
+// listenToSessions accepts the sessions of a queue or subscription one after the other and runs
+// the handler on their messages, printing them grouped per session until the context is cancelled
+func (s *ServiceBusCli) listenToSessions(ctx context.Context, entityPath string, handler MessageHandler) {
+	for {
+		received := 0
+		sessionHandler := func(ctx context.Context, msg *ReceivedMessage) error {
+			if received == 0 {
+				sessionID := ""
+				if msg.SessionID != nil {
+					sessionID = *msg.SessionID
+				}
+				logger.LogHighlight("Session %v started on %v", log.Info, sessionID, entityPath)
+			}
+			received++
+			return handler(ctx, msg)
+		}
+
+		sessionID, err := s.Broker.ReceiveSession(ctx, entityPath, s.SessionID, sessionIdleTimeout, sessionHandler)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Error(err.Error())
+			return
+		}
+		if received > 0 {
+			logger.LogHighlight("Session %v finished, %v messages received", log.Info, sessionID, fmt.Sprint(received))
+		}
+	}
+}
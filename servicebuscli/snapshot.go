@@ -0,0 +1,421 @@
+package servicebuscli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cjlapao/common-go/log"
+	"gopkg.in/yaml.v2"
+)
+
+// NamespaceSnapshotVersion is the version of the namespace snapshot documents written by this tool,
+// documents with a newer version cannot be restored
+const NamespaceSnapshotVersion = 1
+
+// NamespaceSnapshot structure, every topic with its subscriptions and rules and every queue of a
+// namespace with all their properties
+type NamespaceSnapshot struct {
+	Version    int                   `json:"version" yaml:"version"`
+	Namespace  string                `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	ExportedAt time.Time             `json:"exportedAt" yaml:"exportedAt"`
+	Topics     []SnapshotTopicEntity `json:"topics" yaml:"topics"`
+	Queues     []SnapshotQueueEntity `json:"queues" yaml:"queues"`
+}
+
+// SnapshotTopicEntity structure, a topology topic with the properties that can only be set when the
+// topic is created
+type SnapshotTopicEntity struct {
+	TopologyTopicEntity      `yaml:",inline"`
+	DefaultMessageTimeToLive string `json:"defaultMessageTimeToLive,omitempty" yaml:"defaultMessageTimeToLive,omitempty"`
+	AutoDeleteOnIdle         string `json:"autoDeleteOnIdle,omitempty" yaml:"autoDeleteOnIdle,omitempty"`
+	MaxSizeInMegabytes       int32  `json:"maxSizeInMegabytes,omitempty" yaml:"maxSizeInMegabytes,omitempty"`
+	DuplicateDetectionWindow string `json:"duplicateDetectionWindow,omitempty" yaml:"duplicateDetectionWindow,omitempty"`
+	EnablePartitioning       bool   `json:"enablePartitioning,omitempty" yaml:"enablePartitioning,omitempty"`
+	SupportOrdering          bool   `json:"supportOrdering,omitempty" yaml:"supportOrdering,omitempty"`
+}
+
+// SnapshotQueueEntity structure, a topology queue with the properties that can only be set when the
+// queue is created
+type SnapshotQueueEntity struct {
+	TopologyQueueEntity      `yaml:",inline"`
+	DuplicateDetectionWindow string `json:"duplicateDetectionWindow,omitempty" yaml:"duplicateDetectionWindow,omitempty"`
+	EnablePartitioning       bool   `json:"enablePartitioning,omitempty" yaml:"enablePartitioning,omitempty"`
+}
+
+var namespaceSnapshotColumns = []string{"type", "name", "topic", "forwardTo", "forwardDeadLetterTo", "rules"}
+
+// LoadNamespaceSnapshot Loads a namespace snapshot file, the format is chosen by the file extension
+// defaulting to yaml
+func LoadNamespaceSnapshot(filePath string) (*NamespaceSnapshot, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot NamespaceSnapshot
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		err = json.Unmarshal(content, &snapshot)
+	default:
+		err = yaml.Unmarshal(content, &snapshot)
+	}
+
+	if err != nil {
+		return nil, errors.New("Could not read the namespace snapshot " + filePath + ": " + err.Error())
+	}
+
+	return &snapshot, snapshot.Validate()
+}
+
+// SaveNamespaceSnapshot Saves the namespace snapshot to a file, the format is chosen by the file
+// extension defaulting to yaml
+func SaveNamespaceSnapshot(filePath string, snapshot *NamespaceSnapshot) error {
+	format := OutputYAML
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		format = OutputJSON
+	}
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return WriteNamespaceSnapshot(file, format, snapshot)
+}
+
+// WriteNamespaceSnapshot Writes the namespace snapshot as json or yaml, tables and csv only list its
+// entities
+func WriteNamespaceSnapshot(w io.Writer, format OutputFormat, snapshot *NamespaceSnapshot) error {
+	rows := make([][]string, 0)
+	for _, topic := range snapshot.Topics {
+		rows = append(rows, []string{"topic", topic.Name, "", "", "", ""})
+		for _, subscription := range topic.Subscriptions {
+			rows = append(rows, []string{"subscription", subscription.Name, topic.Name, subscription.ForwardTo, subscription.ForwardDeadLetterTo, fmt.Sprint(len(subscription.Rules))})
+		}
+	}
+	for _, queue := range snapshot.Queues {
+		rows = append(rows, []string{"queue", queue.Name, "", queue.ForwardTo, queue.ForwardDeadLetterTo, ""})
+	}
+
+	return writeOutput(w, format, snapshot, namespaceSnapshotColumns, rows)
+}
+
+// Validate Checks the snapshot version is supported and that its entities can be converted
+func (n *NamespaceSnapshot) Validate() error {
+	if n.Version <= 0 {
+		return errors.New("The namespace snapshot has no version")
+	}
+	if n.Version > NamespaceSnapshotVersion {
+		return errors.New("The namespace snapshot version " + fmt.Sprint(n.Version) + " is newer than the supported version " + fmt.Sprint(NamespaceSnapshotVersion))
+	}
+
+	for _, topic := range n.Topics {
+		if topic.Name == "" {
+			return errors.New("Topic name cannot be null")
+		}
+		if _, err := topic.ToTopicEntity(); err != nil {
+			return err
+		}
+		for _, subscription := range topic.Subscriptions {
+			if subscription.Name == "" {
+				return errors.New("Subscription name cannot be null on topic " + topic.Name)
+			}
+			if _, err := subscription.ToSubscriptionEntity(topic.Name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, queue := range n.Queues {
+		if queue.Name == "" {
+			return errors.New("Queue name cannot be null")
+		}
+		if _, err := queue.ToQueueEntity(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ToTopicEntity Converts the snapshot topic into a topic entity
+func (t SnapshotTopicEntity) ToTopicEntity() (TopicEntity, error) {
+	var err error
+	result := NewTopic(t.Name)
+	result.MaxSizeInMegabytes = t.MaxSizeInMegabytes
+	result.EnablePartitioning = t.EnablePartitioning
+	result.SupportOrdering = t.SupportOrdering
+
+	if result.DefaultMessageTimeToLive, err = parseTopologyDuration("topic "+t.Name+" defaultMessageTimeToLive", t.DefaultMessageTimeToLive); err != nil {
+		return result, err
+	}
+	if result.AutoDeleteOnIdle, err = parseTopologyDuration("topic "+t.Name+" autoDeleteOnIdle", t.AutoDeleteOnIdle); err != nil {
+		return result, err
+	}
+	if result.DuplicateDetectionWindow, err = parseTopologyDuration("topic "+t.Name+" duplicateDetectionWindow", t.DuplicateDetectionWindow); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ToQueueEntity Converts the snapshot queue into a queue entity
+func (t SnapshotQueueEntity) ToQueueEntity() (QueueEntity, error) {
+	result, err := t.TopologyQueueEntity.ToQueueEntity()
+	if err != nil {
+		return result, err
+	}
+	result.EnablePartitioning = t.EnablePartitioning
+
+	if result.DuplicateDetectionWindow, err = parseTopologyDuration("queue "+t.Name+" duplicateDetectionWindow", t.DuplicateDetectionWindow); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// ExportNamespace Reads every topic with its subscriptions and rules and every queue of the namespace
+// with all their properties, the wiretap subscriptions of the subscribe command are not exported
+func (s *ServiceBusCli) ExportNamespace() (*NamespaceSnapshot, error) {
+	logger.LogHighlight("Exporting the namespace of service bus %v", log.Info, s.Broker.Name())
+	topics, err := s.ListTopics()
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	queues, err := s.ListQueues()
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	topology, err := s.readTopology(topics, queues)
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	result := NamespaceSnapshot{
+		Version:    NamespaceSnapshotVersion,
+		Namespace:  s.Broker.Name(),
+		ExportedAt: time.Now().UTC(),
+		Topics:     make([]SnapshotTopicEntity, 0, len(topology.Topics)),
+		Queues:     make([]SnapshotQueueEntity, 0, len(topology.Queues)),
+	}
+
+	subscriptionCount := 0
+	for i, topologyTopic := range topology.Topics {
+		subscriptions := make([]TopologySubscriptionEntity, 0, len(topologyTopic.Subscriptions))
+		for _, subscription := range topologyTopic.Subscriptions {
+			if subscription.Name != "wiretap" {
+				subscriptions = append(subscriptions, subscription)
+			}
+		}
+		topologyTopic.Subscriptions = subscriptions
+		subscriptionCount += len(subscriptions)
+
+		topic := SnapshotTopicEntity{TopologyTopicEntity: topologyTopic}
+		if description := topics[i].TopicDescription; description != nil {
+			topic.DefaultMessageTimeToLive = topologyDuration(description.DefaultMessageTimeToLive)
+			topic.AutoDeleteOnIdle = topologyDuration(description.AutoDeleteOnIdle)
+			topic.MaxSizeInMegabytes = int32Value(description.MaxSizeInMegabytes)
+			topic.EnablePartitioning = description.EnablePartitioning != nil && *description.EnablePartitioning
+			topic.SupportOrdering = description.SupportOrdering != nil && *description.SupportOrdering
+			if description.RequiresDuplicateDetection != nil && *description.RequiresDuplicateDetection {
+				topic.DuplicateDetectionWindow = topologyDuration(description.DuplicateDetectionHistoryTimeWindow)
+			}
+		}
+		result.Topics = append(result.Topics, topic)
+	}
+
+	for i, topologyQueue := range topology.Queues {
+		queue := SnapshotQueueEntity{TopologyQueueEntity: topologyQueue}
+		if description := queues[i].QueueDescription; description != nil {
+			queue.EnablePartitioning = description.EnablePartitioning != nil && *description.EnablePartitioning
+			if description.RequiresDuplicateDetection != nil && *description.RequiresDuplicateDetection {
+				queue.DuplicateDetectionWindow = topologyDuration(description.DuplicateDetectionHistoryTimeWindow)
+			}
+		}
+		result.Queues = append(result.Queues, queue)
+	}
+
+	logger.LogHighlight("Exported %v topics, %v subscriptions and %v queues from service bus %v", log.Info, fmt.Sprint(len(result.Topics)), fmt.Sprint(subscriptionCount), fmt.Sprint(len(result.Queues)), s.Broker.Name())
+	return &result, nil
+}
+
+// PlanRestore Plans the creation of the snapshot entities that do not exist in the namespace, topics are
+// created first, then the queues with their forward targets before them and then the subscriptions,
+// queues forwarding to each other in a loop get their forwarding set once all of them exist
+func (s *ServiceBusCli) PlanRestore(snapshot *NamespaceSnapshot) ([]TopologyChange, error) {
+	logger.LogHighlight("Planning the restore of %v topics and %v queues into service bus %v", log.Info, fmt.Sprint(len(snapshot.Topics)), fmt.Sprint(len(snapshot.Queues)), s.Broker.Name())
+	if err := snapshot.Validate(); err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	liveTopics, err := s.ListTopics()
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	liveQueues, err := s.ListQueues()
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	existingTopics := make(map[string]bool)
+	for _, topic := range liveTopics {
+		existingTopics[strings.ToLower(topic.Name)] = true
+	}
+	existingQueues := make(map[string]bool)
+	for _, queue := range liveQueues {
+		existingQueues[strings.ToLower(queue.Name)] = true
+	}
+
+	snapshotEntities := make(map[string]bool)
+	for _, topic := range snapshot.Topics {
+		snapshotEntities[strings.ToLower(topic.Name)] = true
+	}
+	for _, queue := range snapshot.Queues {
+		snapshotEntities[strings.ToLower(queue.Name)] = true
+	}
+	checkForward := func(entity string, forward ForwardEntity) error {
+		target := strings.ToLower(forward.To)
+		if forward.To == "" || snapshotEntities[target] || existingTopics[target] || existingQueues[target] {
+			return nil
+		}
+		return errors.New(entity + " forwards to " + forward.To + " that is neither in the snapshot nor in service bus " + s.Broker.Name())
+	}
+
+	changes := make([]TopologyChange, 0)
+
+	// Topics
+	for _, snapshotTopic := range snapshot.Topics {
+		if existingTopics[strings.ToLower(snapshotTopic.Name)] {
+			logger.LogHighlight("Topic %v already exists in service bus %v and will not be restored", log.Warning, snapshotTopic.Name, s.Broker.Name())
+			continue
+		}
+		topic, _ := snapshotTopic.ToTopicEntity()
+		changes = append(changes, TopologyChange{Action: TopologyCreate, Kind: "topic", Name: topic.Name, Topic: &topic})
+	}
+
+	// Queues, ordered so that the forward targets are created before the queues forwarding to them
+	pendingQueues := make(map[string]*QueueEntity)
+	queueNames := make([]string, 0, len(snapshot.Queues))
+	for _, snapshotQueue := range snapshot.Queues {
+		if existingQueues[strings.ToLower(snapshotQueue.Name)] {
+			logger.LogHighlight("Queue %v already exists in service bus %v and will not be restored", log.Warning, snapshotQueue.Name, s.Broker.Name())
+			continue
+		}
+		queue, _ := snapshotQueue.ToQueueEntity()
+		if err := checkForward("Queue "+queue.Name, queue.Forward); err != nil {
+			logger.Error(err.Error())
+			return nil, err
+		}
+		if err := checkForward("Queue "+queue.Name, queue.ForwardDeadLetter); err != nil {
+			logger.Error(err.Error())
+			return nil, err
+		}
+		pendingQueues[strings.ToLower(queue.Name)] = &queue
+		queueNames = append(queueNames, strings.ToLower(queue.Name))
+	}
+
+	deferred := make([]TopologyChange, 0)
+	visited := make(map[string]int)
+	var visit func(name string)
+	visit = func(name string) {
+		visited[name] = 1
+		queue := pendingQueues[name]
+		created := *queue
+		propertyChanges := make([]PropertyChange, 0)
+		for _, forward := range []struct {
+			name  string
+			value *ForwardEntity
+		}{{"forward to", &created.Forward}, {"forward dead letters to", &created.ForwardDeadLetter}} {
+			if forward.value.To == "" || forward.value.In != ForwardToQueue {
+				continue
+			}
+			target := strings.ToLower(forward.value.To)
+			if _, ok := pendingQueues[target]; !ok {
+				continue
+			}
+			switch visited[target] {
+			case 0:
+				visit(target)
+			case 1:
+				// the target is still waiting for this queue, the forwarding is set after both exist
+				propertyChanges = append(propertyChanges, PropertyChange{Name: forward.name, From: "not set", To: formatForward(*forward.value)})
+				forward.value.To = ""
+			}
+		}
+
+		visited[name] = 2
+		changes = append(changes, TopologyChange{Action: TopologyCreate, Kind: "queue", Name: created.Name, Queue: &created})
+		if len(propertyChanges) > 0 {
+			deferred = append(deferred, TopologyChange{Action: TopologyUpdate, Kind: "queue", Name: queue.Name, Changes: propertyChanges, Queue: queue})
+		}
+	}
+	for _, name := range queueNames {
+		if visited[name] == 0 {
+			visit(name)
+		}
+	}
+
+	// Subscriptions, their forward targets are topics and queues that exist by now
+	for _, snapshotTopic := range snapshot.Topics {
+		existingSubscriptions := make(map[string]bool)
+		if existingTopics[strings.ToLower(snapshotTopic.Name)] {
+			liveSubscriptions, err := s.ListSubscriptions(snapshotTopic.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, subscription := range liveSubscriptions {
+				existingSubscriptions[strings.ToLower(subscription.Name)] = true
+			}
+		}
+
+		for _, snapshotSubscription := range snapshotTopic.Subscriptions {
+			if existingSubscriptions[strings.ToLower(snapshotSubscription.Name)] {
+				logger.LogHighlight("Subscription %v already exists on topic %v in service bus %v and will not be restored", log.Warning, snapshotSubscription.Name, snapshotTopic.Name, s.Broker.Name())
+				continue
+			}
+			subscription, _ := snapshotSubscription.ToSubscriptionEntity(snapshotTopic.Name)
+			entity := "Subscription " + snapshotTopic.Name + "/" + subscription.Name
+			if err := checkForward(entity, subscription.Forward); err != nil {
+				logger.Error(err.Error())
+				return nil, err
+			}
+			if err := checkForward(entity, subscription.ForwardDeadLetter); err != nil {
+				logger.Error(err.Error())
+				return nil, err
+			}
+			changes = append(changes, TopologyChange{Action: TopologyCreate, Kind: "subscription", Name: subscription.Name, TopicName: snapshotTopic.Name, Subscription: &subscription})
+		}
+	}
+
+	return append(changes, deferred...), nil
+}
+
+// RestoreNamespace Creates the snapshot entities that do not exist in the namespace in dependency order,
+// the plan is only printed when dryRun is set
+func (s *ServiceBusCli) RestoreNamespace(snapshot *NamespaceSnapshot, dryRun bool) error {
+	changes, err := s.PlanRestore(snapshot)
+	if err != nil {
+		return err
+	}
+
+	PrintTopologyPlan(changes)
+	if dryRun || len(changes) == 0 {
+		return nil
+	}
+
+	return s.ApplyTopology(changes)
+}
@@ -0,0 +1,108 @@
+package servicebuscli
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newMemoryServiceBusCli(t *testing.T) *ServiceBusCli {
+	return New(newMemoryBroker(t))
+}
+
+func TestNamespaceSnapshotRoundTrip(t *testing.T) {
+	source := newMemoryServiceBusCli(t)
+
+	if err := source.CreateTopic(TopicEntity{Name: "orders", DuplicateDetectionWindow: 10 * time.Minute}); err != nil {
+		t.Fatalf("CreateTopic() error = %v", err)
+	}
+	queueA := NewQueue("a")
+	queueA.MapMessageForwardFlag("queue:b")
+	queueB := NewQueue("b")
+	for _, queue := range []QueueEntity{queueB, queueA} {
+		if err := source.CreateQueue(queue); err != nil {
+			t.Fatalf("CreateQueue(%v) error = %v", queue.Name, err)
+		}
+	}
+	// b forwards back to a so the restore needs to set one of the forwards after both queues exist
+	queueB.MapMessageForwardFlag("queue:a")
+	if err := source.UpdateQueue(queueB); err != nil {
+		t.Fatalf("UpdateQueue() error = %v", err)
+	}
+
+	plain := NewSubscription("orders", "plain")
+	filtered := NewSubscription("orders", "filtered")
+	filtered.MapMessageForwardFlag("queue:a")
+	filtered.Rules = []RuleEntity{{Name: "big", SQLFilter: "amount > 100"}}
+	custom := NewSubscription("orders", "custom")
+	custom.Rules = []RuleEntity{{Name: DefaultRuleName, SQLFilter: "1=1", SQLAction: "SET sys.Label = 'custom'"}}
+	for _, subscription := range []SubscriptionEntity{plain, filtered, custom} {
+		if err := source.CreateSubscription(subscription); err != nil {
+			t.Fatalf("CreateSubscription(%v) error = %v", subscription.Name, err)
+		}
+	}
+
+	snapshot, err := source.ExportNamespace()
+	if err != nil {
+		t.Fatalf("ExportNamespace() error = %v", err)
+	}
+
+	target := newMemoryServiceBusCli(t)
+	if err := target.RestoreNamespace(snapshot, false); err != nil {
+		t.Fatalf("RestoreNamespace() error = %v", err)
+	}
+
+	restored, err := target.ExportNamespace()
+	if err != nil {
+		t.Fatalf("ExportNamespace() of the restored namespace error = %v", err)
+	}
+	if !reflect.DeepEqual(snapshot.Topics, restored.Topics) {
+		t.Errorf("restored topics = %+v, want %+v", restored.Topics, snapshot.Topics)
+	}
+	if !reflect.DeepEqual(snapshot.Queues, restored.Queues) {
+		t.Errorf("restored queues = %+v, want %+v", restored.Queues, snapshot.Queues)
+	}
+
+	// restoring again leaves the existing entities untouched
+	changes, err := target.PlanRestore(snapshot)
+	if err != nil {
+		t.Fatalf("PlanRestore() error = %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("PlanRestore() of a restored namespace = %v changes, want none", len(changes))
+	}
+}
+
+func TestPlanRestoreMissingForwardTarget(t *testing.T) {
+	snapshot := &NamespaceSnapshot{
+		Version: NamespaceSnapshotVersion,
+		Queues: []SnapshotQueueEntity{
+			{TopologyQueueEntity: TopologyQueueEntity{Name: "a", ForwardTo: "queue:nowhere"}},
+		},
+	}
+
+	if _, err := newMemoryServiceBusCli(t).PlanRestore(snapshot); err == nil {
+		t.Error("PlanRestore() error = nil, want a missing forward target error")
+	}
+}
+
+func TestNamespaceSnapshotValidateVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version int
+		wantErr bool
+	}{
+		{"missing", 0, true},
+		{"supported", NamespaceSnapshotVersion, false},
+		{"newer", NamespaceSnapshotVersion + 1, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			snapshot := NamespaceSnapshot{Version: test.version}
+			if err := snapshot.Validate(); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,886 @@
+package servicebuscli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+var sqlSystemPropertyNames = map[string]string{
+	"messageid":               "MessageId",
+	"correlationid":           "CorrelationId",
+	"label":                   "Label",
+	"contenttype":             "ContentType",
+	"sessionid":               "SessionId",
+	"replyto":                 "ReplyTo",
+	"replytosessionid":        "ReplyToSessionId",
+	"to":                      "To",
+	"timetolive":              "TimeToLive",
+	"scheduledenqueuetimeutc": "ScheduledEnqueueTimeUtc",
+	"enqueuedtimeutc":         "EnqueuedTimeUtc",
+	"sequencenumber":          "SequenceNumber",
+	"deliverycount":           "DeliveryCount",
+	"size":                    "Size",
+	"deadlettersource":        "DeadLetterSource",
+}
+
+var sqlReadOnlySystemProperties = map[string]bool{
+	"EnqueuedTimeUtc":  true,
+	"SequenceNumber":   true,
+	"DeliveryCount":    true,
+	"Size":             true,
+	"DeadLetterSource": true,
+}
+
+// SQLMessage structure, holds the message properties a sql filter or action can access
+type SQLMessage struct {
+	SystemProperties map[string]interface{}
+	UserProperties   map[string]interface{}
+	// Body is the decoded json body used by the message filters body scope, nil if the body is not json
+	Body interface{}
+}
+
+type sqlExpression interface {
+	evaluate(message *SQLMessage) (interface{}, error)
+}
+
+type sqlStatement interface {
+	execute(message *SQLMessage) error
+}
+
+type sqlLiteral struct {
+	value interface{}
+}
+
+type sqlPropertyExpression struct {
+	system bool
+	body   bool
+	name   string
+}
+
+type sqlUnaryExpression struct {
+	operator string
+	operand  sqlExpression
+}
+
+type sqlBinaryExpression struct {
+	operator string
+	left     sqlExpression
+	right    sqlExpression
+}
+
+type sqlLikeExpression struct {
+	operand sqlExpression
+	pattern *regexp.Regexp
+	negate  bool
+}
+
+type sqlInExpression struct {
+	operand sqlExpression
+	values  []sqlExpression
+	negate  bool
+}
+
+type sqlIsNullExpression struct {
+	operand sqlExpression
+	negate  bool
+}
+
+type sqlExistsExpression struct {
+	property *sqlPropertyExpression
+}
+
+type sqlNewIDExpression struct{}
+
+type sqlSetStatement struct {
+	property *sqlPropertyExpression
+	value    sqlExpression
+}
+
+type sqlRemoveStatement struct {
+	property *sqlPropertyExpression
+}
+
+// NewSQLMessage Creates the sql message properties from a message entity
+func NewSQLMessage(entity MessageEntity) *SQLMessage {
+	result := SQLMessage{
+		SystemProperties: make(map[string]interface{}),
+		UserProperties:   make(map[string]interface{}),
+	}
+
+	setIfNotEmpty := func(name string, value string) {
+		if value != "" {
+			result.SystemProperties[name] = value
+		}
+	}
+	setIfNotEmpty("Label", entity.Label)
+	setIfNotEmpty("MessageId", entity.ID)
+	setIfNotEmpty("CorrelationId", entity.CorrelationID)
+	setIfNotEmpty("ContentType", entity.ContentType)
+	setIfNotEmpty("SessionId", entity.SessionID)
+	if entity.SystemProperties != nil {
+		setIfNotEmpty("DeadLetterSource", entity.SystemProperties.DeadLetterSource)
+		result.SystemProperties["SequenceNumber"] = entity.SystemProperties.SequenceNumber
+		result.SystemProperties["DeliveryCount"] = int64(entity.SystemProperties.DeliveryCount)
+		if entity.SystemProperties.EnqueuedTime != nil {
+			result.SystemProperties["EnqueuedTimeUtc"] = entity.SystemProperties.EnqueuedTime.UTC()
+		}
+	}
+
+	for key, value := range entity.Properties {
+		result.UserProperties[key] = normalizeSQLValue(value)
+	}
+
+	if len(entity.Data) > 0 {
+		result.Body = parseSQLMessageBody(entity.ContentType, entity.Data)
+	} else if entity.Message != nil {
+		if data, err := json.Marshal(entity.Message); err == nil {
+			result.Body = parseSQLMessageBody("", data)
+		}
+	}
+
+	return &result
+}
+
+// NewSQLMessageFromMessage Creates the sql message properties from a service bus message
+func NewSQLMessageFromMessage(msg *servicebus.Message) *SQLMessage {
+	result := SQLMessage{
+		SystemProperties: make(map[string]interface{}),
+		UserProperties:   make(map[string]interface{}),
+	}
+
+	setIfNotEmpty := func(name string, value string) {
+		if value != "" {
+			result.SystemProperties[name] = value
+		}
+	}
+	setIfNotEmpty("Label", msg.Label)
+	setIfNotEmpty("MessageId", msg.ID)
+	setIfNotEmpty("CorrelationId", msg.CorrelationID)
+	setIfNotEmpty("ContentType", msg.ContentType)
+	setIfNotEmpty("ReplyTo", msg.ReplyTo)
+	setIfNotEmpty("ReplyToSessionId", msg.ReplyToGroupID)
+	setIfNotEmpty("To", msg.To)
+	if msg.SessionID != nil {
+		setIfNotEmpty("SessionId", *msg.SessionID)
+	}
+	if msg.TTL != nil {
+		result.SystemProperties["TimeToLive"] = msg.TTL.String()
+	}
+	result.SystemProperties["DeliveryCount"] = int64(msg.DeliveryCount)
+	result.SystemProperties["Size"] = int64(len(msg.Data))
+	if msg.SystemProperties != nil {
+		if msg.SystemProperties.SequenceNumber != nil {
+			result.SystemProperties["SequenceNumber"] = *msg.SystemProperties.SequenceNumber
+		}
+		if msg.SystemProperties.EnqueuedTime != nil {
+			result.SystemProperties["EnqueuedTimeUtc"] = msg.SystemProperties.EnqueuedTime.UTC()
+		}
+		if msg.SystemProperties.ScheduledEnqueueTime != nil {
+			result.SystemProperties["ScheduledEnqueueTimeUtc"] = msg.SystemProperties.ScheduledEnqueueTime.UTC()
+		}
+		if msg.SystemProperties.DeadLetterSource != nil {
+			setIfNotEmpty("DeadLetterSource", *msg.SystemProperties.DeadLetterSource)
+		}
+	}
+
+	for key, value := range msg.UserProperties {
+		result.UserProperties[key] = normalizeSQLValue(value)
+	}
+	result.Body = parseSQLMessageBody(msg.ContentType, msg.Data)
+
+	return &result
+}
+
+// ApplyTo Copies the writable system properties and the user properties into a service bus message
+func (m *SQLMessage) ApplyTo(msg *servicebus.Message) {
+	getString := func(name string) string {
+		if value, ok := m.SystemProperties[name]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+	msg.Label = getString("Label")
+	msg.ID = getString("MessageId")
+	msg.CorrelationID = getString("CorrelationId")
+	msg.ContentType = getString("ContentType")
+	msg.ReplyTo = getString("ReplyTo")
+	msg.ReplyToGroupID = getString("ReplyToSessionId")
+	msg.To = getString("To")
+	if sessionID := getString("SessionId"); sessionID != "" {
+		msg.SessionID = &sessionID
+	} else {
+		msg.SessionID = nil
+	}
+
+	msg.UserProperties = make(map[string]interface{})
+	for key, value := range m.UserProperties {
+		msg.UserProperties[key] = value
+	}
+}
+
+// Clone Creates a copy of the sql message properties
+func (m *SQLMessage) Clone() *SQLMessage {
+	result := SQLMessage{
+		SystemProperties: make(map[string]interface{}),
+		UserProperties:   make(map[string]interface{}),
+	}
+	for key, value := range m.SystemProperties {
+		result.SystemProperties[key] = value
+	}
+	for key, value := range m.UserProperties {
+		result.UserProperties[key] = value
+	}
+	result.Body = m.Body
+
+	return &result
+}
+
+// Match Evaluates the filter against the message, the message only matches if the filter is true,
+// an unknown result caused by missing properties does not match
+func (f *SQLFilter) Match(message *SQLMessage) (bool, error) {
+	value, err := f.root.evaluate(message)
+	if err != nil {
+		return false, err
+	}
+
+	switch result := value.(type) {
+	case nil:
+		return false, nil
+	case bool:
+		return result, nil
+	}
+
+	return false, errors.New("Filter " + f.Expression + " does not evaluate to a boolean")
+}
+
+// Apply Executes the action statements against the message properties
+func (a *SQLAction) Apply(message *SQLMessage) error {
+	for _, statement := range a.statements {
+		if err := statement.execute(message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate Validates the syntax of the rule sql filter and action
+func (r RuleEntity) Validate() error {
+	if r.CorrelationFilter != nil {
+		if strings.TrimSpace(r.SQLFilter) != "" {
+			return errors.New("Rule " + r.Name + " cannot have both a sql filter and a correlation filter")
+		}
+		if r.CorrelationFilter.IsEmpty() {
+			return errors.New("Correlation filter on rule " + r.Name + " needs at least one property")
+		}
+	} else if _, err := ParseSQLFilter(r.filterExpression()); err != nil {
+		return errors.New("Invalid filter on rule " + r.Name + ": " + err.Error())
+	}
+	if r.SQLAction != "" {
+		if _, err := ParseSQLAction(r.SQLAction); err != nil {
+			return errors.New("Invalid action on rule " + r.Name + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Test Evaluates the rule against a message, returning if the message matches the filter and the
+// message properties after the rule action is applied
+func (r RuleEntity) Test(message *SQLMessage) (bool, *SQLMessage, error) {
+	matched := false
+	if r.CorrelationFilter != nil {
+		matched = r.CorrelationFilter.Match(message)
+	} else {
+		filter, err := ParseSQLFilter(r.filterExpression())
+		if err != nil {
+			return false, nil, err
+		}
+
+		if matched, err = filter.Match(message); err != nil {
+			return matched, message, err
+		}
+	}
+	if !matched {
+		return matched, message, nil
+	}
+
+	result := message.Clone()
+	if r.SQLAction != "" {
+		action, err := ParseSQLAction(r.SQLAction)
+		if err != nil {
+			return matched, nil, err
+		}
+		if err := action.Apply(result); err != nil {
+			return matched, nil, err
+		}
+	}
+
+	return matched, result, nil
+}
+
+func (r RuleEntity) filterExpression() string {
+	if strings.TrimSpace(r.SQLFilter) == "" {
+		return "1=1"
+	}
+
+	return r.SQLFilter
+}
+
+// PrintSQLMessageChanges Prints the properties that were changed between two sql messages
+func PrintSQLMessageChanges(before *SQLMessage, after *SQLMessage) {
+	changes := 0
+	printChanges := func(scope string, from map[string]interface{}, to map[string]interface{}) {
+		keys := make([]string, 0)
+		for key := range from {
+			keys = append(keys, key)
+		}
+		for key := range to {
+			if _, ok := from[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fromValue, fromExists := from[key]
+			toValue, toExists := to[key]
+			switch {
+			case !fromExists:
+				logger.LogHighlight("  %v.%v: set to %v", log.Info, scope, key, formatSQLValue(toValue))
+			case !toExists:
+				logger.LogHighlight("  %v.%v: removed", log.Info, scope, key)
+			case fmt.Sprintf("%#v", fromValue) != fmt.Sprintf("%#v", toValue):
+				logger.LogHighlight("  %v.%v: %v -> %v", log.Info, scope, key, formatSQLValue(fromValue), formatSQLValue(toValue))
+			default:
+				continue
+			}
+			changes++
+		}
+	}
+
+	printChanges("sys", before.SystemProperties, after.SystemProperties)
+	printChanges("user", before.UserProperties, after.UserProperties)
+	if changes == 0 {
+		logger.Info("  the action did not change any property")
+	}
+}
+
+func (e *sqlLiteral) evaluate(message *SQLMessage) (interface{}, error) {
+	return e.value, nil
+}
+
+func (e *sqlPropertyExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	if e.system {
+		return message.SystemProperties[e.name], nil
+	}
+	if e.body {
+		value, _ := e.bodyValue(message)
+		return value, nil
+	}
+
+	return message.UserProperties[e.name], nil
+}
+
+// bodyValue walks the json body following the property path, array items are accessed by their
+// index, objects and arrays are returned as json strings
+func (e *sqlPropertyExpression) bodyValue(message *SQLMessage) (interface{}, bool) {
+	current := message.Body
+	if current == nil {
+		return nil, false
+	}
+
+	for _, part := range strings.Split(e.name, ".") {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[part]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+
+	switch value := current.(type) {
+	case json.Number:
+		if number, err := value.Int64(); err == nil {
+			return number, true
+		}
+		number, err := value.Float64()
+		if err != nil {
+			return value.String(), true
+		}
+		return number, true
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(value)
+		return string(data), true
+	}
+
+	return current, true
+}
+
+func (e *sqlPropertyExpression) String() string {
+	if e.system {
+		return "sys." + e.name
+	}
+	if e.body {
+		return "body." + e.name
+	}
+
+	return "user." + e.name
+}
+
+func (e *sqlUnaryExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	value, err := e.operand.evaluate(message)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	switch e.operator {
+	case "NOT":
+		boolean, ok := value.(bool)
+		if !ok {
+			return nil, errors.New("Operator NOT requires a boolean value")
+		}
+		return !boolean, nil
+	case "-":
+		switch number := value.(type) {
+		case int64:
+			return -number, nil
+		case float64:
+			return -number, nil
+		}
+		return nil, errors.New("Operator - requires a numeric value")
+	case "+":
+		switch value.(type) {
+		case int64, float64:
+			return value, nil
+		}
+		return nil, errors.New("Operator + requires a numeric value")
+	}
+
+	return nil, errors.New("Unknown operator " + e.operator)
+}
+
+func (e *sqlBinaryExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	left, err := e.left.evaluate(message)
+	if err != nil {
+		return nil, err
+	}
+
+	switch e.operator {
+	case "AND", "OR":
+		return e.evaluateLogical(message, left)
+	}
+
+	right, err := e.right.evaluate(message)
+	if err != nil {
+		return nil, err
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	switch e.operator {
+	case "=", "<>", ">", ">=", "<", "<=":
+		return evaluateSQLComparison(e.operator, left, right), nil
+	}
+
+	return evaluateSQLArithmetic(e.operator, left, right)
+}
+
+func (e *sqlBinaryExpression) evaluateLogical(message *SQLMessage, left interface{}) (interface{}, error) {
+	leftBoolean, leftIsBoolean := left.(bool)
+	if left != nil && !leftIsBoolean {
+		return nil, errors.New("Operator " + e.operator + " requires boolean values")
+	}
+	if leftIsBoolean && ((e.operator == "AND" && !leftBoolean) || (e.operator == "OR" && leftBoolean)) {
+		return leftBoolean, nil
+	}
+
+	right, err := e.right.evaluate(message)
+	if err != nil {
+		return nil, err
+	}
+	rightBoolean, rightIsBoolean := right.(bool)
+	if right != nil && !rightIsBoolean {
+		return nil, errors.New("Operator " + e.operator + " requires boolean values")
+	}
+	if rightIsBoolean && ((e.operator == "AND" && !rightBoolean) || (e.operator == "OR" && rightBoolean)) {
+		return rightBoolean, nil
+	}
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	return e.operator == "AND", nil
+}
+
+func newSQLLikeExpression(operand sqlExpression, pattern string, escape string, negate bool) (*sqlLikeExpression, error) {
+	var expression strings.Builder
+	expression.WriteString("(?s)^")
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			expression.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case escape != "" && string(r) == escape:
+			escaped = true
+		case r == '%':
+			expression.WriteString(".*")
+		case r == '_':
+			expression.WriteString(".")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	if escaped {
+		return nil, errors.New("Pattern " + pattern + " ends with the escape character")
+	}
+	expression.WriteString("$")
+
+	compiled, err := regexp.Compile(expression.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlLikeExpression{operand: operand, pattern: compiled, negate: negate}, nil
+}
+
+func (e *sqlLikeExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	value, err := e.operand.evaluate(message)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return nil, nil
+	}
+
+	return e.pattern.MatchString(text) != e.negate, nil
+}
+
+func (e *sqlInExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	value, err := e.operand.evaluate(message)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	unknown := false
+	for _, item := range e.values {
+		itemValue, err := item.evaluate(message)
+		if err != nil {
+			return nil, err
+		}
+		if itemValue == nil {
+			unknown = true
+			continue
+		}
+		if evaluateSQLComparison("=", value, itemValue) == true {
+			return !e.negate, nil
+		}
+	}
+
+	if unknown {
+		return nil, nil
+	}
+
+	return e.negate, nil
+}
+
+func (e *sqlIsNullExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	value, err := e.operand.evaluate(message)
+	if err != nil {
+		return nil, err
+	}
+
+	return (value == nil) != e.negate, nil
+}
+
+func (e *sqlExistsExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	var exists bool
+	switch {
+	case e.property.system:
+		_, exists = message.SystemProperties[e.property.name]
+	case e.property.body:
+		_, exists = e.property.bodyValue(message)
+	default:
+		_, exists = message.UserProperties[e.property.name]
+	}
+
+	return exists, nil
+}
+
+func (e *sqlNewIDExpression) evaluate(message *SQLMessage) (interface{}, error) {
+	return newUUID()
+}
+
+func (s *sqlSetStatement) execute(message *SQLMessage) error {
+	if s.property.system && sqlReadOnlySystemProperties[s.property.name] {
+		return errors.New("System property " + s.property.name + " cannot be changed by an action")
+	}
+
+	value, err := s.value.evaluate(message)
+	if err != nil {
+		return err
+	}
+
+	if s.property.system {
+		message.SystemProperties[s.property.name] = value
+	} else {
+		message.UserProperties[s.property.name] = value
+	}
+
+	return nil
+}
+
+func (s *sqlRemoveStatement) execute(message *SQLMessage) error {
+	if s.property.system {
+		if sqlReadOnlySystemProperties[s.property.name] {
+			return errors.New("System property " + s.property.name + " cannot be removed by an action")
+		}
+		delete(message.SystemProperties, s.property.name)
+		return nil
+	}
+
+	delete(message.UserProperties, s.property.name)
+	return nil
+}
+
+// evaluateSQLComparison compares two values, values of different types are not comparable and
+// give an unknown result
+func evaluateSQLComparison(operator string, left interface{}, right interface{}) interface{} {
+	var comparison int
+	switch leftValue := left.(type) {
+	case int64, float64:
+		switch right.(type) {
+		case int64, float64:
+		default:
+			return nil
+		}
+		leftInteger, leftIsInteger := left.(int64)
+		rightInteger, rightIsInteger := right.(int64)
+		if leftIsInteger && rightIsInteger {
+			switch {
+			case leftInteger < rightInteger:
+				comparison = -1
+			case leftInteger > rightInteger:
+				comparison = 1
+			}
+		} else {
+			comparison = compareOrdered(toSQLFloat(leftValue), toSQLFloat(right))
+		}
+	case string:
+		rightValue, ok := right.(string)
+		if !ok {
+			return nil
+		}
+		comparison = strings.Compare(leftValue, rightValue)
+	case time.Time:
+		rightValue, ok := right.(time.Time)
+		if !ok {
+			return nil
+		}
+		switch {
+		case leftValue.Before(rightValue):
+			comparison = -1
+		case leftValue.After(rightValue):
+			comparison = 1
+		}
+	case bool:
+		rightValue, ok := right.(bool)
+		if !ok {
+			return nil
+		}
+		switch operator {
+		case "=":
+			return leftValue == rightValue
+		case "<>":
+			return leftValue != rightValue
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	switch operator {
+	case "=":
+		return comparison == 0
+	case "<>":
+		return comparison != 0
+	case ">":
+		return comparison > 0
+	case ">=":
+		return comparison >= 0
+	case "<":
+		return comparison < 0
+	case "<=":
+		return comparison <= 0
+	}
+
+	return nil
+}
+
+func evaluateSQLArithmetic(operator string, left interface{}, right interface{}) (interface{}, error) {
+	leftInteger, leftIsInteger := left.(int64)
+	rightInteger, rightIsInteger := right.(int64)
+	_, leftIsFloat := left.(float64)
+	_, rightIsFloat := right.(float64)
+	if !(leftIsInteger || leftIsFloat) || !(rightIsInteger || rightIsFloat) {
+		return nil, errors.New("Operator " + operator + " requires numeric values")
+	}
+
+	if leftIsInteger && rightIsInteger {
+		switch operator {
+		case "+":
+			return leftInteger + rightInteger, nil
+		case "-":
+			return leftInteger - rightInteger, nil
+		case "*":
+			return leftInteger * rightInteger, nil
+		case "/", "%":
+			if rightInteger == 0 {
+				return nil, errors.New("Division by zero")
+			}
+			if operator == "/" {
+				return leftInteger / rightInteger, nil
+			}
+			return leftInteger % rightInteger, nil
+		}
+	}
+
+	leftFloat := toSQLFloat(left)
+	rightFloat := toSQLFloat(right)
+	switch operator {
+	case "+":
+		return leftFloat + rightFloat, nil
+	case "-":
+		return leftFloat - rightFloat, nil
+	case "*":
+		return leftFloat * rightFloat, nil
+	case "/", "%":
+		if rightFloat == 0 {
+			return nil, errors.New("Division by zero")
+		}
+		if operator == "/" {
+			return leftFloat / rightFloat, nil
+		}
+		return math.Mod(leftFloat, rightFloat), nil
+	}
+
+	return nil, errors.New("Unknown operator " + operator)
+}
+
+func compareOrdered(left float64, right float64) int {
+	switch {
+	case left < right:
+		return -1
+	case left > right:
+		return 1
+	}
+
+	return 0
+}
+
+func toSQLFloat(value interface{}) float64 {
+	switch number := value.(type) {
+	case int64:
+		return float64(number)
+	case float64:
+		return number
+	}
+
+	return 0
+}
+
+// normalizeSQLValue converts the message property values into the types used by the evaluator
+func normalizeSQLValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int64, float64, time.Time:
+		return v
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return int64(v)
+	case float32:
+		return float64(v)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// parseSQLMessageBody decodes a json body for the message filters, bodies with a content type other
+// than json or that are not valid json return nil
+func parseSQLMessageBody(contentType string, data []byte) interface{} {
+	if len(data) == 0 || (contentType != "" && !isJSONContentType(contentType)) {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil
+	}
+
+	return body
+}
+
+func formatSQLValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+
+	return fmt.Sprint(value)
+}
+
+// newUUID generates a random version 4 uuid
+func newUUID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
@@ -0,0 +1,652 @@
+package servicebuscli
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type sqlTokenKind int
+
+const (
+	sqlTokenEOF sqlTokenKind = iota
+	sqlTokenIdentifier
+	sqlTokenString
+	sqlTokenNumber
+	sqlTokenOperator
+	sqlTokenComma
+	sqlTokenLeftParen
+	sqlTokenRightParen
+	sqlTokenSemicolon
+)
+
+var sqlKeywords = map[string]bool{
+	"AND":    true,
+	"OR":     true,
+	"NOT":    true,
+	"LIKE":   true,
+	"ESCAPE": true,
+	"IN":     true,
+	"IS":     true,
+	"NULL":   true,
+	"TRUE":   true,
+	"FALSE":  true,
+	"EXISTS": true,
+	"SET":    true,
+	"REMOVE": true,
+}
+
+type sqlToken struct {
+	kind     sqlTokenKind
+	text     string
+	quoted   bool
+	position int
+}
+
+// SQLFilter structure
+type SQLFilter struct {
+	Expression string
+	root       sqlExpression
+}
+
+// SQLAction structure
+type SQLAction struct {
+	Expression string
+	statements []sqlStatement
+}
+
+// ParseSQLFilter Parses a service bus sql filter expression
+func ParseSQLFilter(expression string) (*SQLFilter, error) {
+	return parseSQLFilter(expression, false)
+}
+
+// ParseMessageFilter Parses a sql filter expression used to filter the received messages, it extends
+// the service bus syntax with property names containing hyphens like X-TenantId and with the body
+// scope to access the json body fields like body.order.id or body.items.0.price
+func ParseMessageFilter(expression string) (*SQLFilter, error) {
+	return parseSQLFilter(expression, true)
+}
+
+func parseSQLFilter(expression string, messageFilter bool) (*SQLFilter, error) {
+	parser, err := newSQLParser(expression, messageFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parser.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if parser.current().kind != sqlTokenEOF {
+		return nil, parser.unexpected()
+	}
+
+	return &SQLFilter{
+		Expression: expression,
+		root:       root,
+	}, nil
+}
+
+// ParseSQLAction Parses a service bus sql action, the action is a list of SET and REMOVE
+// statements separated by semicolons
+func ParseSQLAction(expression string) (*SQLAction, error) {
+	parser, err := newSQLParser(expression, false)
+	if err != nil {
+		return nil, err
+	}
+
+	result := SQLAction{
+		Expression: expression,
+		statements: make([]sqlStatement, 0),
+	}
+
+	for parser.current().kind != sqlTokenEOF {
+		if parser.current().kind == sqlTokenSemicolon {
+			parser.next()
+			continue
+		}
+
+		statement, err := parser.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+		result.statements = append(result.statements, statement)
+
+		if parser.current().kind != sqlTokenEOF && parser.current().kind != sqlTokenSemicolon {
+			return nil, parser.unexpected()
+		}
+	}
+
+	if len(result.statements) == 0 {
+		return nil, errors.New("Action does not contain any statement")
+	}
+
+	return &result, nil
+}
+
+type sqlParser struct {
+	tokens   []sqlToken
+	position int
+	// messageFilter enables the body scope used by the received message filters
+	messageFilter bool
+}
+
+func newSQLParser(expression string, messageFilter bool) (*sqlParser, error) {
+	tokens, err := tokenizeSQL(expression, messageFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sqlParser{tokens: tokens, messageFilter: messageFilter}, nil
+}
+
+func (p *sqlParser) current() sqlToken {
+	return p.tokens[p.position]
+}
+
+func (p *sqlParser) peek() sqlToken {
+	if p.position+1 < len(p.tokens) {
+		return p.tokens[p.position+1]
+	}
+
+	return p.tokens[len(p.tokens)-1]
+}
+
+func (p *sqlParser) next() sqlToken {
+	token := p.tokens[p.position]
+	if p.position < len(p.tokens)-1 {
+		p.position++
+	}
+
+	return token
+}
+
+func (p *sqlParser) isKeyword(token sqlToken, keyword string) bool {
+	return token.kind == sqlTokenIdentifier && !token.quoted && strings.EqualFold(token.text, keyword)
+}
+
+func (p *sqlParser) isOperator(token sqlToken, operators ...string) bool {
+	if token.kind != sqlTokenOperator {
+		return false
+	}
+	for _, operator := range operators {
+		if token.text == operator {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *sqlParser) expectKeyword(keyword string) error {
+	if !p.isKeyword(p.current(), keyword) {
+		return fmt.Errorf("Expected %v at position %v but found %v", keyword, p.current().position, describeSQLToken(p.current()))
+	}
+	p.next()
+	return nil
+}
+
+func (p *sqlParser) expect(kind sqlTokenKind, description string) error {
+	if p.current().kind != kind {
+		return fmt.Errorf("Expected %v at position %v but found %v", description, p.current().position, describeSQLToken(p.current()))
+	}
+	p.next()
+	return nil
+}
+
+func (p *sqlParser) unexpected() error {
+	return fmt.Errorf("Unexpected %v at position %v", describeSQLToken(p.current()), p.current().position)
+}
+
+func (p *sqlParser) parseStatement() (sqlStatement, error) {
+	switch {
+	case p.isKeyword(p.current(), "SET"):
+		p.next()
+		property, err := p.parseProperty()
+		if err != nil {
+			return nil, err
+		}
+		if !p.isOperator(p.current(), "=") {
+			return nil, fmt.Errorf("Expected = at position %v but found %v", p.current().position, describeSQLToken(p.current()))
+		}
+		p.next()
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlSetStatement{property: property, value: value}, nil
+	case p.isKeyword(p.current(), "REMOVE"):
+		p.next()
+		property, err := p.parseProperty()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlRemoveStatement{property: property}, nil
+	}
+
+	return nil, fmt.Errorf("Expected SET or REMOVE at position %v but found %v", p.current().position, describeSQLToken(p.current()))
+}
+
+func (p *sqlParser) parseExpression() (sqlExpression, error) {
+	return p.parseOr()
+}
+
+func (p *sqlParser) parseOr() (sqlExpression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword(p.current(), "OR") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpression{operator: "OR", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *sqlParser) parseAnd() (sqlExpression, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isKeyword(p.current(), "AND") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpression{operator: "AND", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *sqlParser) parseNot() (sqlExpression, error) {
+	if p.isKeyword(p.current(), "NOT") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlUnaryExpression{operator: "NOT", operand: operand}, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *sqlParser) parseComparison() (sqlExpression, error) {
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isOperator(p.current(), "=", "<>", "!=", ">", ">=", "<", "<=") {
+		operator := p.next().text
+		if operator == "!=" {
+			operator = "<>"
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlBinaryExpression{operator: operator, left: left, right: right}, nil
+	}
+
+	if p.isKeyword(p.current(), "IS") {
+		p.next()
+		negate := false
+		if p.isKeyword(p.current(), "NOT") {
+			p.next()
+			negate = true
+		}
+		if err := p.expectKeyword("NULL"); err != nil {
+			return nil, err
+		}
+		return &sqlIsNullExpression{operand: left, negate: negate}, nil
+	}
+
+	negate := false
+	if p.isKeyword(p.current(), "NOT") && (p.isKeyword(p.peek(), "LIKE") || p.isKeyword(p.peek(), "IN")) {
+		p.next()
+		negate = true
+	}
+
+	switch {
+	case p.isKeyword(p.current(), "LIKE"):
+		p.next()
+		if p.current().kind != sqlTokenString {
+			return nil, fmt.Errorf("Expected a string pattern at position %v but found %v", p.current().position, describeSQLToken(p.current()))
+		}
+		pattern := p.next().text
+		escape := ""
+		if p.isKeyword(p.current(), "ESCAPE") {
+			p.next()
+			if p.current().kind != sqlTokenString || len([]rune(p.current().text)) != 1 {
+				return nil, fmt.Errorf("Expected a single character escape at position %v", p.current().position)
+			}
+			escape = p.next().text
+		}
+		like, err := newSQLLikeExpression(left, pattern, escape, negate)
+		if err != nil {
+			return nil, err
+		}
+		return like, nil
+	case p.isKeyword(p.current(), "IN"):
+		p.next()
+		if err := p.expect(sqlTokenLeftParen, "("); err != nil {
+			return nil, err
+		}
+		values := make([]sqlExpression, 0)
+		for {
+			value, err := p.parseAdditive()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if p.current().kind != sqlTokenComma {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(sqlTokenRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return &sqlInExpression{operand: left, values: values, negate: negate}, nil
+	}
+
+	return left, nil
+}
+
+func (p *sqlParser) parseAdditive() (sqlExpression, error) {
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator(p.current(), "+", "-") {
+		operator := p.next().text
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpression{operator: operator, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *sqlParser) parseMultiplicative() (sqlExpression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.isOperator(p.current(), "*", "/", "%") {
+		operator := p.next().text
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &sqlBinaryExpression{operator: operator, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *sqlParser) parseUnary() (sqlExpression, error) {
+	if p.isOperator(p.current(), "-", "+") {
+		operator := p.next().text
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &sqlUnaryExpression{operator: operator, operand: operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *sqlParser) parsePrimary() (sqlExpression, error) {
+	token := p.current()
+	switch token.kind {
+	case sqlTokenLeftParen:
+		p.next()
+		expression, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(sqlTokenRightParen, ")"); err != nil {
+			return nil, err
+		}
+		return expression, nil
+	case sqlTokenString:
+		p.next()
+		return &sqlLiteral{value: token.text}, nil
+	case sqlTokenNumber:
+		p.next()
+		value, err := parseSQLNumber(token.text)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid number %v at position %v", token.text, token.position)
+		}
+		return &sqlLiteral{value: value}, nil
+	case sqlTokenIdentifier:
+		switch {
+		case p.isKeyword(token, "NULL"):
+			p.next()
+			return &sqlLiteral{value: nil}, nil
+		case p.isKeyword(token, "TRUE"):
+			p.next()
+			return &sqlLiteral{value: true}, nil
+		case p.isKeyword(token, "FALSE"):
+			p.next()
+			return &sqlLiteral{value: false}, nil
+		case p.isKeyword(token, "EXISTS"):
+			p.next()
+			if err := p.expect(sqlTokenLeftParen, "("); err != nil {
+				return nil, err
+			}
+			property, err := p.parseProperty()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(sqlTokenRightParen, ")"); err != nil {
+				return nil, err
+			}
+			return &sqlExistsExpression{property: property}, nil
+		}
+
+		if !token.quoted && p.peek().kind == sqlTokenLeftParen {
+			p.next()
+			p.next()
+			if err := p.expect(sqlTokenRightParen, ")"); err != nil {
+				return nil, err
+			}
+			if !strings.EqualFold(token.text, "newid") {
+				return nil, fmt.Errorf("Unknown function %v at position %v", token.text, token.position)
+			}
+			return &sqlNewIDExpression{}, nil
+		}
+
+		return p.parseProperty()
+	}
+
+	return nil, p.unexpected()
+}
+
+func (p *sqlParser) parseProperty() (*sqlPropertyExpression, error) {
+	token := p.current()
+	if token.kind != sqlTokenIdentifier || (!token.quoted && sqlKeywords[strings.ToUpper(token.text)]) {
+		return nil, fmt.Errorf("Expected a property name at position %v but found %v", token.position, describeSQLToken(token))
+	}
+	p.next()
+
+	if token.quoted {
+		return &sqlPropertyExpression{name: token.text}, nil
+	}
+
+	parts := strings.SplitN(token.text, ".", 2)
+	if len(parts) == 1 {
+		return &sqlPropertyExpression{name: parts[0]}, nil
+	}
+
+	name := parts[1]
+	if name == "" && p.current().kind == sqlTokenIdentifier && p.current().quoted {
+		name = p.next().text
+	}
+	if name == "" {
+		return nil, fmt.Errorf("Missing property name after %v at position %v", token.text, token.position)
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "sys":
+		canonical, ok := sqlSystemPropertyNames[strings.ToLower(name)]
+		if !ok {
+			return nil, fmt.Errorf("Unknown system property %v at position %v", name, token.position)
+		}
+		return &sqlPropertyExpression{system: true, name: canonical}, nil
+	case "user":
+		return &sqlPropertyExpression{name: name}, nil
+	case "body":
+		if p.messageFilter {
+			return &sqlPropertyExpression{body: true, name: name}, nil
+		}
+	}
+
+	if p.messageFilter {
+		return nil, fmt.Errorf("Invalid property scope %v at position %v, use sys, user or body", parts[0], token.position)
+	}
+	return nil, fmt.Errorf("Invalid property scope %v at position %v, use sys or user", parts[0], token.position)
+}
+
+// tokenizeSQL splits the expression into tokens, the message filters also accept hyphens inside
+// property names when they are followed by a letter, use spaces around the minus operator
+func tokenizeSQL(expression string, messageFilter bool) ([]sqlToken, error) {
+	tokens := make([]sqlToken, 0)
+	runes := []rune(expression)
+	i := 0
+	for i < len(runes) {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			var value strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						value.WriteRune('\'')
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				value.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("Unterminated string starting at position %v", start)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenString, text: value.String(), position: start})
+		case r == '[':
+			end := strings.IndexRune(string(runes[i+1:]), ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Unterminated property name starting at position %v", start)
+			}
+			name := []rune(string(runes[i+1:])[:end])
+			i += len(name) + 2
+			tokens = append(tokens, sqlToken{kind: sqlTokenIdentifier, text: string(name), quoted: true, position: start})
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				i++
+				if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+					i++
+				}
+				for i < len(runes) && unicode.IsDigit(runes[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenNumber, text: string(runes[start:i]), position: start})
+		case unicode.IsLetter(r) || r == '_':
+			for i < len(runes) {
+				if unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.' {
+					i++
+					continue
+				}
+				if messageFilter && runes[i] == '-' && i+1 < len(runes) && unicode.IsLetter(runes[i+1]) {
+					i++
+					continue
+				}
+				break
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenIdentifier, text: string(runes[start:i]), position: start})
+		case r == ',':
+			i++
+			tokens = append(tokens, sqlToken{kind: sqlTokenComma, text: ",", position: start})
+		case r == '(':
+			i++
+			tokens = append(tokens, sqlToken{kind: sqlTokenLeftParen, text: "(", position: start})
+		case r == ')':
+			i++
+			tokens = append(tokens, sqlToken{kind: sqlTokenRightParen, text: ")", position: start})
+		case r == ';':
+			i++
+			tokens = append(tokens, sqlToken{kind: sqlTokenSemicolon, text: ";", position: start})
+		case strings.ContainsRune("=<>!+-*/%", r):
+			i++
+			if i < len(runes) {
+				pair := string([]rune{r, runes[i]})
+				if pair == "<>" || pair == "!=" || pair == ">=" || pair == "<=" {
+					i++
+					tokens = append(tokens, sqlToken{kind: sqlTokenOperator, text: pair, position: start})
+					continue
+				}
+			}
+			if r == '!' {
+				return nil, fmt.Errorf("Unexpected character ! at position %v", start)
+			}
+			tokens = append(tokens, sqlToken{kind: sqlTokenOperator, text: string(r), position: start})
+		default:
+			return nil, fmt.Errorf("Unexpected character %v at position %v", string(r), start)
+		}
+	}
+
+	tokens = append(tokens, sqlToken{kind: sqlTokenEOF, position: len(runes)})
+	return tokens, nil
+}
+
+func parseSQLNumber(value string) (interface{}, error) {
+	if !strings.ContainsAny(value, ".eE") {
+		if result, err := strconv.ParseInt(value, 10, 64); err == nil {
+			return result, nil
+		}
+	}
+
+	return strconv.ParseFloat(value, 64)
+}
+
+func describeSQLToken(token sqlToken) string {
+	switch token.kind {
+	case sqlTokenEOF:
+		return "end of expression"
+	case sqlTokenString:
+		return "'" + token.text + "'"
+	}
+
+	return token.text
+}
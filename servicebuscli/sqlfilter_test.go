@@ -0,0 +1,341 @@
+package servicebuscli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func newTestSQLMessage() *SQLMessage {
+	return &SQLMessage{
+		SystemProperties: map[string]interface{}{
+			"Label":     "order",
+			"MessageId": "order-1",
+		},
+		UserProperties: map[string]interface{}{
+			"amount": int64(150),
+			"region": "eu",
+			"code":   "50%_off",
+			"promo":  "500_off",
+		},
+	}
+}
+
+func TestSQLFilterMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+	}{
+		{"multiplication before addition", "1 + 2 * 3 = 7", true},
+		{"parentheses", "(1 + 2) * 3 = 9", true},
+		{"unary minus", "-amount < 0", true},
+		{"and before or", "region = 'us' AND amount > 100 OR sys.Label = 'order'", true},
+		{"grouped or", "region = 'us' AND (amount > 100 OR sys.Label = 'order')", false},
+		{"not before and", "NOT region = 'us' AND amount > 100", true},
+		{"not on group", "NOT (region = 'eu' AND amount > 100)", false},
+		{"not equal", "region <> 'us' AND region != 'us'", true},
+		{"int and float", "amount = 150.0", true},
+		{"different types", "amount = '150'", false},
+
+		{"missing property", "missing = 1", false},
+		{"not unknown", "NOT missing = 1", false},
+		{"missing not equal", "missing <> 1", false},
+		{"unknown or true", "missing = 1 OR region = 'eu'", true},
+		{"unknown and true", "missing = 1 AND region = 'eu'", false},
+		{"is null", "missing IS NULL", true},
+		{"is not null on missing", "missing IS NOT NULL", false},
+		{"is not null", "region IS NOT NULL", true},
+		{"null literal", "NULL IS NULL", true},
+		{"compare with null", "region = NULL", false},
+
+		{"like prefix", "sys.Label LIKE 'ord%'", true},
+		{"like single character", "sys.Label LIKE 'o_der'", true},
+		{"like whole value", "sys.Label LIKE 'ord'", false},
+		{"not like", "sys.Label NOT LIKE 'x%'", true},
+		{"like wildcards", "promo LIKE '50%_off'", true},
+		{"like escape", "code LIKE '50!%!_off' ESCAPE '!'", true},
+		{"like escaped wildcards are literal", "promo LIKE '50!%!_off' ESCAPE '!'", false},
+		{"like escaped escape", "code LIKE '50%!_off' ESCAPE '!'", true},
+		{"like on a number", "amount LIKE '1%'", false},
+		{"like on missing", "missing LIKE '%'", false},
+
+		{"in", "region IN ('us', 'eu')", true},
+		{"not in", "region NOT IN ('us', 'eu')", false},
+		{"in numbers", "amount IN (100, 150)", true},
+		{"in not found", "region IN ('us', 'uk')", false},
+		{"in on missing", "missing IN ('a')", false},
+		{"in with unknown item", "region IN ('us', missing)", false},
+		{"not in with unknown item", "region NOT IN ('us', missing)", false},
+		{"in with unknown item found", "region IN (missing, 'eu')", true},
+
+		{"exists", "EXISTS(region)", true},
+		{"exists missing", "EXISTS(missing)", false},
+		{"not exists", "NOT EXISTS(missing)", true},
+		{"exists user scope", "EXISTS(user.region)", true},
+		{"exists system property", "EXISTS(sys.Label)", true},
+		{"exists missing system property", "EXISTS(sys.CorrelationId)", false},
+
+		{"quoted property", "[region] = 'eu'", true},
+		{"escaped quote", "'it''s' = 'it''s'", true},
+		{"case insensitive keywords", "region in ('eu') and not missing is not null", true},
+		{"boolean literal", "TRUE", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filter, err := ParseSQLFilter(test.expression)
+			if err != nil {
+				t.Fatalf("ParseSQLFilter(%q) error = %v", test.expression, err)
+			}
+			got, err := filter.Match(newTestSQLMessage())
+			if err != nil {
+				t.Fatalf("Match(%q) error = %v", test.expression, err)
+			}
+			if got != test.want {
+				t.Errorf("Match(%q) = %v, want %v", test.expression, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSQLFilterParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"amount >",
+		"(amount > 1",
+		"amount > 1)",
+		"1 = 1 1",
+		"region = 'open",
+		"[open = 1",
+		"amount ! 1",
+		"region = #",
+		"foo.region = 1",
+		"sys.Unknown = 1",
+		"sys. = 1",
+		"unknown() = 1",
+		"region LIKE 1",
+		"region LIKE 'a' ESCAPE 'ab'",
+		"region LIKE 'a!' ESCAPE '!'",
+		"region IN ()",
+		"region IN 'eu'",
+		"EXISTS region",
+		"EXISTS(1)",
+		"region IS 1",
+		"body.order = 1",
+	}
+
+	for _, expression := range tests {
+		t.Run(expression, func(t *testing.T) {
+			if _, err := ParseSQLFilter(expression); err == nil {
+				t.Errorf("ParseSQLFilter(%q) error = nil, want a parse error", expression)
+			}
+		})
+	}
+}
+
+func TestSQLFilterMatchNotBoolean(t *testing.T) {
+	filter, err := ParseSQLFilter("amount + 1")
+	if err != nil {
+		t.Fatalf("ParseSQLFilter() error = %v", err)
+	}
+	if _, err := filter.Match(newTestSQLMessage()); err == nil {
+		t.Error("Match() error = nil, want an error for a filter that is not a boolean")
+	}
+}
+
+func TestSQLActionApply(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		wantSystem map[string]interface{}
+		wantUser   map[string]interface{}
+	}{
+		{
+			name:       "set system property",
+			action:     "SET sys.Label = 'big'",
+			wantSystem: map[string]interface{}{"Label": "big", "MessageId": "order-1"},
+		},
+		{
+			name:     "set user property from an expression",
+			action:   "SET total = amount * 2 + 1",
+			wantUser: map[string]interface{}{"amount": int64(150), "region": "eu", "code": "50%_off", "promo": "500_off", "total": int64(301)},
+		},
+		{
+			name:     "statements run in order",
+			action:   "SET a = 1; SET b = a + 1; REMOVE a",
+			wantUser: map[string]interface{}{"amount": int64(150), "region": "eu", "code": "50%_off", "promo": "500_off", "b": int64(2)},
+		},
+		{
+			name:     "remove user property",
+			action:   "REMOVE region; REMOVE user.code; REMOVE missing",
+			wantUser: map[string]interface{}{"amount": int64(150), "promo": "500_off"},
+		},
+		{
+			name:       "remove system property",
+			action:     "REMOVE sys.Label;",
+			wantSystem: map[string]interface{}{"MessageId": "order-1"},
+		},
+		{
+			name:     "set from a missing property",
+			action:   "SET region = missing",
+			wantUser: map[string]interface{}{"amount": int64(150), "region": nil, "code": "50%_off", "promo": "500_off"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			action, err := ParseSQLAction(test.action)
+			if err != nil {
+				t.Fatalf("ParseSQLAction(%q) error = %v", test.action, err)
+			}
+			message := newTestSQLMessage()
+			if err := action.Apply(message); err != nil {
+				t.Fatalf("Apply(%q) error = %v", test.action, err)
+			}
+
+			if test.wantSystem == nil {
+				test.wantSystem = newTestSQLMessage().SystemProperties
+			}
+			if test.wantUser == nil {
+				test.wantUser = newTestSQLMessage().UserProperties
+			}
+			if !reflect.DeepEqual(message.SystemProperties, test.wantSystem) {
+				t.Errorf("system properties = %v, want %v", message.SystemProperties, test.wantSystem)
+			}
+			if !reflect.DeepEqual(message.UserProperties, test.wantUser) {
+				t.Errorf("user properties = %v, want %v", message.UserProperties, test.wantUser)
+			}
+		})
+	}
+}
+
+func TestSQLActionErrors(t *testing.T) {
+	tests := []struct {
+		action   string
+		parseErr bool
+	}{
+		{"", true},
+		{";", true},
+		{"SET", true},
+		{"SET a", true},
+		{"SET a =", true},
+		{"SET a == 1", true},
+		{"DROP a", true},
+		{"SET a = 1 SET b = 2", true},
+		{"REMOVE 1", true},
+		{"SET sys.Unknown = 1", true},
+		{"SET sys.SequenceNumber = 1", false},
+		{"REMOVE sys.DeliveryCount", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.action, func(t *testing.T) {
+			action, err := ParseSQLAction(test.action)
+			if test.parseErr {
+				if err == nil {
+					t.Errorf("ParseSQLAction(%q) error = nil, want a parse error", test.action)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSQLAction(%q) error = %v", test.action, err)
+			}
+			if err := action.Apply(newTestSQLMessage()); err == nil {
+				t.Errorf("Apply(%q) error = nil, want a read only property error", test.action)
+			}
+		})
+	}
+}
+
+func TestRuleEntityTest(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      RuleEntity
+		want      bool
+		wantLabel string
+	}{
+		{"empty filter", RuleEntity{Name: "all"}, true, "order"},
+		{"filter and action", RuleEntity{Name: "big", SQLFilter: "amount > 100", SQLAction: "SET sys.Label = 'big'"}, true, "big"},
+		{"action not applied without a match", RuleEntity{Name: "small", SQLFilter: "amount < 100", SQLAction: "SET sys.Label = 'small'"}, false, "order"},
+		{"correlation filter", RuleEntity{Name: "eu", CorrelationFilter: &CorrelationFilterEntity{Label: "order", Properties: map[string]interface{}{"region": "eu"}}}, true, "order"},
+		{"correlation filter no match", RuleEntity{Name: "us", CorrelationFilter: &CorrelationFilterEntity{Properties: map[string]interface{}{"region": "us"}}}, false, "order"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			message := newTestSQLMessage()
+			matched, result, err := test.rule.Test(message)
+			if err != nil {
+				t.Fatalf("Test() error = %v", err)
+			}
+			if matched != test.want {
+				t.Errorf("Test() matched = %v, want %v", matched, test.want)
+			}
+			if label := result.SystemProperties["Label"]; label != test.wantLabel {
+				t.Errorf("Label = %v, want %v", label, test.wantLabel)
+			}
+			if message.SystemProperties["Label"] != "order" {
+				t.Error("Test() changed the original message")
+			}
+		})
+	}
+}
+
+func TestRuleEntityValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RuleEntity
+		wantErr bool
+	}{
+		{"empty filter", RuleEntity{Name: "all"}, false},
+		{"filter and action", RuleEntity{Name: "big", SQLFilter: "amount > 100", SQLAction: "SET sys.Label = 'big'"}, false},
+		{"invalid filter", RuleEntity{Name: "bad", SQLFilter: "amount >"}, true},
+		{"invalid action", RuleEntity{Name: "bad", SQLAction: "SET"}, true},
+		{"correlation and sql filter", RuleEntity{Name: "bad", SQLFilter: "1=1", CorrelationFilter: &CorrelationFilterEntity{Label: "order"}}, true},
+		{"empty correlation filter", RuleEntity{Name: "bad", CorrelationFilter: &CorrelationFilterEntity{}}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.rule.Validate(); (err != nil) != test.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseMessageFilter(t *testing.T) {
+	message := newTestSQLMessage()
+	message.UserProperties["X-TenantId"] = "tenant"
+	message.Body = map[string]interface{}{
+		"order": map[string]interface{}{"id": "order-1"},
+		"items": []interface{}{map[string]interface{}{"price": float64(10)}},
+	}
+
+	tests := []struct {
+		expression string
+		want       bool
+	}{
+		{"X-TenantId = 'tenant'", true},
+		{"amount - 50 = 100", true},
+		{"body.order.id = 'order-1'", true},
+		{"body.items.0.price > 5", true},
+		{"EXISTS(body.order.missing)", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expression, func(t *testing.T) {
+			filter, err := ParseMessageFilter(test.expression)
+			if err != nil {
+				t.Fatalf("ParseMessageFilter(%q) error = %v", test.expression, err)
+			}
+			got, err := filter.Match(message)
+			if err != nil {
+				t.Fatalf("Match(%q) error = %v", test.expression, err)
+			}
+			if got != test.want {
+				t.Errorf("Match(%q) = %v, want %v", test.expression, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+)
+
+// SettleMode Enum
+type SettleMode string
+
+// SettleMode Enum definition, SettleNone leaves the messages locked so they are delivered again
+// once the lock expires
+const (
+	SettleComplete   SettleMode = "complete"
+	SettleAbandon    SettleMode = "abandon"
+	SettleDeadLetter SettleMode = "deadletter"
+	SettleDefer      SettleMode = "defer"
+	SettleNone       SettleMode = "none"
+)
+
+// peekPollInterval is how often a subscription that peeks the messages looks for new ones
+const peekPollInterval = 2 * time.Second
+
+// defaultMaxLockRenewal is the time the lock of a message is renewed for while it is handled
+const defaultMaxLockRenewal = 5 * time.Minute
+
+// concurrentReceiver listens with several receivers at the same time, each of them handles its
+// messages one by one
+type concurrentReceiver struct {
+	receivers []Receiver
+}
+
+// peekReceiver peeks the messages of an entity without locking them, every message is handled once
+// and the session id, when set, only keeps the messages of that session
+type peekReceiver struct {
+	broker     Broker
+	entityPath string
+	sessionID  string
+	seen       map[int64]bool
+	pending    []*servicebus.Message
+}
+
+// peekedSettler settles the peeked messages, they are not locked so there is nothing to release
+type peekedSettler struct{}
+
+// messageLimiter applies the subscription filter, the maximum number of messages and the timeout
+// to the messages received by a subscription
+type messageLimiter struct {
+	entityName  string
+	filter      *SQLFilter
+	maxMessages int
+	timeout     time.Duration
+	settle      SettleMode
+	stop        func()
+	stopOnce    sync.Once
+	mutex       sync.Mutex
+	matched     int
+	stopped     bool
+	timer       *time.Timer
+}
+
+// newMessageLimiter creates the limiter of a subscription, stop is called once when the maximum
+// number of matching messages was received or when no matching message arrived in the timeout, a
+// filter needs the messages to be peeked or to come from a wiretap subscription so the messages that
+// do not match are never kept locked
+func (s *ServiceBusCli) newMessageLimiter(entityName string, wiretap bool, stop func()) (*messageLimiter, error) {
+	if s.Filter != nil && s.Settle != SettleNone && !wiretap {
+		return nil, errors.New("Filtering the messages of " + entityName + " would keep the messages that do not match locked, please add --peek or use a wiretap subscription")
+	}
+
+	limiter := messageLimiter{
+		entityName:  entityName,
+		filter:      s.Filter,
+		maxMessages: s.MaxMessages,
+		timeout:     s.Timeout,
+		settle:      s.Settle,
+		stop:        stop,
+	}
+
+	if limiter.filter != nil {
+		logger.LogHighlight("Only showing the messages in %v matching %v", log.Info, entityName, limiter.filter.Expression)
+	}
+	if limiter.timeout > 0 {
+		limiter.timer = time.AfterFunc(limiter.timeout, func() {
+			logger.LogHighlight("No matching message received in %v for %v, closing the subscription", log.Warning, limiter.timeout.String(), entityName)
+			limiter.finish()
+		})
+	}
+
+	return &limiter, nil
+}
+
+// wrap Runs the handler only on the matching messages, the messages that do not match are skipped
+func (l *messageLimiter) wrap(handler MessageHandler) MessageHandler {
+	return func(ctx context.Context, msg *ReceivedMessage) error {
+		if l.isStopped() {
+			return l.release(ctx, msg)
+		}
+
+		if l.filter != nil {
+			matched, err := l.filter.Match(NewSQLMessageFromMessage(msg.Message))
+			if err != nil {
+				logger.LogHighlight("Could not evaluate the filter on message %v: %v", log.Warning, msg.ID, err.Error())
+			}
+			if !matched {
+				return l.skip(ctx, msg)
+			}
+		}
+
+		l.mutex.Lock()
+		if l.stopped {
+			l.mutex.Unlock()
+			return l.release(ctx, msg)
+		}
+		l.matched++
+		last := l.maxMessages > 0 && l.matched >= l.maxMessages
+		if last {
+			l.stopped = true
+		} else if l.timer != nil {
+			l.timer.Reset(l.timeout)
+		}
+		l.mutex.Unlock()
+
+		err := handler(ctx, msg)
+		if last {
+			logger.LogHighlight("Received %v matching messages from %v, closing the subscription", log.Info, fmt.Sprint(l.matched), l.entityName)
+			l.close()
+			l.stopOnce.Do(l.stop)
+		}
+		return err
+	}
+}
+
+// close Stops the timeout timer
+func (l *messageLimiter) close() {
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+}
+
+func (l *messageLimiter) finish() {
+	l.mutex.Lock()
+	l.stopped = true
+	l.mutex.Unlock()
+	l.stopOnce.Do(l.stop)
+}
+
+func (l *messageLimiter) isStopped() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.stopped
+}
+
+// release gives back the messages received after the subscription was stopped
+func (l *messageLimiter) release(ctx context.Context, msg *ReceivedMessage) error {
+	if l.settle == SettleNone {
+		return nil
+	}
+	return msg.Abandon(ctx)
+}
+
+// skip drops a message that does not match the filter, peeked messages are not locked and the
+// messages of a wiretap subscription are copies so they are completed
+func (l *messageLimiter) skip(ctx context.Context, msg *ReceivedMessage) error {
+	if l.settle == SettleNone {
+		return nil
+	}
+	return msg.Complete(ctx)
+}
+
+// ParseSettleMode Parses how the received messages are settled, complete, abandon, deadletter, defer
+// or none
+func ParseSettleMode(value string) (SettleMode, error) {
+	switch mode := SettleMode(strings.ToLower(strings.Replace(value, "-", "", -1))); mode {
+	case "":
+		return SettleComplete, nil
+	case SettleComplete, SettleAbandon, SettleDeadLetter, SettleDefer, SettleNone:
+		return mode, nil
+	}
+
+	return SettleComplete, errors.New("Invalid settle mode " + value + ", use complete, abandon, deadletter, defer or none")
+}
+
+// settleMessage Settles a handled message with the settle mode of the subscription
+func (s *ServiceBusCli) settleMessage(ctx context.Context, msg *ReceivedMessage) error {
+	switch s.Settle {
+	case SettleNone:
+		return nil
+	case SettleAbandon:
+		return msg.Abandon(ctx)
+	case SettleDeadLetter:
+		return msg.DeadLetter(ctx, errors.New("Dead lettered by the servicebus cli"))
+	case SettleDefer:
+		logger.LogHighlight("Message %v was deferred, sequence number: %v", log.Info, msg.ID, fmt.Sprint(msg.SequenceNumber()))
+		return msg.Defer(ctx)
+	}
+
+	return msg.Complete(ctx)
+}
+
+// newListener creates the receivers of a subscription, one for each of the concurrent handlers
+func (s *ServiceBusCli) newListener(ctx context.Context, entityPath string) (Receiver, error) {
+	if s.peeksMessages() {
+		logger.LogHighlight("Peeking the messages of %v, they are not locked or settled", log.Info, entityPath)
+		return &peekReceiver{
+			broker:     s.Broker,
+			entityPath: entityPath,
+			sessionID:  s.SessionID,
+			seen:       make(map[int64]bool),
+		}, nil
+	}
+
+	options := make([]ReceiverOption, 0)
+	if s.PrefetchCount > 0 {
+		options = append(options, WithPrefetchCount(uint32(s.PrefetchCount)))
+	}
+	if s.Concurrency <= 1 {
+		return s.Broker.NewReceiver(ctx, entityPath, options...)
+	}
+
+	logger.LogHighlight("Handling up to %v messages at the same time from %v", log.Info, fmt.Sprint(s.Concurrency), entityPath)
+	listener := concurrentReceiver{
+		receivers: make([]Receiver, 0, s.Concurrency),
+	}
+	for i := 0; i < s.Concurrency; i++ {
+		receiver, err := s.Broker.NewReceiver(ctx, entityPath, options...)
+		if err != nil {
+			listener.Close(ctx)
+			return nil, err
+		}
+		listener.receivers = append(listener.receivers, receiver)
+	}
+
+	return &listener, nil
+}
+
+// peeksMessages checks if the subscription peeks the messages instead of receiving them, a filtered
+// subscription that does not settle the messages peeks them so the ones that do not match are not
+// locked and their delivery count is not increased
+func (s *ServiceBusCli) peeksMessages() bool {
+	return s.Filter != nil && s.Settle == SettleNone
+}
+
+// withLockRenewal Renews the lock of the messages while the handler runs, at half of the remaining lock
+// time, until the handler returns or the maximum renewal time is reached
+func (s *ServiceBusCli) withLockRenewal(handler MessageHandler) MessageHandler {
+	if !s.AutoRenewLock || s.peeksMessages() {
+		return handler
+	}
+
+	maxLockRenewal := s.MaxLockRenewal
+	return func(ctx context.Context, msg *ReceivedMessage) error {
+		interval := 15 * time.Second
+		if msg.SystemProperties != nil && msg.SystemProperties.LockedUntil != nil {
+			interval = time.Until(*msg.SystemProperties.LockedUntil) / 2
+		}
+		if interval < time.Second {
+			interval = time.Second
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			deadline := time.Now().Add(maxLockRenewal)
+			for {
+				select {
+				case <-done:
+					return
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+
+				if maxLockRenewal > 0 && time.Now().After(deadline) {
+					logger.LogHighlight("Stopped renewing the lock of message %v after %v", log.Warning, msg.ID, maxLockRenewal.String())
+					return
+				}
+				if err := msg.RenewLock(ctx); err != nil {
+					logger.LogHighlight("Could not renew the lock of message %v: %v", log.Warning, msg.ID, err.Error())
+					return
+				}
+			}
+		}()
+
+		return handler(ctx, msg)
+	}
+}
+
+// renewHeldLocks renews the locks of the messages held by a scan at half of the lock duration until the
+// context is cancelled, so the messages that were not selected are not received again before the scan
+// ends and releases them
+func renewHeldLocks(ctx context.Context, lockDuration time.Duration, held func() []*ReceivedMessage) {
+	interval := lockDuration / 2
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, msg := range held() {
+			if err := msg.RenewLock(ctx); err != nil && ctx.Err() == nil {
+				logger.LogHighlight("Could not renew the lock of message %v: %v", log.Warning, msg.ID, err.Error())
+			}
+		}
+	}
+}
+
+// entityLockDuration gets the lock duration of a queue or a subscription, it is 0 when the entity
+// cannot be read
+func (s *ServiceBusCli) entityLockDuration(ctx context.Context, entityPath string) time.Duration {
+	if topicName, subscriptionName, ok := SplitSubscriptionEntityPath(entityPath); ok {
+		subscription, err := s.Broker.GetSubscription(ctx, topicName, subscriptionName)
+		if err != nil || subscription == nil {
+			return 0
+		}
+		return durationFrom8601(subscription.LockDuration)
+	}
+
+	queue, err := s.Broker.GetQueue(ctx, entityPath)
+	if err != nil || queue == nil {
+		return 0
+	}
+	return durationFrom8601(queue.LockDuration)
+}
+
+// ReceiveOne Receives the next message with the first receiver
+func (r *concurrentReceiver) ReceiveOne(ctx context.Context, handler MessageHandler) error {
+	return r.receivers[0].ReceiveOne(ctx, handler)
+}
+
+// Listen Runs all of the receivers until the context is cancelled, the first error stops them
+func (r *concurrentReceiver) Listen(ctx context.Context, handler MessageHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make(chan error, len(r.receivers))
+	for _, receiver := range r.receivers {
+		go func(receiver Receiver) {
+			err := receiver.Listen(ctx, handler)
+			if err != nil {
+				cancel()
+			}
+			errs <- err
+		}(receiver)
+	}
+
+	var result error
+	for range r.receivers {
+		if err := <-errs; err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// Close Closes all of the receivers
+func (r *concurrentReceiver) Close(ctx context.Context) error {
+	var result error
+	for _, receiver := range r.receivers {
+		if err := receiver.Close(ctx); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// ReceiveOne Waits for the next message that was not peeked before and runs the handler on it
+func (r *peekReceiver) ReceiveOne(ctx context.Context, handler MessageHandler) error {
+	for len(r.pending) == 0 {
+		if err := r.peek(ctx); err != nil {
+			return err
+		}
+		if len(r.pending) > 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(peekPollInterval):
+		}
+	}
+
+	msg := r.pending[0]
+	r.pending = r.pending[1:]
+	return handler(ctx, &ReceivedMessage{Message: msg, settler: peekedSettler{}})
+}
+
+// peek Adds the messages that were not seen yet to the pending ones, the scheduled messages are
+// left until they are enqueued
+func (r *peekReceiver) peek(ctx context.Context) error {
+	iterator, err := r.broker.Peek(ctx, r.entityPath)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for {
+		msg, err := iterator.Next(ctx)
+		if err != nil {
+			var noMessages servicebus.ErrNoMessages
+			if errors.As(err, &noMessages) {
+				return nil
+			}
+			return err
+		}
+
+		sequenceNumber := getSequenceNumber(msg)
+		if r.seen[sequenceNumber] || isScheduledMessage(msg, now) {
+			continue
+		}
+		r.seen[sequenceNumber] = true
+		if r.sessionID != "" && (msg.SessionID == nil || *msg.SessionID != r.sessionID) {
+			continue
+		}
+		r.pending = append(r.pending, msg)
+	}
+}
+
+// Listen Runs the handler on every new message until the context is cancelled
+func (r *peekReceiver) Listen(ctx context.Context, handler MessageHandler) error {
+	for {
+		err := r.ReceiveOne(ctx, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close Closes the receiver, peeking does not keep a link open
+func (r *peekReceiver) Close(ctx context.Context) error {
+	return nil
+}
+
+func (peekedSettler) complete(ctx context.Context, msg *ReceivedMessage) error {
+	return errors.New("Message " + msg.ID + " was peeked and cannot be completed")
+}
+
+func (peekedSettler) abandon(ctx context.Context, msg *ReceivedMessage) error {
+	return nil
+}
+
+func (peekedSettler) deadLetter(ctx context.Context, msg *ReceivedMessage, err error) error {
+	return errors.New("Message " + msg.ID + " was peeked and cannot be dead lettered")
+}
+
+func (peekedSettler) deferMessage(ctx context.Context, msg *ReceivedMessage) error {
+	return errors.New("Message " + msg.ID + " was peeked and cannot be deferred")
+}
+
+func (peekedSettler) renewLock(ctx context.Context, msg *ReceivedMessage) error {
+	return nil
+}
@@ -0,0 +1,62 @@
+package servicebuscli
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestSubscribeToQueueFilterDoesNotLockMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		settle  SettleMode
+		wantErr bool
+	}{
+		{name: "peek", settle: SettleNone},
+		{name: "receive", settle: SettleComplete, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			broker := newMemoryBroker(t)
+			queue := NewQueue("orders")
+			queue.LockDuration = time.Second
+			queue.MaxDeliveryCount = 2
+			if err := broker.CreateQueue(ctx, queue); err != nil {
+				t.Fatalf("CreateQueue() error = %v", err)
+			}
+			msg := servicebus.NewMessageFromString("order")
+			msg.UserProperties = map[string]interface{}{"a": "no"}
+			if err := broker.Send(ctx, "orders", msg); err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			sbcli := New(broker)
+			filter, err := ParseMessageFilter("a = 'yes'")
+			if err != nil {
+				t.Fatalf("ParseMessageFilter() error = %v", err)
+			}
+			sbcli.Filter = filter
+			sbcli.Settle = test.settle
+			// the subscription outlives the lock duration times the max delivery count
+			sbcli.Timeout = 3 * time.Second
+			if err := sbcli.SubscribeToQueue("orders"); (err != nil) != test.wantErr {
+				t.Fatalf("SubscribeToQueue() error = %v, wantErr %v", err, test.wantErr)
+			}
+
+			messages := peekMessages(t, broker, "orders")
+			if len(messages) != 1 {
+				t.Fatalf("messages in the queue = %v, want 1", len(messages))
+			}
+			if messages[0].DeliveryCount != 0 {
+				t.Errorf("DeliveryCount = %v, want 0", messages[0].DeliveryCount)
+			}
+			if got := len(peekMessages(t, broker, DeadLetterEntityPath("orders"))); got != 0 {
+				t.Errorf("dead letters = %v, want 0", got)
+			}
+		})
+	}
+}
@@ -22,14 +22,16 @@ type SubscriptionEntity struct {
 	MaxDeliveryCount         int32
 	Forward                  ForwardEntity
 	ForwardDeadLetter        ForwardEntity
+	RequiresSession          bool
 	Rules                    []RuleEntity
 }
 
 // RuleEntity structure
 type RuleEntity struct {
-	Name      string
-	SQLFilter string
-	SQLAction string
+	Name              string
+	SQLFilter         string
+	SQLAction         string
+	CorrelationFilter *CorrelationFilterEntity
 }
 
 // NewSubscription Creates a new subscription entity
@@ -98,6 +100,11 @@ func (s *SubscriptionEntity) AddSQLAction(ruleName string, action string) {
 
 // MapMessageForwardFlag Maps a forward flag string into it's sub components
 func (s *SubscriptionEntity) MapMessageForwardFlag(value string) {
+	if strings.EqualFold(value, ForwardNone) {
+		s.Forward.To = ""
+		s.Forward.Clear = true
+		return
+	}
 	if value != "" {
 		forwardMapped := strings.Split(value, ":")
 		if len(forwardMapped) == 1 {
@@ -116,6 +123,11 @@ func (s *SubscriptionEntity) MapMessageForwardFlag(value string) {
 
 // MapDeadLetterForwardFlag Maps a forward dead letter flag string into it's sub components
 func (s *SubscriptionEntity) MapDeadLetterForwardFlag(value string) {
+	if strings.EqualFold(value, ForwardNone) {
+		s.ForwardDeadLetter.To = ""
+		s.ForwardDeadLetter.Clear = true
+		return
+	}
 	if value != "" {
 		forwardMapped := strings.Split(value, ":")
 		if len(forwardMapped) == 1 {
@@ -145,182 +157,395 @@ func (s *SubscriptionEntity) MapRuleFlag(value string) {
 	}
 }
 
+// GetChanges Gets the properties that are different between the subscription entity and an existing
+// service bus subscription, properties not set in the subscription entity are ignored
+func (s *SubscriptionEntity) GetChanges(existing *servicebus.SubscriptionEntity) []PropertyChange {
+	changes := make([]PropertyChange, 0)
+	if existing == nil || existing.SubscriptionDescription == nil {
+		return changes
+	}
+
+	changes = compareDuration(changes, "lock duration", existing.LockDuration, s.LockDuration)
+	changes = compareDuration(changes, "default message time to live", existing.DefaultMessageTimeToLive, s.DefaultMessageTimeToLive)
+	changes = compareDuration(changes, "auto delete on idle", existing.AutoDeleteOnIdle, s.AutoDeleteOnIdle)
+	changes = compareInt32(changes, "max delivery count", existing.MaxDeliveryCount, s.MaxDeliveryCount)
+	changes = compareForward(changes, "forward to", existing.ForwardTo, s.Forward)
+	changes = compareForward(changes, "forward dead letters to", existing.ForwardDeadLetteredMessagesTo, s.ForwardDeadLetter)
+
+	return changes
+}
+
+// GetRuleChanges Gets the rules that are different between the subscription entity and the existing
+// subscription rules
+func (s *SubscriptionEntity) GetRuleChanges(existing []RuleEntity) []PropertyChange {
+	changes := make([]PropertyChange, 0)
+	existingRules := make(map[string]RuleEntity)
+	for _, existingRule := range existing {
+		existingRules[existingRule.Name] = existingRule
+	}
+
+	wanted := make(map[string]bool)
+	for _, rule := range s.Rules {
+		wanted[rule.Name] = true
+		existingRule, ok := existingRules[rule.Name]
+		if !ok {
+			changes = append(changes, PropertyChange{Name: "rule " + rule.Name, From: "not set", To: rule.String()})
+		} else if !existingRule.Equals(rule) {
+			changes = append(changes, PropertyChange{Name: "rule " + rule.Name, From: existingRule.String(), To: rule.String()})
+		}
+	}
+
+	for _, existingRule := range existing {
+		if !wanted[existingRule.Name] {
+			changes = append(changes, PropertyChange{Name: "rule " + existingRule.Name, From: existingRule.String(), To: "removed"})
+		}
+	}
+
+	return changes
+}
+
 // ListSubscriptions Lists all the topics in a service bus
 func (s *ServiceBusCli) ListSubscriptions(topicName string) ([]*servicebus.SubscriptionEntity, error) {
-	logger.LogHighlight("Getting all topics from %v service bus ", log.Info, s.Namespace.Name)
+	logger.LogHighlight("Getting all topics from %v service bus ", log.Info, s.Broker.Name())
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	topic := s.GetTopic(topicName)
-	if topic == nil {
-		commonError := errors.New("Could not find topic " + topicName + " in " + s.Namespace.Name + " bus")
-		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Namespace.Name)
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError := errors.New("Could not find topic " + topicName + " in " + s.Broker.Name() + " bus")
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
 		return nil, commonError
 	}
 
-	sm := topic.NewSubscriptionManager()
-	return sm.List(ctx)
+	return s.Broker.ListSubscriptions(ctx, topicName)
 }
 
 // CreateSubscription Creates a subscription to a topic in the service bus
 func (s *ServiceBusCli) CreateSubscription(subscription SubscriptionEntity) error {
 	var commonError error
-	opts := make([]servicebus.SubscriptionManagementOption, 0)
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	logger.LogHighlight("Creating subscription %v on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Namespace.Name)
-	topic := s.GetTopic(subscription.TopicName)
-	if topic == nil {
-		commonError = errors.New("Could not find topic " + subscription.TopicName + " in service bus" + s.Namespace.Name)
-		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, subscription.TopicName, s.Namespace.Name)
+	logger.LogHighlight("Creating subscription %v on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Broker.Name())
+	topic, err := s.Broker.GetTopic(ctx, subscription.TopicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + subscription.TopicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, subscription.TopicName, s.Broker.Name())
 		return commonError
 	}
-	sm := topic.NewSubscriptionManager()
-	existingSubscription, err := sm.Get(ctx, subscription.Name)
+	existingSubscription, _ := s.Broker.GetSubscription(ctx, subscription.TopicName, subscription.Name)
 	if existingSubscription != nil {
-		commonError = errors.New("Subscription " + subscription.Name + " already exists on topic " + subscription.TopicName + " in service bus" + s.Namespace.Name)
-		logger.LogHighlight("Subscription %v already exists on topic %v in service bus %v", log.Error, subscription.Name, subscription.TopicName, s.Namespace.Name)
+		commonError = errors.New("Subscription " + subscription.Name + " already exists on topic " + subscription.TopicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Subscription %v already exists on topic %v in service bus %v", log.Error, subscription.Name, subscription.TopicName, s.Broker.Name())
 		return commonError
 	}
 
-	// Generating subscription options
-	if subscription.LockDuration.Milliseconds() > 0 {
-		opts = append(opts, servicebus.SubscriptionWithLockDuration(&subscription.LockDuration))
-	}
-	if subscription.DefaultMessageTimeToLive.Microseconds() > 0 {
-		opts = append(opts, servicebus.SubscriptionWithMessageTimeToLive(&subscription.DefaultMessageTimeToLive))
-	}
-	if subscription.AutoDeleteOnIdle.Microseconds() > 0 {
-		opts = append(opts, servicebus.SubscriptionWithAutoDeleteOnIdle(&subscription.AutoDeleteOnIdle))
+	err = s.Broker.CreateSubscription(ctx, subscription)
+	if err != nil {
+		logger.Info("There was an error creating subscription")
+		logger.Error(err.Error())
+		return err
 	}
 
-	// Generating the forward rule, checking if the target exists or not
-	if subscription.Forward.To != "" {
-		switch subscription.Forward.In {
-		case ForwardToTopic:
-			tm := s.GetTopicManager()
-			target, err := tm.Get(ctx, subscription.Forward.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding topic %v in service bus %v", log.Error, subscription.Forward.To, s.Namespace.Name)
-				return err
+	// Defining the filters if they exist, the default rule accepts every message so it is removed
+	// unless it is one of the subscription rules, the service bus already created it so it is only
+	// replaced when it has its own filter or action
+	hasDefaultRule := false
+	for _, rule := range subscription.Rules {
+		if rule.Name == DefaultRuleName {
+			hasDefaultRule = true
+			if rule.AcceptsAll() {
+				continue
 			}
-			opts = append(opts, servicebus.SubscriptionWithAutoForward(target))
-		case ForwardToQueue:
-			qm := s.GetQueueManager()
-			target, err := qm.Get(ctx, subscription.Forward.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding queue %v in service bus %v", log.Error, subscription.Forward.To, s.Namespace.Name)
+			logger.LogHighlight("Replacing rule %v of subscription %v on topic %v", log.Info, DefaultRuleName, subscription.Name, subscription.TopicName)
+			if err := s.Broker.DeleteRule(ctx, subscription.TopicName, subscription.Name, DefaultRuleName); err != nil {
+				logger.Error(err.Error())
 				return err
 			}
-			opts = append(opts, servicebus.SubscriptionWithAutoForward(target))
+		}
+		err = s.CreateSubscriptionRule(subscription, rule)
+		if err != nil {
+			return err
 		}
 	}
-
-	// Generating the Dead Letter forwarding rule, checking if the target exist or not
-	if subscription.ForwardDeadLetter.To != "" {
-		switch subscription.ForwardDeadLetter.In {
-		case ForwardToTopic:
-			tm := s.GetTopicManager()
-			target, err := tm.Get(ctx, subscription.ForwardDeadLetter.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding topic %v in service bus %v", log.Error, subscription.Forward.To, s.Namespace.Name)
-				return err
-			}
-			opts = append(opts, servicebus.SubscriptionWithAutoForward(target))
-		case ForwardToQueue:
-			qm := s.GetQueueManager()
-			target, err := qm.Get(ctx, subscription.ForwardDeadLetter.To)
-			if err != nil || target == nil {
-				logger.LogHighlight("Could not find forwarding queue %v in service bus %v", log.Error, subscription.Forward.To, s.Namespace.Name)
-				return err
-			}
-			opts = append(opts, servicebus.SubscriptionWithForwardDeadLetteredMessagesTo(target))
+	if len(subscription.Rules) > 0 && !hasDefaultRule {
+		logger.LogHighlight("Removing rule %v from subscription %v on topic %v as it has its own rules", log.Info, DefaultRuleName, subscription.Name, subscription.TopicName)
+		if err := s.Broker.DeleteRule(ctx, subscription.TopicName, subscription.Name, DefaultRuleName); err != nil {
+			logger.Error(err.Error())
+			return err
 		}
 	}
 
-	_, err = sm.Put(ctx, subscription.Name, opts...)
+	logger.LogHighlight("Subscription %v was created successfully on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Broker.Name())
+	return nil
+}
+
+// UpdateSubscription Updates an existing subscription on a topic in the service bus, only the
+// properties set in the subscription entity are changed and the changes are printed before being
+// applied, rules are not changed
+func (s *ServiceBusCli) UpdateSubscription(subscription SubscriptionEntity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	logger.LogHighlight("Updating subscription %v on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Broker.Name())
+	existingSubscription, err := s.getExistingSubscription(subscription.TopicName, subscription.Name)
 	if err != nil {
-		logger.Info("There was an error creating subscription")
-		logger.Error(err.Error())
 		return err
 	}
 
-	// Defining the filters if they exist
-	for _, rule := range subscription.Rules {
-		s.CreateSubscriptionRule(subscription, rule)
-		if err != nil {
-			return err
-		}
+	changes := subscription.GetChanges(existingSubscription)
+	if len(changes) == 0 {
+		logger.LogHighlight("Subscription %v is already up to date on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Broker.Name())
+		return nil
+	}
+	printPropertyChanges(changes)
 
+	err = s.Broker.UpdateSubscription(ctx, subscription)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
 	}
 
-	logger.LogHighlight("Subscription %v was created successfully on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Namespace.Name)
+	logger.LogHighlight("Subscription %v was updated successfully on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Broker.Name())
 	return nil
 }
 
-// CreateSubscriptionRule Creates a rule to a specific subscription
-func (s *ServiceBusCli) CreateSubscriptionRule(subscription SubscriptionEntity, rule RuleEntity) error {
+// ListSubscriptionRules Lists all the rules of a subscription
+func (s *ServiceBusCli) ListSubscriptionRules(topicName string, subscriptionName string) ([]RuleEntity, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	logger.LogHighlight("Creating subscription rule %v in subscription %v on topic %v in service bus %v", log.Info, rule.Name, subscription.Name, subscription.TopicName, s.Namespace.Name)
-	topic := s.GetTopic(subscription.TopicName)
-	sm := topic.NewSubscriptionManager()
-
-	var sqlFilter servicebus.SQLFilter
-	var sqlAction servicebus.SQLAction
-	if rule.SQLFilter != "" {
-		sqlFilter.Expression = rule.SQLFilter
-		if rule.SQLAction != "" {
-			sqlAction.Expression = rule.SQLAction
-			_, err := sm.PutRuleWithAction(ctx, subscription.Name, rule.Name, sqlFilter, sqlAction)
-			if err != nil {
-				logger.LogHighlight("Could not create subscription rule %v in subscription %v on topic %v in service bus %v", log.Error, rule.Name, subscription.Name, subscription.TopicName, s.Namespace.Name)
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError := errors.New("Could not find topic " + topicName + " in " + s.Broker.Name() + " bus")
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
+		return nil, commonError
+	}
+
+	return s.Broker.ListRules(ctx, topicName, subscriptionName)
+}
+
+// SetSubscriptionRules Replaces the rules of an existing subscription with the ones in the subscription
+// entity, rules that are already equal are kept and the others are removed
+func (s *ServiceBusCli) SetSubscriptionRules(subscription SubscriptionEntity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	logger.LogHighlight("Setting the rules of subscription %v on topic %v in service bus %v", log.Info, subscription.Name, subscription.TopicName, s.Broker.Name())
+
+	existingRules, err := s.ListSubscriptionRules(subscription.TopicName, subscription.Name)
+	if err != nil {
+		logger.LogHighlight("There was an error trying to list the rules of subscription %v on topic %v in service bus %v", log.Error, subscription.Name, subscription.TopicName, s.Broker.Name())
+		return err
+	}
+
+	existing := make(map[string]RuleEntity)
+	for _, existingRule := range existingRules {
+		existing[existingRule.Name] = existingRule
+	}
+
+	wanted := make(map[string]bool)
+	for _, rule := range subscription.Rules {
+		wanted[rule.Name] = true
+	}
+
+	for name := range existing {
+		if !wanted[name] {
+			logger.LogHighlight("Removing rule %v from subscription %v on topic %v", log.Info, name, subscription.Name, subscription.TopicName)
+			if err := s.Broker.DeleteRule(ctx, subscription.TopicName, subscription.Name, name); err != nil {
+				logger.Error(err.Error())
 				return err
 			}
-		} else {
-			_, err := sm.PutRule(ctx, subscription.Name, rule.Name, sqlFilter)
-			if err != nil {
-				logger.LogHighlight("Could not create subscription rule %v in subscription %v on topic %v in service bus %v", log.Error, rule.Name, subscription.Name, subscription.TopicName, s.Namespace.Name)
+		}
+	}
+
+	for _, rule := range subscription.Rules {
+		if existingRule, ok := existing[rule.Name]; ok {
+			if existingRule.Equals(rule) {
+				continue
+			}
+			if err := s.Broker.DeleteRule(ctx, subscription.TopicName, subscription.Name, rule.Name); err != nil {
+				logger.Error(err.Error())
 				return err
 			}
 		}
+
+		logger.LogHighlight("Creating rule %v in subscription %v on topic %v", log.Info, rule.Name, subscription.Name, subscription.TopicName)
+		if err := s.Broker.CreateRule(ctx, subscription.TopicName, subscription.Name, rule); err != nil {
+			logger.LogHighlight("Could not create subscription rule %v in subscription %v on topic %v in service bus %v", log.Error, rule.Name, subscription.Name, subscription.TopicName, s.Broker.Name())
+			logger.Error(err.Error())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Equals Compares two rules filter and action expressions
+func (r RuleEntity) Equals(rule RuleEntity) bool {
+	return r.Name == rule.Name &&
+		strings.TrimSpace(r.SQLFilter) == strings.TrimSpace(rule.SQLFilter) &&
+		strings.TrimSpace(r.SQLAction) == strings.TrimSpace(rule.SQLAction) &&
+		r.CorrelationFilter.Equals(rule.CorrelationFilter)
+}
+
+// AcceptsAll Checks if the rule is a true filter without an action, like the default rule the service
+// bus creates in every new subscription
+func (r RuleEntity) AcceptsAll() bool {
+	if r.CorrelationFilter != nil || strings.TrimSpace(r.SQLAction) != "" {
+		return false
 	}
-	logger.LogHighlight("Subscription rule %v was created successfully for subscription %v on topic %v in service bus %v", log.Info, rule.Name, subscription.Name, subscription.TopicName, s.Namespace.Name)
 
-	rules, err := sm.ListRules(ctx, subscription.Name)
+	switch strings.ToLower(strings.Join(strings.Fields(r.SQLFilter), "")) {
+	case "", "1=1", "true":
+		return true
+	}
+
+	return false
+}
+
+// String Gets the rule filter and action expressions as a string
+func (r RuleEntity) String() string {
+	filter := r.SQLFilter
+	if r.CorrelationFilter != nil {
+		filter = r.CorrelationFilter.String()
+	}
+	if r.SQLAction != "" {
+		return filter + " (action: " + r.SQLAction + ")"
+	}
+
+	return filter
+}
+
+// CreateSubscriptionRule Creates a rule to a specific subscription, the other subscription rules are
+// not changed
+func (s *ServiceBusCli) CreateSubscriptionRule(subscription SubscriptionEntity, rule RuleEntity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	logger.LogHighlight("Creating subscription rule %v in subscription %v on topic %v in service bus %v", log.Info, rule.Name, subscription.Name, subscription.TopicName, s.Broker.Name())
+
+	err := s.Broker.CreateRule(ctx, subscription.TopicName, subscription.Name, rule)
 	if err != nil {
-		logger.LogHighlight("There was an error trying to list the rules of subscription %v on topic %v in service bus %v", log.Error, subscription.Name, subscription.TopicName, s.Namespace.Name)
+		logger.LogHighlight("Could not create subscription rule %v in subscription %v on topic %v in service bus %v", log.Error, rule.Name, subscription.Name, subscription.TopicName, s.Broker.Name())
+		logger.Error(err.Error())
+		return err
+	}
+
+	logger.LogHighlight("Subscription rule %v was created successfully for subscription %v on topic %v in service bus %v", log.Info, rule.Name, subscription.Name, subscription.TopicName, s.Broker.Name())
+	return nil
+}
+
+// AddSubscriptionRule Adds a rule to an existing subscription, a warning is shown if the default rule
+// is still there as the subscription keeps receiving every message
+func (s *ServiceBusCli) AddSubscriptionRule(topicName string, subscriptionName string, rule RuleEntity) error {
+	if _, err := s.getExistingSubscription(topicName, subscriptionName); err != nil {
+		return err
+	}
+
+	subscription := NewSubscription(topicName, subscriptionName)
+	if err := s.CreateSubscriptionRule(subscription, rule); err != nil {
 		return err
 	}
 
+	rules, err := s.ListSubscriptionRules(topicName, subscriptionName)
+	if err != nil {
+		logger.LogHighlight("There was an error trying to list the rules of subscription %v on topic %v in service bus %v", log.Error, subscriptionName, topicName, s.Broker.Name())
+		return err
+	}
 	for _, existingRule := range rules {
-		if existingRule.Name == "$Default" {
-			if len(rules) > 1 {
-				sm.DeleteRule(ctx, subscription.Name, "$Default")
-			}
+		if existingRule.Name == DefaultRuleName && rule.Name != DefaultRuleName {
+			logger.LogHighlight("Subscription %v still has the %v rule and will keep receiving every message, use %v to remove it", log.Warning, subscriptionName, DefaultRuleName, "delete-rule --rule="+DefaultRuleName)
 		}
 	}
+
+	return nil
+}
+
+// DeleteSubscriptionRule Deletes a rule from an existing subscription
+func (s *ServiceBusCli) DeleteSubscriptionRule(topicName string, subscriptionName string, ruleName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	if _, err := s.getExistingSubscription(topicName, subscriptionName); err != nil {
+		return err
+	}
+
+	logger.LogHighlight("Removing rule %v from subscription %v on topic %v in service bus %v", log.Info, ruleName, subscriptionName, topicName, s.Broker.Name())
+	if err := s.Broker.DeleteRule(ctx, topicName, subscriptionName, ruleName); err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+
+	logger.LogHighlight("Rule %v was removed successfully from subscription %v on topic %v in service bus %v", log.Info, ruleName, subscriptionName, topicName, s.Broker.Name())
 	return nil
 }
 
+// ReplaceSubscriptionRules Replaces all the rules of an existing subscription, the default rule is
+// only kept if it is one of the rules
+func (s *ServiceBusCli) ReplaceSubscriptionRules(topicName string, subscriptionName string, rules []RuleEntity) error {
+	if _, err := s.getExistingSubscription(topicName, subscriptionName); err != nil {
+		return err
+	}
+
+	subscription := NewSubscription(topicName, subscriptionName)
+	subscription.Rules = rules
+	if err := s.SetSubscriptionRules(subscription); err != nil {
+		return err
+	}
+
+	logger.LogHighlight("Rules of subscription %v were replaced successfully on topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+	return nil
+}
+
+// PrintRule Prints a subscription rule filter and action
+func PrintRule(rule RuleEntity) {
+	if rule.CorrelationFilter != nil {
+		logger.LogHighlight("Rule: %v (correlation filter)", log.Info, rule.Name)
+		logger.Info("  Filter: %v", rule.CorrelationFilter.String())
+	} else {
+		logger.LogHighlight("Rule: %v (sql filter)", log.Info, rule.Name)
+		logger.Info("  Filter: %v", rule.filterExpression())
+	}
+	if rule.SQLAction != "" {
+		logger.Info("  Action: %v", rule.SQLAction)
+	}
+}
+
+// getExistingSubscription gets a subscription logging an error if the topic or the subscription
+// do not exist
+func (s *ServiceBusCli) getExistingSubscription(topicName string, subscriptionName string) (*servicebus.SubscriptionEntity, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError := errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
+		return nil, commonError
+	}
+
+	subscription, err := s.Broker.GetSubscription(ctx, topicName, subscriptionName)
+	if err != nil || subscription == nil {
+		commonError := errors.New("Subscription " + subscriptionName + " was not found on " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Subscription %v was not found on %v in service bus %v", log.Error, subscriptionName, topicName, s.Broker.Name())
+		return nil, commonError
+	}
+
+	return subscription, nil
+}
+
 // DeleteSubscription Deletes a subscription from a topic in the service bus
 func (s *ServiceBusCli) DeleteSubscription(topicName string, subscriptionName string) error {
 	var commonError error
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	logger.LogHighlight("Removing subscription %v from topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Namespace.Name)
-	topic := s.GetTopic(topicName)
-	if topic == nil {
-		commonError = errors.New("Could not find topic " + topicName + " in service bus" + s.Namespace.Name)
-		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Namespace.Name)
+	logger.LogHighlight("Removing subscription %v from topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
 		return commonError
 	}
-	sm := topic.NewSubscriptionManager()
-	err := sm.Delete(ctx, subscriptionName)
+	err = s.Broker.DeleteSubscription(ctx, topicName, subscriptionName)
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
-	logger.LogHighlight("Subscription %v was removed successfully from topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Namespace.Name)
+	logger.LogHighlight("Subscription %v was removed successfully from topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
 	return nil
 }
 
@@ -328,21 +553,23 @@ func (s *ServiceBusCli) DeleteSubscription(topicName string, subscriptionName st
 func (s *ServiceBusCli) SubscribeToTopic(topicName string, subscriptionName string) error {
 	var commonError error
 
-	var concurrentHandler servicebus.HandlerFunc = func(ctx context.Context, msg *servicebus.Message) error {
+	var concurrentHandler MessageHandler = func(ctx context.Context, msg *ReceivedMessage) error {
 		logger.LogHighlight("%v Received message %v from topic %v on subscription %v with label %v", log.Info, msg.SystemProperties.EnqueuedTime.String(), msg.ID, topicName, subscriptionName, msg.Label)
+		if s.Consumer != nil {
+			return s.consumeMessage(ctx, SubscriptionEntityPath(topicName, subscriptionName), msg)
+		}
+		s.printMutex.Lock()
 		logger.Info("User Properties:")
 		jsonString, _ := json.MarshalIndent(msg.UserProperties, "", "  ")
 		fmt.Println(string(jsonString))
 		logger.Info("Message Body:")
-		fmt.Println(string(msg.Data))
+		fmt.Println(FormatMessageBody(msg.ContentType, msg.Data))
+		s.printMutex.Unlock()
 
-		if !s.Peek {
-			return msg.Complete(ctx)
-		}
-		return nil
+		return s.settleMessage(ctx, msg)
 	}
 
-	logger.LogHighlight("Subscribing to %v on topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Namespace.Name)
+	logger.LogHighlight("Subscribing to %v on topic %v in service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
 	if topicName == "" {
 		commonError = errors.New("Topic " + topicName + " cannot be null")
 		logger.LogHighlight("Topic %v cannot be null", log.Info, topicName)
@@ -352,19 +579,18 @@ func (s *ServiceBusCli) SubscribeToTopic(topicName string, subscriptionName stri
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	topic := s.GetTopic(topicName)
-	if topic == nil {
-		commonError = errors.New("Could not find topic " + topicName + " in service bus" + s.Namespace.Name)
-		logger.LogHighlight("Could not find topic %v in service bus %v", log.Info, topicName, s.Namespace.Name)
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Info, topicName, s.Broker.Name())
 		return commonError
 	}
-	s.ActiveTopic = topic
+	s.ActiveTopic = topicName
 
 	foundSubscription := false
-	sm := topic.NewSubscriptionManager()
-	subscriptions, subscriptionsErr := sm.List(ctx)
+	subscriptions, subscriptionsErr := s.Broker.ListSubscriptions(ctx, topicName)
 	if subscriptionsErr != nil {
-		logger.LogHighlight("There was an error getting the list of subscriptions on %v in service bus %v", log.Warning, topicName, s.Namespace.Name)
+		logger.LogHighlight("There was an error getting the list of subscriptions on %v in service bus %v", log.Warning, topicName, s.Broker.Name())
 	}
 
 	for _, subscription := range subscriptions {
@@ -377,7 +603,7 @@ func (s *ServiceBusCli) SubscribeToTopic(topicName string, subscriptionName stri
 	if !foundSubscription {
 		if subscriptionName == "wiretap" {
 			s.DeleteWiretap = true
-			logger.LogHighlight("Wiretap subscription not found on %v in service bus %v, creating...", log.Warning, topicName, s.Namespace.Name)
+			logger.LogHighlight("Wiretap subscription not found on %v in service bus %v, creating...", log.Warning, topicName, s.Broker.Name())
 			wiretapSubscription := NewSubscription(topicName, "wiretap")
 			err := s.CreateSubscription(wiretapSubscription)
 			if err != nil {
@@ -386,33 +612,49 @@ func (s *ServiceBusCli) SubscribeToTopic(topicName string, subscriptionName stri
 			}
 
 		} else {
-			commonError := errors.New("Subscription " + subscriptionName + " was not found on " + topicName + " in service bus" + s.Namespace.Name)
-			logger.LogHighlight("Subscription %v was not found on %v in service bus %v", log.Error, subscriptionName, topicName, s.Namespace.Name)
+			commonError := errors.New("Subscription " + subscriptionName + " was not found on " + topicName + " in service bus " + s.Broker.Name())
+			logger.LogHighlight("Subscription %v was not found on %v in service bus %v", log.Error, subscriptionName, topicName, s.Broker.Name())
 			return commonError
 		}
 	}
 
-	subscription, err := topic.NewSubscription(subscriptionName)
-	s.ActiveSubscription = subscription
+	s.ActiveSubscription = subscriptionName
 
+	limiter, err := s.newMessageLimiter(SubscriptionEntityPath(topicName, subscriptionName), subscriptionName == "wiretap", func() {
+		select {
+		case s.CloseTopicListener <- true:
+		default:
+		}
+	})
 	if err != nil {
-		commonError := errors.New("Subscription " + subscriptionName + " was not found on topic " + topicName + " in service bus" + s.Namespace.Name)
-		logger.LogHighlight("Subscription %v was not found on %v in service bus %v", log.Error, subscriptionName, topicName, s.Namespace.Name)
-		return commonError
+		logger.Error(err.Error())
+		return err
 	}
+	defer limiter.close()
+	concurrentHandler = limiter.wrap(concurrentHandler)
 
-	logger.LogHighlight("Starting to receive messages in %v on topic %v for service bus %v", log.Info, subscriptionName, topicName, s.Namespace.Name)
-	receiver, err := subscription.NewReceiver(ctx)
+	if (s.UseSessions || s.SessionID != "") && !s.peeksMessages() {
+		logger.LogHighlight("Starting to receive sessions in %v on topic %v for service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+		s.stopTopicListener = cancel
+		s.listenToSessionsConcurrently(ctx, SubscriptionEntityPath(topicName, subscriptionName), concurrentHandler)
+	} else {
+		logger.LogHighlight("Starting to receive messages in %v on topic %v for service bus %v", log.Info, subscriptionName, topicName, s.Broker.Name())
+		receiver, err := s.newListener(ctx, SubscriptionEntityPath(topicName, subscriptionName))
 
-	if err != nil {
-		commonError := errors.New("Could not create channel for subscription " + subscriptionName + " on " + topicName + " in " + s.Namespace.Name + " bus, subscription was not found")
-		logger.LogHighlight("Could not create channel for subscription %v on topic %v for service bus %v, subscription was not found", log.Info, subscriptionName, topicName, s.Namespace.Name)
-		return commonError
-	}
+		if err != nil {
+			commonError := errors.New("Could not create channel for subscription " + subscriptionName + " on " + topicName + " in " + s.Broker.Name() + " bus, subscription was not found")
+			logger.LogHighlight("Could not create channel for subscription %v on topic %v for service bus %v, subscription was not found", log.Info, subscriptionName, topicName, s.Broker.Name())
+			return commonError
+		}
 
-	listenerHandler := receiver.Listen(ctx, concurrentHandler)
-	s.ActiveTopicListenerHandle = listenerHandler
-	defer listenerHandler.Close(ctx)
+		s.ActiveTopicReceiver = receiver
+		s.stopTopicListener = cancel
+		go func() {
+			if err := receiver.Listen(ctx, s.withLockRenewal(concurrentHandler)); err != nil {
+				logger.Error(err.Error())
+			}
+		}()
+	}
 
 	if <-s.CloseTopicListener {
 		s.CloseTopicSubscription()
@@ -422,16 +664,20 @@ func (s *ServiceBusCli) SubscribeToTopic(topicName string, subscriptionName stri
 
 // CloseTopicSubscription closes the subscription to a topic
 func (s *ServiceBusCli) CloseTopicSubscription() error {
-	logger.LogHighlight("Closing the subscription for %v on topic %v in service bus %v", log.Info, s.ActiveSubscription.Name, s.ActiveTopic.Name, s.Namespace.Name)
+	logger.LogHighlight("Closing the subscription for %v on topic %v in service bus %v", log.Info, s.ActiveSubscription, s.ActiveTopic, s.Broker.Name())
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	s.ActiveTopicListenerHandle.Close(ctx)
-	if s.DeleteWiretap && s.ActiveSubscription.Name == "wiretap" {
-		s.DeleteSubscription(s.ActiveTopic.Name, "wiretap")
+	s.stopTopicListener()
+	if s.ActiveTopicReceiver != nil {
+		s.ActiveTopicReceiver.Close(ctx)
+	}
+	if s.DeleteWiretap && s.ActiveSubscription == "wiretap" {
+		s.DeleteSubscription(s.ActiveTopic, "wiretap")
 	}
-	s.ActiveTopic = nil
-	s.ActiveTopicListenerHandle = nil
-	s.ActiveSubscription = nil
+	s.ActiveTopic = ""
+	s.ActiveTopicReceiver = nil
+	s.ActiveSubscription = ""
+	s.stopTopicListener = nil
 	s.CloseTopicListener <- false
 	return nil
 }
@@ -0,0 +1,359 @@
+package servicebuscli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// TopSort Enum
+type TopSort string
+
+// TopSort Enum definition, the backlog is the active and transfer messages waiting to be delivered
+const (
+	TopSortBacklog    TopSort = "backlog"
+	TopSortActive     TopSort = "active"
+	TopSortDeadLetter TopSort = "deadletter"
+	TopSortScheduled  TopSort = "scheduled"
+	TopSortTransfer   TopSort = "transfer"
+	TopSortRate       TopSort = "rate"
+	TopSortName       TopSort = "name"
+)
+
+// clearScreen moves the cursor to the top left corner and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// TopOptions structure
+type TopOptions struct {
+	// Interval is the pause between two refreshes
+	Interval time.Duration
+	Sort     TopSort
+	// Limit is the maximum number of entities shown, all of them are shown when it is not set
+	Limit int
+	// Iterations is the number of refreshes before returning, it refreshes until the context is done
+	// when it is not set
+	Iterations int
+	// Topic only shows the subscriptions of this topic and no queues when it is set
+	Topic string
+	// Clear clears the terminal before each refresh so the table is redrawn in place
+	Clear bool
+}
+
+// TopEntry structure, the message counts of a queue or subscription with their change since the
+// previous refresh, the rates are the change per second
+type TopEntry struct {
+	Type               string  `json:"type" yaml:"type"`
+	Name               string  `json:"name" yaml:"name"`
+	Topic              string  `json:"topic,omitempty" yaml:"topic,omitempty"`
+	ActiveMessages     int32   `json:"activeMessages" yaml:"activeMessages"`
+	DeadLetterMessages int32   `json:"deadLetterMessages" yaml:"deadLetterMessages"`
+	ScheduledMessages  int32   `json:"scheduledMessages" yaml:"scheduledMessages"`
+	TransferMessages   int32   `json:"transferMessages" yaml:"transferMessages"`
+	ActiveDelta        int32   `json:"activeDelta" yaml:"activeDelta"`
+	DeadLetterDelta    int32   `json:"deadLetterDelta" yaml:"deadLetterDelta"`
+	ScheduledDelta     int32   `json:"scheduledDelta" yaml:"scheduledDelta"`
+	TransferDelta      int32   `json:"transferDelta" yaml:"transferDelta"`
+	ActiveRate         float64 `json:"activeRate" yaml:"activeRate"`
+	DeadLetterRate     float64 `json:"deadLetterRate" yaml:"deadLetterRate"`
+	// seen is set when the entity was in the previous refresh so its deltas are meaningful
+	seen bool
+}
+
+var topEntryColumns = []string{"type", "name", "topic", "activeMessages", "deadLetterMessages", "scheduledMessages", "transferMessages", "activeDelta", "deadLetterDelta", "scheduledDelta", "transferDelta", "activeRate", "deadLetterRate"}
+
+// ParseTopSort Parses the sort order of the top command, it defaults to the backlog
+func ParseTopSort(value string) (TopSort, error) {
+	sortBy := TopSort(strings.ToLower(strings.TrimSpace(value)))
+	switch sortBy {
+	case "":
+		return TopSortBacklog, nil
+	case TopSortBacklog, TopSortActive, TopSortDeadLetter, TopSortScheduled, TopSortTransfer, TopSortRate, TopSortName:
+		return sortBy, nil
+	}
+
+	return TopSortBacklog, errors.New("Invalid sort order " + value + ", it needs to be one of backlog, active, deadletter, scheduled, transfer, rate or name")
+}
+
+// Backlog Gets the active and transfer messages waiting to be delivered
+func (e TopEntry) Backlog() int32 {
+	return e.ActiveMessages + e.TransferMessages
+}
+
+// Path Gets the name of the queue, or the topic and name of the subscription
+func (e TopEntry) Path() string {
+	if e.Topic != "" {
+		return e.Topic + "/" + e.Name
+	}
+
+	return e.Name
+}
+
+// Top Polls the message counts of the queues and of the subscriptions of every topic and writes them as
+// a table refreshed every interval with the change since the previous refresh, structured formats write
+// the entries of every refresh instead, a failed refresh is reported and the next one is attempted
+func (s *ServiceBusCli) Top(ctx context.Context, w io.Writer, format OutputFormat, options TopOptions) error {
+	if options.Interval <= 0 {
+		options.Interval = 5 * time.Second
+	}
+	if options.Sort == "" {
+		options.Sort = TopSortBacklog
+	}
+
+	// the log and table formats show the dashboard, the other formats write the entries of every refresh
+	dashboard := format == OutputLog || format == OutputTable
+	previous := make(map[string]TopEntry)
+	var previousAt time.Time
+	var entries []TopEntry
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	for refresh := 1; ; refresh++ {
+		polledAt := time.Now()
+		current, err := s.pollTopEntries(ctx, options.Topic)
+		if err != nil && refresh == 1 {
+			logger.Error(err.Error())
+			return err
+		}
+
+		if err == nil {
+			elapsed := polledAt.Sub(previousAt).Seconds()
+			for i := range current {
+				current[i].setChange(previous, elapsed)
+			}
+			sortTopEntries(current, options.Sort)
+
+			previous = make(map[string]TopEntry, len(current))
+			for _, entry := range current {
+				previous[entry.Type+":"+strings.ToLower(entry.Path())] = entry
+			}
+			previousAt = polledAt
+			entries = current
+		}
+
+		if dashboard {
+			if options.Clear {
+				fmt.Fprint(w, clearScreen)
+			}
+			s.writeTopDashboard(w, refresh, polledAt, options, entries, err)
+		} else if err == nil {
+			if writeErr := WriteTopEntries(w, format, limitTopEntries(entries, options.Limit)); writeErr != nil {
+				return writeErr
+			}
+		}
+
+		if options.Iterations > 0 && refresh >= options.Iterations {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteTopEntries Writes the entries of a top refresh as json, yaml, a table or csv
+func WriteTopEntries(w io.Writer, format OutputFormat, entries []TopEntry) error {
+	rows := make([][]string, 0, len(entries))
+	for _, entry := range entries {
+		rows = append(rows, []string{
+			entry.Type,
+			entry.Name,
+			entry.Topic,
+			fmt.Sprint(entry.ActiveMessages),
+			fmt.Sprint(entry.DeadLetterMessages),
+			fmt.Sprint(entry.ScheduledMessages),
+			fmt.Sprint(entry.TransferMessages),
+			fmt.Sprint(entry.ActiveDelta),
+			fmt.Sprint(entry.DeadLetterDelta),
+			fmt.Sprint(entry.ScheduledDelta),
+			fmt.Sprint(entry.TransferDelta),
+			fmt.Sprintf("%.2f", entry.ActiveRate),
+			fmt.Sprintf("%.2f", entry.DeadLetterRate),
+		})
+	}
+
+	return writeOutput(w, format, entries, topEntryColumns, rows)
+}
+
+// pollTopEntries lists the queues and the subscriptions of every topic with the broker directly, so the
+// refreshes do not log every listing
+func (s *ServiceBusCli) pollTopEntries(ctx context.Context, topicName string) ([]TopEntry, error) {
+	pollCtx, cancel := context.WithTimeout(ctx, 40*time.Second)
+	defer cancel()
+
+	result := make([]TopEntry, 0)
+	topicNames := []string{topicName}
+	if topicName == "" {
+		queues, err := s.Broker.ListQueues(pollCtx)
+		if err != nil {
+			return nil, err
+		}
+		for _, queue := range queues {
+			result = append(result, newTopEntry(NewQueueSummary(queue)))
+		}
+
+		topics, err := s.Broker.ListTopics(pollCtx)
+		if err != nil {
+			return nil, err
+		}
+		topicNames = make([]string, 0, len(topics))
+		for _, topic := range topics {
+			topicNames = append(topicNames, topic.Name)
+		}
+	}
+
+	for _, name := range topicNames {
+		subscriptions, err := s.Broker.ListSubscriptions(pollCtx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, subscription := range subscriptions {
+			result = append(result, newTopEntry(NewSubscriptionSummary(name, subscription)))
+		}
+	}
+
+	return result, nil
+}
+
+// writeTopDashboard writes the header with the totals of every entity and the table of a refresh, only
+// the limit of entities is shown in the table and the deltas of the entities that were not in the
+// previous refresh are not shown
+func (s *ServiceBusCli) writeTopDashboard(w io.Writer, refresh int, polledAt time.Time, options TopOptions, entries []TopEntry, err error) {
+	fmt.Fprintf(w, "servicebus top - %v - every %v - %v (refresh %v)\n", s.Broker.Name(), options.Interval, polledAt.Format("15:04:05"), refresh)
+	if err != nil {
+		fmt.Fprintf(w, "Refresh failed, showing the previous counts: %v\n", err.Error())
+	}
+
+	var total TopEntry
+	queues, subscriptions := 0, 0
+	for _, entry := range entries {
+		if entry.Type == "queue" {
+			queues++
+		} else {
+			subscriptions++
+		}
+		total.ActiveMessages += entry.ActiveMessages
+		total.DeadLetterMessages += entry.DeadLetterMessages
+		total.ScheduledMessages += entry.ScheduledMessages
+		total.TransferMessages += entry.TransferMessages
+		total.ActiveDelta += entry.ActiveDelta
+		total.DeadLetterDelta += entry.DeadLetterDelta
+		total.ActiveRate += entry.ActiveRate
+		total.DeadLetterRate += entry.DeadLetterRate
+	}
+	rows := limitTopEntries(entries, options.Limit)
+	shown := ""
+	if len(rows) < len(entries) {
+		shown = fmt.Sprintf(", showing the first %v", len(rows))
+	}
+	fmt.Fprintf(w, "%v queues, %v subscriptions, sorted by %v%v\n", queues, subscriptions, options.Sort, shown)
+	fmt.Fprintf(w, "Active %v (%v, %.1f/s)  Dead letter %v (%v, %.1f/s)  Scheduled %v  Transfer %v\n\n",
+		total.ActiveMessages, formatTopDelta(total.ActiveDelta, refresh > 1), total.ActiveRate,
+		total.DeadLetterMessages, formatTopDelta(total.DeadLetterDelta, refresh > 1), total.DeadLetterRate,
+		total.ScheduledMessages, total.TransferMessages)
+
+	writer := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "ENTITY\tTYPE\tACTIVE\t+/-\tRATE/S\tDEADLETTER\t+/-\tRATE/S\tSCHEDULED\t+/-\tTRANSFER\t+/-")
+	for _, entry := range rows {
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			entry.Path(), entry.Type,
+			entry.ActiveMessages, formatTopDelta(entry.ActiveDelta, entry.seen), formatTopRate(entry.ActiveRate, entry.seen),
+			entry.DeadLetterMessages, formatTopDelta(entry.DeadLetterDelta, entry.seen), formatTopRate(entry.DeadLetterRate, entry.seen),
+			entry.ScheduledMessages, formatTopDelta(entry.ScheduledDelta, entry.seen),
+			entry.TransferMessages, formatTopDelta(entry.TransferDelta, entry.seen))
+	}
+	writer.Flush()
+}
+
+func newTopEntry(summary EntitySummary) TopEntry {
+	return TopEntry{
+		Type:               summary.Type,
+		Name:               summary.Name,
+		Topic:              summary.Topic,
+		ActiveMessages:     summary.ActiveMessages,
+		DeadLetterMessages: summary.DeadLetterMessages,
+		ScheduledMessages:  summary.ScheduledMessages,
+		TransferMessages:   summary.TransferMessages + summary.TransferDeadLetterMessages,
+	}
+}
+
+// setChange sets the deltas and rates of the entry from its counts in the previous refresh
+func (e *TopEntry) setChange(previous map[string]TopEntry, elapsed float64) {
+	before, ok := previous[e.Type+":"+strings.ToLower(e.Path())]
+	if !ok {
+		return
+	}
+
+	e.seen = true
+	e.ActiveDelta = e.ActiveMessages - before.ActiveMessages
+	e.DeadLetterDelta = e.DeadLetterMessages - before.DeadLetterMessages
+	e.ScheduledDelta = e.ScheduledMessages - before.ScheduledMessages
+	e.TransferDelta = e.TransferMessages - before.TransferMessages
+	if elapsed > 0 {
+		e.ActiveRate = float64(e.ActiveDelta) / elapsed
+		e.DeadLetterRate = float64(e.DeadLetterDelta) / elapsed
+	}
+}
+
+// sortTopEntries sorts the entries by the chosen count from the highest, ties and the name order are
+// sorted by the entity path
+func sortTopEntries(entries []TopEntry, sortBy TopSort) {
+	value := func(entry TopEntry) float64 {
+		switch sortBy {
+		case TopSortActive:
+			return float64(entry.ActiveMessages)
+		case TopSortDeadLetter:
+			return float64(entry.DeadLetterMessages)
+		case TopSortScheduled:
+			return float64(entry.ScheduledMessages)
+		case TopSortTransfer:
+			return float64(entry.TransferMessages)
+		case TopSortRate:
+			return entry.ActiveRate
+		case TopSortName:
+			return 0
+		}
+		return float64(entry.Backlog())
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if value(entries[i]) != value(entries[j]) {
+			return value(entries[i]) > value(entries[j])
+		}
+		return strings.ToLower(entries[i].Path()) < strings.ToLower(entries[j].Path())
+	})
+}
+
+func limitTopEntries(entries []TopEntry, limit int) []TopEntry {
+	if limit > 0 && len(entries) > limit {
+		return entries[:limit]
+	}
+
+	return entries
+}
+
+func formatTopDelta(delta int32, seen bool) string {
+	if !seen {
+		return "-"
+	}
+	if delta > 0 {
+		return "+" + fmt.Sprint(delta)
+	}
+
+	return fmt.Sprint(delta)
+}
+
+func formatTopRate(rate float64, seen bool) string {
+	if !seen {
+		return "-"
+	}
+
+	return fmt.Sprintf("%.1f", rate)
+}
@@ -0,0 +1,51 @@
+package servicebuscli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+)
+
+func TestTopDashboardTotalsIgnoreTheLimit(t *testing.T) {
+	sbcli := newMemoryServiceBusCli(t)
+	for i := 1; i <= 3; i++ {
+		name := fmt.Sprintf("queue-%v", i)
+		if err := sbcli.CreateQueue(NewQueue(name)); err != nil {
+			t.Fatalf("CreateQueue(%v) error = %v", name, err)
+		}
+		for j := 0; j < i; j++ {
+			if err := sbcli.Broker.Send(context.Background(), name, servicebus.NewMessageFromString("message")); err != nil {
+				t.Fatalf("Send(%v) error = %v", name, err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		format OutputFormat
+	}{
+		{"log", OutputLog},
+		{"table", OutputTable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			if err := sbcli.Top(context.Background(), &output, test.format, TopOptions{Limit: 1, Iterations: 1}); err != nil {
+				t.Fatalf("Top() error = %v", err)
+			}
+
+			dashboard := output.String()
+			if !strings.Contains(dashboard, "3 queues, 0 subscriptions") || !strings.Contains(dashboard, "Active 6 ") {
+				t.Errorf("the totals do not cover every queue:\n%v", dashboard)
+			}
+			if !strings.Contains(dashboard, "queue-3") || strings.Contains(dashboard, "queue-1") {
+				t.Errorf("the table does not only show the biggest backlog:\n%v", dashboard)
+			}
+		})
+	}
+}
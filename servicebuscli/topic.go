@@ -2,74 +2,71 @@ package servicebuscli
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
-	"os"
+	"fmt"
 	"time"
 
 	servicebus "github.com/Azure/azure-service-bus-go"
 	"github.com/cjlapao/common-go/log"
-	"github.com/fatih/color"
 )
 
-// GetTopicManager creates a servicebus topic manager
-func (s *ServiceBusCli) GetTopicManager() *servicebus.TopicManager {
-	logger.Trace("Creating a service bus topic manager")
-	if s.Namespace == nil {
-		_, err := s.GetNamespace()
-		if err != nil {
-			return nil
-		}
-	}
-
-	s.TopicManager = s.Namespace.NewTopicManager()
-	return s.TopicManager
+// TopicEntity structure
+type TopicEntity struct {
+	Name                     string
+	DefaultMessageTimeToLive time.Duration
+	AutoDeleteOnIdle         time.Duration
+	MaxSizeInMegabytes       int32
+	// DuplicateDetectionWindow enables the duplicate detection when it is set, it can only be set
+	// when the topic is created
+	DuplicateDetectionWindow time.Duration
+	EnablePartitioning       bool
+	SupportOrdering          bool
 }
 
-// GetTopic Gets a topic from the service bus
-func (s *ServiceBusCli) GetTopic(name string) *servicebus.Topic {
-	logger.Trace("Getting a topic " + color.HiCyanString(name) + " entity in service bus " + color.HiYellowString(s.Namespace.Name))
-	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
-	defer cancel()
-	if name == "" {
-		return nil
-	}
-
-	if s.TopicManager == nil {
-		s.GetTopicManager()
+// NewTopic Creates a topic entity
+func NewTopic(name string) TopicEntity {
+	return TopicEntity{
+		Name: name,
 	}
+}
 
-	te, err := s.TopicManager.Get(ctx, name)
-	if err != nil {
-		logger.Error(err.Error())
-		return nil
+// GetChanges Gets the properties that are different between the topic entity and an existing
+// service bus topic, properties not set in the topic entity are ignored
+func (t *TopicEntity) GetChanges(existing *servicebus.TopicEntity) []PropertyChange {
+	changes := make([]PropertyChange, 0)
+	if existing == nil || existing.TopicDescription == nil {
+		return changes
 	}
 
-	topic, err := s.Namespace.NewTopic(te.Name)
+	changes = compareDuration(changes, "default message time to live", existing.DefaultMessageTimeToLive, t.DefaultMessageTimeToLive)
+	changes = compareDuration(changes, "auto delete on idle", existing.AutoDeleteOnIdle, t.AutoDeleteOnIdle)
 
-	return topic
+	return changes
 }
 
 // ListTopics Lists all the topics in a service bus
 func (s *ServiceBusCli) ListTopics() ([]*servicebus.TopicEntity, error) {
-	logger.LogHighlight("Getting all topics in %v service bus", log.Info, s.Namespace.Name)
+	logger.LogHighlight("Getting all topics in %v service bus", log.Info, s.Broker.Name())
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
 
-	if s.TopicManager == nil {
-		tm := s.GetTopicManager()
-		if tm == nil {
-			return nil, errors.New("There was an error getting the topic manager")
-		}
-	}
-
-	return s.TopicManager.List(ctx)
+	return s.Broker.ListTopics(ctx)
 }
 
-// SendTopicMessage sends a message to a specific topic
+// SendTopicMessage Sends a Service Bus Message to a Topic
 func (s *ServiceBusCli) SendTopicMessage(topicName string, message map[string]interface{}, label string, userParameters map[string]interface{}) error {
+	return s.SendTopicMessageEntity(topicName, MessageEntity{
+		Label:      label,
+		Message:    message,
+		Properties: userParameters,
+	})
+}
+
+// SendTopicMessageEntity Sends a message entity to a Topic, keeping its id, correlation and session,
+// if the message has a scheduled time it is scheduled instead and its sequence number is logged
+func (s *ServiceBusCli) SendTopicMessageEntity(topicName string, message MessageEntity) error {
 	var commonError error
-	logger.LogHighlight("Sending a service bus topic message to %v topic in service bus %v", log.Info, topicName, s.Namespace.Name)
+	logger.LogHighlight("Sending a service bus topic message to %v topic in service bus %v", log.Info, topicName, s.Broker.Name())
 	if topicName == "" {
 		commonError = errors.New("Topic cannot be null")
 		logger.Error(commonError.Error())
@@ -79,60 +76,96 @@ func (s *ServiceBusCli) SendTopicMessage(topicName string, message map[string]in
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	topic := s.GetTopic(topicName)
-	if topic == nil {
-		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Namespace.Name)
-		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Namespace.Name)
+	topic, err := s.Broker.GetTopic(ctx, topicName)
+	if err != nil || topic == nil {
+		commonError = errors.New("Could not find topic " + topicName + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topicName, s.Broker.Name())
 		return commonError
 	}
 
-	messageData, err := json.MarshalIndent(message, "", "  ")
+	sbMessage, err := message.ToServiceBusMessage()
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
 
-	sbMessage := servicebus.Message{
-		Data:           messageData,
-		UserProperties: userParameters,
-	}
+	if message.ScheduledAt != nil {
+		sequenceNumber, err := s.Broker.Schedule(ctx, topicName, sbMessage, *message.ScheduledAt)
+		if err != nil {
+			logger.Error(err.Error())
+			return err
+		}
 
-	if label != "" {
-		sbMessage.Label = label
-	}
+		logger.LogHighlight("Service bus topic message was scheduled successfully to %v topic in service bus %v", log.Info, topicName, s.Broker.Name())
+		logger.LogHighlight("Scheduled at: %v, sequence number: %v", log.Info, message.ScheduledAt.UTC().Format(time.RFC3339), fmt.Sprint(sequenceNumber))
+	} else {
+		err = s.Broker.Send(ctx, topicName, sbMessage)
 
-	err = topic.Send(ctx, &sbMessage)
+		if err != nil {
+			logger.Error(err.Error())
+			return err
+		}
 
-	if err != nil {
-		logger.Error(err.Error())
-		os.Exit(1)
+		logger.LogHighlight("Service bus topic message was sent successfully to %v topic in service bus %v", log.Info, topicName, s.Broker.Name())
+	}
+	if message.SessionID != "" {
+		logger.LogHighlight("Session: %v", log.Info, message.SessionID)
 	}
-
-	logger.LogHighlight("Service bus topic message was sent successfully to %v topic in service bus %v", log.Info, topicName, s.Namespace.Name)
 	logger.Info("Message:")
-	logger.Info(string(messageData))
+	fmt.Println(FormatMessageBody(sbMessage.ContentType, sbMessage.Data))
 	return nil
 }
 
 // CreateTopic Creates a topic in the service bus namespace
-func (s *ServiceBusCli) CreateTopic(topicName string) error {
+func (s *ServiceBusCli) CreateTopic(topic TopicEntity) error {
 	var commonError error
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	if topicName == "" {
+	if topic.Name == "" {
 		commonError = errors.New("Topic cannot be null")
 		logger.Error(commonError.Error())
 		return commonError
 	}
-	logger.LogHighlight("Creating topic %v in service bus %v", log.Info, topicName, s.Namespace.Name)
+	logger.LogHighlight("Creating topic %v in service bus %v", log.Info, topic.Name, s.Broker.Name())
+
+	err := s.Broker.CreateTopic(ctx, topic)
+	if err != nil {
+		logger.Error(err.Error())
+		return err
+	}
+	logger.LogHighlight("Topic %v was created successfully in service bus %v", log.Info, topic.Name, s.Broker.Name())
+	return nil
+}
+
+// UpdateTopic Updates an existing topic in the service bus namespace, only the properties set in the
+// topic entity are changed and the changes are printed before being applied
+func (s *ServiceBusCli) UpdateTopic(topic TopicEntity) error {
+	var commonError error
+	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
+	defer cancel()
+	logger.LogHighlight("Updating topic %v in service bus %v", log.Info, topic.Name, s.Broker.Name())
+
+	existingTopic, err := s.Broker.GetTopic(ctx, topic.Name)
+	if err != nil || existingTopic == nil {
+		commonError = errors.New("Could not find topic " + topic.Name + " in service bus " + s.Broker.Name())
+		logger.LogHighlight("Could not find topic %v in service bus %v", log.Error, topic.Name, s.Broker.Name())
+		return commonError
+	}
+
+	changes := topic.GetChanges(existingTopic)
+	if len(changes) == 0 {
+		logger.LogHighlight("Topic %v is already up to date in service bus %v", log.Info, topic.Name, s.Broker.Name())
+		return nil
+	}
+	printPropertyChanges(changes)
 
-	tm := s.GetTopicManager()
-	_, err := tm.Put(ctx, topicName)
+	err = s.Broker.UpdateTopic(ctx, topic)
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
-	logger.LogHighlight("Topic %v was created successfully in service bus %v", log.Info, topicName, s.Namespace.Name)
+
+	logger.LogHighlight("Topic %v was updated successfully in service bus %v", log.Info, topic.Name, s.Broker.Name())
 	return nil
 }
 
@@ -147,14 +180,12 @@ func (s *ServiceBusCli) DeleteTopic(topicName string) error {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 40*time.Second)
 	defer cancel()
-	logger.LogHighlight("Removing topic %v in service bus %v", log.Info, topicName, s.Namespace.Name)
-	tm := s.GetTopicManager()
-
-	err := tm.Delete(ctx, topicName)
+	logger.LogHighlight("Removing topic %v in service bus %v", log.Info, topicName, s.Broker.Name())
+	err := s.Broker.DeleteTopic(ctx, topicName)
 	if err != nil {
 		logger.Error(err.Error())
 		return err
 	}
-	logger.LogHighlight("Topic %v was removed successfully from service bus %v", log.Info, topicName, s.Namespace.Name)
+	logger.LogHighlight("Topic %v was removed successfully from service bus %v", log.Info, topicName, s.Broker.Name())
 	return nil
 }
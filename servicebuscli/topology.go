@@ -0,0 +1,706 @@
+package servicebuscli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	servicebus "github.com/Azure/azure-service-bus-go"
+	"github.com/cjlapao/common-go/log"
+	"gopkg.in/yaml.v2"
+)
+
+// TopologyChangeAction Enum
+type TopologyChangeAction int
+
+// TopologyChangeAction Enum definition
+const (
+	TopologyCreate TopologyChangeAction = iota
+	TopologyUpdate
+	TopologyDelete
+)
+
+// TopologyEntity structure
+type TopologyEntity struct {
+	Topics []TopologyTopicEntity `json:"topics,omitempty" yaml:"topics,omitempty"`
+	Queues []TopologyQueueEntity `json:"queues,omitempty" yaml:"queues,omitempty"`
+	// live is set when the topology was read from the namespace, its subscriptions list all of their
+	// rules while the ones of a file without rules leave them unmanaged
+	live bool
+}
+
+// TopologyTopicEntity structure
+type TopologyTopicEntity struct {
+	Name          string                       `json:"name" yaml:"name"`
+	Subscriptions []TopologySubscriptionEntity `json:"subscriptions,omitempty" yaml:"subscriptions,omitempty"`
+}
+
+// TopologySubscriptionEntity structure
+type TopologySubscriptionEntity struct {
+	Name                     string               `json:"name" yaml:"name"`
+	LockDuration             string               `json:"lockDuration,omitempty" yaml:"lockDuration,omitempty"`
+	DefaultMessageTimeToLive string               `json:"defaultMessageTimeToLive,omitempty" yaml:"defaultMessageTimeToLive,omitempty"`
+	AutoDeleteOnIdle         string               `json:"autoDeleteOnIdle,omitempty" yaml:"autoDeleteOnIdle,omitempty"`
+	MaxDeliveryCount         int32                `json:"maxDeliveryCount,omitempty" yaml:"maxDeliveryCount,omitempty"`
+	ForwardTo                string               `json:"forwardTo,omitempty" yaml:"forwardTo,omitempty"`
+	ForwardDeadLetterTo      string               `json:"forwardDeadLetterTo,omitempty" yaml:"forwardDeadLetterTo,omitempty"`
+	RequiresSession          bool                 `json:"requiresSession,omitempty" yaml:"requiresSession,omitempty"`
+	Rules                    []TopologyRuleEntity `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+// TopologyRuleEntity structure
+type TopologyRuleEntity struct {
+	Name              string                           `json:"name" yaml:"name"`
+	SQLFilter         string                           `json:"sqlFilter,omitempty" yaml:"sqlFilter,omitempty"`
+	SQLAction         string                           `json:"sqlAction,omitempty" yaml:"sqlAction,omitempty"`
+	CorrelationFilter *TopologyCorrelationFilterEntity `json:"correlationFilter,omitempty" yaml:"correlationFilter,omitempty"`
+}
+
+// TopologyCorrelationFilterEntity structure
+type TopologyCorrelationFilterEntity struct {
+	CorrelationID    string                 `json:"correlationId,omitempty" yaml:"correlationId,omitempty"`
+	MessageID        string                 `json:"messageId,omitempty" yaml:"messageId,omitempty"`
+	To               string                 `json:"to,omitempty" yaml:"to,omitempty"`
+	ReplyTo          string                 `json:"replyTo,omitempty" yaml:"replyTo,omitempty"`
+	Label            string                 `json:"label,omitempty" yaml:"label,omitempty"`
+	SessionID        string                 `json:"sessionId,omitempty" yaml:"sessionId,omitempty"`
+	ReplyToSessionID string                 `json:"replyToSessionId,omitempty" yaml:"replyToSessionId,omitempty"`
+	ContentType      string                 `json:"contentType,omitempty" yaml:"contentType,omitempty"`
+	Properties       map[string]interface{} `json:"properties,omitempty" yaml:"properties,omitempty"`
+}
+
+// TopologyQueueEntity structure
+type TopologyQueueEntity struct {
+	Name                     string `json:"name" yaml:"name"`
+	LockDuration             string `json:"lockDuration,omitempty" yaml:"lockDuration,omitempty"`
+	DefaultMessageTimeToLive string `json:"defaultMessageTimeToLive,omitempty" yaml:"defaultMessageTimeToLive,omitempty"`
+	AutoDeleteOnIdle         string `json:"autoDeleteOnIdle,omitempty" yaml:"autoDeleteOnIdle,omitempty"`
+	MaxDeliveryCount         int32  `json:"maxDeliveryCount,omitempty" yaml:"maxDeliveryCount,omitempty"`
+	ForwardTo                string `json:"forwardTo,omitempty" yaml:"forwardTo,omitempty"`
+	ForwardDeadLetterTo      string `json:"forwardDeadLetterTo,omitempty" yaml:"forwardDeadLetterTo,omitempty"`
+	RequiresSession          bool   `json:"requiresSession,omitempty" yaml:"requiresSession,omitempty"`
+}
+
+// TopologyChange structure
+type TopologyChange struct {
+	Action       TopologyChangeAction
+	Kind         string
+	Name         string
+	TopicName    string
+	Changes      []PropertyChange
+	RulesChanged bool
+	Topic        *TopicEntity
+	Queue        *QueueEntity
+	Subscription *SubscriptionEntity
+}
+
+// LoadTopology Loads a topology file, the format is chosen by the file extension defaulting to yaml
+func LoadTopology(filePath string) (*TopologyEntity, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var topology TopologyEntity
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		err = json.Unmarshal(content, &topology)
+	default:
+		err = yaml.Unmarshal(content, &topology)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &topology, topology.Validate()
+}
+
+// LoadTopologyRules Loads a file with a list of subscription rules in the topology format, the format is
+// chosen by the file extension defaulting to yaml
+func LoadTopologyRules(filePath string) ([]RuleEntity, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []TopologyRuleEntity
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		err = json.Unmarshal(content, &rules)
+	default:
+		err = yaml.Unmarshal(content, &rules)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]RuleEntity, 0)
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, errors.New("Rule name cannot be null in " + filePath)
+		}
+		result = append(result, rule.ToRuleEntity())
+	}
+
+	return result, nil
+}
+
+// Validate Validates the topology entities and their properties
+func (t *TopologyEntity) Validate() error {
+	names := make(map[string]bool)
+	for _, topic := range t.Topics {
+		if topic.Name == "" {
+			return errors.New("Topic name cannot be null")
+		}
+		if names["topic:"+strings.ToLower(topic.Name)] {
+			return errors.New("Topic " + topic.Name + " is defined more than once")
+		}
+		names["topic:"+strings.ToLower(topic.Name)] = true
+
+		for _, subscription := range topic.Subscriptions {
+			if subscription.Name == "" {
+				return errors.New("Subscription name cannot be null on topic " + topic.Name)
+			}
+			if names["subscription:"+strings.ToLower(topic.Name+"/"+subscription.Name)] {
+				return errors.New("Subscription " + subscription.Name + " is defined more than once on topic " + topic.Name)
+			}
+			names["subscription:"+strings.ToLower(topic.Name+"/"+subscription.Name)] = true
+
+			entity, err := subscription.ToSubscriptionEntity(topic.Name)
+			if err != nil {
+				return err
+			}
+			for _, rule := range entity.Rules {
+				if err := rule.Validate(); err != nil {
+					return errors.New(err.Error() + " in subscription " + subscription.Name + " on topic " + topic.Name)
+				}
+			}
+		}
+	}
+
+	for _, queue := range t.Queues {
+		if queue.Name == "" {
+			return errors.New("Queue name cannot be null")
+		}
+		if names["queue:"+strings.ToLower(queue.Name)] {
+			return errors.New("Queue " + queue.Name + " is defined more than once")
+		}
+		names["queue:"+strings.ToLower(queue.Name)] = true
+
+		if _, err := queue.ToQueueEntity(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ToQueueEntity Converts the topology queue into a queue entity
+func (t TopologyQueueEntity) ToQueueEntity() (QueueEntity, error) {
+	var err error
+	result := QueueEntity{
+		Name:             t.Name,
+		MaxDeliveryCount: t.MaxDeliveryCount,
+		RequiresSession:  t.RequiresSession,
+	}
+	result.Forward.In = ForwardToQueue
+	result.ForwardDeadLetter.In = ForwardToQueue
+
+	if result.LockDuration, err = parseTopologyDuration("queue "+t.Name+" lockDuration", t.LockDuration); err != nil {
+		return result, err
+	}
+	if result.DefaultMessageTimeToLive, err = parseTopologyDuration("queue "+t.Name+" defaultMessageTimeToLive", t.DefaultMessageTimeToLive); err != nil {
+		return result, err
+	}
+	if result.AutoDeleteOnIdle, err = parseTopologyDuration("queue "+t.Name+" autoDeleteOnIdle", t.AutoDeleteOnIdle); err != nil {
+		return result, err
+	}
+
+	result.MapMessageForwardFlag(t.ForwardTo)
+	result.MapDeadLetterForwardFlag(t.ForwardDeadLetterTo)
+
+	return result, nil
+}
+
+// ToSubscriptionEntity Converts the topology subscription into a subscription entity
+func (t TopologySubscriptionEntity) ToSubscriptionEntity(topicName string) (SubscriptionEntity, error) {
+	var err error
+	result := SubscriptionEntity{
+		Name:             t.Name,
+		TopicName:        topicName,
+		MaxDeliveryCount: t.MaxDeliveryCount,
+		RequiresSession:  t.RequiresSession,
+		Rules:            make([]RuleEntity, 0),
+	}
+	result.Forward.In = ForwardToTopic
+	result.ForwardDeadLetter.In = ForwardToTopic
+
+	if result.LockDuration, err = parseTopologyDuration("subscription "+t.Name+" lockDuration", t.LockDuration); err != nil {
+		return result, err
+	}
+	if result.DefaultMessageTimeToLive, err = parseTopologyDuration("subscription "+t.Name+" defaultMessageTimeToLive", t.DefaultMessageTimeToLive); err != nil {
+		return result, err
+	}
+	if result.AutoDeleteOnIdle, err = parseTopologyDuration("subscription "+t.Name+" autoDeleteOnIdle", t.AutoDeleteOnIdle); err != nil {
+		return result, err
+	}
+
+	result.MapMessageForwardFlag(t.ForwardTo)
+	result.MapDeadLetterForwardFlag(t.ForwardDeadLetterTo)
+
+	for _, rule := range t.Rules {
+		if rule.Name == "" {
+			return result, errors.New("Rule name cannot be null on subscription " + t.Name)
+		}
+		result.Rules = append(result.Rules, rule.ToRuleEntity())
+	}
+
+	return result, nil
+}
+
+// ToRuleEntity Converts the topology rule into a rule entity, rules without a filter accept every message
+func (t TopologyRuleEntity) ToRuleEntity() RuleEntity {
+	result := RuleEntity{
+		Name:      t.Name,
+		SQLFilter: t.SQLFilter,
+		SQLAction: t.SQLAction,
+	}
+
+	if t.CorrelationFilter != nil {
+		result.CorrelationFilter = &CorrelationFilterEntity{
+			CorrelationID:    t.CorrelationFilter.CorrelationID,
+			MessageID:        t.CorrelationFilter.MessageID,
+			To:               t.CorrelationFilter.To,
+			ReplyTo:          t.CorrelationFilter.ReplyTo,
+			Label:            t.CorrelationFilter.Label,
+			SessionID:        t.CorrelationFilter.SessionID,
+			ReplyToSessionID: t.CorrelationFilter.ReplyToSessionID,
+			ContentType:      t.CorrelationFilter.ContentType,
+			Properties:       t.CorrelationFilter.Properties,
+		}
+	} else if result.SQLFilter == "" {
+		result.SQLFilter = "1=1"
+	}
+
+	return result
+}
+
+// PlanTopology Compares the topology with the live namespace and returns the changes needed to converge,
+// entities that are not in the topology are only deleted if prune is set
+func (s *ServiceBusCli) PlanTopology(topology *TopologyEntity, prune bool) ([]TopologyChange, error) {
+	logger.LogHighlight("Planning topology changes for service bus %v", log.Info, s.Broker.Name())
+	changes := make([]TopologyChange, 0)
+
+	liveTopics, err := s.ListTopics()
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+	liveQueues, err := s.ListQueues()
+	if err != nil {
+		logger.Error(err.Error())
+		return nil, err
+	}
+
+	existingTopics := make(map[string]*servicebus.TopicEntity)
+	for _, topic := range liveTopics {
+		existingTopics[strings.ToLower(topic.Name)] = topic
+	}
+	existingQueues := make(map[string]*servicebus.QueueEntity)
+	for _, queue := range liveQueues {
+		existingQueues[strings.ToLower(queue.Name)] = queue
+	}
+
+	// Topics and their subscriptions
+	wantedTopics := make(map[string]bool)
+	for _, topic := range topology.Topics {
+		wantedTopics[strings.ToLower(topic.Name)] = true
+		_, topicExists := existingTopics[strings.ToLower(topic.Name)]
+		if !topicExists {
+			changes = append(changes, TopologyChange{Action: TopologyCreate, Kind: "topic", Name: topic.Name})
+		}
+
+		existingSubscriptions := make(map[string]*servicebus.SubscriptionEntity)
+		if topicExists {
+			liveSubscriptions, err := s.ListSubscriptions(topic.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, subscription := range liveSubscriptions {
+				existingSubscriptions[strings.ToLower(subscription.Name)] = subscription
+			}
+		}
+
+		wantedSubscriptions := make(map[string]bool)
+		for _, topologySubscription := range topic.Subscriptions {
+			subscription, _ := topologySubscription.ToSubscriptionEntity(topic.Name)
+			wantedSubscriptions[strings.ToLower(subscription.Name)] = true
+
+			existingSubscription, ok := existingSubscriptions[strings.ToLower(subscription.Name)]
+			if !ok {
+				changes = append(changes, TopologyChange{Action: TopologyCreate, Kind: "subscription", Name: subscription.Name, TopicName: topic.Name, Subscription: &subscription})
+				continue
+			}
+
+			propertyChanges := subscription.GetChanges(existingSubscription)
+			rulesChanged := false
+			if len(subscription.Rules) > 0 {
+				existingRules, err := s.ListSubscriptionRules(topic.Name, subscription.Name)
+				if err != nil {
+					return nil, err
+				}
+				ruleChanges := subscription.GetRuleChanges(existingRules)
+				rulesChanged = len(ruleChanges) > 0
+				propertyChanges = append(propertyChanges, ruleChanges...)
+			}
+
+			if len(propertyChanges) > 0 {
+				changes = append(changes, TopologyChange{Action: TopologyUpdate, Kind: "subscription", Name: subscription.Name, TopicName: topic.Name, Changes: propertyChanges, RulesChanged: rulesChanged, Subscription: &subscription})
+			}
+		}
+
+		if prune {
+			for _, existingSubscription := range existingSubscriptions {
+				// the wiretap subscription is owned by the subscribe command and removed on exit
+				if existingSubscription.Name == "wiretap" || wantedSubscriptions[strings.ToLower(existingSubscription.Name)] {
+					continue
+				}
+				changes = append(changes, TopologyChange{Action: TopologyDelete, Kind: "subscription", Name: existingSubscription.Name, TopicName: topic.Name})
+			}
+		}
+	}
+
+	// Queues
+	wantedQueues := make(map[string]bool)
+	for _, topologyQueue := range topology.Queues {
+		queue, _ := topologyQueue.ToQueueEntity()
+		wantedQueues[strings.ToLower(queue.Name)] = true
+
+		existingQueue, ok := existingQueues[strings.ToLower(queue.Name)]
+		if !ok {
+			changes = append(changes, TopologyChange{Action: TopologyCreate, Kind: "queue", Name: queue.Name, Queue: &queue})
+			continue
+		}
+
+		propertyChanges := queue.GetChanges(existingQueue)
+		if len(propertyChanges) > 0 {
+			changes = append(changes, TopologyChange{Action: TopologyUpdate, Kind: "queue", Name: queue.Name, Changes: propertyChanges, Queue: &queue})
+		}
+	}
+
+	if prune {
+		for _, existingTopic := range liveTopics {
+			if !wantedTopics[strings.ToLower(existingTopic.Name)] {
+				changes = append(changes, TopologyChange{Action: TopologyDelete, Kind: "topic", Name: existingTopic.Name})
+			}
+		}
+		for _, existingQueue := range liveQueues {
+			if !wantedQueues[strings.ToLower(existingQueue.Name)] {
+				changes = append(changes, TopologyChange{Action: TopologyDelete, Kind: "queue", Name: existingQueue.Name})
+			}
+		}
+	}
+
+	return sortTopologyChanges(changes), nil
+}
+
+// ApplyTopology Applies the planned changes to the namespace, stopping on the first error
+func (s *ServiceBusCli) ApplyTopology(changes []TopologyChange) error {
+	logger.LogHighlight("Applying %v topology changes to service bus %v", log.Info, fmt.Sprint(len(changes)), s.Broker.Name())
+	for _, change := range changes {
+		var err error
+		switch change.Action {
+		case TopologyCreate:
+			switch change.Kind {
+			case "topic":
+				topic := NewTopic(change.Name)
+				if change.Topic != nil {
+					topic = *change.Topic
+				}
+				err = s.CreateTopic(topic)
+			case "queue":
+				err = s.CreateQueue(*change.Queue)
+			case "subscription":
+				err = s.CreateSubscription(*change.Subscription)
+			}
+		case TopologyUpdate:
+			switch change.Kind {
+			case "queue":
+				err = s.UpdateQueue(*change.Queue)
+			case "subscription":
+				if !onlyRuleChanges(change.Changes) {
+					err = s.UpdateSubscription(*change.Subscription)
+				}
+				if err == nil && change.RulesChanged {
+					err = s.SetSubscriptionRules(*change.Subscription)
+				}
+			}
+		case TopologyDelete:
+			switch change.Kind {
+			case "topic":
+				err = s.DeleteTopic(change.Name)
+			case "queue":
+				err = s.DeleteQueue(change.Name)
+			case "subscription":
+				err = s.DeleteSubscription(change.TopicName, change.Name)
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.LogHighlight("Topology was applied successfully to service bus %v", log.Info, s.Broker.Name())
+	return nil
+}
+
+// ReadTopology Reads the topics, subscriptions with their rules and queues of the namespace as a topology,
+// the forward targets are prefixed with their entity type when they exist
+func (s *ServiceBusCli) ReadTopology() (*TopologyEntity, error) {
+	logger.LogHighlight("Reading the topology of service bus %v", log.Info, s.Broker.Name())
+	topics, err := s.ListTopics()
+	if err != nil {
+		return nil, err
+	}
+	queues, err := s.ListQueues()
+	if err != nil {
+		return nil, err
+	}
+
+	return s.readTopology(topics, queues)
+}
+
+// readTopology reads the subscriptions and rules of the listed topics and converts them with the listed
+// queues into a topology
+func (s *ServiceBusCli) readTopology(topics []*servicebus.TopicEntity, queues []*servicebus.QueueEntity) (*TopologyEntity, error) {
+	kinds := make(map[string]string)
+	for _, topic := range topics {
+		kinds[strings.ToLower(topic.Name)] = "topic"
+	}
+	for _, queue := range queues {
+		kinds[strings.ToLower(queue.Name)] = "queue"
+	}
+	forwardTarget := func(value *string) string {
+		name := forwardTargetName(value)
+		if kind, ok := kinds[strings.ToLower(name)]; ok {
+			return kind + ":" + name
+		}
+		return name
+	}
+
+	result := TopologyEntity{
+		Topics: make([]TopologyTopicEntity, 0, len(topics)),
+		Queues: make([]TopologyQueueEntity, 0, len(queues)),
+		live:   true,
+	}
+	for _, topic := range topics {
+		topologyTopic := TopologyTopicEntity{
+			Name:          topic.Name,
+			Subscriptions: make([]TopologySubscriptionEntity, 0),
+		}
+
+		subscriptions, err := s.ListSubscriptions(topic.Name)
+		if err != nil {
+			return nil, err
+		}
+		for _, subscription := range subscriptions {
+			topologySubscription := TopologySubscriptionEntity{
+				Name: subscription.Name,
+			}
+			if subscription.SubscriptionDescription != nil {
+				topologySubscription.LockDuration = topologyDuration(subscription.LockDuration)
+				topologySubscription.DefaultMessageTimeToLive = topologyDuration(subscription.DefaultMessageTimeToLive)
+				topologySubscription.AutoDeleteOnIdle = topologyDuration(subscription.AutoDeleteOnIdle)
+				topologySubscription.MaxDeliveryCount = int32Value(subscription.MaxDeliveryCount)
+				topologySubscription.ForwardTo = forwardTarget(subscription.ForwardTo)
+				topologySubscription.ForwardDeadLetterTo = forwardTarget(subscription.ForwardDeadLetteredMessagesTo)
+				topologySubscription.RequiresSession = subscription.RequiresSession != nil && *subscription.RequiresSession
+			}
+
+			rules, err := s.ListSubscriptionRules(topic.Name, subscription.Name)
+			if err != nil {
+				return nil, err
+			}
+			for _, rule := range rules {
+				topologySubscription.Rules = append(topologySubscription.Rules, NewTopologyRule(rule))
+			}
+
+			topologyTopic.Subscriptions = append(topologyTopic.Subscriptions, topologySubscription)
+		}
+
+		result.Topics = append(result.Topics, topologyTopic)
+	}
+
+	for _, queue := range queues {
+		topologyQueue := TopologyQueueEntity{
+			Name: queue.Name,
+		}
+		if queue.QueueDescription != nil {
+			topologyQueue.LockDuration = topologyDuration(queue.LockDuration)
+			topologyQueue.DefaultMessageTimeToLive = topologyDuration(queue.DefaultMessageTimeToLive)
+			topologyQueue.AutoDeleteOnIdle = topologyDuration(queue.AutoDeleteOnIdle)
+			topologyQueue.MaxDeliveryCount = int32Value(queue.MaxDeliveryCount)
+			topologyQueue.ForwardTo = forwardTarget(queue.ForwardTo)
+			topologyQueue.ForwardDeadLetterTo = forwardTarget(queue.ForwardDeadLetteredMessagesTo)
+			topologyQueue.RequiresSession = queue.RequiresSession != nil && *queue.RequiresSession
+		}
+
+		result.Queues = append(result.Queues, topologyQueue)
+	}
+
+	return &result, nil
+}
+
+// NewTopologyRule Converts a rule entity into a topology rule
+func NewTopologyRule(rule RuleEntity) TopologyRuleEntity {
+	result := TopologyRuleEntity{
+		Name:      rule.Name,
+		SQLFilter: rule.SQLFilter,
+		SQLAction: rule.SQLAction,
+	}
+
+	if rule.CorrelationFilter != nil {
+		result.CorrelationFilter = &TopologyCorrelationFilterEntity{
+			CorrelationID:    rule.CorrelationFilter.CorrelationID,
+			MessageID:        rule.CorrelationFilter.MessageID,
+			To:               rule.CorrelationFilter.To,
+			ReplyTo:          rule.CorrelationFilter.ReplyTo,
+			Label:            rule.CorrelationFilter.Label,
+			SessionID:        rule.CorrelationFilter.SessionID,
+			ReplyToSessionID: rule.CorrelationFilter.ReplyToSessionID,
+			ContentType:      rule.CorrelationFilter.ContentType,
+			Properties:       rule.CorrelationFilter.Properties,
+		}
+	}
+
+	return result
+}
+
+// PrintTopologyPlan Prints the planned topology changes
+func PrintTopologyPlan(changes []TopologyChange) {
+	if len(changes) == 0 {
+		logger.Info("No changes, the service bus matches the topology")
+		return
+	}
+
+	created, updated, deleted := 0, 0, 0
+	for _, change := range changes {
+		name := change.Name
+		if change.TopicName != "" {
+			name = change.TopicName + "/" + change.Name
+		}
+
+		switch change.Action {
+		case TopologyCreate:
+			created++
+			logger.Info("  + create %v %v", change.Kind, name)
+		case TopologyUpdate:
+			updated++
+			logger.Info("  ~ update %v %v", change.Kind, name)
+			for _, propertyChange := range change.Changes {
+				logger.Info("      %v: %v -> %v", propertyChange.Name, propertyChange.From, propertyChange.To)
+			}
+		case TopologyDelete:
+			deleted++
+			logger.Warn("  - delete %v %v", change.Kind, name)
+		}
+	}
+
+	logger.Info("Plan: %v to create, %v to update, %v to delete", fmt.Sprint(created), fmt.Sprint(updated), fmt.Sprint(deleted))
+}
+
+// sortTopologyChanges orders the changes so that creations come first with topics before queues and
+// queues before subscriptions, forward targets are created before the entities forwarding to them
+func sortTopologyChanges(changes []TopologyChange) []TopologyChange {
+	kindOrder := map[string]int{"topic": 0, "queue": 1, "subscription": 2}
+	createdQueues := make(map[string]*QueueEntity)
+	for _, change := range changes {
+		if change.Action == TopologyCreate && change.Kind == "queue" {
+			createdQueues[strings.ToLower(change.Name)] = change.Queue
+		}
+	}
+
+	// depth is the longest chain of created queues reached through the message and dead letter forwards
+	var queueDepth func(queue *QueueEntity, visited map[string]bool) int
+	queueDepth = func(queue *QueueEntity, visited map[string]bool) int {
+		result := 0
+		for _, forward := range []ForwardEntity{queue.Forward, queue.ForwardDeadLetter} {
+			if forward.To == "" || forward.In != ForwardToQueue {
+				continue
+			}
+			target := strings.ToLower(forward.To)
+			next, ok := createdQueues[target]
+			if !ok || visited[target] {
+				continue
+			}
+			visited[target] = true
+			if targetDepth := queueDepth(next, visited) + 1; targetDepth > result {
+				result = targetDepth
+			}
+			delete(visited, target)
+		}
+		return result
+	}
+	depth := func(change TopologyChange) int {
+		if change.Queue == nil {
+			return 0
+		}
+		return queueDepth(change.Queue, map[string]bool{strings.ToLower(change.Name): true})
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		if changes[i].Action != changes[j].Action {
+			return changes[i].Action < changes[j].Action
+		}
+		if changes[i].Action == TopologyDelete {
+			return kindOrder[changes[i].Kind] > kindOrder[changes[j].Kind]
+		}
+		if kindOrder[changes[i].Kind] != kindOrder[changes[j].Kind] {
+			return kindOrder[changes[i].Kind] < kindOrder[changes[j].Kind]
+		}
+		return depth(changes[i]) < depth(changes[j])
+	})
+
+	return changes
+}
+
+func onlyRuleChanges(changes []PropertyChange) bool {
+	for _, change := range changes {
+		if !strings.HasPrefix(change.Name, "rule ") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// topologyDuration formats a service bus duration for a topology, infinite durations are not set
+func topologyDuration(value *string) string {
+	duration := durationFrom8601(value)
+	if duration <= 0 || duration == time.Duration(1<<63-1) {
+		return ""
+	}
+
+	return duration.String()
+}
+
+func parseTopologyDuration(name string, value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("Invalid duration " + value + " for " + name)
+	}
+
+	return duration, nil
+}